@@ -1 +1,96 @@
-package main
\ No newline at end of file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+
+	"hillside/internal/client"
+	"hillside/internal/models"
+)
+
+func parseConfig() client.Options {
+	var opts client.Options
+	flag.IntVar(&opts.LogPort, "logport", 4567, "Port for remote logger")
+	flag.BoolVar(&opts.RelayService, "relay", false, "Relay connections for room members behind NAT")
+	flag.StringVar(&opts.Relays, "relays", "", "Comma separated multiaddrs of extra relays to use besides the hubs")
+	flag.BoolVar(&opts.LAN, "lan", false, "LAN-only mode: find hubs and peers over mDNS and never join the public DHT")
+	flag.StringVar(&opts.SwarmKey, "swarmkey", "", "Path to a swarm.key file shared by every peer of a private network")
+	flag.StringVar(&opts.Listen, "listen", "", "Comma separated multiaddrs to listen on (default TCP, QUIC and WebSocket on random ports)")
+	flag.BoolVar(&opts.SealedSender, "sealed", false, "Hide the sender of chat messages, edits, reactions and receipts from everyone outside the room (members on older versions can't read them)")
+	flag.StringVar(&opts.Notify, "notify", "", "Command run with a title and the message when you are mentioned in another room or screen, e.g. notify-send (default: terminal bell)")
+	flag.BoolVar(&opts.NoReceipts, "noreceipts", false, "Don't send delivery and read receipts to the rooms you are in")
+	flag.Parse()
+	return opts
+}
+
+// export writes the history of a room stored for a profile, without going
+// online. The password is read from HILLSIDE_PASSWORD, or asked for.
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	user := fs.String("user", "", "username of the profile whose history to export")
+	room := fs.String("room", "", "ID of the room to export")
+	format := fs.String("format", "json", "json (with signatures), md or txt")
+	sender := fs.String("sender", "", "only export the messages of this username")
+	since := fs.String("since", "", "only export messages from this day on, YYYY-MM-DD")
+	until := fs.String("until", "", "only export messages up to this day included, YYYY-MM-DD")
+	out := fs.String("out", "-", "file to write the archive to, - for stdout")
+	fs.Parse(args)
+
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		os.Exit(1)
+	}
+	if *user == "" {
+		fail(fmt.Errorf("-user is required"))
+	}
+	req := models.ExportRequest{RoomID: *room, Format: models.ExportFormat(*format), Sender: *sender}
+	var err error
+	if *since != "" {
+		if req.Since, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+			fail(fmt.Errorf("-since: dates are YYYY-MM-DD"))
+		}
+	}
+	if *until != "" {
+		if req.Until, err = time.ParseInLocation("2006-01-02", *until, time.Local); err != nil {
+			fail(fmt.Errorf("-until: dates are YYYY-MM-DD"))
+		}
+		req.Until = req.Until.AddDate(0, 0, 1) // the whole day
+	}
+	if err := req.Validate(); err != nil {
+		fail(err)
+	}
+
+	password, ok := os.LookupEnv("HILLSIDE_PASSWORD")
+	if !ok {
+		fmt.Fprint(os.Stderr, "Password: ")
+		pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fail(err)
+		}
+		password = string(pass)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			fail(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := client.Export(*user, password, req, w)
+	if err != nil {
+		if *out != "-" {
+			os.Remove(*out)
+		}
+		fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d messages\n", n)
+}
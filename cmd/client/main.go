@@ -1,7 +1,6 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -11,6 +10,11 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		export(os.Args[2:])
+		return
+	}
+
 	logFile, err := os.OpenFile("panic.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		panic(err)
@@ -30,8 +34,5 @@ func run() {
 		}
 	}()
 
-	var logPort int
-	flag.IntVar(&logPort, "logport", 4567, "Port for remote logger")
-	flag.Parse()
-	client.StartClientApp(logPort)
+	client.StartClientApp(parseConfig())
 }
@@ -1 +1,35 @@
-package main
\ No newline at end of file
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hillside/internal/p2p"
+	"os"
+)
+
+// keygen implements `hub keygen [-out swarm.key]`, writing a new pre-shared key
+// for a private network. Hand the file to every hub and client of the deployment.
+func keygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "swarm.key", "file to write the key to, - for stdout")
+	fs.Parse(args)
+
+	if *out == "-" {
+		if err := p2p.WriteSwarmKey(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := p2p.WriteSwarmKey(f); err != nil {
+		fmt.Fprintf(os.Stderr, "keygen: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Swarm key written to %s\n", *out)
+}
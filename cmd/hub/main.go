@@ -2,15 +2,31 @@ package main
 
 import (
 	"context"
+	"flag"
 	"hillside/internal/hub"
+	"hillside/internal/p2p"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	"unicode"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		keygen(os.Args[2:])
+		return
+	}
+
+	listen := flag.String("listen", "/ip4/0.0.0.0/tcp/4001,/ip4/0.0.0.0/udp/4001/quic-v1,/ip4/0.0.0.0/tcp/4002/ws",
+		"comma separated multiaddrs to listen on")
+	peers := flag.String("peers", "", "comma separated multiaddrs of hubs to federate with")
+	lan := flag.Bool("lan", false, "LAN-only mode: announce over mDNS and never join the public DHT")
+	swarmKey := flag.String("swarmkey", "", "path to a swarm.key file, only peers holding it can connect")
+	flag.Parse()
+
 	// Configure logging
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 	log.SetPrefix("[HUB-MAIN] ")
@@ -19,10 +35,32 @@ func main() {
 	log.Printf("Timestamp: %s", time.Now().Format(time.RFC3339))
 
 	ctx := context.Background()
-	h, err := hub.NewHubServer(ctx, "/ip4/0.0.0.0/tcp/4001")
+	listenAddrs := strings.FieldsFunc(*listen, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(listenAddrs) == 0 {
+		log.Fatalf("No address to listen on")
+	}
+	opts := []hub.Option{hub.WithListenAddrs(listenAddrs[1:]...)}
+	if *lan {
+		opts = append(opts, hub.WithLAN())
+	}
+	if *swarmKey != "" {
+		psk, err := p2p.LoadSwarmKey(*swarmKey)
+		if err != nil {
+			log.Fatalf("Failed to load swarm key: %v", err)
+		}
+		opts = append(opts, hub.WithSwarmKey(psk))
+	}
+	h, err := hub.NewHubServer(ctx, listenAddrs[0], opts...)
 	if err != nil {
 		log.Fatalf("Failed to create hub server: %v", err)
 	}
+	if *peers != "" {
+		federated, err := p2p.ParseHubAddrs(*peers)
+		if err != nil {
+			log.Fatalf("Invalid -peers: %v", err)
+		}
+		h.EnableFederation(federated)
+	}
 
 	log.Printf("Hub server created successfully")
 	h.ListenAddrs()
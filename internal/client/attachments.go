@@ -0,0 +1,180 @@
+package client
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/utils"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AttachHandler encrypts the file at path into the blob cache and sends it to
+// the current room. Members fetch the blob from us, or from whoever already
+// did, when they open it.
+func (cli *Client) AttachHandler(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.IsDir() || st.Size() >= models.MaxAttachmentSize {
+		return utils.ValidationError(fmt.Sprintf("Attachments must be files under %s", humanSize(models.MaxAttachmentSize)))
+	}
+	mimeType, err := detectMIME(f)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.NewBlobKey()
+	if err != nil {
+		return err
+	}
+	size, hash, err := cli.Session.SessionDB.Blobs.Encrypt(f, key)
+	if err != nil {
+		return err
+	}
+	a := &models.Attachment{Name: filepath.Base(path), MIME: mimeType, Size: size, Hash: hash, Key: key}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	return cli.sendChat(&models.MessageBody{Attachment: a})
+}
+
+// detectMIME guesses the type of f from its extension, else from its first
+// bytes, and rewinds it.
+func detectMIME(f *os.File) (string, error) {
+	if t := mime.TypeByExtension(filepath.Ext(f.Name())); t != "" {
+		return t, nil
+	}
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	if _, err := f.Seek(0, 0); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// DownloadAttachmentHandler fetches the attachment of the message at index in
+// the current room in the background, and saves it decrypted under
+// ~/.hillside/downloads.
+func (cli *Client) DownloadAttachmentHandler(index int) error {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return ErrNotInitialized.WithDetails("no message selected")
+	}
+	m := room.Messages[index]
+	if m.Attachment == nil || m.Deleted {
+		return fmt.Errorf("this message has no attachment")
+	}
+	if _, busy := cli.downloads.LoadOrStore(m.Attachment.Hash, true); busy {
+		return fmt.Errorf("this attachment is already downloading")
+	}
+	go func() {
+		defer cli.downloads.Delete(m.Attachment.Hash)
+		path, err := cli.downloadAttachment(room, m)
+		cli.UI.App.QueueUpdateDraw(func() {
+			if err != nil {
+				cli.UI.ShowError("Download failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			cli.UI.ShowToast("Saved to "+path, 3*time.Second, nil)
+		})
+	}()
+	return nil
+}
+
+// downloadAttachment fetches the blob of m's attachment unless it is cached,
+// trying its sender first and then the other members of room, and decrypts
+// it into a new file.
+func (cli *Client) downloadAttachment(room *RoomSession, m models.DecrypetMessage) (string, error) {
+	a := m.Attachment
+	blobs := cli.Session.SessionDB.Blobs
+	if !blobs.Has(a.Hash) {
+		var err error = ErrNotInitialized.WithDetails("no member to fetch the attachment from")
+		for _, p := range cli.blobProviders(room, m.Sender.PeerID) {
+			if err = cli.Node.FetchBlob(cli.Node.Ctx, p, blobs, a.Hash, a.Size); err == nil {
+				break
+			}
+			cli.Session.Log.Logf("Failed to fetch attachment %s from %s: %v", a.Hash, p, err)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(homeDir, ".hillside", "downloads")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, a.Name)
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if os.IsExist(err) {
+		path = filepath.Join(dir, a.Hash[:8]+"-"+a.Name)
+		out, err = os.Create(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	err = blobs.Decrypt(a.Hash, a.Key, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// blobProviders lists who may have a blob sent by sender in room: the sender
+// first, then the peers we share its chat topic with.
+func (cli *Client) blobProviders(room *RoomSession, sender string) []peer.ID {
+	var out []peer.ID
+	if id, err := peer.Decode(sender); err == nil && sender != cli.User.PeerID {
+		out = append(out, id)
+	}
+	if room.Topics.HasTopic(models.TopicChat) {
+		for _, p := range room.Topics.GetTopic(models.TopicChat).ListPeers() {
+			if p.String() != sender && !cli.Node.IsHub(p) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// attachmentLabel renders the attachment of m, or nothing.
+func attachmentLabel(m models.DecrypetMessage) string {
+	if m.Attachment == nil {
+		return ""
+	}
+	a := m.Attachment
+	return fmt.Sprintf(" [gray]📎 %s (%s, %s, o to download)[white]", a.Name, a.MIME, humanSize(a.Size))
+}
+
+// humanSize renders a size in bytes with a binary unit.
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
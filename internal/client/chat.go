@@ -1,12 +1,15 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"hillside/internal/crypto"
 	"hillside/internal/models"
 	"hillside/internal/p2p"
 	"hillside/internal/utils"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 )
 
 func (cli *Client) chatHandler() error {
@@ -19,24 +22,32 @@ func (cli *Client) chatHandler() error {
 				return err
 			}
 	*/
-	if !cli.Session.Current.Room.Topics.HasTopic(models.TopicChat) {
-		chatTopic := p2p.ChatTopic(cli.GetServerID(), cli.GetRoomID())
+	room := cli.Session.Current.Room
+	if !room.Topics.HasTopic(models.TopicChat) {
+		chatTopic := p2p.ChatTopic(room.ServerID(), room.RoomMeta.ID)
+		if err := cli.Node.PS.RegisterTopicValidator(chatTopic, cli.chatValidator(room)); err != nil {
+			return err
+		}
 		topic, err := cli.Node.PS.Join(chatTopic)
 		if err != nil {
 			return err
 		}
-		cli.Session.Current.Room.Topics.SetTopic(models.TopicChat, topic)
+		if err := topic.SetScoreParams(p2p.ChatTopicScoreParams()); err != nil {
+			cli.Session.Log.Logf("Failed to set score params for %s: %v", chatTopic, err)
+		}
+		room.Topics.SetTopic(models.TopicChat, topic)
 	}
-	sub, err := cli.Session.Current.Room.Topics.GetTopic(models.TopicChat).Subscribe()
+	sub, err := room.Topics.GetTopic(models.TopicChat).Subscribe()
 	if err != nil {
 		return err
 	}
-	err = cli.parseAndDisplayDBMessages(cli.GetRoomID())
+	err = cli.parseAndDisplayDBMessages(room.RoomMeta.ID)
 	if err != nil {
 		return err
 	}
 
-	// Recieve messages from the chat topic
+	// Recieve messages from the chat topic, in the background once we switch
+	// to another room
 	go func() error {
 		for {
 			msg, err := sub.Next(cli.Node.Ctx)
@@ -47,91 +58,192 @@ func (cli *Client) chatHandler() error {
 			if err != nil {
 				return err
 			}
-			senderID := msg.ReceivedFrom
-			err = cli.validateChatMessage(env, message.(*models.ChatMessage), senderID.String())
+			castedMsg, ok := roomCiphertext(message)
+			if !ok {
+				continue
+			}
+			if castedMsg.Sealed {
+				// the sender is only known once decrypted, see openSealedChat
+				err = cli.validateChatMessageIntegrity(env, castedMsg)
+			} else {
+				// the author, not the neighbour that relayed it to us
+				err = cli.validateChatMessage(env, castedMsg, msg.GetFrom().String())
+			}
 			if err != nil {
-
-				if utils.IsValidationError(err) {
-					cli.UI.ShowError("Validation Error", err.Error(), "OK", 0, nil)
-				}
-				if utils.IsSecurityError(err) {
-					cli.UI.ShowError("Security Error", err.Error(), "OK", 0, nil)
-					//TODO: Notify others
-				}
+				cli.showMessageError(err)
+				continue
+			}
+			if !castedMsg.Sealed && cli.Session.Muted.IsMuted(env.Sender.PeerID) {
+				continue
 			}
 
-			castedMsg, ok := message.(*models.ChatMessage)
-			if ok {
-				pt, err := cli.decryptMessage(castedMsg)
+			pt, err := cli.decryptMessage(room, castedMsg)
+			if err != nil {
+				cli.UI.ShowError("Decryption Error", "Failed to decrypt message: "+err.Error(), "OK", 0, nil)
+				continue
+			}
+			if castedMsg.Sealed {
+				inner, sc, err := cli.openSealedChat(room, env.Type, pt, castedMsg.ChainIndex)
 				if err != nil {
-					cli.UI.ShowError("Decryption Error", "Failed to decrypt message: "+err.Error(), "OK", 0, nil)
+					cli.showMessageError(err)
 					continue
 				}
-				decMsg := &models.DecrypetMessage{
-					Sender:    env.Sender,
-					Timestamp: env.Timestamp,
-					Content:   string(pt),
-					RoomID:    cli.GetRoomID(),
-					ServerID:  cli.GetServerID(),
+				if cli.Session.Muted.IsMuted(inner.Sender.PeerID) {
+					continue
 				}
-				cli.Session.Current.Room.Messages = append(cli.Session.Current.Room.Messages, *decMsg)
-				if err := cli.Session.SessionDB.History.EnqueueEnvelope(cli.Node.Ctx, env.Signature, env.Payload, env.Timestamp, env.Type, &castedMsg.ChainIndex, env.Sender.PeerID, cli.GetRoomID(), cli.GetServerID()); err != nil {
-					cli.UI.ShowError("Storage Error", "Failed to store message: "+err.Error(), "OK", 0, nil)
+				// keep the outer payload: only ciphertext is stored, as for other messages
+				inner.Type, inner.Payload = env.Type, env.Payload
+				env, pt = inner, []byte(sc.Text)
+			}
+			if env.Type != models.MsgTypeChat {
+				switch env.Type {
+				case models.MsgTypeReaction:
+					err = cli.applyReaction(room, env, castedMsg.ChainIndex, pt)
+				case models.MsgTypeReceipt:
+					err = cli.applyReceipt(room, env, castedMsg.ChainIndex, pt)
+				default:
+					err = cli.applyControl(room, env, castedMsg.ChainIndex, pt)
 				}
-				//line := fmt.Sprintf("[%d] %s: %s", env.Timestamp, env.Sender.Username, decMsg.Content)
-				formattedTime := utils.FormatPrettyTime(env.Timestamp)
-
-				prefColor := env.Sender.PreferredColor
-				if !utils.Contains(utils.BaseXtermAnsiColorNames, prefColor) {
-					prefColor = utils.GenerateRandomColor()
+				if err != nil {
+					cli.Session.Log.Logf("Dropping %s message %d: %v", env.Type, castedMsg.ChainIndex, err)
 				}
-				lineContent := fmt.Sprintf("[yellow][%s] [%s]%s:[white] %s", formattedTime, prefColor, env.Sender.Username, decMsg.Content)
-				cli.UI.App.QueueUpdateDraw(func() {
-					cli.UI.ChatScreen.ChatSection.AddItem(lineContent, "", 0, nil)
-
-				})
-
+				continue
+			}
+			body, err := messageBody(castedMsg, pt)
+			if err != nil {
+				cli.showMessageError(err)
+				continue
+			}
+			decMsg := &models.DecrypetMessage{
+				Sender:     env.Sender,
+				Timestamp:  env.Timestamp,
+				Content:    body.Text,
+				RoomID:     room.RoomMeta.ID,
+				ServerID:   room.ServerID(),
+				ChainIndex: castedMsg.ChainIndex,
+				ReplyTo:    body.ReplyTo,
+				ThreadRoot: body.ThreadRoot,
+				Attachment: body.Attachment,
 			}
+			if err := cli.Session.SessionDB.History.EnqueueMessage(cli.Node.Ctx, models.StoredMessage{
+				RoomID:     room.RoomMeta.ID,
+				ServerID:   room.ServerID(),
+				ChainIndex: &castedMsg.ChainIndex,
+				MsgType:    env.Type,
+				SenderID:   env.Sender.PeerID,
+				Timestamp:  env.Timestamp,
+				SigAlg:     env.SigAlg,
+				Signature:  env.Signature,
+				Payload:    env.Payload,
+				ReplyTo:    body.ReplyTo,
+				ThreadRoot: body.ThreadRoot,
+			}); err != nil {
+				cli.UI.ShowError("Storage Error", "Failed to store message: "+err.Error(), "OK", 0, nil)
+			}
+			cli.indexMessages(*decMsg)
+			cli.UI.App.QueueUpdateDraw(func() {
+				cli.appendLive(room, *decMsg)
+				cli.noteUnseen(room, *decMsg)
+				if decMsg.Sender.PeerID != cli.User.PeerID {
+					cli.noteReceipt(room, decMsg.ChainIndex, cli.viewing(room) && !room.Behind)
+				}
+			})
 
 		}
 	}()
 	return nil
 }
 
-func (cli *Client) DisplayMessage(timestamp int64, sender models.User, decMsg *models.DecrypetMessage) {
+// showMessageError reports a message rejected by validation.
+func (cli *Client) showMessageError(err error) {
+	if utils.IsValidationError(err) {
+		cli.UI.ShowError("Validation Error", err.Error(), "OK", 0, nil)
+	}
+	if utils.IsSecurityError(err) {
+		cli.UI.ShowError("Security Error", err.Error(), "OK", 0, nil)
+		//TODO: Notify others
+	}
+}
+
+func formatMessageLine(timestamp int64, sender models.User, content string) string {
 	formattedTime := utils.FormatPrettyTime(timestamp)
 
 	prefColor := sender.PreferredColor
 	if !utils.Contains(utils.BaseXtermAnsiColorNames, prefColor) {
 		prefColor = utils.GenerateRandomColor()
 	}
-	lineContent := fmt.Sprintf("[yellow][%s] [%s]%s:[white] %s", formattedTime, prefColor, sender.Username, decMsg.Content)
+	return fmt.Sprintf("[yellow][%s] [%s]%s:[white] %s", formattedTime, prefColor, sender.Username, content)
+}
+
+func (cli *Client) DisplayMessage(timestamp int64, sender models.User, decMsg *models.DecrypetMessage) {
+	cli.displayLines(formatMessageLine(timestamp, sender, decMsg.Content))
+}
 
+// displayLines appends lines to the chat section in order, from any goroutine.
+func (cli *Client) displayLines(lines ...string) {
 	go func() {
 		cli.UI.App.QueueUpdateDraw(func() {
-			cli.UI.ChatScreen.ChatSection.AddItem(lineContent, "", 0, nil)
+			for _, line := range lines {
+				cli.UI.ChatScreen.ChatSection.AddItem(line, "", 0, nil)
+			}
 		})
 
 	}()
 }
 
 func (cli *Client) SendMessageHandler(text string) error {
+	return cli.sendChat(&models.MessageBody{Text: text})
+}
+
+// sendChat encrypts body through the room ratchet and publishes it on the
+// current room's chat topic.
+func (cli *Client) sendChat(body *models.MessageBody) error {
 	if cli.Session.Current.Room.RoomRatchet == nil {
 		cli.UI.ShowError("Error", "You must join a room before sending messages", "OK", 0, nil)
 		return utils.SendMessageError("Room ratchet is not initialized. Join a room first.")
 	}
 
-	ct, _, err := crypto.EncryptMessage(cli.Session.Current.Room.RoomRatchet, []byte(text))
+	ratchet := cli.Session.Current.Room.RoomRatchet
+	chainIndex := ratchet.Index
+	plaintext, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	var inner *models.Envelope
+	if cli.SealedSender {
+		if plaintext, inner, err = cli.sealChat(cli.Session.Current.Room, models.MsgTypeChat, string(plaintext), chainIndex); err != nil {
+			return err
+		}
+	}
+	ct, _, err := crypto.EncryptMessage(ratchet, plaintext)
 	if err != nil {
 		return err
 	}
 
 	msg := &models.ChatMessage{
-		ChainIndex: cli.Session.Current.Room.RoomRatchet.Index - 1,
+		ChainIndex: chainIndex,
 		Ciphertext: ct,
+		Padded:     true,
+		Sealed:     cli.SealedSender,
+		Structured: true,
 	}
 
-	data, env, err := MarshalEnvelope(msg, *cli.User, cli.Keybag.DilithiumPriv)
+	var data []byte
+	var env *models.Envelope
+	var opts []pubsub.PubOpt
+	if cli.SealedSender {
+		data, env, err = MarshalSealedEnvelope(msg)
+		if err == nil {
+			// stored with the inner signature, like received sealed messages
+			inner.Type, inner.Payload = env.Type, env.Payload
+			env = inner
+			var anon pubsub.PubOpt
+			anon, err = p2p.AnonymousPublish()
+			opts = append(opts, anon)
+		}
+	} else {
+		data, env, err = MarshalEnvelope(msg, *cli.User, cli.Keybag, cli.sigAlg())
+	}
 	if err != nil {
 		return err
 	}
@@ -139,11 +251,23 @@ func (cli *Client) SendMessageHandler(text string) error {
 		return ErrNotInitialized.WithDetails("chat topic is not initialized")
 	}
 
-	err = cli.Session.Current.Room.Topics.GetTopic(models.TopicChat).Publish(cli.Node.Ctx, data)
+	err = cli.Session.Current.Room.Topics.GetTopic(models.TopicChat).Publish(cli.Node.Ctx, data, opts...)
 	if err != nil {
 		return err
 	}
-	err = cli.Session.SessionDB.History.EnqueueEnvelope(cli.Node.Ctx, env.Signature, env.Payload, env.Timestamp, env.Type, &msg.ChainIndex, env.Sender.PeerID, cli.GetRoomID(), cli.GetServerID())
+	err = cli.Session.SessionDB.History.EnqueueMessage(cli.Node.Ctx, models.StoredMessage{
+		RoomID:     cli.GetRoomID(),
+		ServerID:   cli.GetServerID(),
+		ChainIndex: &msg.ChainIndex,
+		MsgType:    env.Type,
+		SenderID:   cli.User.PeerID,
+		Timestamp:  env.Timestamp,
+		SigAlg:     env.SigAlg,
+		Signature:  env.Signature,
+		Payload:    env.Payload,
+		ReplyTo:    body.ReplyTo,
+		ThreadRoot: body.ThreadRoot,
+	})
 	return err
 
 }
@@ -6,24 +6,49 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"unicode"
 
 	"hillside/internal/models"
 	"hillside/internal/p2p"
 	"hillside/internal/ui"
 	"hillside/internal/utils"
+
+	"github.com/libp2p/go-libp2p/core/pnet"
 )
 
 type Client struct {
-	User    *models.User
-	Keybag  *models.Keybag
-	Node    *p2p.Node
-	UI      *ui.UI
-	Session *Session
+	User         *models.User
+	Keybag       *models.Keybag
+	Node         *p2p.Node
+	UI           *ui.UI
+	Session      *Session
+	SealedSender bool   // sign chat and control messages inside the ciphertext and publish them under a throwaway peer ID
+	Notify       string // command run when we are mentioned out of sight, the terminal bell rings if empty
+	NoReceipts   bool   // don't tell rooms what we received and read, theirs are still shown
+
+	downloads sync.Map // hashes of the attachment blobs being fetched
+	fetches   sync.Map // IDs of the rooms whose older history is asked for
 }
 
-func StartClientApp(logPort int) {
+// Options are the command line settings of the client.
+type Options struct {
+	LogPort      int
+	RelayService bool   // relay traffic for members behind NAT
+	Relays       string // comma separated relay multiaddrs, in addition to the hubs
+	LAN          bool   // isolated network mode, see p2p.Node.LAN
+	SwarmKey     string // path to a swarm.key file, joins the private network it defines
+	Listen       string // comma separated listen multiaddrs, empty for p2p.DefaultListenAddrs
+	SealedSender bool   // see Client.SealedSender
+	Notify       string // see Client.Notify
+	NoReceipts   bool   // see Client.NoReceipts
+}
 
-	client := &Client{}
+func StartClientApp(opts Options) {
+	logPort := opts.LogPort
+
+	client := &Client{SealedSender: opts.SealedSender, Notify: opts.Notify, NoReceipts: opts.NoReceipts}
 	ctx := context.Background()
 
 	homeDir, err := os.UserHomeDir()
@@ -36,25 +61,62 @@ func StartClientApp(logPort int) {
 		panic("Failed to load default theme: " + err.Error())
 	}
 	client.UI = ui.NewUI(&ui.UIConfig{
-		Theme:               theme,
-		LoginHandler:        client.LoginHandler,
-		CreateUserHandler:   client.CreateUserHandler,
-		CreateServerHandler: client.CreateServerHandler,
-		JoinServerHandler:   client.JoinServerHandler,
-		GetServerName:       client.GetServerName,
-		GetRoomName:         client.GetRoomName,
-		GetServerID:         client.GetServerID,
-		CreateRoomHandler:   client.CreateRoomHandler,
-		JoinRoomHandler:     client.JoinRoomHandler,
-		SendMessageHandler:  client.SendMessageHandler,
-		ChatInputHandler:    client.ChatInputHandler,
+		Theme:                theme,
+		LoginHandler:         client.LoginHandler,
+		CreateUserHandler:    client.CreateUserHandler,
+		FindLANHubHandler:    client.FindLANHubHandler,
+		CreateServerHandler:  client.CreateServerHandler,
+		JoinServerHandler:    client.JoinServerHandler,
+		GetServerName:        client.GetServerName,
+		GetRoomName:          client.GetRoomName,
+		GetServerID:          client.GetServerID,
+		CreateRoomHandler:    client.CreateRoomHandler,
+		JoinRoomHandler:      client.JoinRoomHandler,
+		SendMessageHandler:   client.SendMessageHandler,
+		ChatInputHandler:     client.ChatInputHandler,
+		MuteSenderHandler:    client.MuteSenderHandler,
+		EditMessageHandler:   client.EditMessageHandler,
+		DeleteMessageHandler: client.DeleteMessageHandler,
+		ReplyHandler:         client.ReplyHandler,
+		ThreadHandler:        client.ThreadHandler,
+		ReactHandler:         client.ReactHandler,
+		MemberNamesHandler:   client.MemberNamesHandler,
+		SeenByHandler:        client.SeenByHandler,
+		AttachHandler:        client.AttachHandler,
+		DownloadHandler:      client.DownloadAttachmentHandler,
+		SearchHandler:        client.SearchHandler,
+		JumpToMessageHandler: client.JumpToMessageHandler,
+		ExportHandler:        client.ExportHandler,
+		LoadOlderHandler:     client.LoadOlderHandler,
+		LoadNewerHandler:     client.LoadNewerHandler,
+		GetRoomID:            client.GetRoomID,
+		CreateInviteHandler:  client.CreateInviteHandler,
+		RedeemInviteHandler:  client.RedeemInviteHandler,
+		RevokeInviteHandler:  client.RevokeInviteHandler,
 	})
 
 	fmt.Println("Starting Hillside Client...")
 	client.UI.ChatScreen.InputHandler = client.ChatInputHandler
 	client.UI.ChatScreen.HookupInputHandler()
+	relays, err := p2p.ParseHubAddrs(opts.Relays)
+	if err != nil {
+		panic("Invalid relay address: " + err.Error())
+	}
+	var psk pnet.PSK
+	if opts.SwarmKey != "" {
+		if psk, err = p2p.LoadSwarmKey(opts.SwarmKey); err != nil {
+			panic("Failed to load swarm key: " + err.Error())
+		}
+	}
 	node := &p2p.Node{
-		Ctx: ctx,
+		Ctx:          ctx,
+		StaticRelays: relays,
+		RelayService: opts.RelayService,
+		LAN:          opts.LAN,
+		PSK:          psk,
+	}
+	if opts.Listen != "" {
+		node.ListenAddrs = strings.FieldsFunc(opts.Listen, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
 	}
 	client.Node = node
 
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+)
+
+// owners re-publish their records so peers joining the directory topic later still learn about them
+const directoryRepublishInterval = 2 * time.Minute
+
+// startDirectory joins the directory topic, caches every valid record it receives
+// and keeps re-publishing the servers owned by this user.
+func (cli *Client) startDirectory() error {
+	top, err := cli.Node.JoinDirectory()
+	if err != nil {
+		return err
+	}
+	cli.Session.Topics.SetTopic(models.TopicDirectory, top)
+	sub, err := top.Subscribe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			msg, err := sub.Next(cli.Node.Ctx)
+			if err != nil {
+				return
+			}
+			var rec models.DirectoryRecord
+			if err := json.Unmarshal(msg.Data, &rec); err != nil {
+				continue
+			}
+			entry, err := p2p.OpenDirectoryRecord(&rec)
+			if err != nil {
+				continue
+			}
+			if _, err := cli.Session.SessionDB.Store.SaveDirectoryRecord(cli.Node.Ctx, &rec, entry); err != nil {
+				cli.Session.Log.Logf("Failed to cache directory record for %s: %v", entry.Server.ID, err)
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(directoryRepublishInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cli.republishOwnedServers()
+			case <-cli.Node.Ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// directoryMeta returns a copy of meta that is safe to publish:
+// no password material, no member lists and only public rooms.
+func directoryMeta(meta *models.ServerMeta) models.ServerMeta {
+	out := models.ServerMeta{
+		ID:          meta.ID,
+		Name:        meta.Name,
+		Description: meta.Description,
+		Visibility:  meta.Visibility,
+		OwnerPeerID: meta.OwnerPeerID,
+		CreatedAt:   meta.CreatedAt,
+		Rooms:       make(map[string]*models.RoomMeta),
+	}
+	for id, r := range meta.Rooms {
+		if r == nil || r.Visibility != models.Public {
+			continue
+		}
+		out.Rooms[id] = &models.RoomMeta{ID: r.ID, Name: r.Name, Visibility: r.Visibility}
+	}
+	return out
+}
+
+// announceServer signs a fresh record for a server owned by this user,
+// caches it and publishes it on the directory topic. Private servers are never announced.
+func (cli *Client) announceServer(meta *models.ServerMeta) error {
+	if meta.Visibility == models.Private {
+		return nil
+	}
+	if meta.OwnerPeerID != cli.User.PeerID {
+		return fmt.Errorf("only the owner can announce server %s", meta.ID)
+	}
+	entry := &models.DirectoryEntry{
+		Server:  directoryMeta(meta),
+		Version: time.Now().UnixMicro(),
+	}
+	rec, err := p2p.SignDirectoryEntry(entry, cli.Keybag.Libp2pPriv)
+	if err != nil {
+		return err
+	}
+	if _, err := cli.Session.SessionDB.Store.SaveDirectoryRecord(cli.Node.Ctx, rec, entry); err != nil {
+		return err
+	}
+	return cli.publishDirectoryRecord(rec)
+}
+
+func (cli *Client) publishDirectoryRecord(rec *models.DirectoryRecord) error {
+	if !cli.Session.Topics.HasTopic(models.TopicDirectory) {
+		return ErrNotInitialized.WithDetails("directory topic")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return cli.Session.Topics.GetTopic(models.TopicDirectory).Publish(cli.Node.Ctx, data)
+}
+
+// announceRoom adds a room to the record of a server owned by this user.
+func (cli *Client) announceRoom(serverID string, room *models.RoomMeta) error {
+	meta, err := cli.cachedServer(serverID)
+	if err != nil {
+		return err
+	}
+	if meta.OwnerPeerID != cli.User.PeerID {
+		// the owner picks it up from the hub on its next republish
+		return nil
+	}
+	meta.Rooms[room.ID] = room
+	return cli.announceServer(meta)
+}
+
+// republishOwnedServers re-sends the records of servers owned by this user.
+// While the hub is reachable the room list is refreshed from it first.
+func (cli *Client) republishOwnedServers() {
+	recs, err := cli.Session.SessionDB.Store.ListDirectoryRecords(cli.Node.Ctx)
+	if err != nil {
+		cli.Session.Log.Logf("Failed to list directory records: %v", err)
+		return
+	}
+	for _, rec := range recs {
+		if rec.OwnerPeerID != cli.User.PeerID {
+			continue
+		}
+		entry, err := p2p.OpenDirectoryRecord(&rec)
+		if err != nil {
+			continue
+		}
+		if cli.Node.HubReachable() {
+			if resp, err := cli.requestRooms(entry.Server.ID); err == nil && roomsChanged(entry.Server.Rooms, resp.Rooms) {
+				meta := entry.Server
+				meta.Rooms = make(map[string]*models.RoomMeta, len(resp.Rooms))
+				for i := range resp.Rooms {
+					meta.Rooms[resp.Rooms[i].ID] = &resp.Rooms[i]
+				}
+				if err := cli.announceServer(&meta); err != nil {
+					cli.Session.Log.Logf("Failed to announce server %s: %v", meta.ID, err)
+				}
+				continue
+			}
+		}
+		if err := cli.publishDirectoryRecord(&rec); err != nil {
+			cli.Session.Log.Logf("Failed to republish server %s: %v", entry.Server.ID, err)
+		}
+	}
+}
+
+func roomsChanged(known map[string]*models.RoomMeta, rooms []models.RoomMeta) bool {
+	public := 0
+	for _, r := range rooms {
+		if r.Visibility != models.Public {
+			continue
+		}
+		public++
+		k, ok := known[r.ID]
+		if !ok || k == nil || k.Name != r.Name {
+			return true
+		}
+	}
+	return public != len(known)
+}
+
+// cachedServers returns every server found in the local directory cache.
+func (cli *Client) cachedServers() []models.ServerMeta {
+	recs, err := cli.Session.SessionDB.Store.ListDirectoryRecords(cli.Node.Ctx)
+	if err != nil {
+		cli.Session.Log.Logf("Failed to list directory records: %v", err)
+		return nil
+	}
+	servers := make([]models.ServerMeta, 0, len(recs))
+	for _, rec := range recs {
+		entry, err := p2p.OpenDirectoryRecord(&rec)
+		if err != nil {
+			continue
+		}
+		servers = append(servers, entry.Server)
+	}
+	return servers
+}
+
+// cachedServer returns a server from the local directory cache.
+func (cli *Client) cachedServer(serverID string) (*models.ServerMeta, error) {
+	rec, err := cli.Session.SessionDB.Store.GetDirectoryRecord(cli.Node.Ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := p2p.OpenDirectoryRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Server.Rooms == nil {
+		entry.Server.Rooms = make(map[string]*models.RoomMeta)
+	}
+	return &entry.Server, nil
+}
+
+// cachedRooms lists the rooms of a server from the local directory cache.
+func (cli *Client) cachedRooms(serverID string) ([]models.RoomMeta, error) {
+	meta, err := cli.cachedServer(serverID)
+	if err != nil {
+		return nil, err
+	}
+	rooms := make([]models.RoomMeta, 0, len(meta.Rooms))
+	for _, r := range meta.Rooms {
+		if r != nil {
+			rooms = append(rooms, *r)
+		}
+	}
+	return rooms, nil
+}
+
+// discoverRoomMembers finds and connects to members of the current room through
+// the DHT rendezvous, for when the hub can't list them.
+func (cli *Client) discoverRoomMembers(serverID, roomID string) {
+	peers, err := cli.Node.DiscoverPeers(serverID, roomID)
+	if err != nil {
+		cli.Session.Log.Logf("Failed to discover members for room %s: %v", roomID, err)
+		return
+	}
+	cli.Session.Log.Logf("Discovered %d members for room %s through the DHT", len(peers), roomID)
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/utils"
+)
+
+// EditMessageHandler replaces the text of our message at index in the current room.
+func (cli *Client) EditMessageHandler(index int, text string) error {
+	target, err := cli.controlTarget(index)
+	if err != nil {
+		return err
+	}
+	if target.Sender.PeerID != cli.User.PeerID {
+		return fmt.Errorf("you can only edit your own messages")
+	}
+	if text == "" {
+		return utils.ValidationError("Message text cannot be empty")
+	}
+	return cli.publishControl(cli.Session.Current.Room, models.MsgTypeEdit, &models.MessageControl{
+		Target: cli.messageRef(target),
+		Text:   text,
+	})
+}
+
+// DeleteMessageHandler deletes the message at index in the current room. Only
+// our own messages can be deleted, unless we moderate the server.
+func (cli *Client) DeleteMessageHandler(index int) error {
+	target, err := cli.controlTarget(index)
+	if err != nil {
+		return err
+	}
+	if target.Sender.PeerID != cli.User.PeerID && !cli.Session.Current.Room.isModerator(cli.User.PeerID) {
+		return fmt.Errorf("you can only delete your own messages")
+	}
+	return cli.publishControl(cli.Session.Current.Room, models.MsgTypeDelete, &models.MessageControl{
+		Target: cli.messageRef(target),
+	})
+}
+
+// controlTarget returns the message at index in the current room, if it can
+// still be edited or deleted.
+func (cli *Client) controlTarget(index int) (*models.DecrypetMessage, error) {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return nil, ErrNotInitialized.WithDetails("no message selected")
+	}
+	if room.Messages[index].Deleted {
+		return nil, fmt.Errorf("this message was deleted")
+	}
+	return &room.Messages[index], nil
+}
+
+func (cli *Client) messageRef(m *models.DecrypetMessage) models.MessageRef {
+	return models.MessageRef{
+		RoomID:     cli.GetRoomID(),
+		ChainIndex: m.ChainIndex,
+		SenderID:   m.Sender.PeerID,
+	}
+}
+
+// publishControl encrypts the content of an edit, delete, reaction or receipt
+// through the ratchet of room and publishes it on its chat topic, sealed like
+// chat when SealedSender is on. Like chat, it is applied and stored when it
+// comes back to us from the topic.
+func (cli *Client) publishControl(room *RoomSession, typ models.MessageType, content any) error {
+	if room.RoomRatchet == nil {
+		return utils.SendMessageError("Room ratchet is not initialized. Join a room first.")
+	}
+	if !room.Topics.HasTopic(models.TopicChat) {
+		return ErrNotInitialized.WithDetails("chat topic is not initialized")
+	}
+	pt, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	cm := models.ChatMessage{ChainIndex: room.RoomRatchet.Index, Padded: true, Sealed: cli.SealedSender}
+	if cm.Sealed {
+		if pt, _, err = cli.sealChat(room, typ, string(pt), cm.ChainIndex); err != nil {
+			return err
+		}
+	}
+	if cm.Ciphertext, _, err = crypto.EncryptMessage(room.RoomRatchet, pt); err != nil {
+		return err
+	}
+	var msg models.Message
+	switch typ {
+	case models.MsgTypeEdit:
+		msg = &models.EditMessage{ChatMessage: cm}
+	case models.MsgTypeDelete:
+		msg = &models.DeleteMessage{ChatMessage: cm}
+	case models.MsgTypeReaction:
+		msg = &models.ReactionMessage{ChatMessage: cm}
+	case models.MsgTypeReceipt:
+		msg = &models.ReceiptMessage{ChatMessage: cm}
+	default:
+		return fmt.Errorf("not a control message type: %s", typ)
+	}
+	if !cm.Sealed {
+		data, _, err := MarshalEnvelope(msg, *cli.User, cli.Keybag, cli.sigAlg())
+		if err != nil {
+			return err
+		}
+		return room.Topics.GetTopic(models.TopicChat).Publish(cli.Node.Ctx, data)
+	}
+	data, _, err := MarshalSealedEnvelope(msg)
+	if err != nil {
+		return err
+	}
+	anon, err := p2p.AnonymousPublish()
+	if err != nil {
+		return err
+	}
+	return room.Topics.GetTopic(models.TopicChat).Publish(cli.Node.Ctx, data, anon)
+}
+
+// OpenControl parses a decrypted edit or delete sent by signer and checks it
+// may be applied: to a message of room, by its sender, or for a delete by a
+// moderator too.
+func OpenControl(room *RoomSession, typ models.MessageType, signer string, pt []byte) (*models.MessageControl, error) {
+	var ctl models.MessageControl
+	if err := json.Unmarshal(pt, &ctl); err != nil {
+		return nil, utils.SecurityError(fmt.Sprintf("Malformed %s message: %v", typ, err))
+	}
+	if ctl.Target.RoomID != room.RoomMeta.ID {
+		return nil, utils.SecurityError(fmt.Sprintf("The %s message targets another room", typ))
+	}
+	allowed := signer == ctl.Target.SenderID
+	if typ == models.MsgTypeDelete && !allowed {
+		allowed = room.isModerator(signer)
+	}
+	if !allowed {
+		return nil, utils.SecurityError(fmt.Sprintf("Peer %s may not %s a message of %s", signer, typ, ctl.Target.SenderID))
+	}
+	if typ == models.MsgTypeEdit && ctl.Text == "" {
+		return nil, utils.ValidationError("An edit cannot empty a message, delete it instead")
+	}
+	return &ctl, nil
+}
+
+// applyControl checks a decrypted edit or delete received in room, queues it
+// for storage and updates its target, on screen if the room is.
+func (cli *Client) applyControl(room *RoomSession, env *models.Envelope, chainIndex uint64, pt []byte) error {
+	ctl, err := OpenControl(room, env.Type, env.Sender.PeerID, pt)
+	if err != nil {
+		return err
+	}
+	stored := models.StoredMessage{
+		RoomID:     room.RoomMeta.ID,
+		ServerID:   room.ServerID(),
+		ChainIndex: &chainIndex,
+		MsgType:    env.Type,
+		SenderID:   env.Sender.PeerID,
+		Timestamp:  env.Timestamp,
+		SigAlg:     env.SigAlg,
+		Signature:  env.Signature,
+		Payload:    env.Payload,
+	}
+	if err := cli.Session.SessionDB.History.EnqueueEdit(cli.Node.Ctx, stored, ctl.Target); err != nil {
+		return err
+	}
+	if env.Type == models.MsgTypeEdit {
+		cli.reindexMessage(room.RoomMeta.ID, ctl.Target.ChainIndex, ctl.Text)
+	}
+	cli.UI.App.QueueUpdateDraw(func() {
+		i := applyToMessages(room.Messages, env.Type, ctl)
+		if i >= 0 && cli.onScreen(room) && i < cli.UI.ChatScreen.ChatSection.GetItemCount() {
+			cli.UI.ChatScreen.ChatSection.SetItemText(i, cli.formatDecryptedLine(room.Messages[i], room.Messages), "")
+		}
+	})
+	return nil
+}
+
+// applyToMessages applies an edit or delete to its target in msgs and returns
+// the target's index, or -1 if it isn't there.
+func applyToMessages(msgs []models.DecrypetMessage, typ models.MessageType, ctl *models.MessageControl) int {
+	for i := range msgs {
+		m := &msgs[i]
+		if m.ChainIndex != ctl.Target.ChainIndex || m.Sender.PeerID != ctl.Target.SenderID || m.Deleted {
+			continue
+		}
+		switch typ {
+		case models.MsgTypeEdit:
+			m.Content, m.Edited = ctl.Text, true
+		case models.MsgTypeDelete:
+			m.Content, m.Deleted = "", true
+		}
+		return i
+	}
+	return -1
+}
+
+// formatDecryptedLine renders a message of a room session with its
+// attachment, edit or delete marker and reactions, quoting what it replies to from msgs and
+// highlighting where it mentions us.
+func (cli *Client) formatDecryptedLine(m models.DecrypetMessage, msgs []models.DecrypetMessage) string {
+	if m.Deleted {
+		return formatMessageLine(m.Timestamp, m.Sender, "[gray]message deleted")
+	}
+	content := quoteOf(m, msgs) + utils.HighlightMentions(m.Content, cli.User.Username) + attachmentLabel(m)
+	if m.Edited {
+		content += " [gray](edited)"
+	}
+	return formatMessageLine(m.Timestamp, m.Sender, content+reactionSummary(m)+cli.receiptMarker(m))
+}
@@ -0,0 +1,434 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/profile"
+	"hillside/internal/storage"
+	"hillside/internal/utils"
+)
+
+const exportPage = 500 // messages decrypted at a time while exporting
+
+// ExportHandler exports the history of the current room in the background
+// to a new file under ~/.hillside/exports, and tells where once written.
+func (cli *Client) ExportHandler(req models.ExportRequest) error {
+	current := cli.Session.Current.Room
+	if current == nil {
+		return ErrNotInitialized.WithDetails("no room joined")
+	}
+	req.RoomID = current.RoomMeta.ID
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	// the export decodes with the members known now, the UI keeps changing current
+	room := &RoomSession{
+		RoomMeta: current.RoomMeta,
+		Server:   current.Server,
+		Members:  slices.Clone(current.Members),
+	}
+	go func() {
+		path, n, err := cli.exportToFile(room, req)
+		cli.UI.App.QueueUpdateDraw(func() {
+			if err != nil {
+				cli.UI.ShowError("Export failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			cli.UI.ShowToast(fmt.Sprintf("Exported %d messages to %s", n, path), 3*time.Second, nil)
+		})
+	}()
+	return nil
+}
+
+// exportToFile writes the export of room to a new file named after it, and
+// removes the file if the export fails.
+func (cli *Client) exportToFile(room *RoomSession, req models.ExportRequest) (string, int, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", 0, err
+	}
+	dir := filepath.Join(homeDir, ".hillside", "exports")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", 0, err
+	}
+	name := exportName(room.RoomMeta)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), req.Format))
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := cli.exportRoom(room, req, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, n, nil
+}
+
+// exportName is the room name made safe for a file name, or its ID.
+func exportName(meta *models.RoomMeta) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, meta.Name)
+	if name == "" {
+		return meta.ID
+	}
+	return name
+}
+
+// exportRoom writes the chat messages of room selected by req to w, decrypted
+// from the stored room key a page at a time, and returns how many it wrote.
+// Messages of muted senders are left out, as they are on screen.
+func (cli *Client) exportRoom(room *RoomSession, req models.ExportRequest, w io.Writer) (int, error) {
+	store := cli.Session.SessionDB.Store
+	ra, err := store.GetAuth(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil {
+		return 0, err
+	}
+	var senders []string
+	if req.Sender != "" {
+		if senders, err = cli.peerIDsNamed(req.Sender); err != nil {
+			return 0, err
+		}
+	}
+	aw, err := storage.NewArchiveWriter(w, req.Format, storage.ArchiveHeader{
+		RoomID:   room.RoomMeta.ID,
+		RoomName: room.RoomMeta.Name,
+		Exported: time.Now(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if req.Sender != "" && len(senders) == 0 {
+		return aw.Close()
+	}
+
+	q := storage.ExportQuery{RoomID: room.RoomMeta.ID, Since: req.Since, Until: req.Until}
+	r := &crypto.RoomRatchet{Index: ra.ChainIndex, ChainKey: ra.MasterRatchetKey}
+	from := ra.ChainIndex
+	for {
+		page, err := store.GetMessagesForExport(cli.Node.Ctx, q, from, exportPage)
+		if err != nil {
+			return 0, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		from = *page[len(page)-1].ChainIndex + 1
+		msgs, err := cli.withEdits(room, page)
+		if err != nil {
+			return 0, err
+		}
+		// edits may lie past the page, the next one starts over from its first message
+		pr := r.Clone()
+		keys := make(map[uint64]messageKey, len(msgs))
+		loaded, err := cli.decodeStored(room, msgs, func(cm *models.ChatMessage) ([]byte, error) {
+			key, nonce, err := crypto.MessageKeyAt(pr, cm.ChainIndex)
+			if err != nil {
+				return nil, err
+			}
+			pt, err := crypto.OpenMessageWithKey(key, nonce, cm.Ciphertext, cm.Padded)
+			if err != nil {
+				return nil, err
+			}
+			keys[cm.ChainIndex] = messageKey{key: key, nonce: nonce, pt: pt}
+			return pt, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		edits := cli.lastEdits(room, msgs, keys)
+		for r.Index < from {
+			if _, _, err := r.NextKey(); err != nil {
+				return 0, err
+			}
+		}
+
+		stored := make(map[uint64]models.StoredMessage, len(page))
+		for _, m := range page {
+			stored[*m.ChainIndex] = m
+		}
+		for _, m := range loaded {
+			s, ok := stored[m.ChainIndex]
+			if !ok || (senders != nil && !slices.Contains(senders, m.Sender.PeerID)) {
+				continue
+			}
+			if err := aw.Write(cli.exportedMessage(room, m, s, keys, edits)); err != nil {
+				return 0, err
+			}
+		}
+		if len(page) < exportPage {
+			break
+		}
+	}
+	return aw.Close()
+}
+
+// messageKey is the message key a stored message was decrypted with, and
+// what it decrypted to.
+type messageKey struct {
+	key, nonce, pt []byte
+}
+
+// lastEdits maps the chain index of each edited message among msgs to the
+// last edit of its sender, as decodeStored applies them.
+func (cli *Client) lastEdits(room *RoomSession, msgs []models.StoredMessage, keys map[uint64]messageKey) map[uint64]models.StoredMessage {
+	edits := make(map[uint64]models.StoredMessage)
+	for _, m := range msgs {
+		k, ok := keys[*m.ChainIndex]
+		if m.MsgType != models.MsgTypeEdit || !ok {
+			continue
+		}
+		pt := k.pt
+		if isSealedPayload(m.Payload) {
+			inner, sc, err := cli.openSealedChat(room, m.MsgType, pt, *m.ChainIndex)
+			if err != nil || inner.Sender.PeerID != m.SenderID {
+				continue
+			}
+			pt = []byte(sc.Text)
+		}
+		ctl, err := OpenControl(room, m.MsgType, m.SenderID, pt)
+		if err != nil {
+			continue
+		}
+		edits[ctl.Target.ChainIndex] = m
+	}
+	return edits
+}
+
+// exportedMessage is m as archived, with the signed payload it was stored
+// with and its message key, and those of its last edit. Only proofs that
+// check out against the key we know the sender by are kept.
+func (cli *Client) exportedMessage(room *RoomSession, m models.DecrypetMessage, stored models.StoredMessage, keys map[uint64]messageKey, edits map[uint64]models.StoredMessage) models.ExportedMessage {
+	e := models.ExportedMessage{
+		ChainIndex: m.ChainIndex,
+		Time:       time.UnixMicro(m.Timestamp),
+		SenderID:   m.Sender.PeerID,
+		Sender:     m.Sender.Username,
+		Text:       m.Content,
+		ReplyTo:    m.ReplyTo,
+		ThreadRoot: m.ThreadRoot,
+		Edited:     m.Edited,
+		Deleted:    m.Deleted,
+		Reactions:  m.Reactions,
+	}
+	if m.Attachment != nil {
+		e.Attachment = &models.ExportedAttachment{
+			Name: m.Attachment.Name,
+			MIME: m.Attachment.MIME,
+			Size: m.Attachment.Size,
+			Hash: m.Attachment.Hash,
+		}
+	}
+	k, ok := keys[m.ChainIndex]
+	if m.Deleted || !ok {
+		return e
+	}
+	e.Payload, e.Key, e.Nonce = stored.Payload, k.key, k.nonce
+	if !isSealedPayload(stored.Payload) {
+		e.SigAlg, e.Signature = stored.SigAlg, stored.Signature
+	}
+	e.SenderKey = cli.senderKey(room, m.Sender.PeerID, stored.SigAlg)
+	if edit, ok := edits[m.ChainIndex]; ok && m.Edited {
+		ek := keys[*edit.ChainIndex]
+		e.Edit = &models.ExportedEdit{
+			ChainIndex: *edit.ChainIndex,
+			SigAlg:     edit.SigAlg,
+			Signature:  edit.Signature,
+			Payload:    edit.Payload,
+			Key:        ek.key,
+			Nonce:      ek.nonce,
+		}
+
+		if isSealedPayload(edit.Payload) {
+			e.Edit.SigAlg, e.Edit.Signature = "", nil
+		}
+	}
+	if err := VerifyExported(room.RoomMeta.ID, e); err != nil {
+		cli.Session.Log.Logf("Exporting message %d without its signature: %v", e.ChainIndex, err)
+		e.SigAlg, e.Signature, e.Payload, e.Key, e.Nonce, e.SenderKey, e.Edit = "", nil, nil, nil, nil, nil, nil
+	}
+	return e
+}
+
+// senderKey is the alg key we know peerID by, ours or the one of the member
+// the hub listed, never one that came with its messages.
+func (cli *Client) senderKey(room *RoomSession, peerID, alg string) []byte {
+	sender, err := cli.knownUser(room, peerID)
+	if err != nil {
+		return nil
+	}
+	return sender.SigKey(alg)
+}
+
+// VerifyExported checks a message archived from room roomID against its
+// SenderKey: Payload is signed by it, and decrypts under Key to the archived
+// text, or for an edited message to the text of its Edit, also signed by it.
+// Deleted messages have nothing left to check.
+func VerifyExported(roomID string, m models.ExportedMessage) error {
+	if m.Deleted {
+		return nil
+	}
+	if len(m.Key) == 0 || len(m.SenderKey) == 0 {
+		return utils.SecurityError(fmt.Sprintf("Message %d was exported without its keys", m.ChainIndex))
+	}
+	cm, pt, err := openExported(m.ChainIndex, m.SigAlg, m.SenderKey, m.Signature, m.Payload, m.Key, m.Nonce)
+	if err != nil {
+		return err
+	}
+	if cm.Sealed {
+		if pt, err = openExportedSealed(roomID, models.MsgTypeChat, m.ChainIndex, m, pt); err != nil {
+			return err
+		}
+	}
+	body, err := messageBody(cm, pt)
+	if err != nil {
+		return err
+	}
+	text := body.Text
+	if m.Edit != nil {
+		if text, err = openExportedEdit(roomID, m); err != nil {
+			return err
+		}
+	}
+	if text != m.Text {
+		return utils.SecurityError(fmt.Sprintf("Message %d doesn't read as its sender wrote it", m.ChainIndex))
+	}
+	if (body.ReplyTo == nil) != (m.ReplyTo == nil) || (body.ReplyTo != nil && *body.ReplyTo != *m.ReplyTo) {
+		return utils.SecurityError(fmt.Sprintf("Message %d doesn't reply to what its sender wrote", m.ChainIndex))
+	}
+	return nil
+}
+
+// openExported checks the signed payload of an archived message or edit sent
+// at index, and decrypts it with its message key. A sealed payload has no
+// signature outside, see openExportedSealed.
+func openExported(index uint64, sigAlg string, pub, sig, payload, key, nonce []byte) (*models.ChatMessage, []byte, error) {
+	var cm models.ChatMessage
+	if err := json.Unmarshal(payload, &cm); err != nil {
+		return nil, nil, utils.SecurityError(fmt.Sprintf("Malformed payload of message %d: %v", index, err))
+	}
+	if cm.ChainIndex != index {
+		return nil, nil, utils.SecurityError(fmt.Sprintf("Message %d was sent at chain index %d", index, cm.ChainIndex))
+	}
+	if !cm.Sealed {
+		if err := crypto.VerifyWith(sigAlg, pub, payload, sig); err != nil {
+			return nil, nil, utils.SecurityError(err.Error())
+		}
+	}
+	pt, err := crypto.OpenMessageWithKey(key, nonce, cm.Ciphertext, cm.Padded)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &cm, pt, nil
+}
+
+// openExportedSealed checks the envelope an archived sealed typ message of m's
+// sender, sent at index, decrypted to, as openSealedChat does, and returns its
+// text.
+func openExportedSealed(roomID string, typ models.MessageType, index uint64, m models.ExportedMessage, pt []byte) ([]byte, error) {
+	env, message, err := UnmarshalEnvelope(pt)
+	if err != nil {
+		return nil, utils.SecurityError("Malformed sealed message: " + err.Error())
+	}
+	sc, ok := message.(*models.SealedChat)
+	if !ok || env.Sender.PeerID != m.SenderID || sc.Kind != sealedKind(typ) {
+		return nil, utils.SecurityError(fmt.Sprintf("Sealed message %d is not a %s of %s", index, typ, m.SenderID))
+	}
+	if err := crypto.VerifyWith(env.SigAlg, m.SenderKey, env.Payload, env.Signature); err != nil {
+		return nil, utils.SecurityError(err.Error())
+	}
+	if sc.RoomID != roomID || sc.ChainIndex != index {
+		return nil, utils.SecurityError("Sealed message was signed for another room or position")
+	}
+	return []byte(sc.Text), nil
+}
+
+// openExportedEdit checks the edit of an archived message and returns the
+// text it sets.
+func openExportedEdit(roomID string, m models.ExportedMessage) (string, error) {
+	e := m.Edit
+	if e.ChainIndex <= m.ChainIndex {
+		return "", utils.SecurityError(fmt.Sprintf("Edit %d comes before message %d", e.ChainIndex, m.ChainIndex))
+	}
+	cm, pt, err := openExported(e.ChainIndex, e.SigAlg, m.SenderKey, e.Signature, e.Payload, e.Key, e.Nonce)
+	if err != nil {
+		return "", err
+	}
+	if cm.Sealed {
+		if pt, err = openExportedSealed(roomID, models.MsgTypeEdit, e.ChainIndex, m, pt); err != nil {
+			return "", err
+		}
+	}
+	var ctl models.MessageControl
+	if err := json.Unmarshal(pt, &ctl); err != nil {
+		return "", utils.SecurityError(fmt.Sprintf("Malformed edit %d: %v", e.ChainIndex, err))
+	}
+	target := models.MessageRef{RoomID: roomID, ChainIndex: m.ChainIndex, SenderID: m.SenderID}
+	if ctl.Target != target || ctl.Text == "" {
+		return "", utils.SecurityError(fmt.Sprintf("Edit %d doesn't edit message %d", e.ChainIndex, m.ChainIndex))
+	}
+	return ctl.Text, nil
+}
+
+// Export writes the history of a room from the local database of username to
+// w, without joining the network, and returns how many messages it wrote.
+func Export(username, password string, req models.ExportRequest, w io.Writer) (int, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+	kb, usr, err := profile.LoadProfile(username, password, "")
+	if err != nil {
+		return 0, err
+	}
+	dbPath, err := storage.SessionDBPath(username)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, utils.ValidationError(fmt.Sprintf("no history stored for %s", username))
+	}
+	store, err := storage.NewSQLiteStore(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	if err := store.Migrate(); err != nil {
+		return 0, err
+	}
+	cli := &Client{
+		User:   usr,
+		Keybag: kb,
+		Node:   &p2p.Node{Ctx: context.Background()},
+		Session: &Session{
+			Muted:     NewMuteList(),
+			SessionDB: &storage.SessionDB{Store: store},
+			Log:       &utils.RemoteLogger{},
+		},
+	}
+	cli.loadMuteList()
+	// rooms aren't stored, the archive is named by ID only
+	room := NewRoomSession()
+	room.RoomMeta = &models.RoomMeta{ID: req.RoomID}
+	return cli.exportRoom(room, req, w)
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	floodRate      = 2.0  // sustained chat messages per second per sender
+	floodBurst     = 10.0 // messages a sender may send back to back
+	maxSeenEntries = 4096 // (sender, chain index) pairs remembered per room
+)
+
+type senderBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type seenKey struct {
+	senderID   string
+	chainIndex uint64
+}
+
+// FloodGuard enforces per-sender rate limits and drops duplicate
+// (sender, chain index) pairs for a single room.
+type FloodGuard struct {
+	mu      sync.Mutex
+	buckets map[string]*senderBucket // key: peer ID
+	seen    map[seenKey]struct{}
+	order   []seenKey // insertion order, used to bound seen
+}
+
+func NewFloodGuard() *FloodGuard {
+	return &FloodGuard{
+		buckets: make(map[string]*senderBucket),
+		seen:    make(map[seenKey]struct{}),
+	}
+}
+
+// Allow consumes one token from the sender's bucket.
+func (fg *FloodGuard) Allow(senderID string) bool {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+
+	now := time.Now()
+	b, ok := fg.buckets[senderID]
+	if !ok {
+		b = &senderBucket{tokens: floodBurst, last: now}
+		fg.buckets[senderID] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * floodRate
+	if b.tokens > floodBurst {
+		b.tokens = floodBurst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// MarkSeen records a (sender, chain index) pair and reports whether it was new.
+func (fg *FloodGuard) MarkSeen(senderID string, chainIndex uint64) bool {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+
+	k := seenKey{senderID: senderID, chainIndex: chainIndex}
+	if _, ok := fg.seen[k]; ok {
+		return false
+	}
+	fg.seen[k] = struct{}{}
+	fg.order = append(fg.order, k)
+	if len(fg.order) > maxSeenEntries {
+		delete(fg.seen, fg.order[0])
+		fg.order = fg.order[1:]
+	}
+	return true
+}
+
+// Admit decides on a chat message of senderID at chainIndex, published by
+// author and delivered by a neighbour that is the author itself or only
+// relays it. A sender that isn't the author is rejected before any state is
+// touched, so nobody can spend the dedup slots or budget of someone else.
+func (fg *FloodGuard) Admit(senderID, author string, chainIndex uint64, direct bool) pubsub.ValidationResult {
+	if senderID != author {
+		return pubsub.ValidationReject
+	}
+	if !fg.MarkSeen(senderID, chainIndex) {
+		return pubsub.ValidationIgnore
+	}
+	if !fg.Allow(senderID) {
+		// only punish the relay if it is the flooder itself
+		if direct {
+			return pubsub.ValidationReject
+		}
+		return pubsub.ValidationIgnore
+	}
+	return pubsub.ValidationAccept
+}
+
+// MuteList is the local ignore list, keyed on peer ID.
+type MuteList struct {
+	mu    sync.RWMutex
+	peers map[string]struct{}
+}
+
+func NewMuteList() *MuteList {
+	return &MuteList{peers: make(map[string]struct{})}
+}
+
+func (ml *MuteList) IsMuted(peerID string) bool {
+	ml.mu.RLock()
+	defer ml.mu.RUnlock()
+	_, ok := ml.peers[peerID]
+	return ok
+}
+
+func (ml *MuteList) Set(peerID string, muted bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if muted {
+		ml.peers[peerID] = struct{}{}
+	} else {
+		delete(ml.peers, peerID)
+	}
+}
+
+// chatValidator is registered as the gossipsub validator of a room's chat topic.
+// Rejected messages count as invalid deliveries against the forwarding peer,
+// which lets the mesh score (see p2p.ChatTopicScoreParams) push flooders out.
+func (cli *Client) chatValidator(room *RoomSession) func(context.Context, peer.ID, *pubsub.Message) pubsub.ValidationResult {
+	return func(_ context.Context, from peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+		if from == cli.Node.Host.ID() {
+			return pubsub.ValidationAccept
+		}
+		env, message, err := UnmarshalEnvelope(msg.Data)
+		if err != nil {
+			return pubsub.ValidationReject
+		}
+		chatMsg, ok := roomCiphertext(message)
+		if !ok {
+			return pubsub.ValidationReject
+		}
+		if err := cli.validateChatMessageIntegrity(env, chatMsg); err != nil {
+			return pubsub.ValidationReject
+		}
+		if chatMsg.Sealed {
+			// published under a throwaway peer ID, only the neighbour that
+			// delivered it can be held to a budget, and it may be an honest relay
+			if !room.Flood.Allow(from.String()) {
+				return pubsub.ValidationIgnore
+			}
+			return pubsub.ValidationAccept
+		}
+		return room.Flood.Admit(env.Sender.PeerID, msg.GetFrom().String(), chatMsg.ChainIndex, msg.GetFrom() == from)
+	}
+}
@@ -3,10 +3,11 @@ package client
 import (
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"hillside/internal/crypto"
@@ -19,6 +20,7 @@ import (
 	"github.com/gdamore/tcell/v2"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
+	manet "github.com/multiformats/go-multiaddr/net"
 	chacha "golang.org/x/crypto/chacha20poly1305"
 )
 
@@ -37,33 +39,16 @@ func (cli *Client) LoginHandler(username string, password string, hub string) {
 	cli.Keybag = kb
 	cli.Session.Log.Logf("Loaded profile for user %s", username)
 
-	hubadrr, err := peer.AddrInfoFromString(hub)
+	hubs, err := p2p.ParseHubAddrs(hub)
 	if err != nil {
 		cli.UI.ShowError("Invalid Hub Address", "Failed to parse hub address: "+err.Error(), "OK", 0, nil)
 		return
 	}
-	cli.Node.Hub = hubadrr
+	cli.Node.SetHubs(hubs)
 
 	cli.Node.PK = kb.Libp2pPriv
 
-	go func() {
-		db, err := storage.InitSessionDB(username, "", 1024)
-		if err != nil {
-			cli.UI.ShowError("Storage Init Failed", "Failed to initialize storage: "+err.Error(), "OK", 0, nil)
-			return
-		}
-		cli.Session.SessionDB = db
-
-		if err := cli.Node.InitNode(); err != nil {
-			cli.UI.App.QueueUpdateDraw(func() {
-				cli.UI.ShowError("Node init failed", err.Error(), "OK", 0, nil)
-			})
-			return
-		}
-		cli.UI.App.QueueUpdateDraw(func() {
-			cli.SwitchToBrowseScreen(hub)
-		})
-	}()
+	go cli.startSession(username, hub)
 
 }
 
@@ -86,36 +71,95 @@ func (cli *Client) CreateUserHandler(username string, password string, hub strin
 	cli.User = usr
 	cli.Keybag = kb
 
-	hubadrr, err := peer.AddrInfoFromString(hub)
+	hubs, err := p2p.ParseHubAddrs(hub)
 	if err != nil {
 		cli.UI.ShowError("Invalid Hub Address", "Failed to parse hub address: "+err.Error(), "OK", 0, nil)
 		return
 	}
-	cli.Node.Hub = hubadrr
+	cli.Node.SetHubs(hubs)
 
 	cli.Node.PK = kb.Libp2pPriv
 
-	go func() {
-		db, err := storage.InitSessionDB(username, "", 1024)
-		if err != nil {
-			cli.UI.ShowError("Storage Init Failed", "Failed to initialize storage: "+err.Error(), "OK", 0, nil)
-			return
-		}
-		cli.Session.SessionDB = db
-		// cli.UI.ShowError("Storage Success", fmt.Sprintf("db: %p", db), "OK", 0, nil)
+	go cli.startSession(username, hub)
 
-		if err := cli.Node.InitNode(); err != nil {
-			cli.UI.App.QueueUpdateDraw(func() {
-				cli.UI.ShowError("Node init failed", err.Error(), "OK", 0, nil)
-			})
-			return
-		}
+}
+
+// lanHubSearchTime is how long the login screen listens for hubs announced over mDNS
+const lanHubSearchTime = 3 * time.Second
 
+// FindLANHubHandler looks for hubs on the local network and fills them into the login form.
+func (cli *Client) FindLANHubHandler() {
+	cli.UI.ShowToast("Looking for hubs on the local network...", lanHubSearchTime, nil)
+	go func() {
+		hubs, err := p2p.DiscoverLANHubs(cli.Node.Ctx, lanHubSearchTime, cli.Node.PSK)
 		cli.UI.App.QueueUpdateDraw(func() {
-			cli.SwitchToBrowseScreen(hub)
+			if err != nil {
+				cli.UI.ShowError("LAN discovery failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			var addrs []string
+			for _, hub := range hubs {
+				if addr := lanHubAddr(hub); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+			if len(addrs) == 0 {
+				cli.UI.ShowToast("No hub found on the local network", 3*time.Second, nil)
+				return
+			}
+			cli.Session.Log.Logf("Found %d hubs on the local network", len(addrs))
+			cli.UI.LoginScreen.SetHub(strings.Join(addrs, ","))
 		})
 	}()
+}
 
+// lanHubAddr picks a dialable, non-loopback multiaddr of a hub.
+func lanHubAddr(hub peer.AddrInfo) string {
+	addrs, err := peer.AddrInfoToP2pAddrs(&hub)
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if !manet.IsIPLoopback(a) {
+			return a.String()
+		}
+	}
+	return ""
+}
+
+// startSession opens the user's database, brings up the node and joins the
+// server directory before switching to the browse screen.
+func (cli *Client) startSession(username string, hub string) {
+	db, err := storage.InitSessionDB(username, "", 1024)
+	if err != nil {
+		cli.UI.ShowError("Storage Init Failed", "Failed to initialize storage: "+err.Error(), "OK", 0, nil)
+		return
+	}
+	cli.Session.SessionDB = db
+	db.Janitor.OnExpire(cli.dropExpired)
+	cli.loadMuteList()
+
+	// only the peers we met in a room may use our relay
+	cli.Node.RelayMembers = func(p peer.ID) bool {
+		u, err := db.Store.GetUserByID(cli.Node.Ctx, p.String())
+		return err == nil && u != nil
+	}
+	if err := cli.Node.InitNode(); err != nil {
+		cli.UI.App.QueueUpdateDraw(func() {
+			cli.UI.ShowError("Node init failed", err.Error(), "OK", 0, nil)
+		})
+		return
+	}
+	cli.Node.ServeBlobs(db.Blobs)
+	if err := cli.startDirectory(); err != nil {
+		cli.Session.Log.Logf("Failed to join the server directory: %v", err)
+	}
+	cli.UI.App.QueueUpdateDraw(func() {
+		cli.SwitchToBrowseScreen(hub)
+		if !cli.Node.HubReachable() {
+			cli.UI.ShowToast("Hub unreachable, showing known servers only", 3*time.Second, nil)
+		}
+	})
 }
 
 func (cli *Client) SwitchToBrowseScreen(hub string) {
@@ -126,12 +170,18 @@ func (cli *Client) SwitchToBrowseScreen(hub string) {
 
 func (cli *Client) SwitchToChatScreen() {
 	cli.UI.Pages.SwitchToPage("chat")
+	if room := cli.Session.Current.Room; room != nil && cli.onScreen(room) {
+		cli.markSeen(room)
+	}
 	go cli.StartRoomAutoRefresh()
 }
 
 func (cli *Client) ChatInputHandler() {
 	cli.UI.ChatScreen.Layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyTAB {
+			if cli.UI.ChatScreen.CompleteMention() {
+				return nil
+			}
 			cli.UI.App.SetFocus(cli.UI.ChatScreen.ChatSection) // Focus back to chat section on Escape
 			return nil
 		} else if event.Key() == tcell.KeyESC {
@@ -142,25 +192,86 @@ func (cli *Client) ChatInputHandler() {
 	})
 }
 
+// MuteSenderHandler toggles the mute state of whoever sent the message at index
+// in the current room. Muted peers' messages are dropped before rendering or storage.
+func (cli *Client) MuteSenderHandler(index int) error {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return ErrNotInitialized.WithDetails("no message selected")
+	}
+	sender := room.Messages[index].Sender
+	if sender.PeerID == cli.User.PeerID {
+		return fmt.Errorf("you cannot mute yourself")
+	}
+	muted := !cli.Session.Muted.IsMuted(sender.PeerID)
+	var err error
+	if muted {
+		err = cli.Session.SessionDB.Store.MutePeer(cli.Node.Ctx, sender.PeerID)
+	} else {
+		err = cli.Session.SessionDB.Store.UnmutePeer(cli.Node.Ctx, sender.PeerID)
+	}
+	if err != nil {
+		return err
+	}
+	cli.Session.Muted.Set(sender.PeerID, muted)
+	if muted {
+		cli.UI.ShowToast(fmt.Sprintf("Muted %s", sender.Username), 2*time.Second, nil)
+	} else {
+		cli.UI.ShowToast(fmt.Sprintf("Unmuted %s", sender.Username), 2*time.Second, nil)
+	}
+	return nil
+}
+
+func (cli *Client) loadMuteList() {
+	muted, err := cli.Session.SessionDB.Store.ListMutedPeers(cli.Node.Ctx)
+	if err != nil {
+		cli.Session.Log.Logf("Failed to load mute list: %v", err)
+		return
+	}
+	for _, pid := range muted {
+		cli.Session.Muted.Set(pid, true)
+	}
+	cli.Session.Log.Logf("Loaded %d muted peers", len(muted))
+}
+
 func (cli *Client) CreateServerHandler(request models.CreateServerRequest) (serverID string, err error) {
 	if request.Name == "" {
 		return "", utils.CreateServerError("Server name cannot be empty")
 	}
-	if request.Visibility == models.Private && len(request.PasswordHash) == 0 {
-		return "", utils.CreateServerError("Private servers must have a password")
+	if request.Visibility != models.Public && len(request.PasswordHash) == 0 {
+		return "", utils.CreateServerError("Private and password protected servers must have a password")
 	}
 	salt := make([]byte, 16)
 	if _, err := rand.Read(salt); err != nil {
 		return "", utils.CreateServerError("Failed to generate salt: " + err.Error())
 	}
 	request.PasswordSalt = salt
-	hash := sha256.Sum256(request.PasswordHash)
-	request.PasswordHash = hash[:]
+	// the hub only ever sees the verifier, joins are checked with PasswordProof
+	request.PasswordHash = crypto.PasswordVerifier(string(request.PasswordHash), salt)
+	meta := &models.ServerMeta{
+		ID:           p2p.NewServerID(cli.User.PeerID),
+		Name:         request.Name,
+		Description:  request.Description,
+		Visibility:   request.Visibility,
+		OwnerPeerID:  cli.User.PeerID,
+		CreatedAt:    time.Now().Unix(),
+		PasswordHash: request.PasswordHash,
+		PasswordSalt: request.PasswordSalt,
+		Rooms:        make(map[string]*models.RoomMeta),
+	}
+	// hubs take the server from this record only, and check it when replicating
+	request.Record, err = p2p.SignDirectoryEntry(&models.DirectoryEntry{Server: *meta, Version: time.Now().UnixMicro()}, cli.Keybag.Libp2pPriv)
+	if err != nil {
+		return "", utils.CreateServerError("Failed to sign server: " + err.Error())
+	}
 	resp, err := cli.requestCreateServer(request)
 	if err != nil {
 		return "", utils.CreateServerError("Failed to create server: " + err.Error())
 	}
 	serverID = resp.ServerID
+	if err := cli.announceServer(meta); err != nil {
+		cli.Session.Log.Logf("Failed to announce server %s: %v", serverID, err)
+	}
 	go cli.refreshServerList()
 	return serverID, nil
 }
@@ -169,26 +280,45 @@ func (cli *Client) CreateRoomHandler(req models.CreateRoomRequest) (string, erro
 	if req.RoomName == "" {
 		return "", utils.CreateRoomError("Room name cannot be empty")
 	}
-	if req.Visibility == models.Private && len(req.PasswordHash) == 0 {
-		return "", utils.CreateRoomError("Private rooms must have a password")
+	if req.Visibility != models.Public && len(req.PasswordHash) == 0 {
+		return "", utils.CreateRoomError("Private and password protected rooms must have a password")
+	}
+	if err := req.Retention.Validate(); err != nil {
+		return "", utils.CreateRoomError(err.Error())
 	}
 	salt := make([]byte, 16)
 	if _, err := rand.Read(salt); err != nil {
 		return "", utils.CreateRoomError("Failed to generate salt: " + err.Error())
 	}
+	_, masterKey, err := crypto.GenerateRoomKey()
+	if err != nil {
+		return "", utils.CreateRoomError("Failed to generate room key: " + err.Error())
+	}
+	pass := string(req.PasswordHash)
 	req.PasswordSalt = salt
-	hash := sha256.Sum256(req.PasswordHash)
-	req.PasswordHash = hash[:]
+	req.PasswordHash = crypto.PasswordVerifier(pass, salt)
+	if req.Visibility != models.Public {
+		// lets joiners who know the password start the ratchet without anyone online to catch them up
+		req.EncRoomKey, err = crypto.WrapRoomKey(masterKey, pass, salt)
+		if err != nil {
+			return "", utils.CreateRoomError("Failed to wrap room key: " + err.Error())
+		}
+	}
 	resp, err := cli.requestCreateRoom(req)
 	if err != nil {
 		return "", utils.CreateRoomError("Failed to create room: " + err.Error())
 	}
-	_, masterKey, err := crypto.GenerateRoomKey()
-	if err != nil {
-		return "", utils.CreateRoomError("Failed to generate room key: " + err.Error())
-	}
 
 	cli.Session.SessionDB.Store.SaveAuth(cli.Node.Ctx, resp.RoomID, 0, masterKey, time.Now())
+	if err := cli.Session.SessionDB.Store.SetRetention(cli.Node.Ctx, resp.RoomID, req.Retention); err != nil {
+		cli.Session.Log.Logf("Failed to save retention of room %s: %v", resp.RoomID, err)
+	}
+	if req.Visibility == models.Public {
+		room := &models.RoomMeta{ID: resp.RoomID, Name: req.RoomName, Visibility: req.Visibility, Retention: req.Retention}
+		if err := cli.announceRoom(req.ServerID, room); err != nil {
+			cli.Session.Log.Logf("Failed to announce room %s: %v", resp.RoomID, err)
+		}
+	}
 	go cli.refreshRoomList()
 	return resp.RoomID, nil
 }
@@ -202,6 +332,11 @@ func (cli *Client) JoinServerHandler(serverID string, pass string) error {
 	if err != nil {
 		return utils.JoinServerError(err.Error())
 	}
+	if room := cli.Session.Current.Room; room != nil && !cli.onScreen(room) {
+		// the room of the server we left keeps receiving in the background
+		cli.UI.ChatScreen.ChatSection.Clear()
+		cli.UI.ChatScreen.ChatSection.SetTitle("")
+	}
 	cli.SwitchToChatScreen()
 	cli.UI.ChatScreen.RoomWrapper.SetTitle(fmt.Sprintf("[ %s ]", cli.GetServerName()))
 	go cli.refreshRoomList()
@@ -213,11 +348,17 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 	if roomID == "" {
 		return utils.JoinRoomError("Server ID and Room ID cannot be empty")
 	}
+	if room := cli.Session.JoinedRoom(roomID); room != nil {
+		cli.Session.Log.Logf("Switching to room %s", roomID)
+		cli.switchRoom(room)
+		return nil
+	}
 	cli.Session.Log.Logf("Joining room %s", roomID)
 	err := cli.requestJoinRoom(roomID, pass)
 	if err != nil {
 		return utils.JoinRoomError(err.Error())
 	}
+	room := cli.Session.Current.Room
 	cli.Session.Log.Logf("Requested to join room %s", roomID)
 	/* TODO: Add rekeying
 	*
@@ -247,15 +388,24 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 		return err
 	}
 	cli.Session.Log.Logf("Subscribed to members topic for room %s", roomID)
-	go cli.refreshMembersList(subs)
+	go cli.refreshMembersList(room, subs)
 	cli.Session.Log.Logf("Refreshing members list for room %s", roomID)
 
-	mbr, err := cli.requestListRoomMembers()
+	serverID := cli.GetServerID()
+	go func() {
+		if err := cli.Node.AdvertiseRoom(serverID, roomID); err != nil {
+			cli.Session.Log.Logf("Failed to advertise room %s: %v", roomID, err)
+		}
+	}()
+
+	var members []models.Member
+	mbr, err := cli.requestListRoomMembers(serverID, roomID)
 	if err != nil {
-		return utils.JoinRoomError("Failed to list room members: " + err.Error())
+		cli.Session.Log.Logf("Failed to list room members (%v), discovering them through the DHT", err)
+		go cli.discoverRoomMembers(serverID, roomID)
+	} else {
+		members = mbr.Members
 	}
-
-	members := mbr.Members
 	for _, member := range members {
 		cli.Session.Log.Logf("Connecting to member %s for room %s", member.User.PeerID, roomID)
 		if member.AddrInfo.ID == cli.Node.Host.ID() {
@@ -284,6 +434,20 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 		}
 		cli.Session.Current.Room.Topics.SetTopic(models.TopicCatchUp, top)
 	}
+	if !room.Topics.HasTopic(models.TopicHistory) {
+		top, err := cli.Node.PS.Join(p2p.HistoryReqTopic(cli.GetServerID(), roomID))
+		if err != nil {
+			return err
+		}
+		room.Topics.SetTopic(models.TopicHistory, top)
+	}
+	if !room.Topics.HasTopic(models.TopicHistoryResp) {
+		top, err := cli.Node.PS.Join(p2p.HistoryRespTopic(cli.GetServerID(), roomID, cli.Node.Host.ID().String()))
+		if err != nil {
+			return err
+		}
+		room.Topics.SetTopic(models.TopicHistoryResp, top)
+	}
 	cli.Session.Log.Logf("Connected to %d members for room %s", len(members), roomID)
 
 	// Check if we have room auth stored
@@ -296,7 +460,11 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 
 			ratchet, err = cli.requestCatchUp(0, 0) // TODO: since, limit
 			if err != nil {
-				return utils.JoinRoomError("Failed to catch up: " + err.Error())
+				cli.Session.Log.Logf("Catch-up for room %s failed (%v), trying the wrapped room key", roomID, err)
+				ratchet, err = cli.unwrapRoomRatchet(cli.Session.Current.Room.RoomMeta, pass)
+				if err != nil {
+					return utils.JoinRoomError("Failed to catch up: " + err.Error())
+				}
 			}
 		} else {
 
@@ -315,6 +483,9 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 	}
 	cli.Session.Current.Room.SetInitialRatchet(ratchet)
 
+	// left from an earlier attempt to join, loaded again from the database
+	room.Messages = nil
+	cli.UI.ChatScreen.ChatSection.Clear()
 	if err = cli.chatHandler(); err != nil {
 		cli.Session.Log.Logf("Failed to initialize chat handler for room %s: %+v", roomID, err)
 		return utils.JoinRoomError("Failed to initialize chat handler: " + err.Error())
@@ -324,10 +495,15 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 	if err != nil {
 		return err
 	}
+	historySub, err := room.Topics.GetTopic(models.TopicHistory).Subscribe()
+	if err != nil {
+		return err
+	}
 	cli.UI.ChatScreen.ChatSection.SetTitle(fmt.Sprintf("[ %s ]", cli.GetRoomName()))
+	room.Joined = true
 	cli.Session.Log.Logf("Set title for chat section for room %s", roomID)
 	go func() error {
-		err = cli.helpCatchUp(sub)
+		err = cli.helpCatchUp(room, sub)
 		cli.Session.Log.Logf("Finished catch-up for room %s: %+v", roomID, cli.Session.Current.Room.RoomRatchet)
 		if err != nil {
 			cli.Session.Log.Logf("Catch-up error for room %s: %+v", roomID, err)
@@ -335,71 +511,209 @@ func (cli *Client) JoinRoomHandler(roomID string, pass string) error {
 		}
 		return nil
 	}()
+	go func() {
+		if err := cli.helpHistory(room, historySub); err != nil {
+			cli.Session.Log.Logf("History error for room %s: %+v", roomID, err)
+		}
+	}()
 	return nil
 }
 
+// unwrapRoomRatchet bootstraps the ratchet of a protected room from its password-wrapped
+// initial key. It starts at index 0 and is advanced by the messages received afterwards.
+func (cli *Client) unwrapRoomRatchet(meta *models.RoomMeta, pass string) (*crypto.RoomRatchet, error) {
+	if meta == nil || len(meta.EncRoomKey) == 0 || pass == "" {
+		return nil, errors.New("no wrapped room key available")
+	}
+	masterKey, err := crypto.UnwrapRoomKey(meta.EncRoomKey, pass, meta.PasswordSalt)
+	if err != nil {
+		return nil, err
+	}
+	if err := cli.Session.SessionDB.Store.SaveAuth(cli.Node.Ctx, meta.ID, 0, masterKey, time.Now()); err != nil {
+		cli.Session.Log.Logf("Failed to save room auth for %s: %v", meta.ID, err)
+	}
+	return &crypto.RoomRatchet{Index: 0, ChainKey: masterKey}, nil
+}
+
 func (cli *Client) parseAndDisplayDBMessages(roomID string) error {
-	msgs, err := cli.Session.SessionDB.Store.GetLatestMessages(cli.Node.Ctx, roomID, 200)
+	msgs, err := cli.Session.SessionDB.Store.GetMessagesBefore(cli.Node.Ctx, roomID, math.MaxInt64, historyPage)
 	if err != nil {
 		return err
 	}
 	cli.Session.Log.Logf("Fetched %d messages from DB for room %s", len(msgs), roomID)
+	room := cli.Session.Current.Room
+	loaded, err := cli.decodeStored(room, msgs, func(cm *models.ChatMessage) ([]byte, error) {
+		return cli.decryptMessage(room, cm)
+	})
+	if err != nil {
+		return err
+	}
+	cli.indexMessages(loaded...)
+	if room.Receipts, err = cli.Session.SessionDB.Store.GetReceipts(cli.Node.Ctx, roomID); err != nil {
+		return err
+	}
+	if n := len(msgs); n > 0 {
+		room.Latest = max(room.Latest, *msgs[n-1].ChainIndex)
+	}
+	room.Messages = append(room.Messages, loaded...)
+	room.Behind = false
+	go cli.UI.App.QueueUpdateDraw(func() { cli.renderRoom(room) })
+	if n := len(loaded); n > 0 {
+		cli.noteReceipt(room, loaded[n-1].ChainIndex, true)
+	}
+	return nil
+}
+
+// decodeStored decrypts stored messages of room in order, with edits and
+// deletes applied to the messages before them, and their reactions. Those
+// that can't be decrypted are left out.
+func (cli *Client) decodeStored(room *RoomSession, msgs []models.StoredMessage, decrypt func(*models.ChatMessage) ([]byte, error)) ([]models.DecrypetMessage, error) {
+	loaded := make([]models.DecrypetMessage, 0, len(msgs))
 	for _, msg := range msgs {
+		if cli.Session.Muted.IsMuted(msg.SenderID) {
+			continue
+		}
+		if msg.DeletedAt != 0 {
+			// tombstones have no payload left, edits of them are dropped
+			if msg.MsgType == models.MsgTypeChat && msg.ChainIndex != nil {
+				loaded = append(loaded, models.DecrypetMessage{
+					Sender:     *cli.storedSender(msg.SenderID),
+					Timestamp:  msg.Timestamp,
+					RoomID:     room.RoomMeta.ID,
+					ServerID:   room.ServerID(),
+					ChainIndex: *msg.ChainIndex,
+					Deleted:    true,
+				})
+			}
+			continue
+		}
 		var cm *models.ChatMessage
 		err := json.Unmarshal(msg.Payload, &cm)
 		if err != nil {
-			return err
+			cli.Session.Log.Logf("Dropping malformed message: %v", err)
+			continue
 		}
 		cli.Session.Log.Logf("Decrypting message with chain index %d", cm.ChainIndex)
-		pt, err := cli.decryptMessage(cm)
+		pt, err := decrypt(cm)
 		if err != nil {
-			cli.Session.Log.Logf("Failed to decrypt message: %v", err)
-			return err
+			// one bad row, stored by catch-up or history, mustn't hide the rest
+			cli.Session.Log.Logf("Dropping message %d, failed to decrypt: %v", cm.ChainIndex, err)
+			continue
 		}
 		cli.Session.Log.Logf("Decrypted message: %s", string(pt))
 
 		var sender *models.User
-		sender, err = cli.Session.SessionDB.Store.GetUserByID(cli.Node.Ctx, msg.SenderID)
+		if cm.Sealed {
+			inner, sc, err := cli.openSealedChat(room, msg.MsgType, pt, cm.ChainIndex)
+			if err == nil && inner.Sender.PeerID != msg.SenderID {
+				err = utils.SecurityError("Sealed message is stored under another sender")
+			}
+			if err != nil {
+				cli.Session.Log.Logf("Dropping sealed message %d: %v", cm.ChainIndex, err)
+				continue
+			}
+			sender, pt = &inner.Sender, []byte(sc.Text)
+		}
+
+		if msg.MsgType == models.MsgTypeEdit || msg.MsgType == models.MsgTypeDelete {
+			ctl, err := OpenControl(room, msg.MsgType, msg.SenderID, pt)
+			if err != nil {
+				cli.Session.Log.Logf("Dropping %s message %d: %v", msg.MsgType, cm.ChainIndex, err)
+				continue
+			}
+			// edits saved by catch-up can only be applied to their target once decrypted
+			if _, err := cli.Session.SessionDB.Store.SaveEdit(cli.Node.Ctx, msg, ctl.Target); err != nil {
+				cli.Session.Log.Logf("Failed to apply %s message %d: %v", msg.MsgType, cm.ChainIndex, err)
+			}
+			applyToMessages(loaded, msg.MsgType, ctl)
+			continue
+		}
+		if msg.MsgType == models.MsgTypeReaction {
+			r, err := cli.openReaction(room, pt)
+			if err != nil {
+				cli.Session.Log.Logf("Dropping reaction message %d: %v", cm.ChainIndex, err)
+				continue
+			}
+			// counted from the reactions table below, once every message is in
+			if err := cli.Session.SessionDB.Store.SaveReaction(cli.Node.Ctx, msg, *r); err != nil {
+				cli.Session.Log.Logf("Failed to apply reaction message %d: %v", cm.ChainIndex, err)
+			}
+			continue
+		}
+
+		if sender == nil {
+			sender = cli.storedSender(msg.SenderID)
+		}
+		body, err := messageBody(cm, pt)
 		if err != nil {
-			cli.Session.Log.Logf("Failed to Get sender %s: %v", msg.SenderID, err)
-			sender = &models.User{
-				PeerID:   msg.SenderID,
-				Username: "Unknown",
+			cli.Session.Log.Logf("Dropping message %d: %v", cm.ChainIndex, err)
+			continue
+		}
+		if body.ReplyTo != nil && msg.ThreadRoot == nil {
+			// saved by catch-up, before it could be read
+			if err := cli.Session.SessionDB.Store.SetThread(cli.Node.Ctx, msg.RoomID, cm.ChainIndex, *body.ReplyTo, *body.ThreadRoot); err != nil {
+				cli.Session.Log.Logf("Failed to index reply %d: %v", cm.ChainIndex, err)
 			}
 		}
 		decMsg := &models.DecrypetMessage{
-			Sender:    *sender,
-			Timestamp: msg.Timestamp,
-			Content:   string(pt),
-			RoomID:    cli.GetRoomID(),
-			ServerID:  cli.GetServerID(),
+			Sender:     *sender,
+			Timestamp:  msg.Timestamp,
+			Content:    body.Text,
+			RoomID:     room.RoomMeta.ID,
+			ServerID:   room.ServerID(),
+			ChainIndex: cm.ChainIndex,
+			ReplyTo:    body.ReplyTo,
+			ThreadRoot: body.ThreadRoot,
+			Attachment: body.Attachment,
+			Edited:     msg.EditedAt != 0,
 		}
 		cli.Session.Log.Logf("Displaying message from %s: %s", sender.Username, decMsg.Content)
-		cli.DisplayMessage(msg.Timestamp, *sender, decMsg)
-		cli.Session.Current.Room.Messages = append(cli.Session.Current.Room.Messages, *decMsg)
+		loaded = append(loaded, *decMsg)
 	}
-	return nil
+	reactions, err := cli.Session.SessionDB.Store.GetReactions(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range loaded {
+		if !loaded[i].Deleted {
+			loaded[i].Reactions = reactions[loaded[i].ChainIndex]
+		}
+	}
+	return loaded, nil
+}
+
+// storedSender returns the saved user peerID, or a placeholder if unknown.
+func (cli *Client) storedSender(peerID string) *models.User {
+	sender, err := cli.Session.SessionDB.Store.GetUserByID(cli.Node.Ctx, peerID)
+	if err != nil || sender == nil {
+		cli.Session.Log.Logf("Failed to Get sender %s: %v", peerID, err)
+		return &models.User{
+			PeerID:   peerID,
+			Username: "Unknown",
+		}
+	}
+	return sender
 }
 
-func (cli *Client) decryptMessage(cm *models.ChatMessage) ([]byte, error) {
+func (cli *Client) decryptMessage(room *RoomSession, cm *models.ChatMessage) ([]byte, error) {
 	// Advance ratchet to the message’s index
 	var key, nonce []byte
 	var err error
-	if cli.Session.Current.Room.RoomRatchet.Index <= cm.ChainIndex {
-		for cli.Session.Current.Room.RoomRatchet.Index <= cm.ChainIndex {
-			key, nonce, err = cli.Session.Current.Room.RoomRatchet.NextKey()
+	if room.RoomRatchet.Index <= cm.ChainIndex {
+		for room.RoomRatchet.Index <= cm.ChainIndex {
+			key, nonce, err = room.RoomRatchet.NextKey()
 			if err != nil {
 				return nil, fmt.Errorf("failed to Get next key: %w", err)
 			}
-			for cli.Session.Current.Room.BackupRatchet.Index+10 <= cli.Session.Current.Room.RoomRatchet.Index {
-				_, _, err = cli.Session.Current.Room.BackupRatchet.NextKey()
+			for room.BackupRatchet.Index+10 <= room.RoomRatchet.Index {
+				_, _, err = room.BackupRatchet.NextKey()
 				if err != nil {
 					return nil, fmt.Errorf("failed to Get next backup key: %w", err)
 				}
 			}
 		}
-	} else if cli.Session.Current.Room.RoomRatchet.Index > cm.ChainIndex {
-		rr := cli.Session.Current.Room.BackupRatchet
+	} else if room.RoomRatchet.Index > cm.ChainIndex {
+		rr := room.BackupRatchet
 		for rr.Index <= cm.ChainIndex {
 			key, nonce, err = rr.NextKey()
 			if err != nil {
@@ -407,7 +721,7 @@ func (cli *Client) decryptMessage(cm *models.ChatMessage) ([]byte, error) {
 			}
 		}
 	} else {
-		return nil, fmt.Errorf("invalid chain index: %d, current index: %d", cm.ChainIndex, cli.Session.Current.Room.RoomRatchet.Index)
+		return nil, fmt.Errorf("invalid chain index: %d, current index: %d", cm.ChainIndex, room.RoomRatchet.Index)
 	}
 	cli.Session.Log.Logf("Decrypting message at chain index %d with key %x and nonce %x", cm.ChainIndex, key, nonce)
 	aead, err := chacha.New(key)
@@ -415,10 +729,14 @@ func (cli *Client) decryptMessage(cm *models.ChatMessage) ([]byte, error) {
 
 		return nil, fmt.Errorf("failed to create AEAD: %+v , %x", err, key)
 	}
-	return aead.Open(nil, nonce, cm.Ciphertext, nil)
+	pt, err := aead.Open(nil, nonce, cm.Ciphertext, nil)
+	if err != nil || !cm.Padded {
+		return pt, err
+	}
+	return crypto.UnpadMessage(pt)
 }
 
-func (cli *Client) refreshMembersList(sub *pubsub.Subscription) error {
+func (cli *Client) refreshMembersList(room *RoomSession, sub *pubsub.Subscription) error {
 
 	for {
 		msg, err := sub.Next(cli.Node.Ctx)
@@ -430,8 +748,8 @@ func (cli *Client) refreshMembersList(sub *pubsub.Subscription) error {
 			return err
 		}
 
-		if cli.Node.Hub.ID != msg.ReceivedFrom {
-			return utils.SecurityError("Received message from unexpected peer: " + msg.ReceivedFrom.String())
+		if !cli.Node.IsHub(msg.GetFrom()) {
+			return utils.SecurityError("Received message from unexpected peer: " + msg.GetFrom().String())
 		}
 
 		member := resp.Members
@@ -444,7 +762,7 @@ func (cli *Client) refreshMembersList(sub *pubsub.Subscription) error {
 			}
 			cli.Session.Log.Logf("Member: %s", m.User.PeerID)
 			alreadyInList := false
-			for _, member := range cli.Session.Current.Room.Members {
+			for _, member := range room.Members {
 				if member.PeerID == m.User.PeerID {
 					alreadyInList = true
 					break
@@ -454,7 +772,7 @@ func (cli *Client) refreshMembersList(sub *pubsub.Subscription) error {
 				// Already in the list
 				continue
 			} else {
-				cli.Session.Current.Room.Members = append(cli.Session.Current.Room.Members, m.User)
+				room.Members = append(room.Members, m.User)
 				err = cli.Session.SessionDB.Peers.EnqueueUserEntry(cli.Node.Ctx, &m.User)
 				if err != nil {
 					cli.Session.Log.Logf("Failed to enqueue user %s: %v", m.User.PeerID, err)
@@ -502,7 +820,14 @@ func (cli *Client) refreshMessageList() {
 }*/
 
 func (cli *Client) refreshRoomList() {
+	var rooms []models.RoomMeta
 	roomResp, err := cli.requestRooms(cli.GetServerID())
+	if err == nil {
+		rooms = roomResp.Rooms
+	} else if cached, cerr := cli.cachedRooms(cli.GetServerID()); cerr == nil {
+		cli.Session.Log.Logf("Failed to list rooms (%v), using the directory cache", err)
+		rooms, err = cached, nil
+	}
 	cli.UI.App.QueueUpdateDraw(func() {
 		if err != nil {
 			cli.UI.ShowError("Server Error", err.Error(), "Go back to Browse view", 0, func() {
@@ -510,12 +835,19 @@ func (cli *Client) refreshRoomList() {
 			})
 			return
 		} else {
-			cli.UI.ChatScreen.UpdateRoomList(roomResp.Rooms)
+			cli.UI.ChatScreen.UpdateRoomList(rooms)
 		}
 	})
 }
 func (cli *Client) refreshServerList() {
+	var servers []models.ServerMeta
 	serverResp, err := cli.requestServers()
+	if err == nil {
+		servers = serverResp.Servers
+	} else if cached := cli.cachedServers(); len(cached) > 0 {
+		cli.Session.Log.Logf("Failed to list servers (%v), using the directory cache", err)
+		servers, err = cached, nil
+	}
 	cli.UI.App.QueueUpdateDraw(func() {
 		if err != nil {
 			cli.UI.ShowError("Server Error", err.Error(), "Go back to Login", 0, func() {
@@ -523,7 +855,7 @@ func (cli *Client) refreshServerList() {
 			})
 			return
 		} else {
-			cli.UI.BrowseScreen.UpdateServerList(serverResp.Servers)
+			cli.UI.BrowseScreen.UpdateServerList(servers)
 		}
 	})
 }
@@ -9,6 +9,7 @@ import (
 	"hillside/internal/crypto"
 	"hillside/internal/models"
 	"hillside/internal/p2p"
+	"hillside/internal/utils"
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 )
@@ -77,7 +78,7 @@ func (cli *Client) requestCatchUp(since, limit uint64) (*crypto.RoomRatchet, err
 	}
 	cli.Session.Log.Logf("Subscribed to catch-up response topic: %s", CatchupRespTopic)
 	req := &models.CatchUpRequest{}
-	data, _, err := MarshalEnvelope(req, *cli.User, cli.Keybag.DilithiumPriv)
+	data, _, err := MarshalEnvelope(req, *cli.User, cli.Keybag, cli.sigAlg())
 	if err != nil {
 		return nil, err
 	}
@@ -112,9 +113,19 @@ func (cli *Client) requestCatchUp(since, limit uint64) (*crypto.RoomRatchet, err
 			if castMsg.Error != "" {
 				return nil, fmt.Errorf("catch-up error: %s", castMsg.Error)
 			}
+			if castMsg.RoomKey == nil {
+				return nil, errors.New("catch-up response carries no room key")
+			}
+			if castMsg.RoomKey.PeerID != cli.User.PeerID {
+				return nil, fmt.Errorf("catch-up room key is wrapped for %s", castMsg.RoomKey.PeerID)
+			}
+			chainKey, err := cli.Keybag.UnwrapKey(*castMsg.RoomKey)
+			if err != nil {
+				return nil, err
+			}
 			r := &crypto.RoomRatchet{
 				Index:    castMsg.ChainIndex,
-				ChainKey: castMsg.MasterRoomKey, // TODO: derive from PoW key
+				ChainKey: chainKey, // TODO: derive from PoW key
 			}
 			if castMsg.Error != "" {
 				return r, nil
@@ -132,7 +143,7 @@ func (cli *Client) requestCatchUp(since, limit uint64) (*crypto.RoomRatchet, err
 				if valid != nil {
 					return r, fmt.Errorf("catch-up message security validation failed: %v", valid)
 				}
-				err = cli.Session.SessionDB.Store.SaveEnvelope(cli.Node.Ctx, msg.Signature, msg.Payload, msg.Timestamp, msg.MsgType, msg.ChainIndex, msg.SenderID, msg.RoomID, msg.ServerID)
+				err = cli.Session.SessionDB.Store.SaveEnvelope(cli.Node.Ctx, msg.SigAlg, msg.Signature, msg.Payload, msg.Timestamp, msg.MsgType, msg.ChainIndex, msg.SenderID, msg.RoomID, msg.ServerID)
 				if err != nil {
 					cli.Session.Log.Logf("Failed to save catch-up message index %d: %v", *msg.ChainIndex, err)
 				}
@@ -150,6 +161,10 @@ func (cli *Client) requestCatchUp(since, limit uint64) (*crypto.RoomRatchet, err
 }
 
 func (cli *Client) validateCatchupMessageSecurity(msg *models.StoredMessage, senderID string) error {
+	if isSealedPayload(msg.Payload) {
+		// checked once decrypted, see parseAndDisplayDBMessages
+		return nil
+	}
 	sender, err := cli.Session.SessionDB.Store.GetUserByID(cli.Node.Ctx, senderID)
 	if err != nil {
 		cli.Session.Log.Logf("Failed to Get sender user by ID: %v", err)
@@ -163,6 +178,7 @@ func (cli *Client) validateCatchupMessageSecurity(msg *models.StoredMessage, sen
 		Type:      msg.MsgType,
 		Sender:    *sender,
 		Timestamp: msg.Timestamp,
+		SigAlg:    msg.SigAlg,
 		Signature: msg.Signature,
 		Payload:   msg.Payload,
 	}
@@ -176,61 +192,43 @@ func (cli *Client) validateCatchupMessageSecurity(msg *models.StoredMessage, sen
 	return nil
 }
 
-func (cli *Client) helpCatchUp(sub *pubsub.Subscription) error {
+// memberRelist is how often a catch-up helper asks the hub for the members
+// of its room, when a request comes from a peer it doesn't know yet.
+const memberRelist = 2 * time.Second
 
+// helpCatchUp answers the catch-up requests of room, whether it is on screen
+// or not.
+func (cli *Client) helpCatchUp(room *RoomSession, sub *pubsub.Subscription) error {
+	var listed time.Time
 	for {
-		cli.Session.Log.Logf("Waiting for catch-up requests on topic: %s", cli.Session.Current.Room.Topics.GetTopic(models.TopicCatchUp).String())
+		cli.Session.Log.Logf("Waiting for catch-up requests on topic: %s", room.Topics.GetTopic(models.TopicCatchUp).String())
 		msg, err := sub.Next(cli.Node.Ctx)
-		catchUpPayload, _, dberr, msgs := cli.Session.SessionDB.History.BuildCatchUpPayload(cli.Node.Ctx, cli.GetRoomID(), 0, 100, cli.Session.SessionDB.Store)
-		roomkey, rkerr := cli.Session.SessionDB.Store.GetAuth(cli.Node.Ctx, cli.GetRoomID())
-		if rkerr != nil {
-			return rkerr
-		}
-		if dberr != nil {
-			cli.Session.Log.Logf("Failed to build catch-up payload: %v", err)
-		}
-		cli.Session.Log.Logf("Built catch-up payload with %d messages", len(msgs))
-
-		cli.Session.Log.Logf("Built catch-up payload of length %d", len(catchUpPayload))
-
-		if err != nil {
-			return err
-		}
-		cli.Session.Log.Logf("Received catch-up request from: %s", msg.ReceivedFrom.String())
-		env, message, err := UnmarshalEnvelope(msg.Data)
 		if err != nil {
 			return err
 		}
 		senderID := msg.ReceivedFrom
-		err = cli.validateMessageSecurity(env, senderID.String())
-		if err != nil {
-			return err
+		cli.Session.Log.Logf("Received catch-up request from: %s", senderID.String())
+		if roomMember(room, senderID.String()) == nil && time.Since(listed) > memberRelist {
+			// newcomers ask right after joining, maybe before the hub's advert of them reached us
+			listed = time.Now()
+			cli.relistMembers(room)
 		}
-		_, ok := message.(*models.CatchUpRequest)
-		if !ok {
-			return fmt.Errorf("expected CatchUpRequest, got %s", message.Type())
-		}
-		resp := &models.CatchUpResponse{
-			ChainIndex:        0,
-			MasterRoomKey:     roomkey.MasterRatchetKey,
-			MasterRoomKeyBase: roomkey.MasterRatchetKey, // TODO: change to PoW derived key
-			CatchUpMessages:   catchUpPayload,
-			Error:             "",
-		}
-		if dberr != nil {
-			resp.Error = fmt.Sprintf("failed to build catch-up payload: %s", dberr)
+		resp, err := cli.AnswerCatchUp(room, msg)
+		if err != nil {
+			cli.Session.Log.Logf("Ignoring catch-up request from %s: %v", senderID, err)
+			continue
 		}
-		respTopic := p2p.CatchUpResponseTopic(cli.GetServerID(), cli.GetRoomID(), senderID.String())
+		respTopic := p2p.CatchUpResponseTopic(room.ServerID(), room.RoomMeta.ID, senderID.String())
 		top, err := cli.Node.PS.Join(respTopic)
 		if err != nil {
 			return err
 		}
 
-		data, _, err := MarshalEnvelope(resp, *cli.User, cli.Keybag.DilithiumPriv)
+		data, _, err := MarshalEnvelope(resp, *cli.User, cli.Keybag, cli.sigAlg())
 		if err != nil {
 			return err
 		}
-		if !cli.Session.Current.Room.Topics.HasTopic(models.TopicCatchUp) {
+		if !room.Topics.HasTopic(models.TopicCatchUp) {
 			return errors.New("catch up topic is not initialized")
 		}
 		err = top.Publish(cli.Node.Ctx, data)
@@ -245,6 +243,67 @@ func (cli *Client) helpCatchUp(sub *pubsub.Subscription) error {
 	}
 }
 
+// AnswerCatchUp builds the response to a catch-up request received in room:
+// the newest messages, members page back through the older ones with history
+// requests, and the room key. The key is only sent to a member, wrapped under
+// the KEM keys the hub listed it with, never the ones it sent.
+func (cli *Client) AnswerCatchUp(room *RoomSession, msg *pubsub.Message) (*models.CatchUpResponse, error) {
+	env, message, err := UnmarshalEnvelope(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := message.(*models.CatchUpRequest); !ok {
+		return nil, fmt.Errorf("expected CatchUpRequest, got %s", message.Type())
+	}
+	member := roomMember(room, msg.ReceivedFrom.String())
+	if member == nil {
+		return nil, utils.SecurityError("Catch-up request from " + msg.ReceivedFrom.String() + ", who is not a member")
+	}
+	env.Sender = *member
+	if err := cli.validateMessageSecurity(env, msg.ReceivedFrom.String()); err != nil {
+		return nil, err
+	}
+	roomkey, err := cli.Session.SessionDB.Store.GetAuth(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.CatchUpResponse{
+		ChainIndex: roomkey.ChainIndex, // past any expired messages, see storage.AdvanceAuth
+	}
+	wrapped, err := models.WrapKeyFor(*member, roomkey.MasterRatchetKey)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to wrap room key: %s", err)
+		return resp, nil
+	}
+	resp.RoomKey = &wrapped
+	payload, n, err := cli.Session.SessionDB.History.BuildHistoryPayload(cli.Node.Ctx, room.RoomMeta.ID, 0, historyPage, cli.Session.SessionDB.Store)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to build catch-up payload: %s", err)
+		return resp, nil
+	}
+	cli.Session.Log.Logf("Built catch-up payload with %d messages, %d bytes", n, len(payload))
+	resp.CatchUpMessages = payload
+	return resp, nil
+}
+
+// relistMembers adds the members of room the hub lists that we don't know yet.
+func (cli *Client) relistMembers(room *RoomSession) {
+	resp, err := cli.requestListRoomMembers(room.ServerID(), room.RoomMeta.ID)
+	if err != nil {
+		cli.Session.Log.Logf("Failed to list members of room %s: %v", room.RoomMeta.ID, err)
+		return
+	}
+	for _, m := range resp.Members {
+		if m.AddrInfo.ID == cli.Node.Host.ID() || roomMember(room, m.User.PeerID) != nil {
+			continue
+		}
+		room.Members = append(room.Members, m.User)
+		if err := cli.Session.SessionDB.Peers.EnqueueUserEntry(cli.Node.Ctx, &m.User); err != nil {
+			cli.Session.Log.Logf("Failed to enqueue user %s: %v", m.User.PeerID, err)
+		}
+	}
+}
+
 /*
 	func (cli *Client) requestCatchUp(since, limit uint64) (*models.CatchUpResponse, error) {
 		if cli.Session == nil || cli.Session.Room == nil {
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"time"
+
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/utils"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CreateInviteHandler asks the hub for an invite link to the current server, and to roomID if set.
+// A zero ttl never expires, zero maxUses is unlimited and a non-empty boundPeerID restricts
+// the invite to that peer. Only the server owner can create invites.
+func (cli *Client) CreateInviteHandler(roomID string, maxUses int, ttl time.Duration, boundPeerID string) (link string, inviteID string, err error) {
+	serverID := cli.GetServerID()
+	if serverID == "" {
+		return "", "", utils.InviteError("join a server first")
+	}
+	req := models.CreateInviteRequest{
+		ServerID:    serverID,
+		RoomID:      roomID,
+		MaxUses:     maxUses,
+		BoundPeerID: boundPeerID,
+	}
+	if ttl > 0 {
+		req.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	resp, err := cli.requestCreateInvite(req)
+	if err != nil {
+		return "", "", utils.InviteError(err.Error())
+	}
+	cli.Session.Log.Logf("Created invite %s for server %s room %q", resp.InviteID, serverID, roomID)
+	return resp.Link, resp.InviteID, nil
+}
+
+// RedeemInviteHandler redeems a hillside:// invite link and joins the server and room it grants.
+// Invites are tracked by the hub that issued them, so it has to be one of ours.
+func (cli *Client) RedeemInviteHandler(link string) error {
+	tok, err := p2p.DecodeInvite(link)
+	if err != nil {
+		return utils.InviteError(err.Error())
+	}
+	inv, err := p2p.OpenInviteToken(tok)
+	if err != nil {
+		return utils.InviteError(err.Error())
+	}
+	if hubID, err := peer.Decode(inv.HubPeerID); err != nil || !cli.Node.IsHub(hubID) {
+		return utils.InviteError("invite was issued by hub " + inv.HubPeerID + ", connect to it to redeem")
+	}
+	if inv.BoundPeerID != "" && inv.BoundPeerID != cli.User.PeerID {
+		return utils.InviteError("invite is bound to another peer")
+	}
+
+	resp, err := cli.requestRedeemInvite(link)
+	if err != nil {
+		return utils.InviteError(err.Error())
+	}
+	cli.Session.Log.Logf("Redeemed invite %s for server %s room %q", inv.ID, resp.ServerID, resp.RoomID)
+	if err := cli.JoinServerHandler(resp.ServerID, ""); err != nil {
+		return err
+	}
+	if resp.RoomID != "" {
+		return cli.JoinRoomHandler(resp.RoomID, "")
+	}
+	return nil
+}
+
+// RevokeInviteHandler stops an invite created by this user from being redeemed again.
+func (cli *Client) RevokeInviteHandler(inviteID string) error {
+	if inviteID == "" {
+		return utils.InviteError("invite ID cannot be empty")
+	}
+	if err := cli.requestRevokeInvite(inviteID); err != nil {
+		return utils.InviteError(err.Error())
+	}
+	cli.Session.Log.Logf("Revoked invite %s", inviteID)
+	return nil
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"os/exec"
+
+	"hillside/internal/models"
+	"hillside/internal/utils"
+)
+
+// MemberNamesHandler returns the usernames of the other members of the
+// current room, to complete @mentions with.
+func (cli *Client) MemberNamesHandler() []string {
+	room := cli.Session.Current.Room
+	if room == nil {
+		return nil
+	}
+	names := make([]string, 0, len(room.Members))
+	for _, m := range room.Members {
+		if m.PeerID != cli.User.PeerID && !utils.Contains(names, m.Username) {
+			names = append(names, m.Username)
+		}
+	}
+	return names
+}
+
+// notifyMention tells us we were mentioned in room out of sight: through the
+// notify command, or the terminal bell.
+func (cli *Client) notifyMention(room *RoomSession, m models.DecrypetMessage) {
+	if cli.Notify == "" {
+		cli.UI.Bell()
+		return
+	}
+	cmd := exec.Command(cli.Notify, "Hillside: "+room.RoomMeta.Name, m.Sender.Username+": "+m.Content)
+	if err := cmd.Start(); err != nil {
+		cli.Session.Log.Logf("Failed to run notify command: %v", err)
+		cli.UI.Bell()
+		return
+	}
+	go cmd.Wait()
+}
@@ -9,12 +9,21 @@ import (
 	"hillside/internal/models"
 )
 
-func MarshalEnvelope(msg models.Message, sender models.User, sigPKBlob []byte) ([]byte, *models.Envelope, error) {
+// MarshalEnvelope signs msg with the keybag's sigAlg key. Dilithium2
+// envelopes leave SigAlg empty so they read the same as before algorithm IDs.
+func MarshalEnvelope(msg models.Message, sender models.User, kb *models.Keybag, sigAlg string) ([]byte, *models.Envelope, error) {
 	payload, err := json.Marshal(msg)
 	if err != nil {
 		return nil, nil, err
 	}
-	sig, err := crypto.Sign(payload, sigPKBlob)
+	if sigAlg == crypto.SigAlgDilithium2 {
+		sigAlg = ""
+	}
+	priv := kb.SigPriv(sigAlg)
+	if priv == nil {
+		return nil, nil, crypto.ErrSigningFailed.WithDetails("no key for " + sigAlg)
+	}
+	sig, err := crypto.SignWith(sigAlg, payload, priv)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -23,6 +32,7 @@ func MarshalEnvelope(msg models.Message, sender models.User, sigPKBlob []byte) (
 		Type:      msg.Type(),
 		Sender:    sender,
 		Timestamp: time.Now().UnixMicro(),
+		SigAlg:    sigAlg,
 		Signature: sig,
 		Payload:   payload,
 	}
@@ -30,6 +40,37 @@ func MarshalEnvelope(msg models.Message, sender models.User, sigPKBlob []byte) (
 	return data, &env, err
 }
 
+// MarshalSealedEnvelope wraps msg in an envelope with no sender, timestamp or
+// signature. The sender is authenticated inside the encrypted payload instead.
+func MarshalSealedEnvelope(msg models.Message) ([]byte, *models.Envelope, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	env := models.Envelope{
+		Type:    msg.Type(),
+		Payload: payload,
+	}
+	data, err := json.Marshal(env)
+	return data, &env, err
+}
+
+// sigAlg picks the signature algorithm for envelopes sent to the current
+// room: the most preferred one every known member has a key for, so members
+// on older versions can still verify them.
+func (cli *Client) sigAlg() string {
+	peers := [][]string{cli.User.SigAlgs()}
+	if room := cli.Session.Current.Room; room != nil {
+		for _, m := range room.Members {
+			peers = append(peers, m.SigAlgs())
+		}
+	}
+	if alg := crypto.Negotiate(crypto.SigAlgs, peers...); alg != "" {
+		return alg
+	}
+	return crypto.SigAlgDilithium2
+}
+
 func UnmarshalEnvelope(data []byte) (*models.Envelope, models.Message, error) {
 	var env models.Envelope
 	if err := json.Unmarshal(data, &env); err != nil {
@@ -59,6 +100,27 @@ func UnmarshalEnvelope(data []byte) (*models.Envelope, models.Message, error) {
 	case models.MsgTypeUserUpdate:
 		m := new(models.UserUpdate)
 		msg = m
+	case models.MsgTypeSealedChat:
+		m := new(models.SealedChat)
+		msg = m
+	case models.MsgTypeEdit:
+		m := new(models.EditMessage)
+		msg = m
+	case models.MsgTypeDelete:
+		m := new(models.DeleteMessage)
+		msg = m
+	case models.MsgTypeReaction:
+		m := new(models.ReactionMessage)
+		msg = m
+	case models.MsgTypeReceipt:
+		m := new(models.ReceiptMessage)
+		msg = m
+	case models.MsgTypeHistoryReq:
+		m := new(models.HistoryRequest)
+		msg = m
+	case models.MsgTypeHistoryResp:
+		m := new(models.HistoryResponse)
+		msg = m
 	default:
 		return &env, nil, fmt.Errorf("unknown message type: %s", env.Type)
 	}
@@ -68,3 +130,21 @@ func UnmarshalEnvelope(data []byte) (*models.Envelope, models.Message, error) {
 	}
 	return &env, msg, nil
 }
+
+// roomCiphertext returns the ratchet-encrypted part of the messages published
+// on a room's chat topic: chat, edits, deletes, reactions and receipts.
+func roomCiphertext(message models.Message) (*models.ChatMessage, bool) {
+	switch m := message.(type) {
+	case *models.ChatMessage:
+		return m, true
+	case *models.EditMessage:
+		return &m.ChatMessage, true
+	case *models.DeleteMessage:
+		return &m.ChatMessage, true
+	case *models.ReactionMessage:
+		return &m.ChatMessage, true
+	case *models.ReceiptMessage:
+		return &m.ChatMessage, true
+	}
+	return nil, false
+}
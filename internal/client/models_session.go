@@ -19,6 +19,8 @@ type Session struct {
 	Rooms     map[string]*RoomSession   // key: room ID
 	Current   Current
 	Password  string
+	Topics    *TopicCollection // session wide topics, e.g. the directory
+	Muted     *MuteList
 	SessionDB *storage.SessionDB
 	Log       *utils.RemoteLogger
 }
@@ -29,11 +31,20 @@ type TopicCollection struct {
 
 type RoomSession struct {
 	RoomMeta      *models.RoomMeta
+	Server        *ServerSession // the room belongs to
 	RoomRatchet   *crypto.RoomRatchet
 	BackupRatchet *crypto.RoomRatchet
 	Members       []models.User
 	Messages      []models.DecrypetMessage
 	Topics        *TopicCollection
+	Flood         *FloodGuard
+	Joined        bool // subscribed, it keeps receiving in the background
+	Unread        int  // messages received while not on screen
+	Mentions      int  // of them, those mentioning us
+	Receipt       *ReceiptTracker
+	Receipts      map[string]models.Receipt // by peer ID, how far the other members got
+	Behind        bool                      // Messages stop short of the newest, see scrollback.go
+	Latest        uint64                    // chain index of the newest chat message stored
 }
 
 type ServerSession struct {
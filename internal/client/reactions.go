@@ -0,0 +1,123 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"hillside/internal/models"
+	"hillside/internal/utils"
+)
+
+// ReactHandler toggles our emoji reaction to the message at index in the
+// current room: it is added, or removed if we already reacted with it.
+func (cli *Client) ReactHandler(index int, emoji string) error {
+	target, err := cli.controlTarget(index)
+	if err != nil {
+		return err
+	}
+	r := &models.Reaction{
+		Target: cli.messageRef(target),
+		Emoji:  emoji,
+		Remove: slices.Contains(target.Reactions[emoji], cli.User.PeerID),
+	}
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	return cli.publishControl(cli.Session.Current.Room, models.MsgTypeReaction, r)
+}
+
+// openReaction parses a decrypted reaction and checks it targets a message of
+// room.
+func (cli *Client) openReaction(room *RoomSession, pt []byte) (*models.Reaction, error) {
+	var r models.Reaction
+	if err := json.Unmarshal(pt, &r); err != nil {
+		return nil, utils.SecurityError(fmt.Sprintf("Malformed reaction message: %v", err))
+	}
+	if r.Target.RoomID != room.RoomMeta.ID {
+		return nil, utils.SecurityError("The reaction message targets another room")
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// applyReaction checks a decrypted reaction received in room, queues it for
+// storage and updates its target, on screen if the room is.
+func (cli *Client) applyReaction(room *RoomSession, env *models.Envelope, chainIndex uint64, pt []byte) error {
+	r, err := cli.openReaction(room, pt)
+	if err != nil {
+		return err
+	}
+	stored := models.StoredMessage{
+		RoomID:     room.RoomMeta.ID,
+		ServerID:   room.ServerID(),
+		ChainIndex: &chainIndex,
+		MsgType:    env.Type,
+		SenderID:   env.Sender.PeerID,
+		Timestamp:  env.Timestamp,
+		SigAlg:     env.SigAlg,
+		Signature:  env.Signature,
+		Payload:    env.Payload,
+	}
+	if err := cli.Session.SessionDB.History.EnqueueReaction(cli.Node.Ctx, stored, *r); err != nil {
+		return err
+	}
+	sender := env.Sender.PeerID
+	cli.UI.App.QueueUpdateDraw(func() {
+		i := reactToMessages(room.Messages, sender, r)
+		if i >= 0 && cli.onScreen(room) && i < cli.UI.ChatScreen.ChatSection.GetItemCount() {
+			cli.UI.ChatScreen.ChatSection.SetItemText(i, cli.formatDecryptedLine(room.Messages[i], room.Messages), "")
+		}
+	})
+	return nil
+}
+
+// reactToMessages applies a reaction of sender to its target in msgs and
+// returns the target's index, or -1 if it isn't there.
+func reactToMessages(msgs []models.DecrypetMessage, sender string, r *models.Reaction) int {
+	for i := range msgs {
+		m := &msgs[i]
+		if m.ChainIndex != r.Target.ChainIndex || m.Sender.PeerID != r.Target.SenderID || m.Deleted {
+			continue
+		}
+		peers := slices.DeleteFunc(m.Reactions[r.Emoji], func(p string) bool { return p == sender })
+		if !r.Remove {
+			peers = append(peers, sender)
+		}
+		if m.Reactions == nil {
+			m.Reactions = make(map[string][]string)
+		}
+		if len(peers) == 0 {
+			delete(m.Reactions, r.Emoji)
+		} else {
+			m.Reactions[r.Emoji] = peers
+		}
+		return i
+	}
+	return -1
+}
+
+// reactionSummary renders the reactions to m with their counts, or nothing.
+func reactionSummary(m models.DecrypetMessage) string {
+	if len(m.Reactions) == 0 {
+		return ""
+	}
+	emojis := make([]string, 0, len(m.Reactions))
+	for e := range m.Reactions {
+		emojis = append(emojis, e)
+	}
+	sort.Strings(emojis)
+	var b strings.Builder
+	b.WriteString(" [gray]")
+	for i, e := range emojis {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s %d", e, len(m.Reactions[e]))
+	}
+	return b.String()
+}
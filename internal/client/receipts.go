@@ -0,0 +1,160 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"hillside/internal/models"
+	"hillside/internal/utils"
+)
+
+// receiptInterval is the least time between two receipts sent to a room.
+const receiptInterval = 5 * time.Second
+
+// ReceiptTracker coalesces how far we received and read a room, so at most
+// one receipt is sent per receiptInterval and only when it moved.
+type ReceiptTracker struct {
+	mu        sync.Mutex
+	next      models.Receipt
+	sent      models.Receipt
+	scheduled bool
+}
+
+func NewReceiptTracker(roomID string) *ReceiptTracker {
+	return &ReceiptTracker{
+		next: models.Receipt{RoomID: roomID},
+		sent: models.Receipt{RoomID: roomID},
+	}
+}
+
+// Note records that we received the message at chainIndex, and read it if
+// read. It reports whether a receipt must now be scheduled.
+func (rt *ReceiptTracker) Note(chainIndex uint64, read bool) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.next.Delivered = max(rt.next.Delivered, chainIndex+1)
+	if read {
+		rt.next.Read = max(rt.next.Read, chainIndex+1)
+	}
+	if rt.scheduled || rt.next == rt.sent {
+		return false
+	}
+	rt.scheduled = true
+	return true
+}
+
+// Take returns the receipt to send, unless nothing moved since the last one.
+func (rt *ReceiptTracker) Take() (models.Receipt, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.scheduled = false
+	if rt.next == rt.sent {
+		return rt.sent, false
+	}
+	rt.sent = rt.next
+	return rt.sent, true
+}
+
+// noteReceipt records that we received the message at chainIndex in room, and
+// read it if read, for the receipt sent once receiptInterval has passed.
+func (cli *Client) noteReceipt(room *RoomSession, chainIndex uint64, read bool) {
+	if cli.NoReceipts || !room.Receipt.Note(chainIndex, read) {
+		return
+	}
+	time.AfterFunc(receiptInterval, func() {
+		// on the UI goroutine, like sends, as it advances the room ratchet
+		cli.UI.App.QueueUpdate(func() {
+			r, ok := room.Receipt.Take()
+			if !ok {
+				return
+			}
+			if err := cli.publishControl(room, models.MsgTypeReceipt, r); err != nil {
+				cli.Session.Log.Logf("Failed to send receipt to room %s: %v", room.RoomMeta.ID, err)
+			}
+		})
+	})
+}
+
+// applyReceipt checks a decrypted receipt received in room, saves it and
+// updates the markers of our messages.
+func (cli *Client) applyReceipt(room *RoomSession, env *models.Envelope, chainIndex uint64, pt []byte) error {
+	var r models.Receipt
+	if err := json.Unmarshal(pt, &r); err != nil {
+		return utils.SecurityError(fmt.Sprintf("Malformed receipt message: %v", err))
+	}
+	if err := r.Validate(room.RoomMeta.ID, chainIndex); err != nil {
+		return err
+	}
+	sender := env.Sender.PeerID
+	if sender == cli.User.PeerID {
+		return nil
+	}
+	if err := cli.Session.SessionDB.Store.SaveReceipt(cli.Node.Ctx, sender, r); err != nil {
+		return err
+	}
+	cli.UI.App.QueueUpdateDraw(func() {
+		prev := room.Receipts[sender]
+		r.Delivered, r.Read = max(prev.Delivered, r.Delivered), max(prev.Read, r.Read)
+		room.Receipts[sender] = r
+		if !cli.onScreen(room) {
+			return
+		}
+		for i, m := range room.Messages {
+			if m.Sender.PeerID == cli.User.PeerID && i < cli.UI.ChatScreen.ChatSection.GetItemCount() {
+				cli.UI.ChatScreen.ChatSection.SetItemText(i, cli.formatDecryptedLine(m, room.Messages), "")
+			}
+		}
+	})
+	return nil
+}
+
+// receiptMarker shows whether another member received (✓) or read (✓✓) m,
+// if we sent it.
+func (cli *Client) receiptMarker(m models.DecrypetMessage) string {
+	room := cli.Session.Rooms[m.RoomID]
+	if room == nil || m.Sender.PeerID != cli.User.PeerID || m.Deleted {
+		return ""
+	}
+	marker := ""
+	for peerID, r := range room.Receipts {
+		switch {
+		case peerID == cli.User.PeerID:
+		case r.Read > m.ChainIndex:
+			return " [gray]✓✓"
+		case r.Delivered > m.ChainIndex:
+			marker = " [gray]✓"
+		}
+	}
+	return marker
+}
+
+// SeenByHandler returns, for each known member of the current room, whether
+// they received or read the message at index.
+func (cli *Client) SeenByHandler(index int) ([]string, error) {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return nil, ErrNotInitialized.WithDetails("no message selected")
+	}
+	m := room.Messages[index]
+	var lines []string
+	seen := map[string]bool{cli.User.PeerID: true, m.Sender.PeerID: true}
+	for _, member := range room.Members {
+		if seen[member.PeerID] {
+			continue
+		}
+		seen[member.PeerID] = true
+		status := "[gray]not yet"
+		if r, ok := room.Receipts[member.PeerID]; ok && r.Read > m.ChainIndex {
+			status = "read"
+		} else if ok && r.Delivered > m.ChainIndex {
+			status = "delivered"
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", member.Username, status))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No other member known yet")
+	}
+	return lines, nil
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"hillside/internal/crypto"
+	"hillside/internal/storage"
+)
+
+// dropExpired forgets messages the janitor deleted: from the room session,
+// from the chat view if the room is on screen, and from the ratchets, whose
+// keys for them are erased.
+func (cli *Client) dropExpired(exp storage.Expiry) {
+	cli.UI.App.QueueUpdateDraw(func() {
+		room, ok := cli.Session.Rooms[exp.RoomID]
+		if !ok {
+			return
+		}
+		kept := room.Messages[:0]
+		for _, m := range room.Messages {
+			if m.Timestamp >= exp.Before {
+				kept = append(kept, m)
+			}
+		}
+		room.Messages = kept
+		for _, r := range []*crypto.RoomRatchet{room.BackupRatchet, room.RoomRatchet} {
+			for r != nil && r.Index < exp.NextIndex {
+				if _, _, err := r.NextKey(); err != nil {
+					break
+				}
+			}
+		}
+		cli.Session.Log.Logf("Expired %d messages of room %s", exp.Deleted, exp.RoomID)
+
+		if !cli.onScreen(room) {
+			return
+		}
+		cli.UI.ChatScreen.ChatSection.Clear()
+		for _, m := range room.Messages {
+			cli.UI.ChatScreen.ChatSection.AddItem(cli.formatDecryptedLine(m, room.Messages), "", 0, nil)
+		}
+	})
+}
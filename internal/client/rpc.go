@@ -13,6 +13,9 @@ func (cli *Client) requestServers() (*models.ListServersResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	if listResp.Error != "" {
+		return nil, fmt.Errorf("%s", listResp.Error)
+	}
 	return &listResp, nil
 
 }
@@ -23,6 +26,9 @@ func (cli *Client) requestCreateServer(req models.CreateServerRequest) (*models.
 	if err != nil {
 		return nil, err
 	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
 	return &resp, nil
 }
 
@@ -44,24 +50,57 @@ func (cli *Client) requestRooms(serverID string) (*models.ListRoomsResponse, err
 	if err != nil {
 		return nil, err
 	}
+	if roomsResp.Error != "" {
+		return nil, fmt.Errorf("%s", roomsResp.Error)
+	}
 	return &roomsResp, nil
 }
 
+// joinProof answers a hub challenge for a password protected server (roomID empty) or room.
+// Without a password there is nothing to prove and it returns nil.
+func (cli *Client) joinProof(serverID, roomID, pass string) ([]byte, error) {
+	if pass == "" {
+		return nil, nil
+	}
+	var resp models.JoinChallengeResponse
+	err := cli.Node.SendRPC("JoinChallenge", models.JoinChallengeRequest{ServerID: serverID, RoomID: roomID}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	verifier := crypto.PasswordVerifier(pass, resp.Salt)
+	return crypto.PasswordProof(verifier, resp.Nonce, cli.User.PeerID, serverID, roomID), nil
+}
+
 func (cli *Client) requestJoinServer(serverID string, pass string) error {
 	var resp models.JoinServerResponse
 	cli.Session.Log.Logf("Requesting to join server with ID: %s", serverID)
 
-	passwordHash := crypto.HashPassword(pass)
-	err := cli.Node.SendRPC("JoinServer", models.JoinServerRequest{ServerID: serverID, PasswordHash: passwordHash}, &resp)
+	proof, err := cli.joinProof(serverID, "", pass)
+	if err == nil {
+		err = cli.Node.SendRPC("JoinServer", models.JoinServerRequest{ServerID: serverID, Proof: proof}, &resp)
+	}
 	if err != nil {
-		return err
+		if cached, cerr := cli.cachedServer(serverID); cerr == nil && cached.Visibility == models.Public {
+			cli.Session.Log.Logf("Hub unavailable (%v), joining server %s from the directory cache", err, serverID)
+			resp.Server = cached
+		} else {
+			return err
+		}
 	}
 	if resp.Error != "" {
 		return fmt.Errorf("failed to join server: %s", resp.Error)
 	}
 	cli.Session.Log.Logf("Successfully joined server: %s", resp.Server.Name)
-	cli.Session.Servers[resp.Server.ID] = NewServerSessionWithMeta(resp.Server)
-	cli.Session.Log.Logf("Added server to session servers map: %s", resp.Server.Name)
+	if srv, ok := cli.Session.Servers[resp.Server.ID]; ok {
+		// keep its topics, its rooms may still be subscribed
+		srv.ServerMeta = resp.Server
+	} else {
+		cli.Session.Servers[resp.Server.ID] = NewServerSessionWithMeta(resp.Server)
+		cli.Session.Log.Logf("Added server to session servers map: %s", resp.Server.Name)
+	}
 
 	cli.Session.Current.Server = cli.Session.Servers[resp.Server.ID]
 	cli.Session.Log.Logf("Set current server to: %s", cli.GetServerName())
@@ -71,35 +110,70 @@ func (cli *Client) requestJoinServer(serverID string, pass string) error {
 
 func (cli *Client) requestJoinRoom(roomID, pass string) error {
 	var resp models.JoinRoomResponse
-	passwordHash := crypto.HashPassword(pass)
 	sid := cli.GetServerID()
 	if sid == "" {
 		return fmt.Errorf("no server joined, cannot join room")
 	}
-	err := cli.Node.SendRPC("JoinRoom", models.JoinRoomRequest{ServerID: sid, RoomID: roomID, PasswordHash: passwordHash, Sender: *cli.User}, &resp)
+	proof, err := cli.joinProof(sid, roomID, pass)
+	if err == nil {
+		err = cli.Node.SendRPC("JoinRoom", models.JoinRoomRequest{ServerID: sid, RoomID: roomID, Proof: proof, Sender: *cli.User}, &resp)
+	}
 	if err != nil {
-		return err
+		// only public rooms are published in the directory
+		cached, cerr := cli.cachedServer(sid)
+		if cerr != nil || cached.Rooms[roomID] == nil {
+			return err
+		}
+		cli.Session.Log.Logf("Hub unavailable (%v), joining room %s from the directory cache", err, roomID)
+		resp.Room = cached.Rooms[roomID]
 	}
 	if resp.Error != "" {
 		return fmt.Errorf("%s", resp.Error)
 	}
+	if err := resp.Room.Retention.Validate(); err == nil {
+		if err := cli.Session.SessionDB.Store.SetRetention(cli.Node.Ctx, resp.Room.ID, resp.Room.Retention); err != nil {
+			cli.Session.Log.Logf("Failed to save retention of room %s: %v", resp.Room.ID, err)
+		}
+	}
 	if roomSession, ok := cli.Session.Rooms[resp.Room.ID]; ok {
 		cli.Session.Current.Room = roomSession
 		return nil
 	}
 
 	cli.Session.Rooms[resp.Room.ID] = NewRoomSessionWithMeta(resp.Room)
+	cli.Session.Rooms[resp.Room.ID].Server = cli.Session.Current.Server
 	cli.Session.Current.Room = cli.Session.Rooms[resp.Room.ID]
 
 	return nil
 }
 
-func (cli *Client) requestListRoomMembers() (*models.ListRoomMembersResponse, error) {
-	if cli.Session == nil || cli.Session.Current.Room == nil {
-		return nil, fmt.Errorf("no room joined, cannot list members")
-	}
+func (cli *Client) requestListRoomMembers(serverID, roomID string) (*models.ListRoomMembersResponse, error) {
 	var resp models.ListRoomMembersResponse
-	err := cli.Node.SendRPC("ListRoomMembers", models.ListRoomMembersRequest{ServerID: cli.GetServerID(), RoomID: cli.GetRoomID()}, &resp)
+	err := cli.Node.SendRPC("ListRoomMembers", models.ListRoomMembersRequest{ServerID: serverID, RoomID: roomID}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &resp, nil
+}
+
+func (cli *Client) requestCreateInvite(req models.CreateInviteRequest) (*models.CreateInviteResponse, error) {
+	var resp models.CreateInviteResponse
+	err := cli.Node.SendRPC("CreateInvite", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return &resp, nil
+}
+
+func (cli *Client) requestRedeemInvite(link string) (*models.RedeemInviteResponse, error) {
+	var resp models.RedeemInviteResponse
+	err := cli.Node.SendRPC("RedeemInvite", models.RedeemInviteRequest{Link: link}, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -108,3 +182,15 @@ func (cli *Client) requestListRoomMembers() (*models.ListRoomMembersResponse, er
 	}
 	return &resp, nil
 }
+
+func (cli *Client) requestRevokeInvite(inviteID string) error {
+	var resp models.RevokeInviteResponse
+	err := cli.Node.SendRPC("RevokeInvite", models.RevokeInviteRequest{InviteID: inviteID}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+	return nil
+}
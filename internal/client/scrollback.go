@@ -0,0 +1,449 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/utils"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	historyPage    = 100             // messages loaded at a time when scrolling, or asked of members
+	historyWindow  = 500             // most messages of a room kept and shown at once
+	historyTimeout = 3 * time.Second // how long members get to send older history
+)
+
+// LoadOlderHandler pages the chat section back through the stored history of
+// the current room, once scrolled to its first message, and asks the members
+// for more when ours runs out. It runs on the UI goroutine.
+func (cli *Client) LoadOlderHandler() error {
+	room := cli.Session.Current.Room
+	if room == nil {
+		return ErrNotInitialized.WithDetails("no room joined")
+	}
+	first := uint64(math.MaxInt64)
+	if len(room.Messages) > 0 {
+		first = room.Messages[0].ChainIndex
+	}
+	store := cli.Session.SessionDB.Store
+	from := first
+	for {
+		older, err := store.GetMessagesBefore(cli.Node.Ctx, room.RoomMeta.ID, from, historyPage)
+		if err != nil {
+			return err
+		}
+		if len(older) == 0 {
+			cli.fetchOlder(room, from)
+			break
+		}
+		from = *older[0].ChainIndex
+		if hasChat(older) {
+			break
+		}
+	}
+	if from == first {
+		return nil
+	}
+	msgs, err := store.GetMessagesFrom(cli.Node.Ctx, room.RoomMeta.ID, from, historyWindow)
+	if err != nil {
+		return err
+	}
+	if err := cli.showWindow(room, msgs); err != nil {
+		return err
+	}
+	cli.selectMessage(room, first)
+	return nil
+}
+
+// LoadNewerHandler pages the chat section forward again, once scrolled to
+// its last message while older history is shown. It runs on the UI goroutine.
+func (cli *Client) LoadNewerHandler() error {
+	room := cli.Session.Current.Room
+	if room == nil || !room.Behind || len(room.Messages) == 0 {
+		return nil
+	}
+	last := room.Messages[len(room.Messages)-1].ChainIndex
+	store := cli.Session.SessionDB.Store
+	from := last + 1
+	for {
+		newer, err := store.GetMessagesFrom(cli.Node.Ctx, room.RoomMeta.ID, from, historyPage)
+		if err != nil {
+			return err
+		}
+		if len(newer) == 0 {
+			break
+		}
+		from = *newer[len(newer)-1].ChainIndex + 1
+		if hasChat(newer) {
+			break
+		}
+	}
+	msgs, err := store.GetMessagesBefore(cli.Node.Ctx, room.RoomMeta.ID, from, historyWindow)
+	if err != nil {
+		return err
+	}
+	if err := cli.showWindow(room, msgs); err != nil {
+		return err
+	}
+	cli.selectMessage(room, last)
+	return nil
+}
+
+// hasChat reports whether msgs hold a chat message, rather than only edits,
+// reactions and the like that show nothing of their own.
+func hasChat(msgs []models.StoredMessage) bool {
+	return slices.ContainsFunc(msgs, func(m models.StoredMessage) bool { return m.MsgType == models.MsgTypeChat })
+}
+
+// showWindow makes the stored msgs, with the edits of those edited since, the
+// messages of room, and shows them if it is on screen. It runs on the UI
+// goroutine.
+func (cli *Client) showWindow(room *RoomSession, msgs []models.StoredMessage) error {
+	var last uint64
+	if n := len(msgs); n > 0 {
+		last = *msgs[n-1].ChainIndex
+	}
+	all, err := cli.withEdits(room, msgs)
+	if err != nil {
+		return err
+	}
+	loaded, err := cli.decodeWithStoredKey(room, all)
+	if err != nil {
+		return err
+	}
+	cli.indexMessages(loaded...)
+	room.Messages = loaded
+	room.Behind = last < room.Latest
+	if cli.onScreen(room) {
+		cli.renderRoom(room)
+	}
+	return nil
+}
+
+// withEdits adds to msgs the edits of those edited, which may be stored far
+// after them, in chain index order.
+func (cli *Client) withEdits(room *RoomSession, msgs []models.StoredMessage) ([]models.StoredMessage, error) {
+	out := slices.Clone(msgs)
+	for _, m := range msgs {
+		if m.MsgType != models.MsgTypeChat || m.EditedAt == 0 || m.ChainIndex == nil {
+			continue
+		}
+		edits, err := cli.Session.SessionDB.Store.GetEditHistory(cli.Node.Ctx, room.RoomMeta.ID, *m.ChainIndex)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, edits...)
+	}
+	// one ratchet walks them all, so in order
+	slices.SortFunc(out, func(a, b models.StoredMessage) int {
+		return cmp.Compare(*a.ChainIndex, *b.ChainIndex)
+	})
+	return slices.CompactFunc(out, func(a, b models.StoredMessage) bool {
+		return *a.ChainIndex == *b.ChainIndex
+	}), nil
+}
+
+// selectMessage selects the message at chainIndex in the chat section, if
+// room is on screen and shows it.
+func (cli *Client) selectMessage(room *RoomSession, chainIndex uint64) {
+	if i := messageAt(room.Messages, chainIndex); i >= 0 && cli.onScreen(room) {
+		cli.UI.ChatScreen.ChatSection.SetCurrentItem(i)
+	}
+}
+
+// appendLive adds a message just received to room. The oldest message goes
+// once the window is full, unless it is being read: then, as when older
+// history is shown, newer messages wait in the store until scrolled to. It
+// runs on the UI goroutine.
+func (cli *Client) appendLive(room *RoomSession, m models.DecrypetMessage) {
+	room.Latest = max(room.Latest, m.ChainIndex)
+	onScreen := cli.onScreen(room)
+	if room.Behind {
+		if onScreen && m.Sender.PeerID == cli.User.PeerID {
+			// what we send is shown, with what came before it
+			cli.showLatest(room, m)
+		}
+		return
+	}
+	cs := cli.UI.ChatScreen.ChatSection
+	following := onScreen && cs.GetCurrentItem() >= cs.GetItemCount()-1
+	for len(room.Messages) >= historyWindow {
+		if onScreen && cs.GetCurrentItem() == 0 {
+			room.Behind = true
+			return
+		}
+		room.Messages = slices.Delete(room.Messages, 0, 1)
+		if onScreen {
+			cs.RemoveItem(0)
+		}
+	}
+	room.Messages = append(room.Messages, m)
+	if !onScreen {
+		return
+	}
+	cs.AddItem(cli.formatDecryptedLine(m, room.Messages), "", 0, nil)
+	if following {
+		cs.SetCurrentItem(cs.GetItemCount() - 1)
+	}
+}
+
+// showLatest shows the newest stored messages of room again, ending with m
+// if it isn't stored yet.
+func (cli *Client) showLatest(room *RoomSession, m models.DecrypetMessage) {
+	msgs, err := cli.Session.SessionDB.Store.GetMessagesBefore(cli.Node.Ctx, room.RoomMeta.ID, math.MaxInt64, historyPage)
+	if err == nil {
+		err = cli.showWindow(room, msgs)
+	}
+	if err != nil {
+		cli.Session.Log.Logf("Failed to show the latest messages of room %s: %v", room.RoomMeta.ID, err)
+		return
+	}
+	if messageAt(room.Messages, m.ChainIndex) < 0 {
+		room.Messages = append(room.Messages, m)
+		cli.UI.ChatScreen.ChatSection.AddItem(cli.formatDecryptedLine(m, room.Messages), "", 0, nil)
+	}
+	room.Behind = false
+	cli.UI.ChatScreen.ChatSection.SetCurrentItem(len(room.Messages) - 1)
+}
+
+// fetchOlder asks the members of room in the background for the messages
+// before chain index before, and shows them once stored. Nothing is asked
+// before the stored room key, those messages could not be read.
+func (cli *Client) fetchOlder(room *RoomSession, before uint64) {
+	auth, err := cli.Session.SessionDB.Store.GetAuth(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil || before <= auth.ChainIndex {
+		return
+	}
+	if _, busy := cli.fetches.LoadOrStore(room.RoomMeta.ID, true); busy {
+		return
+	}
+	cli.UI.ShowToast("Asking members for older messages...", 2*time.Second, nil)
+	go func() {
+		defer cli.fetches.Delete(room.RoomMeta.ID)
+		n, err := cli.requestHistory(room, before, historyPage)
+		cli.UI.App.QueueUpdateDraw(func() {
+			if err != nil {
+				cli.UI.ShowError("Loading history failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			if n == 0 {
+				cli.UI.ShowToast("No member has older messages", 2*time.Second, nil)
+				return
+			}
+			if !cli.onScreen(room) {
+				return
+			}
+			if err := cli.LoadOlderHandler(); err != nil {
+				cli.UI.ShowError("Loading history failed", err.Error(), "OK", 0, nil)
+			}
+		})
+	}()
+}
+
+// requestHistory asks the members of room for up to limit messages before
+// chain index before, and stores those of the first answer with any that
+// check out. It reports how many, none if nobody answered in time.
+func (cli *Client) requestHistory(room *RoomSession, before uint64, limit int) (int, error) {
+	if !room.Topics.HasTopic(models.TopicHistory) || !room.Topics.HasTopic(models.TopicHistoryResp) {
+		return 0, ErrNotInitialized.WithDetails("history topics are not joined")
+	}
+	sub, err := room.Topics.GetTopic(models.TopicHistoryResp).Subscribe()
+	if err != nil {
+		return 0, err
+	}
+	defer sub.Cancel()
+	data, _, err := MarshalEnvelope(&models.HistoryRequest{BeforeIndex: before, Limit: limit}, *cli.User, cli.Keybag, cli.sigAlg())
+	if err != nil {
+		return 0, err
+	}
+	if err := room.Topics.GetTopic(models.TopicHistory).Publish(cli.Node.Ctx, data); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(cli.Node.Ctx, historyTimeout)
+	defer cancel()
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return 0, nil
+		}
+		n, err := cli.SaveHistory(room, msg, before)
+		if err != nil {
+			cli.Session.Log.Logf("Dropping history from %s: %v", msg.ReceivedFrom, err)
+			continue
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// SaveHistory stores the messages of a history response to room, and
+// reports how many. Anyone can publish one, so it must come from a member,
+// and each message is only kept if it checks out, see checkHistoryMessage.
+func (cli *Client) SaveHistory(room *RoomSession, msg *pubsub.Message, before uint64) (int, error) {
+	env, message, err := UnmarshalEnvelope(msg.Data)
+	if err != nil {
+		return 0, err
+	}
+	member := roomMember(room, env.Sender.PeerID)
+	if member == nil {
+		return 0, utils.SecurityError("History response from " + env.Sender.PeerID + ", who is not a member")
+	}
+	// the keys we know the member by, not the ones it sent
+	env.Sender = *member
+	if err := cli.validateMessageSecurity(env, msg.GetFrom().String()); err != nil {
+		return 0, err
+	}
+	resp, ok := message.(*models.HistoryResponse)
+	if !ok {
+		return 0, fmt.Errorf("expected HistoryResponse, got %s", message.Type())
+	}
+	if resp.Error != "" {
+		return 0, fmt.Errorf("history error: %s", resp.Error)
+	}
+	page, err := cli.Session.SessionDB.History.DecompressCatchUpPayload(cli.Node.Ctx, resp.Messages, room.RoomMeta.ID, cli.Session.SessionDB.Store)
+	if err != nil {
+		return 0, err
+	}
+	ra, err := cli.Session.SessionDB.Store.GetAuth(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil {
+		return 0, err
+	}
+	msgs := slices.DeleteFunc(page.ReturnedMessages, func(m models.StoredMessage) bool {
+		return m.ChainIndex == nil || *m.ChainIndex >= before || *m.ChainIndex < ra.ChainIndex
+	})
+	// one ratchet walks them all, so in order
+	slices.SortFunc(msgs, func(a, b models.StoredMessage) int {
+		return cmp.Compare(*a.ChainIndex, *b.ChainIndex)
+	})
+	r := &crypto.RoomRatchet{Index: ra.ChainIndex, ChainKey: ra.MasterRatchetKey}
+	saved := 0
+	for _, m := range msgs {
+		if err := cli.checkHistoryMessage(room, r, &m); err != nil {
+			cli.Session.Log.Logf("Dropping history message %d: %v", *m.ChainIndex, err)
+			continue
+		}
+		err := cli.Session.SessionDB.Store.SaveEnvelope(cli.Node.Ctx, m.SigAlg, m.Signature, m.Payload, m.Timestamp, m.MsgType, m.ChainIndex, m.SenderID, room.RoomMeta.ID, room.ServerID())
+		if err != nil {
+			return saved, err
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+// checkHistoryMessage checks a message of a history page before it is
+// stored: signed by its sender, sent at the chain index it is stored under
+// and decrypting there under our room key r, which binds it to this room, and
+// for a sealed message signed inside by that same sender. r walks forward
+// through the page.
+func (cli *Client) checkHistoryMessage(room *RoomSession, r *crypto.RoomRatchet, m *models.StoredMessage) error {
+	if !payloadAt(*m) {
+		return utils.SecurityError("Message was sent at another chain index")
+	}
+	if err := cli.validateCatchupMessageSecurity(m, m.SenderID); err != nil {
+		return err
+	}
+	var cm models.ChatMessage
+	if err := json.Unmarshal(m.Payload, &cm); err != nil {
+		return err
+	}
+	pt, err := crypto.OpenMessage(r, cm.ChainIndex, cm.Ciphertext, cm.Padded)
+	if err != nil {
+		return err
+	}
+	if !cm.Sealed {
+		return nil
+	}
+	inner, _, err := cli.openSealedChat(room, m.MsgType, pt, cm.ChainIndex)
+	if err != nil {
+		return err
+	}
+	if inner.Sender.PeerID != m.SenderID {
+		return utils.SecurityError("Sealed message is stored under another sender")
+	}
+	return nil
+}
+
+// roomMember returns the member of room with peerID, nil if there is none.
+func roomMember(room *RoomSession, peerID string) *models.User {
+	for i := range room.Members {
+		if room.Members[i].PeerID == peerID {
+			return &room.Members[i]
+		}
+	}
+	return nil
+}
+
+// payloadAt reports whether the signed payload of m was sent at the chain
+// index it is stored under, which the signature doesn't cover.
+func payloadAt(m models.StoredMessage) bool {
+	var cm models.ChatMessage
+	return json.Unmarshal(m.Payload, &cm) == nil && cm.ChainIndex == *m.ChainIndex
+}
+
+// helpHistory answers the history requests of room with what we stored,
+// whether it is on screen or not.
+func (cli *Client) helpHistory(room *RoomSession, sub *pubsub.Subscription) error {
+	for {
+		msg, err := sub.Next(cli.Node.Ctx)
+		if err != nil {
+			return err
+		}
+		if msg.ReceivedFrom == cli.Node.Host.ID() {
+			continue
+		}
+		env, message, err := UnmarshalEnvelope(msg.Data)
+		if err == nil {
+			err = cli.validateMessageSecurity(env, msg.ReceivedFrom.String())
+		}
+		if err != nil {
+			cli.Session.Log.Logf("Dropping history request from %s: %v", msg.ReceivedFrom, err)
+			continue
+		}
+		req, ok := message.(*models.HistoryRequest)
+		if !ok {
+			continue
+		}
+		if err := cli.answerHistory(room, msg.ReceivedFrom, req); err != nil {
+			cli.Session.Log.Logf("Failed to answer history request from %s: %v", msg.ReceivedFrom, err)
+		}
+	}
+}
+
+// answerHistory sends the messages asked for by req to the response topic of
+// the member who asked, unless we have none of them.
+func (cli *Client) answerHistory(room *RoomSession, to peer.ID, req *models.HistoryRequest) error {
+	limit := req.Limit
+	if limit <= 0 || limit > historyPage {
+		limit = historyPage
+	}
+	payload, n, err := cli.Session.SessionDB.History.BuildHistoryPayload(cli.Node.Ctx, room.RoomMeta.ID, req.BeforeIndex, limit, cli.Session.SessionDB.Store)
+	resp := &models.HistoryResponse{Messages: payload}
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to build history payload: %s", err)
+	} else if n == 0 {
+		return nil
+	}
+	data, _, err := MarshalEnvelope(resp, *cli.User, cli.Keybag, cli.sigAlg())
+	if err != nil {
+		return err
+	}
+	top, err := cli.Node.PS.Join(p2p.HistoryRespTopic(room.ServerID(), room.RoomMeta.ID, to.String()))
+	if err != nil {
+		return err
+	}
+	defer top.Close()
+	return top.Publish(cli.Node.Ctx, data)
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"hillside/internal/models"
+	"hillside/internal/utils"
+)
+
+// sealChat builds the plaintext of a sealed-sender message of type typ sent
+// in room: an envelope signed as usual whose Sender is reduced to our peer ID.
+func (cli *Client) sealChat(room *RoomSession, typ models.MessageType, text string, chainIndex uint64) ([]byte, *models.Envelope, error) {
+	sc := &models.SealedChat{
+		RoomID:     room.RoomMeta.ID,
+		ChainIndex: chainIndex,
+		Kind:       sealedKind(typ),
+		Text:       text,
+	}
+	return MarshalEnvelope(sc, models.User{PeerID: cli.User.PeerID}, cli.Keybag, cli.sigAlg())
+}
+
+// sealedKind is the Kind a sealed message of type typ is signed with, empty
+// for chat as before control messages could be sealed.
+func sealedKind(typ models.MessageType) models.MessageType {
+	if typ == models.MsgTypeChat {
+		return ""
+	}
+	return typ
+}
+
+// sealable reports whether a typ message may be sent sealed: chat, and the
+// control messages that would otherwise tell relays who is active in a room.
+func sealable(typ models.MessageType) bool {
+	switch typ {
+	case models.MsgTypeChat, models.MsgTypeEdit, models.MsgTypeDelete, models.MsgTypeReaction, models.MsgTypeReceipt:
+		return true
+	}
+	return false
+}
+
+// openSealedChat checks a decrypted sealed-sender plaintext of a typ message
+// received in room. The message was published under a throwaway peer ID and
+// may have been relayed by anyone, so the sender is only the one that signed
+// inside. Its keys come from the room members or the peer store, never from
+// the message, and the signed room, chain index and type must be the ones it
+// was received under.
+func (cli *Client) openSealedChat(room *RoomSession, typ models.MessageType, pt []byte, chainIndex uint64) (*models.Envelope, *models.SealedChat, error) {
+	env, message, err := UnmarshalEnvelope(pt)
+	if err != nil {
+		return nil, nil, utils.SecurityError("Malformed sealed message: " + err.Error())
+	}
+	sc, ok := message.(*models.SealedChat)
+	if !ok {
+		return nil, nil, utils.SecurityError(fmt.Sprintf("Expected a sealed chat message, got %s", env.Type))
+	}
+	if sc.Kind != sealedKind(typ) {
+		return nil, nil, utils.SecurityError(fmt.Sprintf("Sealed %s message was signed as another type", typ))
+	}
+	sender, err := cli.knownUser(room, env.Sender.PeerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	env.Sender = *sender
+	if err := cli.validateMessageSecurity(env, sender.PeerID); err != nil {
+		return nil, nil, err
+	}
+	if sc.RoomID != room.RoomMeta.ID || sc.ChainIndex != chainIndex {
+		return nil, nil, utils.SecurityError("Sealed message was signed for another room or position")
+	}
+	return env, sc, nil
+}
+
+// knownUser returns what we know of peerID: ourselves, a member of room or a
+// peer saved earlier.
+func (cli *Client) knownUser(room *RoomSession, peerID string) (*models.User, error) {
+	if peerID == cli.User.PeerID {
+		return cli.User, nil
+	}
+	for i := range room.Members {
+		if room.Members[i].PeerID == peerID {
+			return &room.Members[i], nil
+		}
+	}
+	sender, err := cli.Session.SessionDB.Store.GetUserByID(cli.Node.Ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if sender == nil {
+		return nil, utils.SecurityError("Sealed message from unknown peer " + peerID)
+	}
+	return sender, nil
+}
+
+// isSealedPayload reports whether a stored chat payload is sealed-sender,
+// whose signature can only be checked once decrypted.
+func isSealedPayload(payload []byte) bool {
+	var cm models.ChatMessage
+	return json.Unmarshal(payload, &cm) == nil && cm.Sealed
+}
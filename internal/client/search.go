@@ -0,0 +1,219 @@
+package client
+
+import (
+	"slices"
+	"strings"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/storage"
+	"hillside/internal/utils"
+)
+
+const (
+	searchLimit   = 50 // most results shown by a search
+	searchContext = 20 // chain indexes loaded on each side of a result jumped to
+)
+
+// searchTokens blinds the words of text for the search index, under a key
+// derived from our keybag.
+func (cli *Client) searchTokens(text string) ([]string, error) {
+	key, err := crypto.SearchIndexKey(cli.Keybag.KyberPriv)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.SearchTokens(key, text), nil
+}
+
+// indexMessages adds decrypted messages to the search index. Failures are
+// only logged, the messages are still shown.
+func (cli *Client) indexMessages(msgs ...models.DecrypetMessage) {
+	entries := make([]storage.SearchEntry, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Deleted {
+			continue
+		}
+		text := m.Content
+		if m.Attachment != nil {
+			text += " " + m.Attachment.Name
+		}
+		tokens, err := cli.searchTokens(text)
+		if err != nil {
+			cli.Session.Log.Logf("Failed to index messages: %v", err)
+			return
+		}
+		entries = append(entries, storage.SearchEntry{
+			RoomID:     m.RoomID,
+			ChainIndex: m.ChainIndex,
+			SenderID:   m.Sender.PeerID,
+			Timestamp:  m.Timestamp,
+			Tokens:     tokens,
+		})
+	}
+	if err := cli.Session.SessionDB.Store.IndexMessages(cli.Node.Ctx, entries); err != nil {
+		cli.Session.Log.Logf("Failed to index messages: %v", err)
+	}
+}
+
+// reindexMessage replaces the indexed words of an edited message.
+func (cli *Client) reindexMessage(roomID string, chainIndex uint64, text string) {
+	tokens, err := cli.searchTokens(text)
+	if err == nil {
+		err = cli.Session.SessionDB.Store.ReindexMessage(cli.Node.Ctx, roomID, chainIndex, tokens)
+	}
+	if err != nil {
+		cli.Session.Log.Logf("Failed to reindex message %d: %v", chainIndex, err)
+	}
+}
+
+// SearchHandler searches the decrypted history of the current room, or of
+// the rooms joined on its server, newest first.
+func (cli *Client) SearchHandler(req models.SearchRequest) ([]models.SearchResult, error) {
+	current := cli.Session.Current.Room
+	if current == nil {
+		return nil, ErrNotInitialized.WithDetails("no room joined")
+	}
+	tokens, err := cli.searchTokens(req.Text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, utils.ValidationError("Search for at least one word")
+	}
+	q := storage.SearchQuery{Tokens: tokens, Since: req.Since, Until: req.Until, Limit: searchLimit}
+	rooms := map[string]*RoomSession{current.RoomMeta.ID: current}
+	if req.AllRooms {
+		for id, rs := range cli.Session.Rooms {
+			if rs.Joined && rs.Server == current.Server {
+				rooms[id] = rs
+			}
+		}
+	}
+	for id := range rooms {
+		q.RoomIDs = append(q.RoomIDs, id)
+	}
+	if req.Sender != "" {
+		if q.SenderIDs, err = cli.peerIDsNamed(req.Sender); err != nil {
+			return nil, err
+		}
+		if len(q.SenderIDs) == 0 {
+			return nil, nil
+		}
+	}
+	hits, err := cli.Session.SessionDB.Store.Search(cli.Node.Ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]map[uint64]models.DecrypetMessage, len(rooms))
+	for id, rs := range rooms {
+		var indexes []uint64
+		for _, h := range hits {
+			if h.RoomID == id {
+				indexes = append(indexes, h.ChainIndex)
+			}
+		}
+		if len(indexes) == 0 {
+			continue
+		}
+		if found[id], err = cli.loadMessages(rs, indexes); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]models.SearchResult, 0, len(hits))
+	for _, h := range hits {
+		m, ok := found[h.RoomID][h.ChainIndex]
+		if !ok {
+			continue
+		}
+		line := cli.formatDecryptedLine(m, nil)
+		if req.AllRooms {
+			line = "[gray]#" + rooms[h.RoomID].RoomMeta.Name + "[white] " + line
+		}
+		results = append(results, models.SearchResult{RoomID: h.RoomID, ChainIndex: h.ChainIndex, Line: line})
+	}
+	return results, nil
+}
+
+// peerIDsNamed returns the peer IDs of the users we know by username.
+func (cli *Client) peerIDsNamed(username string) ([]string, error) {
+	users, err := cli.Session.SessionDB.Store.GetAllUsers(cli.Node.Ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, u := range users {
+		if strings.EqualFold(u.Username, username) {
+			ids = append(ids, u.PeerID)
+		}
+	}
+	return ids, nil
+}
+
+// loadMessages decrypts the chat messages of room at indexes, with their
+// edits, from the stored room key.
+func (cli *Client) loadMessages(room *RoomSession, indexes []uint64) (map[uint64]models.DecrypetMessage, error) {
+	store := cli.Session.SessionDB.Store
+	var msgs []models.StoredMessage
+	for _, idx := range indexes {
+		at, err := store.GetMessagesAround(cli.Node.Ctx, room.RoomMeta.ID, idx, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, at...)
+	}
+	msgs, err := cli.withEdits(room, msgs)
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := cli.decodeWithStoredKey(room, msgs)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint64]models.DecrypetMessage, len(loaded))
+	for _, m := range loaded {
+		out[m.ChainIndex] = m
+	}
+	return out, nil
+}
+
+// JumpToMessageHandler selects the message at chainIndex of a room in the
+// chat section, switching to the room if it is joined in the background and
+// loading the history around the message if it isn't shown yet.
+func (cli *Client) JumpToMessageHandler(roomID string, chainIndex uint64) error {
+	room := cli.Session.Rooms[roomID]
+	if room == nil || !room.Joined {
+		return ErrNotInitialized.WithDetails("join the room to open this message")
+	}
+	if room != cli.Session.Current.Room {
+		cli.switchRoom(room)
+	}
+	i := messageAt(room.Messages, chainIndex)
+	if i < 0 {
+		if err := cli.loadContext(room, chainIndex); err != nil {
+			return err
+		}
+		if i = messageAt(room.Messages, chainIndex); i < 0 {
+			return ErrNotInitialized.WithDetails("the message is no longer stored")
+		}
+	}
+	cli.UI.ChatScreen.ChatSection.SetCurrentItem(i)
+	cli.UI.App.SetFocus(cli.UI.ChatScreen.ChatSection)
+	return nil
+}
+
+// loadContext shows the stored messages around chainIndex in place of those
+// of room, older and newer ones load again when scrolling. It runs on the UI
+// goroutine.
+func (cli *Client) loadContext(room *RoomSession, chainIndex uint64) error {
+	msgs, err := cli.Session.SessionDB.Store.GetMessagesAround(cli.Node.Ctx, room.RoomMeta.ID, chainIndex, searchContext)
+	if err != nil {
+		return err
+	}
+	return cli.showWindow(room, msgs)
+}
+
+// messageAt returns the position of the message at chainIndex in msgs, or -1.
+func messageAt(msgs []models.DecrypetMessage, chainIndex uint64) int {
+	return slices.IndexFunc(msgs, func(m models.DecrypetMessage) bool { return m.ChainIndex == chainIndex })
+}
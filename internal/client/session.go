@@ -25,6 +25,9 @@ func NewRoomSession() *RoomSession {
 		Members:       []models.User{},
 		Messages:      []models.DecrypetMessage{},
 		Topics:        NewTopicCollection(),
+		Flood:         NewFloodGuard(),
+		Receipt:       NewReceiptTracker(""),
+		Receipts:      make(map[string]models.Receipt),
 	}
 }
 
@@ -74,6 +77,7 @@ func NewServerSessionWithMeta(meta *models.ServerMeta) *ServerSession {
 func NewRoomSessionWithMeta(meta *models.RoomMeta) *RoomSession {
 	session := NewRoomSession()
 	session.RoomMeta = meta
+	session.Receipt = NewReceiptTracker(meta.ID)
 	return session
 }
 
@@ -88,11 +92,27 @@ func NewSession(db *storage.SessionDB, logger *utils.RemoteLogger) *Session {
 		Servers:   make(map[string]*ServerSession),
 		Rooms:     make(map[string]*RoomSession),
 		Current:   NewCurrent(),
+		Topics:    NewTopicCollection(),
+		Muted:     NewMuteList(),
 		SessionDB: db,
 		Log:       logger,
 	}
 }
 
+// ServerID returns the ID of the server the room belongs to.
+func (rs *RoomSession) ServerID() string {
+	if rs.Server == nil || rs.Server.ServerMeta == nil {
+		return ""
+	}
+	return rs.Server.ServerMeta.ID
+}
+
+// isModerator reports whether peerID moderates the room's server, which for
+// now means owning it.
+func (rs *RoomSession) isModerator(peerID string) bool {
+	return rs.Server != nil && rs.Server.ServerMeta != nil && rs.Server.ServerMeta.OwnerPeerID == peerID
+}
+
 func (rs *RoomSession) SetInitialRatchet(ratchet *crypto.RoomRatchet) {
 	rs.RoomRatchet = ratchet
 	rs.BackupRatchet = ratchet.Clone()
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/utils"
+)
+
+// quoteLen is how many characters of a message are quoted above a reply.
+const quoteLen = 40
+
+// ReplyHandler sends text as a reply to the message at index in the current
+// room, in the thread that message belongs to.
+func (cli *Client) ReplyHandler(index int, text string) error {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return ErrNotInitialized.WithDetails("no message selected")
+	}
+	target := room.Messages[index]
+	replyTo, root := target.ChainIndex, threadRoot(target)
+	return cli.sendChat(&models.MessageBody{
+		Text:       text,
+		ReplyTo:    &replyTo,
+		ThreadRoot: &root,
+	})
+}
+
+// ThreadHandler returns the lines of the thread the message at index in the
+// current room belongs to, loaded from the database.
+func (cli *Client) ThreadHandler(index int) ([]string, error) {
+	room := cli.Session.Current.Room
+	if room == nil || index < 0 || index >= len(room.Messages) {
+		return nil, ErrNotInitialized.WithDetails("no message selected")
+	}
+	thread, err := cli.loadThread(threadRoot(room.Messages[index]))
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0, len(thread))
+	for _, m := range thread {
+		lines = append(lines, cli.formatDecryptedLine(m, thread))
+	}
+	return lines, nil
+}
+
+// loadThread decrypts the thread started at root from the stored room key,
+// leaving the session ratchets where they are.
+func (cli *Client) loadThread(root uint64) ([]models.DecrypetMessage, error) {
+	room := cli.Session.Current.Room
+	msgs, err := cli.Session.SessionDB.Store.GetThread(cli.Node.Ctx, room.RoomMeta.ID, root)
+	if err != nil {
+		return nil, err
+	}
+	return cli.decodeWithStoredKey(room, msgs)
+}
+
+// decodeWithStoredKey decodes stored messages of room, in chain index order,
+// with a ratchet of its own from the stored room key.
+func (cli *Client) decodeWithStoredKey(room *RoomSession, msgs []models.StoredMessage) ([]models.DecrypetMessage, error) {
+	ra, err := cli.Session.SessionDB.Store.GetAuth(cli.Node.Ctx, room.RoomMeta.ID)
+	if err != nil {
+		return nil, err
+	}
+	r := &crypto.RoomRatchet{Index: ra.ChainIndex, ChainKey: ra.MasterRatchetKey}
+	return cli.decodeStored(room, msgs, func(cm *models.ChatMessage) ([]byte, error) {
+		return crypto.OpenMessage(r, cm.ChainIndex, cm.Ciphertext, cm.Padded)
+	})
+}
+
+// threadRoot returns the chain index of the first message of m's thread.
+func threadRoot(m models.DecrypetMessage) uint64 {
+	if m.ThreadRoot != nil {
+		return *m.ThreadRoot
+	}
+	return m.ChainIndex
+}
+
+// messageBody decodes the text of a chat message: a MessageBody, or raw text
+// from clients that predate them. A reply must come after what it answers,
+// and an attachment must be one we can fetch and save.
+func messageBody(cm *models.ChatMessage, pt []byte) (*models.MessageBody, error) {
+	if !cm.Structured {
+		return &models.MessageBody{Text: string(pt)}, nil
+	}
+	var body models.MessageBody
+	if err := json.Unmarshal(pt, &body); err != nil {
+		return nil, utils.ValidationError("Malformed message body: " + err.Error())
+	}
+	if (body.ReplyTo == nil) != (body.ThreadRoot == nil) {
+		return nil, utils.ValidationError("A reply needs both the message it answers and its thread")
+	}
+	if body.ReplyTo != nil && (*body.ReplyTo >= cm.ChainIndex || *body.ThreadRoot > *body.ReplyTo) {
+		return nil, utils.ValidationError(fmt.Sprintf("Message %d replies to a later message", cm.ChainIndex))
+	}
+	if body.Attachment != nil {
+		if err := body.Attachment.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &body, nil
+}
+
+// quoteOf returns the quoted context of a reply, found among msgs.
+func quoteOf(m models.DecrypetMessage, msgs []models.DecrypetMessage) string {
+	if m.ReplyTo == nil {
+		return ""
+	}
+	for _, q := range msgs {
+		if q.ChainIndex != *m.ReplyTo {
+			continue
+		}
+		text := []rune(q.Content)
+		if q.Deleted {
+			text = []rune("message deleted")
+		}
+		if len(text) > quoteLen {
+			text = append(text[:quoteLen], '…')
+		}
+		return fmt.Sprintf("[gray]> %s: %s[white] ", q.Sender.Username, string(text))
+	}
+	return "[gray]> earlier message[white] "
+}
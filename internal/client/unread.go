@@ -0,0 +1,122 @@
+package client
+
+import (
+	"fmt"
+
+	"hillside/internal/models"
+	"hillside/internal/ui"
+	"hillside/internal/utils"
+)
+
+// onScreen reports whether room is the one shown on the chat screen.
+func (cli *Client) onScreen(room *RoomSession) bool {
+	return cli.Session.Current.Room == room && cli.Session.Current.Server == room.Server
+}
+
+// viewing reports whether we are looking at room on the chat screen.
+func (cli *Client) viewing(room *RoomSession) bool {
+	page, _ := cli.UI.Pages.GetFrontPage()
+	return cli.onScreen(room) && utils.IsChatPageActive(page)
+}
+
+// noteUnseen counts a message received in room if we aren't looking at it,
+// notifying us if it mentions us. It runs on the UI goroutine.
+func (cli *Client) noteUnseen(room *RoomSession, m models.DecrypetMessage) {
+	if cli.viewing(room) {
+		return
+	}
+	counted, mentioned := room.CountUnseen(m, cli.User)
+	if !counted {
+		return
+	}
+	if mentioned {
+		cli.notifyMention(room, m)
+	}
+	cli.showBadges(room)
+}
+
+// CountUnseen counts m, received in rs while we weren't looking, unless we
+// sent it, and reports whether it mentions us.
+func (rs *RoomSession) CountUnseen(m models.DecrypetMessage, me *models.User) (counted, mentioned bool) {
+	if m.Sender.PeerID == me.PeerID {
+		return false, false
+	}
+	rs.Unread++
+	if utils.MentionsUser(m.Content, me.Username) {
+		rs.Mentions++
+		return true, true
+	}
+	return true, false
+}
+
+// ClearUnseen resets the unread counts of rs and reports whether there were any.
+func (rs *RoomSession) ClearUnseen() bool {
+	if rs.Unread == 0 && rs.Mentions == 0 {
+		return false
+	}
+	rs.Unread, rs.Mentions = 0, 0
+	return true
+}
+
+// Badge is the unread badge of rs.
+func (rs *RoomSession) Badge() ui.Badge {
+	return ui.Badge{Unread: rs.Unread, Mentions: rs.Mentions}
+}
+
+// ServerBadge adds up the unread badges of the rooms of server.
+func (s *Session) ServerBadge(server *ServerSession) ui.Badge {
+	var total ui.Badge
+	for _, rs := range s.Rooms {
+		if rs.Server == server {
+			total.Unread += rs.Unread
+			total.Mentions += rs.Mentions
+		}
+	}
+	return total
+}
+
+// JoinedRoom returns the room of the current server we already joined, and
+// which kept receiving in the background, or nil if there is none.
+func (s *Session) JoinedRoom(roomID string) *RoomSession {
+	if room, ok := s.Rooms[roomID]; ok && room.Joined && room.Server == s.Current.Server {
+		return room
+	}
+	return nil
+}
+
+// markSeen clears the unread counts of room, now on screen, and tells the room
+// we read it. It runs on the UI goroutine.
+func (cli *Client) markSeen(room *RoomSession) {
+	if n := len(room.Messages); n > 0 {
+		cli.noteReceipt(room, room.Messages[n-1].ChainIndex, true)
+	}
+	if room.ClearUnseen() {
+		cli.showBadges(room)
+	}
+}
+
+// showBadges updates the unread badges of room and of its server.
+func (cli *Client) showBadges(room *RoomSession) {
+	cli.UI.ChatScreen.SetRoomBadge(room.RoomMeta.ID, room.Badge())
+	cli.UI.BrowseScreen.SetServerBadge(room.ServerID(), cli.Session.ServerBadge(room.Server))
+}
+
+// switchRoom shows a room we already joined, which kept receiving in the
+// background, without joining it or catching up again. It runs on the UI
+// goroutine.
+func (cli *Client) switchRoom(room *RoomSession) {
+	cli.Session.Current.Room = room
+	cli.renderRoom(room)
+	cli.UI.ChatScreen.ChatSection.SetTitle(fmt.Sprintf("[ %s ]", room.RoomMeta.Name))
+	cli.markSeen(room)
+}
+
+// renderRoom shows the messages of room, the current one, again, with the
+// newest selected.
+func (cli *Client) renderRoom(room *RoomSession) {
+	cli.UI.ChatScreen.ChatSection.Clear()
+	for _, m := range room.Messages {
+		cli.UI.ChatScreen.ChatSection.AddItem(cli.formatDecryptedLine(m, room.Messages), "", 0, nil)
+	}
+	cli.UI.ChatScreen.ChatSection.SetCurrentItem(len(room.Messages) - 1)
+}
@@ -7,8 +7,13 @@ import (
 	"hillside/internal/crypto"
 	"hillside/internal/models"
 	"hillside/internal/utils"
+
+	chacha "golang.org/x/crypto/chacha20poly1305"
 )
 
+// maxCiphertextLen fits the largest padding bucket plus the AEAD tag.
+var maxCiphertextLen = crypto.MaxPaddedLen + chacha.Overhead
+
 func (cli *Client) validateChatMessageIntegrity(env *models.Envelope, msg *models.ChatMessage) error {
 	if msg == nil {
 		return utils.ValidationError("Chat message cannot be nil")
@@ -17,11 +22,14 @@ func (cli *Client) validateChatMessageIntegrity(env *models.Envelope, msg *model
 		return utils.ValidationError("Chat message content cannot be empty")
 	}
 
-	if len(msg.Ciphertext) > 10000 { // Arbitrary limit for message length
-		return utils.ValidationError("Chat message content exceeds maximum length of 10000 characters")
+	if len(msg.Ciphertext) > maxCiphertextLen {
+		return utils.ValidationError(fmt.Sprintf("Chat message content exceeds maximum length of %d bytes", maxCiphertextLen))
+	}
+	if msg.Sealed && !sealable(env.Type) {
+		return utils.ValidationError(fmt.Sprintf("A %s message cannot be sealed", env.Type))
 	}
 	if env.Timestamp == 0 {
-		env.Timestamp = time.Now().Unix()
+		env.Timestamp = time.Now().UnixMicro()
 	}
 	return nil
 }
@@ -34,7 +42,11 @@ func (cli *Client) validateMessageSecurity(env *models.Envelope, strSenderID str
 		return utils.SecurityError(fmt.Sprintf("Message timestamp %d is in the future, now is %d", env.Timestamp, time.Now().UnixMicro()))
 	}
 
-	verify := crypto.ValidateSignature(env.Sender.DilithiumPub, env.Payload, env.Signature)
+	pub := env.Sender.SigKey(env.SigAlg)
+	if pub == nil {
+		return utils.SecurityError(fmt.Sprintf("Sender has no %q signing key", env.SigAlg))
+	}
+	verify := crypto.VerifyWith(env.SigAlg, pub, env.Payload, env.Signature)
 	if verify != nil {
 		return utils.SecurityError(verify.Error())
 	}
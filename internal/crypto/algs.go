@@ -0,0 +1,303 @@
+package crypto
+
+import (
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/hybrid"
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/ed25519"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+)
+
+// Algorithm identifiers, carried next to public keys and in envelopes.
+// Dilithium2 and Kyber1024 are the keys every profile was created with and
+// the algorithms assumed when no identifier is present.
+const (
+	SigAlgDilithium2     = "Dilithium2"
+	SigAlgEd25519MLDSA65 = "Ed25519-ML-DSA-65" // both signatures must verify
+	KEMAlgKyber1024      = "Kyber1024"
+	KEMAlgX25519MLKEM768 = "X25519MLKEM768"
+)
+
+// Supported algorithms, most preferred first.
+var (
+	SigAlgs = []string{SigAlgEd25519MLDSA65, SigAlgDilithium2}
+	KEMAlgs = []string{KEMAlgX25519MLKEM768, KEMAlgKyber1024}
+)
+
+// sigScheme is the subset of a signature scheme hillside needs, over
+// marshalled keys so callers never handle scheme-specific key types.
+type sigScheme interface {
+	generate() (pub, priv []byte, err error)
+	public(priv []byte) ([]byte, error)
+	sign(priv, msg []byte) ([]byte, error)
+	verify(pub, msg, sig []byte) bool
+}
+
+func sigSchemeFor(alg string) (sigScheme, error) {
+	switch alg {
+	case SigAlgDilithium2, "":
+		return single{DilithiumScheme}, nil
+	case SigAlgEd25519MLDSA65:
+		return composite{alg: alg, classic: ed25519.Scheme(), pq: mldsa65.Scheme()}, nil
+	}
+	return nil, ErrUnsupportedAlg.WithDetails(alg)
+}
+
+func kemSchemeFor(alg string) (kem.Scheme, error) {
+	switch alg {
+	case KEMAlgKyber1024, "":
+		return KyberScheme, nil
+	case KEMAlgX25519MLKEM768:
+		return hybrid.X25519MLKEM768(), nil
+	}
+	return nil, ErrUnsupportedAlg.WithDetails(alg)
+}
+
+// GenSigKeyFor generates a signing key pair for alg.
+func GenSigKeyFor(alg string) ([]byte, []byte, error) {
+	s, err := sigSchemeFor(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.generate()
+}
+
+// SigPublicKey returns the public half of a marshalled alg private key.
+func SigPublicKey(alg string, priv []byte) ([]byte, error) {
+	s, err := sigSchemeFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := s.public(priv)
+	if err != nil {
+		return nil, ErrBadKey.WithDetails(err.Error())
+	}
+	return pub, nil
+}
+
+// SignWith signs message with an alg private key.
+func SignWith(alg string, message, priv []byte) ([]byte, error) {
+	s, err := sigSchemeFor(alg)
+	if err != nil {
+		return nil, ErrSigningFailed.WithDetails(err.Error())
+	}
+	sig, err := s.sign(priv, message)
+	if err != nil {
+		return nil, ErrSigningFailed.WithDetails(err.Error())
+	}
+	return sig, nil
+}
+
+// VerifyWith checks an alg signature. An empty alg means Dilithium2.
+func VerifyWith(alg string, pub, message, signature []byte) error {
+	if pub == nil {
+		return ErrSignatureInvalid.WithDetails("public key is nil")
+	}
+	s, err := sigSchemeFor(alg)
+	if err != nil {
+		return ErrSignatureInvalid.WithDetails(err.Error())
+	}
+	if !s.verify(pub, message, signature) {
+		return ErrSignatureInvalid.WithDetails("INVALID SIGNATURE")
+	}
+	return nil
+}
+
+// GenKEMKeyFor generates a KEM key pair for alg.
+func GenKEMKeyFor(alg string) ([]byte, []byte, error) {
+	s, err := kemSchemeFor(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, priv, err := s.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	return marshalPair(pub, priv)
+}
+
+// KEMPublicKey returns the public half of a marshalled alg private key.
+func KEMPublicKey(alg string, priv []byte) ([]byte, error) {
+	s, err := kemSchemeFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := s.UnmarshalBinaryPrivateKey(priv)
+	if err != nil {
+		return nil, ErrBadKey.WithDetails(err.Error())
+	}
+	return sk.Public().MarshalBinary()
+}
+
+// Encapsulate generates a shared secret for the holder of an alg public key.
+func Encapsulate(alg string, pub []byte) (ct, shared []byte, err error) {
+	s, err := kemSchemeFor(alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := s.UnmarshalBinaryPublicKey(pub)
+	if err != nil {
+		return nil, nil, ErrBadKey.WithDetails(err.Error())
+	}
+	return s.Encapsulate(pk)
+}
+
+// Decapsulate recovers the shared secret from an Encapsulate ciphertext.
+func Decapsulate(alg string, priv, ct []byte) ([]byte, error) {
+	s, err := kemSchemeFor(alg)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := s.UnmarshalBinaryPrivateKey(priv)
+	if err != nil {
+		return nil, ErrBadKey.WithDetails(err.Error())
+	}
+	return s.Decapsulate(sk, ct)
+}
+
+// Negotiate returns the first algorithm of prefs that every peer supports,
+// or "" when they have none in common.
+func Negotiate(prefs []string, peers ...[]string) string {
+next:
+	for _, alg := range prefs {
+		for _, supported := range peers {
+			if !contains(supported, alg) {
+				continue next
+			}
+		}
+		return alg
+	}
+	return ""
+}
+
+func contains(algs []string, alg string) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+type binaryMarshaler interface {
+	MarshalBinary() ([]byte, error)
+}
+
+func marshalPair(pub, priv binaryMarshaler) ([]byte, []byte, error) {
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubBytes, privBytes, nil
+}
+
+// single is a plain circl signature scheme.
+type single struct{ sign.Scheme }
+
+func (s single) generate() ([]byte, []byte, error) {
+	pub, priv, err := s.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	return marshalPair(pub, priv)
+}
+
+func (s single) public(priv []byte) ([]byte, error) {
+	sk, err := s.UnmarshalBinaryPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return sk.Public().(sign.PublicKey).MarshalBinary()
+}
+
+func (s single) sign(priv, msg []byte) ([]byte, error) {
+	sk, err := s.UnmarshalBinaryPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(sk, msg, nil), nil
+}
+
+func (s single) verify(pub, msg, sig []byte) bool {
+	pk, err := s.UnmarshalBinaryPublicKey(pub)
+	if err != nil {
+		return false
+	}
+	return s.Verify(pk, msg, sig, nil)
+}
+
+// composite pairs a classical and a post-quantum scheme. Keys and signatures
+// are the classical part followed by the post-quantum part, and both
+// signatures cover the message prefixed with the algorithm identifier so
+// neither half can be lifted out and passed off on its own.
+type composite struct {
+	alg         string
+	classic, pq sign.Scheme
+}
+
+func (c composite) bind(msg []byte) []byte {
+	out := make([]byte, 0, len("hillside/")+len(c.alg)+1+len(msg))
+	out = append(out, "hillside/"...)
+	out = append(out, c.alg...)
+	out = append(out, 0)
+	return append(out, msg...)
+}
+
+func (c composite) generate() ([]byte, []byte, error) {
+	cPub, cPriv, err := single{c.classic}.generate()
+	if err != nil {
+		return nil, nil, err
+	}
+	qPub, qPriv, err := single{c.pq}.generate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(cPub, qPub...), append(cPriv, qPriv...), nil
+}
+
+func (c composite) public(priv []byte) ([]byte, error) {
+	n := c.classic.PrivateKeySize()
+	if len(priv) != n+c.pq.PrivateKeySize() {
+		return nil, ErrBadKey.WithDetails("wrong composite private key size")
+	}
+	cPub, err := single{c.classic}.public(priv[:n])
+	if err != nil {
+		return nil, err
+	}
+	qPub, err := single{c.pq}.public(priv[n:])
+	if err != nil {
+		return nil, err
+	}
+	return append(cPub, qPub...), nil
+}
+
+func (c composite) sign(priv, msg []byte) ([]byte, error) {
+	n := c.classic.PrivateKeySize()
+	if len(priv) != n+c.pq.PrivateKeySize() {
+		return nil, ErrBadKey.WithDetails("wrong composite private key size")
+	}
+	bound := c.bind(msg)
+	cSig, err := single{c.classic}.sign(priv[:n], bound)
+	if err != nil {
+		return nil, err
+	}
+	qSig, err := single{c.pq}.sign(priv[n:], bound)
+	if err != nil {
+		return nil, err
+	}
+	return append(cSig, qSig...), nil
+}
+
+func (c composite) verify(pub, msg, sig []byte) bool {
+	n, m := c.classic.PublicKeySize(), c.classic.SignatureSize()
+	if len(pub) != n+c.pq.PublicKeySize() || len(sig) != m+c.pq.SignatureSize() {
+		return false
+	}
+	bound := c.bind(msg)
+	return single{c.classic}.verify(pub[:n], bound, sig[:m]) &&
+		single{c.pq}.verify(pub[n:], bound, sig[m:])
+}
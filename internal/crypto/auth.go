@@ -1,9 +1,39 @@
 // Package crypto provides cryptographic utilities for the application (e.g., password hashing, encryption, signatures...)
 package crypto
 
-import "crypto/sha256"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
 
-func HashPassword(password string) []byte {
-	passHash := sha256.Sum256([]byte(password))
-	return passHash[:]
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordVerifier derives what the hub stores for a password protected server or room.
+// It is salted and slow to compute, so the hub never holds the password itself.
+func PasswordVerifier(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, 2, 19*1024, 1, 32)
+}
+
+// PasswordProof answers a hub challenge. The verifier never leaves the client:
+// the proof is bound to the hub's single-use nonce, the joining peer and the target,
+// so a captured proof can't be replayed.
+func PasswordProof(verifier, nonce []byte, peerID, serverID, roomID string) []byte {
+	mac := hmac.New(sha256.New, verifier)
+	mac.Write(nonce)
+	for _, field := range []string{peerID, serverID, roomID} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(field)))
+		mac.Write(n[:])
+		mac.Write([]byte(field))
+	}
+	return mac.Sum(nil)
+}
+
+// CheckPasswordProof recomputes the proof from the stored verifier and compares it in constant time.
+func CheckPasswordProof(verifier, nonce, proof []byte, peerID, serverID, roomID string) bool {
+	if len(verifier) == 0 || len(nonce) == 0 {
+		return false
+	}
+	return hmac.Equal(proof, PasswordProof(verifier, nonce, peerID, serverID, roomID))
 }
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	chacha "golang.org/x/crypto/chacha20poly1305"
+)
+
+// BlobChunkSize is the plaintext size of each chunk of an encrypted blob, the
+// last one may be shorter.
+const BlobChunkSize = 64 * 1024
+
+// sealedChunkSize is the size of a full chunk once sealed.
+const sealedChunkSize = BlobChunkSize + chacha.Overhead
+
+// NewBlobKey returns a random key for EncryptBlob. Each blob has its own, so
+// chunk nonces can simply count from zero.
+func NewBlobKey() ([]byte, error) {
+	key := make([]byte, chacha.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// BlobHash is the content address of a blob: the hex SHA-256 of its ciphertext.
+func BlobHash(ct []byte) string {
+	sum := sha256.Sum256(ct)
+	return hex.EncodeToString(sum[:])
+}
+
+// EncryptBlob seals r under key into w, chunk by chunk, and returns the size
+// and BlobHash of the ciphertext. Each chunk is sealed with its index as nonce
+// and whether it is the last as associated data, so chunks can neither be
+// reordered nor dropped from the end.
+func EncryptBlob(r io.Reader, w io.Writer, key []byte) (int64, string, error) {
+	aead, err := chacha.New(key)
+	if err != nil {
+		return 0, "", ErrBadKey.WithDetails(err.Error())
+	}
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(w, h)}
+	br := bufio.NewReaderSize(r, BlobChunkSize)
+	buf := make([]byte, BlobChunkSize)
+	out := make([]byte, 0, sealedChunkSize)
+	for i := uint64(0); ; i++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, "", err
+		}
+		_, peek := br.Peek(1)
+		last := n < BlobChunkSize || peek != nil
+		out = aead.Seal(out[:0], chunkNonce(i), buf[:n], chunkAD(last))
+		if _, err := cw.Write(out); err != nil {
+			return 0, "", err
+		}
+		if last {
+			break
+		}
+	}
+	return cw.n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DecryptBlob opens a blob sealed by EncryptBlob from r into w. It fails if a
+// chunk was tampered with or the blob was cut short.
+func DecryptBlob(r io.Reader, w io.Writer, key []byte) error {
+	aead, err := chacha.New(key)
+	if err != nil {
+		return ErrBadKey.WithDetails(err.Error())
+	}
+	br := bufio.NewReaderSize(r, sealedChunkSize)
+	buf := make([]byte, sealedChunkSize)
+	out := make([]byte, 0, BlobChunkSize)
+	for i := uint64(0); ; i++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if errors.Is(err, io.EOF) {
+				return ErrDecryptionFailed.WithDetails("blob is truncated")
+			}
+			return err
+		}
+		_, peek := br.Peek(1)
+		last := peek != nil
+		if out, err = aead.Open(out[:0], chunkNonce(i), buf[:n], chunkAD(last)); err != nil {
+			return ErrDecryptionFailed.WithDetails(err.Error())
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func chunkNonce(i uint64) []byte {
+	nonce := make([]byte, chacha.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha.NonceSize-8:], i)
+	return nonce
+}
+
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
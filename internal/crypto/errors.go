@@ -7,4 +7,8 @@ var (
 	ErrSigningFailed    = utils.NewHillsideError("signing failed")
 	ErrSignatureInvalid = utils.NewHillsideError("signature invalid")
 	ErrBadKey           = utils.NewHillsideError("invalid key provided")
+	ErrUnsupportedAlg   = utils.NewHillsideError("unsupported algorithm")
+	ErrMessageTooLong   = utils.NewHillsideError("message too long")
+	ErrBadPadding       = utils.NewHillsideError("invalid message padding")
+	ErrDecryptionFailed = utils.NewHillsideError("decryption failed")
 )
@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	KDFArgon2id = "argon2id"
+
+	// KDFVersionLegacy is the original derivation with hard-coded costs and a
+	// separate, cheaper Argon2 run for the password checksum.
+	KDFVersionLegacy = 1
+	// KDFVersionCurrent derives key and checksum from a single Argon2id run.
+	KDFVersionCurrent = 2
+
+	kdfSaltSize = 16
+)
+
+// KDFParams describes how a password was turned into a key, so the costs can be
+// raised later without breaking existing profiles.
+type KDFParams struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB
+	Threads   uint8  `json:"threads"`
+	Salt      []byte `json:"salt"`
+}
+
+// NewKDFParams returns the current parameters with a fresh random salt.
+func NewKDFParams() (*KDFParams, error) {
+	salt := make([]byte, kdfSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &KDFParams{
+		Version:   KDFVersionCurrent,
+		Algorithm: KDFArgon2id,
+		Time:      3,
+		Memory:    64 * 1024,
+		Threads:   4,
+		Salt:      salt,
+	}, nil
+}
+
+// LegacyKDFParams describes profiles created before the parameters were stored.
+// Their salt was lost to a bug, so it is usually nil.
+func LegacyKDFParams(salt []byte) *KDFParams {
+	return &KDFParams{
+		Version:   KDFVersionLegacy,
+		Algorithm: KDFArgon2id,
+		Time:      1,
+		Memory:    64 * 1024,
+		Threads:   4,
+		Salt:      salt,
+	}
+}
+
+// Derive returns the key sealing the profile and a checksum that lets a wrong
+// password be rejected before any decryption is attempted.
+func (p *KDFParams) Derive(pass string) (passkey []byte, checksum []byte, err error) {
+	if p.Algorithm != KDFArgon2id {
+		return nil, nil, ErrBadKey.WithDetails("unsupported KDF " + p.Algorithm)
+	}
+	switch p.Version {
+	case KDFVersionLegacy:
+		passkey = argon2.IDKey([]byte(pass), p.Salt, p.Time, p.Memory, p.Threads, 32)
+		checksum = argon2.IDKey([]byte(pass), p.Salt, 3, 8*1024, 2, 32)
+		return passkey, checksum, nil
+	case KDFVersionCurrent:
+		out := argon2.IDKey([]byte(pass), p.Salt, p.Time, p.Memory, p.Threads, 64)
+		sum := sha256.Sum256(out[32:])
+		return out[:32], sum[:], nil
+	default:
+		return nil, nil, ErrBadKey.WithDetails("unsupported KDF version")
+	}
+}
+
+// CheckPasswordChecksum compares checksums in constant time.
+func CheckPasswordChecksum(got, want []byte) bool {
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/cloudflare/circl/sign/dilithium/mode2"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
-	"golang.org/x/crypto/argon2"
 	chacha "golang.org/x/crypto/chacha20poly1305"
 )
 
@@ -24,18 +23,6 @@ func GenerateRoomKey() ([]byte, []byte, error) {
 	return key, hash[:], nil
 }
 
-func GenPasskeys(pass string, salt []byte) ([]byte, []byte, []byte, error) {
-	if salt == nil {
-		salt := make([]byte, 16)
-		if _, err := rand.Read(salt); err != nil {
-			return nil, nil, nil, err
-		}
-	}
-	passkey := argon2.IDKey([]byte(pass), salt, 1, 64*1024, 4, 32)
-	unlocker := argon2.IDKey([]byte(pass), salt, 3, 8*1024, 2, 32)
-	return passkey, unlocker, salt, nil
-}
-
 func GenKEMKey() ([]byte, []byte, error) {
 	pub, priv, err := kyber.GenerateKeyPair(rand.Reader)
 	if err != nil {
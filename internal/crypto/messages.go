@@ -40,7 +40,13 @@ func ValidateSignature(pubKeyBlob, message, signature []byte) error {
 	return nil
 }
 
+// EncryptMessage pads plaintext with PadMessage and seals it under the next
+// ratchet key. The ratchet only advances if the plaintext fits.
 func EncryptMessage(r *RoomRatchet, plaintext []byte) (ciphertext, nonce []byte, err error) {
+	padded, err := PadMessage(plaintext)
+	if err != nil {
+		return nil, nil, ErrEncryptionFailed.WithDetails(err.Error())
+	}
 	key, nonce, err := r.NextKey()
 	if err != nil {
 		return nil, nil, ErrEncryptionFailed.WithDetails(err.Error())
@@ -49,7 +55,48 @@ func EncryptMessage(r *RoomRatchet, plaintext []byte) (ciphertext, nonce []byte,
 	if err != nil {
 		return nil, nil, ErrEncryptionFailed.WithDetails(err.Error())
 	}
-	ct := aead.Seal(nil, nonce, plaintext, nil)
+	ct := aead.Seal(nil, nonce, padded, nil)
 	return ct, nonce, nil
 
 }
+
+// OpenMessage decrypts the ciphertext sent at chain index, advancing r to
+// it. Keys before r's index are gone, so earlier messages can't be opened.
+func OpenMessage(r *RoomRatchet, index uint64, ciphertext []byte, padded bool) ([]byte, error) {
+	key, nonce, err := MessageKeyAt(r, index)
+	if err != nil {
+		return nil, err
+	}
+	return OpenMessageWithKey(key, nonce, ciphertext, padded)
+}
+
+// MessageKeyAt returns the message key and nonce of chain index, advancing r
+// past it like OpenMessage.
+func MessageKeyAt(r *RoomRatchet, index uint64) (key, nonce []byte, err error) {
+	if index < r.Index {
+		return nil, nil, ErrDecryptionFailed.WithDetails("key already erased")
+	}
+	for r.Index <= index {
+		if key, nonce, err = r.NextKey(); err != nil {
+			return nil, nil, ErrDecryptionFailed.WithDetails(err.Error())
+		}
+	}
+	return key, nonce, nil
+}
+
+// OpenMessageWithKey decrypts a ciphertext with the message key and nonce of
+// its chain index, which open that one message and no other.
+func OpenMessageWithKey(key, nonce, ciphertext []byte, padded bool) ([]byte, error) {
+	aead, err := chacha.New(key)
+	if err != nil {
+		return nil, ErrDecryptionFailed.WithDetails(err.Error())
+	}
+	pt, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed.WithDetails(err.Error())
+	}
+	if !padded {
+		return pt, nil
+	}
+	return UnpadMessage(pt)
+}
@@ -0,0 +1,34 @@
+package crypto
+
+// PadBuckets are the sizes message plaintexts are padded up to before
+// encryption, so a ciphertext only reveals which bucket its message fits in.
+var PadBuckets = []int{256, 1024, 4096, 16384}
+
+// MaxPaddedLen is the largest padded plaintext, the last bucket.
+var MaxPaddedLen = PadBuckets[len(PadBuckets)-1]
+
+// PadMessage appends 0x80 and zeros (ISO/IEC 7816-4) up to the smallest
+// bucket that fits pt. Plaintexts of MaxPaddedLen or more are refused.
+func PadMessage(pt []byte) ([]byte, error) {
+	for _, size := range PadBuckets {
+		if len(pt) < size {
+			out := make([]byte, size)
+			copy(out, pt)
+			out[len(pt)] = 0x80
+			return out, nil
+		}
+	}
+	return nil, ErrMessageTooLong
+}
+
+// UnpadMessage strips the padding added by PadMessage.
+func UnpadMessage(padded []byte) ([]byte, error) {
+	i := len(padded) - 1
+	for i >= 0 && padded[i] == 0 {
+		i--
+	}
+	if i < 0 || padded[i] != 0x80 {
+		return nil, ErrBadPadding
+	}
+	return padded[:i], nil
+}
@@ -1,82 +1,71 @@
 package crypto
 
-// RekeyEntry is one per-peer encapsulation of the new room key.
-/* TODO: Some time in the future
-*
-func (n *Node) RotateRoomKey(serverID, roomID string, memberPeers []models.User, sender models.User, sigPK *mode2.PrivateKey) error {
-	// 1) generate a new room key
+import (
+	"crypto/sha256"
+	"io"
 
-	msg := models.RekeyMessage{Entries: make([]models.RekeyEntry, 0, len(memberPeers))}
-	seed := make([]byte, kyber1024.EncapsulationSeedSize)
-	if _, err := rand.Read(seed[:]); err != nil {
-		return fmt.Errorf("failed to generate random seed for rekey: %w", err)
-	}
+	"golang.org/x/crypto/hkdf"
+)
 
-	for _, user := range memberPeers {
-		// look up their Kyber public key in your Node (you must have stored it somewhere)
-		pid := peer.ID(user.PeerID)
-		pubkey := user.KyberPub
-		kyberPub, err := kyber1024.Scheme().UnmarshalBinaryPublicKey(pubkey)
-		if err != nil {
-			return fmt.Errorf("failed to unmarshal kyber public key for %s: %w", pid, err)
-		}
+// peerKeyDomain separates keys wrapped for one peer from other uses of a KEM
+// shared secret, and the algorithm is bound in too so a ciphertext can't be
+// replayed under another one.
+const peerKeyDomain = "hillside/peer-key/"
 
-		ct, _, err := kyber1024.Scheme().EncapsulateDeterministically(kyberPub, seed)
-		if err != nil {
-			return fmt.Errorf("failed to encapsulate key for %s: %w", pid, err)
-		}
-		msg.Entries = append(msg.Entries, models.RekeyEntry{
-			PeerID: pid.String(),
-			Ciph:   ct,
-		})
+func peerWrappingKey(alg string, shared []byte) ([]byte, error) {
+	if alg == "" {
+		alg = KEMAlgKyber1024
+	}
+	key := make([]byte, 32)
+	r := hkdf.New(sha256.New, shared, nil, []byte(peerKeyDomain+alg))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
 	}
+	return key, nil
+}
 
-	// 3) marshal and publish
-	data, _, err := models.Marshal(&msg, sender, sigPK)
+// WrapKeyFor encrypts key, a room or ratchet key, for the holder of an alg
+// KEM public key. kemCT is sent along for Decapsulate.
+func WrapKeyFor(alg string, pub, key []byte) (kemCT, wrapped []byte, err error) {
+	kemCT, shared, err := Encapsulate(alg, pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	wk, err := peerWrappingKey(alg, shared)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := DeriveChaChaKey(wk)
 	if err != nil {
-		return fmt.Errorf("failed to marshal rekey message: %w", err)
+		return nil, nil, err
 	}
-	rkt, err := n.PS.Join(RekeyTopic(serverID, roomID))
+	wrapped, err = SealAEAD(key, aead)
 	if err != nil {
-		return fmt.Errorf("failed to join rekey topic: %w", err)
+		return nil, nil, err
 	}
-	return rkt.Publish(n.Ctx, data)
+	return kemCT, wrapped, nil
 }
 
-// ListenForRekeys subscribes to the room’s rekey topic and updates n.RoomKey
-// whenever there’s a RekeyMessage addressed to this node.
-func (n *Node) ListenForRekeys(serverID, roomID string, pk *kyber1024.PrivateKey) error {
-
-	sub, err := n.Topics.RekeyTopic.Subscribe()
+// UnwrapKeyFrom reverses WrapKeyFor with the alg private key.
+func UnwrapKeyFrom(alg string, priv, kemCT, wrapped []byte) ([]byte, error) {
+	shared, err := Decapsulate(alg, priv, kemCT)
 	if err != nil {
-		return fmt.Errorf("failed to subscribe to rekey topic: %w", err)
+		return nil, ErrBadKey.WithDetails(err.Error())
 	}
-
-	go func() {
-		for {
-			msg, err := sub.Next(n.Ctx)
-			if err != nil {
-				return
-			}
-			var rk models.RekeyMessage
-			if err := json.Unmarshal(msg.Data, &rk); err != nil {
-				continue
-			}
-			// find our entry
-			ourID := n.Host.ID().String()
-			for _, e := range rk.Entries {
-				if e.PeerID == ourID {
-					_, err := kyber1024.Scheme().Decapsulate(pk, e.Ciph)
-					if err != nil {
-						continue
-					}
-					// reset your RoomRatchet with this key
-					// TODO: n.RoomRatchet = NewRoomRatchet(newKey)
-					break
-				}
-			}
-		}
-	}()
-	return nil
+	wk, err := peerWrappingKey(alg, shared)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := DeriveChaChaKey(wk)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrBadKey.WithDetails("wrapped key too short")
+	}
+	key, err := OpenAEAD(wrapped, aead)
+	if err != nil {
+		return nil, ErrDecryptionFailed.WithDetails("key was not wrapped for us")
+	}
+	return key, nil
 }
-*/
@@ -0,0 +1,39 @@
+package crypto
+
+import "golang.org/x/crypto/argon2"
+
+// roomKeyDomain separates the wrapping key from PasswordVerifier, which the hub stores,
+// even though both are derived from the same password and salt.
+const roomKeyDomain = "hillside/room-key/"
+
+// RoomKeyWrappingKey derives the Argon2id key protecting a room's initial ratchet key.
+func RoomKeyWrappingKey(password string, salt []byte) []byte {
+	domainSalt := append([]byte(roomKeyDomain), salt...)
+	return argon2.IDKey([]byte(password), domainSalt, 3, 64*1024, 4, 32)
+}
+
+// WrapRoomKey encrypts the initial room key under the room password.
+// The result is what gets stored in RoomMeta.EncRoomKey.
+func WrapRoomKey(roomKey []byte, password string, salt []byte) ([]byte, error) {
+	aead, err := DeriveChaChaKey(RoomKeyWrappingKey(password, salt))
+	if err != nil {
+		return nil, err
+	}
+	return SealAEAD(roomKey, aead)
+}
+
+// UnwrapRoomKey reverses WrapRoomKey. A wrong password fails authentication.
+func UnwrapRoomKey(wrapped []byte, password string, salt []byte) ([]byte, error) {
+	aead, err := DeriveChaChaKey(RoomKeyWrappingKey(password, salt))
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrBadKey.WithDetails("wrapped room key too short")
+	}
+	key, err := OpenAEAD(wrapped, aead)
+	if err != nil {
+		return nil, ErrBadKey.WithDetails("wrong room password")
+	}
+	return key, nil
+}
@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// SearchIndexKey derives the key blinding the local search index from a
+// secret of the user's keybag, so the index means nothing without the
+// unlocked profile.
+func SearchIndexKey(secret []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	hk := hkdf.New(sha256.New, secret, nil, []byte("hillside search index"))
+	if _, err := io.ReadFull(hk, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// SearchTokens splits text into lowercase words and blinds each one with an
+// HMAC under key, once each, in order of first appearance. The index only
+// holds these, so it reveals which messages share words but not the words;
+// a query is blinded the same way to look them up.
+func SearchTokens(key []byte, text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if seen[w] {
+			continue
+		}
+		seen[w] = true
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(w))
+		tokens = append(tokens, "t"+hex.EncodeToString(mac.Sum(nil)[:12]))
+	}
+	return tokens
+}
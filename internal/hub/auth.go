@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"crypto/rand"
+	"log"
+	"sync"
+	"time"
+
+	"hillside/internal/crypto"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	challengeTTL       = 30 * time.Second
+	challengeNonceSize = 32
+	// maxPendingChallenges bounds memory if many peers request challenges and never answer
+	maxPendingChallenges = 4096
+)
+
+type challenge struct {
+	nonce   []byte
+	expires time.Time
+}
+
+// ChallengeStore hands out the nonces password proofs are computed over.
+// There is at most one pending nonce per (peer, server, room) and it can only be used once.
+type ChallengeStore struct {
+	mu      sync.Mutex
+	pending map[string]challenge
+	now     func() time.Time
+}
+
+func NewChallengeStore() *ChallengeStore {
+	return &ChallengeStore{
+		pending: make(map[string]challenge),
+		now:     time.Now,
+	}
+}
+
+func challengeKey(p peer.ID, serverID, roomID string) string {
+	return p.String() + "/" + serverID + "/" + roomID
+}
+
+// Issue creates a fresh nonce for p, replacing any earlier one for the same target.
+func (cs *ChallengeStore) Issue(p peer.ID, serverID, roomID string) ([]byte, error) {
+	nonce := make([]byte, challengeNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := cs.now()
+	if len(cs.pending) >= maxPendingChallenges {
+		for k, c := range cs.pending {
+			if now.After(c.expires) {
+				delete(cs.pending, k)
+			}
+		}
+		if len(cs.pending) >= maxPendingChallenges {
+			return nil, ErrRateLimited
+		}
+	}
+	cs.pending[challengeKey(p, serverID, roomID)] = challenge{nonce: nonce, expires: now.Add(challengeTTL)}
+	return nonce, nil
+}
+
+// Take returns and forgets the pending nonce for p, or nil if there is none or it expired.
+func (cs *ChallengeStore) Take(p peer.ID, serverID, roomID string) []byte {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := challengeKey(p, serverID, roomID)
+	c, ok := cs.pending[key]
+	if !ok {
+		return nil
+	}
+	delete(cs.pending, key)
+	if cs.now().After(c.expires) {
+		return nil
+	}
+	return c.nonce
+}
+
+// checkPasswordProof verifies a join proof against the stored verifier.
+// Wrong proofs are throttled per peer through PasswordFailureLimit.
+func (s *HubServer) checkPasswordProof(p peer.ID, serverID, roomID string, verifier, proof []byte) error {
+	if !s.Limiter.Peek(p, PasswordFailureLimit) {
+		return ErrTooManyAttempts
+	}
+	nonce := s.Challenges.Take(p, serverID, roomID)
+	if crypto.CheckPasswordProof(verifier, nonce, proof, p.String(), serverID, roomID) {
+		return nil
+	}
+	if !s.Limiter.Allow(p, PasswordFailureLimit) {
+		s.penalize(p)
+	}
+	log.Printf("[HUB] Wrong password proof from %s for %s/%s", p.String(), serverID, roomID)
+	return ErrInvalidPassword
+}
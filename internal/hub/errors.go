@@ -3,5 +3,21 @@ package hub
 import "hillside/internal/utils"
 
 var (
-	ErrDuplicateID = utils.NewHillsideError("duplicate ID detected")
+	ErrDuplicateID        = utils.NewHillsideError("duplicate ID detected")
+	ErrRateLimited        = utils.NewHillsideError("rate limit exceeded")
+	ErrFieldTooLong       = utils.NewHillsideError("field exceeds maximum length")
+	ErrServerLimitReached = utils.NewHillsideError("server limit reached for owner")
+	ErrRoomLimitReached   = utils.NewHillsideError("room limit reached for server")
+	ErrOwnerMismatch      = utils.NewHillsideError("server is owned by another peer")
+	ErrInvalidServer      = utils.NewHillsideError("malformed server")
+	ErrNotFederated       = utils.NewHillsideError("peer is not a federated hub")
+	ErrNotOwner           = utils.NewHillsideError("only the server owner can do this")
+	ErrInviteLimitReached = utils.NewHillsideError("invite limit reached for server")
+	ErrInviteNotFound     = utils.NewHillsideError("invite not found")
+	ErrInviteExpired      = utils.NewHillsideError("invite expired")
+	ErrInviteExhausted    = utils.NewHillsideError("invite has no uses left")
+	ErrInviteRevoked      = utils.NewHillsideError("invite revoked")
+	ErrInviteWrongPeer    = utils.NewHillsideError("invite is bound to another peer")
+	ErrInvalidPassword    = utils.NewHillsideError("invalid password")
+	ErrTooManyAttempts    = utils.NewHillsideError("too many failed password attempts")
 )
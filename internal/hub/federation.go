@@ -0,0 +1,236 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	FederationProtocolID = "/hillside/hub/federation/1.0.0"
+
+	// MaxFederationBytes bounds a directory snapshot exchanged between hubs
+	MaxFederationBytes = 8 * 1024 * 1024
+	// federationSyncInterval is how often a full snapshot is pulled from every peer hub,
+	// to repair anything a missed push left behind
+	federationSyncInterval = time.Minute
+)
+
+// Federation holds the hubs this hub replicates its server directory with.
+// Snapshots include password hashes, so they only travel over direct streams
+// between the configured peers and never over pubsub. Peers are trusted with
+// rooms but not with server fields, see HubStore.Merge; room members and
+// invite grants are not replicated.
+type Federation struct {
+	mu    sync.RWMutex
+	peers map[peer.ID]peer.AddrInfo
+}
+
+func NewFederation(peers []peer.AddrInfo) *Federation {
+	f := &Federation{peers: make(map[peer.ID]peer.AddrInfo, len(peers))}
+	for _, pi := range peers {
+		f.peers[pi.ID] = pi
+	}
+	return f
+}
+
+// IsPeer reports whether id belongs to a federated hub.
+func (f *Federation) IsPeer(id peer.ID) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.peers[id]
+	return ok
+}
+
+// Peers returns the federated hubs.
+func (f *Federation) Peers() []peer.AddrInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]peer.AddrInfo, 0, len(f.peers))
+	for _, pi := range f.peers {
+		out = append(out, pi)
+	}
+	return out
+}
+
+// EnableFederation starts replicating the server directory with the given hubs.
+// Federation is symmetric: every hub listed here must list this hub as well.
+func (s *HubServer) EnableFederation(peers []peer.AddrInfo) {
+	s.Federation = NewFederation(peers)
+	s.Host.SetStreamHandler(FederationProtocolID, s.handleFederation)
+	log.Printf("[HUB] Federation enabled with %d peer hubs", len(peers))
+	go s.syncFederation()
+}
+
+func (s *HubServer) syncFederation() {
+	ticker := time.NewTicker(federationSyncInterval)
+	defer ticker.Stop()
+	for {
+		for _, pi := range s.Federation.Peers() {
+			if err := s.pullSnapshot(pi); err != nil {
+				log.Printf("[HUB] FED ERROR: Snapshot from %s failed: %v", pi.ID.String(), err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-s.Ctx.Done():
+			return
+		}
+	}
+}
+
+// federationCall sends a single request to a peer hub and decodes its response.
+func (s *HubServer) federationCall(pi peer.AddrInfo, req models.FederationRequest) (*models.FederationResponse, error) {
+	ctx, cancel := context.WithTimeout(s.Ctx, RPCStreamDeadline)
+	defer cancel()
+
+	if err := s.Host.Connect(ctx, pi); err != nil {
+		return nil, err
+	}
+	stream, err := s.Host.NewStream(ctx, pi.ID, FederationProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(RPCStreamDeadline))
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp models.FederationResponse
+	if err := json.NewDecoder(io.LimitReader(stream, MaxFederationBytes)).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, ErrNotFederated.WithDetails(resp.Error)
+	}
+	return &resp, nil
+}
+
+func (s *HubServer) pullSnapshot(pi peer.AddrInfo) error {
+	resp, err := s.federationCall(pi, models.FederationRequest{Method: "Snapshot"})
+	if err != nil {
+		return err
+	}
+	s.mergeServers(pi.ID, resp.Servers)
+	return nil
+}
+
+// pushToFederation sends the current state of a server to every peer hub.
+func (s *HubServer) pushToFederation(serverID string) {
+	if s.Federation == nil {
+		return
+	}
+	server, err := s.Store.SnapshotServer(serverID)
+	if err != nil {
+		return
+	}
+	req := models.FederationRequest{Method: "Push", Servers: []models.ServerMeta{server}}
+	for _, pi := range s.Federation.Peers() {
+		if _, err := s.federationCall(pi, req); err != nil {
+			log.Printf("[HUB] FED ERROR: Push of server %s to %s failed: %v", serverID, pi.ID.String(), err)
+		}
+	}
+}
+
+func (s *HubServer) mergeServers(from peer.ID, servers []models.ServerMeta) {
+	for i := range servers {
+		changed, err := s.Store.Merge(&servers[i])
+		if err != nil {
+			log.Printf("[HUB] FED ERROR: Merge of server %s from %s failed: %v", servers[i].ID, from.String(), err)
+			continue
+		}
+		if changed {
+			go s.AdvertiseNewServer()
+			go s.AdvertiseNewRoom(servers[i].ID)
+		}
+	}
+}
+
+// handleFederation serves Snapshot and Push requests from peer hubs.
+func (s *HubServer) handleFederation(stream network.Stream) {
+	remotePeer := stream.Conn().RemotePeer()
+	defer stream.Close()
+
+	encoder := json.NewEncoder(stream)
+	if s.Federation == nil || !s.Federation.IsPeer(remotePeer) {
+		log.Printf("[HUB] FED: Rejected stream from unknown peer %s", remotePeer.String())
+		encoder.Encode(models.FederationResponse{Error: ErrNotFederated.Error()})
+		s.penalize(remotePeer)
+		return
+	}
+	_ = stream.SetDeadline(time.Now().Add(RPCStreamDeadline))
+
+	var req models.FederationRequest
+	if err := json.NewDecoder(io.LimitReader(stream, MaxFederationBytes)).Decode(&req); err != nil {
+		log.Printf("[HUB] FED ERROR: Failed to decode request from %s: %v", remotePeer.String(), err)
+		return
+	}
+
+	switch req.Method {
+	case "Snapshot":
+		servers := s.Store.Snapshot()
+		log.Printf("[HUB] FED: Sending snapshot of %d servers to %s", len(servers), remotePeer.String())
+		encoder.Encode(models.FederationResponse{Servers: servers})
+	case "Push":
+		log.Printf("[HUB] FED: Received %d servers from %s", len(req.Servers), remotePeer.String())
+		s.mergeServers(remotePeer, req.Servers)
+		encoder.Encode(models.FederationResponse{})
+	default:
+		encoder.Encode(models.FederationResponse{Error: "unknown method"})
+	}
+}
+
+// watchDirectory applies owner-signed records published on the directory topic,
+// so owners can update their servers on every hub even when their own hub is gone.
+func (s *HubServer) watchDirectory() error {
+	if err := s.PS.RegisterTopicValidator(p2p.DirectoryTopic(), p2p.DirectoryValidator); err != nil {
+		return err
+	}
+	top, err := s.PS.Join(p2p.DirectoryTopic())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.topicCache[p2p.DirectoryTopic()] = top
+	s.mu.Unlock()
+	sub, err := top.Subscribe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			msg, err := sub.Next(s.Ctx)
+			if err != nil {
+				return
+			}
+			var rec models.DirectoryRecord
+			if err := json.Unmarshal(msg.Data, &rec); err != nil {
+				continue
+			}
+			entry, err := p2p.OpenDirectoryRecord(&rec)
+			if err != nil {
+				continue
+			}
+			changed, err := s.Store.ApplyDirectoryEntry(entry)
+			if err != nil {
+				log.Printf("[HUB] ERROR: Directory record for %s rejected: %v", entry.Server.ID, err)
+				continue
+			}
+			if changed {
+				go s.AdvertiseNewServer()
+				go s.AdvertiseNewRoom(entry.Server.ID)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// BlockGater is a libp2p ConnectionGater that refuses connections from
+// temporarily blocked peers. Blocks expire on their own.
+type BlockGater struct {
+	mu      sync.RWMutex
+	blocked map[peer.ID]time.Time // key: peer ID, value: block expiry
+}
+
+func NewBlockGater() *BlockGater {
+	return &BlockGater{
+		blocked: make(map[peer.ID]time.Time),
+	}
+}
+
+// Block refuses any connection to or from p for the given duration.
+func (g *BlockGater) Block(p peer.ID, d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.blocked[p] = time.Now().Add(d)
+	log.Printf("[GATER] Blocked peer %s for %v", p.String(), d)
+}
+
+// Unblock lifts a block early.
+func (g *BlockGater) Unblock(p peer.ID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.blocked, p)
+}
+
+// IsBlocked reports whether p is currently blocked, dropping expired entries.
+func (g *BlockGater) IsBlocked(p peer.ID) bool {
+	g.mu.RLock()
+	until, ok := g.blocked[p]
+	g.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		g.Unblock(p)
+		return false
+	}
+	return true
+}
+
+func (g *BlockGater) InterceptPeerDial(p peer.ID) bool {
+	return !g.IsBlocked(p)
+}
+
+func (g *BlockGater) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return !g.IsBlocked(p)
+}
+
+func (g *BlockGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *BlockGater) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.IsBlocked(p)
+}
+
+func (g *BlockGater) InterceptUpgraded(network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,214 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/utils"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// inviteState is the hub-side bookkeeping of an issued invite.
+type inviteState struct {
+	invite  models.Invite
+	uses    int
+	revoked bool
+}
+
+// live reports whether the invite can still be redeemed by someone.
+func (st *inviteState) live(now time.Time) bool {
+	inv := st.invite
+	return !st.revoked &&
+		(inv.ExpiresAt == 0 || now.Unix() < inv.ExpiresAt) &&
+		(inv.MaxUses == 0 || st.uses < inv.MaxUses)
+}
+
+func grantKey(serverID, roomID string) string {
+	return serverID + "/" + roomID
+}
+
+// AddInvite registers an invite. Only the owner of the server may issue one,
+// and each server has at most MaxInvitesPerServer live invites.
+func (hs *HubStore) AddInvite(inv *models.Invite) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	server, exists := hs.servers[inv.ServerID]
+	if !exists {
+		return models.ErrServerNotFound
+	}
+	if server.OwnerPeerID != inv.IssuedBy {
+		return ErrNotOwner
+	}
+	if inv.RoomID != "" && server.Rooms[inv.RoomID] == nil {
+		return models.ErrRoomNotFound
+	}
+	if _, exists := hs.invites[inv.ID]; exists {
+		return ErrDuplicateID
+	}
+
+	now := time.Now()
+	live := 0
+	for id, st := range hs.invites {
+		if !st.live(now) {
+			delete(hs.invites, id)
+			continue
+		}
+		if st.invite.ServerID == inv.ServerID {
+			live++
+		}
+	}
+	if live >= MaxInvitesPerServer {
+		log.Printf("[STORE] AddInvite failed - Server %s already has %d invites", inv.ServerID, live)
+		return ErrInviteLimitReached
+	}
+
+	hs.invites[inv.ID] = &inviteState{invite: *inv}
+	log.Printf("[STORE] Invite %s added for server %s room %q", inv.ID, inv.ServerID, inv.RoomID)
+	return nil
+}
+
+// RedeemInvite checks an invite against its expiry, use count, revocation and peer binding,
+// then admits p to the server and, if the invite names one, the room.
+// Redeeming again after being admitted doesn't consume another use.
+func (hs *HubStore) RedeemInvite(inviteID string, p string, now time.Time) (*models.Invite, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	st, exists := hs.invites[inviteID]
+	if !exists {
+		return nil, ErrInviteNotFound
+	}
+	inv := st.invite
+	if st.revoked {
+		return nil, ErrInviteRevoked
+	}
+	if inv.BoundPeerID != "" && inv.BoundPeerID != p {
+		return nil, ErrInviteWrongPeer
+	}
+	if _, ok := hs.grants[grantKey(inv.ServerID, inv.RoomID)][p]; ok {
+		return &inv, nil
+	}
+	if inv.ExpiresAt != 0 && now.Unix() >= inv.ExpiresAt {
+		return nil, ErrInviteExpired
+	}
+	if inv.MaxUses != 0 && st.uses >= inv.MaxUses {
+		return nil, ErrInviteExhausted
+	}
+
+	st.uses++
+	hs.grant(grantKey(inv.ServerID, ""), p)
+	if inv.RoomID != "" {
+		hs.grant(grantKey(inv.ServerID, inv.RoomID), p)
+	}
+	log.Printf("[STORE] Invite %s redeemed by %s (%d uses)", inv.ID, p, st.uses)
+	return &inv, nil
+}
+
+func (hs *HubStore) grant(key, p string) {
+	peers, ok := hs.grants[key]
+	if !ok {
+		peers = make(map[string]struct{})
+		hs.grants[key] = peers
+	}
+	peers[p] = struct{}{}
+}
+
+// RevokeInvite stops an invite from being redeemed again. Peers already admitted keep access.
+func (hs *HubStore) RevokeInvite(inviteID string, requester string) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	st, exists := hs.invites[inviteID]
+	if !exists {
+		return ErrInviteNotFound
+	}
+	if st.invite.IssuedBy != requester {
+		return ErrNotOwner
+	}
+	st.revoked = true
+	log.Printf("[STORE] Invite %s revoked", inviteID)
+	return nil
+}
+
+// IsAdmitted reports whether p may enter a server (roomID empty) or room
+// whatever its visibility: either p owns the server or redeemed an invite for it.
+func (hs *HubStore) IsAdmitted(serverID, roomID, p string) bool {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	if server, ok := hs.servers[serverID]; ok && server.OwnerPeerID == p {
+		return true
+	}
+	_, ok := hs.grants[grantKey(serverID, roomID)][p]
+	return ok
+}
+
+func (s *HubServer) createInvite(remotePeer peer.ID, req models.CreateInviteRequest) models.CreateInviteResponse {
+	if req.MaxUses < 0 {
+		return models.CreateInviteResponse{Error: "max uses cannot be negative"}
+	}
+	if req.ExpiresAt != 0 && req.ExpiresAt <= time.Now().Unix() {
+		return models.CreateInviteResponse{Error: "expiry is in the past"}
+	}
+	if req.BoundPeerID != "" {
+		if _, err := peer.Decode(req.BoundPeerID); err != nil {
+			return models.CreateInviteResponse{Error: "invalid bound peer ID"}
+		}
+	}
+
+	inv := &models.Invite{
+		HubPeerID:   s.Host.ID().String(),
+		ServerID:    req.ServerID,
+		RoomID:      req.RoomID,
+		IssuedBy:    remotePeer.String(),
+		ExpiresAt:   req.ExpiresAt,
+		MaxUses:     req.MaxUses,
+		BoundPeerID: req.BoundPeerID,
+	}
+	for {
+		inv.ID = utils.GenerateRandomID()
+		err := s.Store.AddInvite(inv)
+		if err == nil {
+			break
+		}
+		if err != ErrDuplicateID {
+			return models.CreateInviteResponse{Error: err.Error()}
+		}
+	}
+
+	tok, err := p2p.SignInvite(inv, s.Host.Peerstore().PrivKey(s.Host.ID()))
+	if err != nil {
+		log.Printf("[HUB] RPC ERROR: Failed to sign invite %s: %v", inv.ID, err)
+		return models.CreateInviteResponse{Error: "failed to sign invite"}
+	}
+	link, err := p2p.EncodeInvite(tok)
+	if err != nil {
+		return models.CreateInviteResponse{Error: "failed to encode invite"}
+	}
+	return models.CreateInviteResponse{InviteID: inv.ID, Link: link}
+}
+
+func (s *HubServer) redeemInvite(remotePeer peer.ID, req models.RedeemInviteRequest) models.RedeemInviteResponse {
+	tok, err := p2p.DecodeInvite(req.Link)
+	if err != nil {
+		s.penalize(remotePeer)
+		return models.RedeemInviteResponse{Error: err.Error()}
+	}
+	inv, err := p2p.OpenInviteToken(tok)
+	if err != nil {
+		s.penalize(remotePeer)
+		return models.RedeemInviteResponse{Error: err.Error()}
+	}
+	if inv.HubPeerID != s.Host.ID().String() {
+		return models.RedeemInviteResponse{Error: p2p.ErrInvalidInvite.WithDetails("issued by another hub").Error()}
+	}
+	inv, err = s.Store.RedeemInvite(inv.ID, remotePeer.String(), time.Now())
+	if err != nil {
+		return models.RedeemInviteResponse{Error: err.Error()}
+	}
+	return models.RedeemInviteResponse{ServerID: inv.ServerID, RoomID: inv.RoomID}
+}
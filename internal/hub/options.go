@@ -0,0 +1,30 @@
+package hub
+
+import "github.com/libp2p/go-libp2p/core/pnet"
+
+// Option configures optional hub behaviour in NewHubServer.
+type Option func(*hubConfig)
+
+type hubConfig struct {
+	lan         bool
+	psk         pnet.PSK
+	listenAddrs []string
+}
+
+// WithLAN runs the hub on an isolated network: it announces itself over mDNS and
+// uses a private DHT (p2p.LANProtocolPrefix) without any public bootstrap peers.
+func WithLAN() Option {
+	return func(c *hubConfig) { c.lan = true }
+}
+
+// WithSwarmKey makes the hub part of a private network: only peers holding the same
+// pre-shared key (see p2p.LoadSwarmKey) can complete a handshake with it.
+func WithSwarmKey(psk pnet.PSK) Option {
+	return func(c *hubConfig) { c.psk = psk }
+}
+
+// WithListenAddrs adds listen addresses besides the one given to NewHubServer,
+// e.g. QUIC and WebSocket next to TCP.
+func WithListenAddrs(addrs ...string) Option {
+	return func(c *hubConfig) { c.listenAddrs = append(c.listenAddrs, addrs...) }
+}
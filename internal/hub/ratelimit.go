@@ -0,0 +1,193 @@
+package hub
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Hard limits applied to every RPC handled by the hub.
+const (
+	MaxRPCBytes          = 64 * 1024 // max size of a single JSON envelope
+	RPCStreamDeadline    = 10 * time.Second
+	MaxNameLength        = 64
+	MaxDescriptionLength = 256
+	MaxSecretLength      = 64   // password hashes and salts
+	MaxEncRoomKeyLength  = 4096 // wrapped room keys
+	MaxServersPerOwner   = 10
+	MaxRoomsPerServer    = 50
+	MaxMemberAddrs       = 16 // addresses recorded per room member
+	MaxInvitesPerServer  = 100
+
+	// a peer that gets rate limited this many times within violationWindow is blocked
+	maxViolations   = 5
+	violationWindow = time.Minute
+	blockDuration   = 10 * time.Minute
+)
+
+// MethodLimit describes the token bucket for a single RPC method.
+type MethodLimit struct {
+	Rate  float64 // tokens refilled per second
+	Burst float64 // bucket capacity
+}
+
+// DefaultMethodLimits are the per-peer limits for every known RPC method.
+// Methods not listed here share one bucket limited by defaultMethodLimit.
+var DefaultMethodLimits = map[string]MethodLimit{
+	"ListServers":     {Rate: 2, Burst: 10},
+	"CreateServer":    {Rate: 1.0 / 60, Burst: 3},
+	"ListRooms":       {Rate: 2, Burst: 10},
+	"CreateRoom":      {Rate: 1.0 / 10, Burst: 5},
+	"JoinServer":      {Rate: 0.5, Burst: 5},
+	"JoinRoom":        {Rate: 0.5, Burst: 5},
+	"ListRoomMembers": {Rate: 1, Burst: 10},
+	"CreateInvite":    {Rate: 1.0 / 10, Burst: 5},
+	"RedeemInvite":    {Rate: 0.2, Burst: 3},
+	"RevokeInvite":    {Rate: 0.5, Burst: 5},
+	"JoinChallenge":   {Rate: 0.5, Burst: 5},
+
+	// not an RPC: one token is taken per wrong password, see checkPasswordProof
+	PasswordFailureLimit: {Rate: 1.0 / 30, Burst: 5},
+	// nor this: one per relay reservation, which clients renew about hourly
+	RelayReserveLimit: {Rate: 1.0 / 60, Burst: 5},
+}
+
+// PasswordFailureLimit is the DefaultMethodLimits key throttling wrong password proofs.
+const PasswordFailureLimit = "PasswordFailure"
+
+// RelayReserveLimit is the DefaultMethodLimits key throttling relay reservations.
+const RelayReserveLimit = "RelayReserve"
+
+var defaultMethodLimit = MethodLimit{Rate: 1, Burst: 5}
+
+// unknownMethod is the bucket shared by the methods missing from the limits.
+const unknownMethod = "?"
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type peerState struct {
+	buckets    map[string]*tokenBucket
+	violations []time.Time
+	lastSeen   time.Time
+}
+
+// RateLimiter keeps a token bucket per (peer, method) pair and tracks
+// repeated violations so abusive peers can be handed to the ConnectionGater.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]MethodLimit
+	peers  map[peer.ID]*peerState
+	now    func() time.Time
+}
+
+// NewRateLimiter returns a limiter using the given per-method limits.
+// A nil map selects DefaultMethodLimits.
+func NewRateLimiter(limits map[string]MethodLimit) *RateLimiter {
+	if limits == nil {
+		limits = DefaultMethodLimits
+	}
+	return &RateLimiter{
+		limits: limits,
+		peers:  make(map[peer.ID]*peerState),
+		now:    time.Now,
+	}
+}
+
+// Allow consumes one token for the given peer and method.
+// It returns false when the bucket is empty.
+func (rl *RateLimiter) Allow(p peer.ID, method string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b := rl.refill(p, method)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Peek reports whether Allow would succeed, without consuming a token.
+func (rl *RateLimiter) Peek(p peer.ID, method string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.refill(p, method).tokens >= 1
+}
+
+// refill returns the peer's bucket for method, topped up for the time elapsed.
+// The caller must hold rl.mu.
+func (rl *RateLimiter) refill(p peer.ID, method string) *tokenBucket {
+	now := rl.now()
+	st, ok := rl.peers[p]
+	if !ok {
+		st = &peerState{buckets: make(map[string]*tokenBucket)}
+		rl.peers[p] = st
+	}
+	st.lastSeen = now
+
+	limit, ok := rl.limits[method]
+	if !ok {
+		// one bucket for every unknown name, so rotating them gains nothing
+		limit, method = defaultMethodLimit, unknownMethod
+	}
+	b, ok := st.buckets[method]
+	if !ok {
+		b = &tokenBucket{tokens: limit.Burst, last: now}
+		st.buckets[method] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > limit.Burst {
+		b.tokens = limit.Burst
+	}
+	b.last = now
+	return b
+}
+
+// RecordViolation notes that a peer misbehaved (rate limited, oversized request...)
+// and reports whether the peer crossed the threshold and should be blocked.
+func (rl *RateLimiter) RecordViolation(p peer.ID) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	st, ok := rl.peers[p]
+	if !ok {
+		st = &peerState{buckets: make(map[string]*tokenBucket)}
+		rl.peers[p] = st
+	}
+	st.lastSeen = now
+
+	recent := st.violations[:0]
+	for _, v := range st.violations {
+		if now.Sub(v) < violationWindow {
+			recent = append(recent, v)
+		}
+	}
+	st.violations = append(recent, now)
+	return len(st.violations) >= maxViolations
+}
+
+// Forget drops all state kept for a peer.
+func (rl *RateLimiter) Forget(p peer.ID) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	delete(rl.peers, p)
+}
+
+// Prune removes peers that haven't been seen for longer than idle.
+func (rl *RateLimiter) Prune(idle time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	for p, st := range rl.peers {
+		if now.Sub(st.lastSeen) > idle {
+			delete(rl.peers, p)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package hub
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sync"
 	"time"
@@ -19,6 +20,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -30,14 +32,45 @@ type HubServer struct {
 	DHT        *dht.IpfsDHT
 	Store      *HubStore
 	PS         *pubsub.PubSub
+	Limiter    *RateLimiter
+	Gater      *BlockGater
+	Federation *Federation
+	Challenges *ChallengeStore
 	mu         sync.Mutex
 	topicCache map[string]*pubsub.Topic
 }
 
-func NewHubServer(ctx context.Context, listenAddr string) (*HubServer, error) {
+func NewHubServer(ctx context.Context, listenAddr string, opts ...Option) (*HubServer, error) {
 	log.Printf("[HUB] Initializing hub server on %s", listenAddr)
+	var cfg hubConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	listenAddrs := append([]string{listenAddr}, cfg.listenAddrs...)
+	if len(cfg.psk) > 0 {
+		listenAddrs = p2p.PrivateNetworkListenAddrs(listenAddrs)
+	}
 
-	h, err := libp2p.New(libp2p.ListenAddrStrings(listenAddr))
+	// In-memory store
+	st := NewHubStore()
+	log.Printf("[HUB] Hub store initialized")
+
+	gater := NewBlockGater()
+	limiter := NewRateLimiter(nil)
+	hostOpts := []libp2p.Option{
+		libp2p.ListenAddrStrings(listenAddrs...),
+		libp2p.ConnectionGater(gater),
+		// the hub is expected to be publicly reachable and relays for clients behind NAT
+		libp2p.ForceReachabilityPublic(),
+		libp2p.EnableNATService(),
+		libp2p.EnableRelayService(relay.WithResources(p2p.RelayResources()), relay.WithACL(NewRelayACL(st, gater, limiter))),
+	}
+	if len(cfg.psk) > 0 {
+		hostOpts = append(hostOpts, libp2p.PrivateNetwork(cfg.psk))
+		log.Printf("[HUB] Private network enabled, peers need the swarm key")
+	}
+	h, err := libp2p.New(hostOpts...)
 	if err != nil {
 		log.Printf("[HUB] ERROR: Failed to create libp2p host: %v", err)
 		return nil, err
@@ -45,9 +78,13 @@ func NewHubServer(ctx context.Context, listenAddr string) (*HubServer, error) {
 
 	log.Printf("[HUB] Created libp2p host with ID: %s", h.ID().String())
 
-	dhtNode, err := dht.New(ctx, h,
-		dht.BootstrapPeers(dht.GetDefaultBootstrapPeerAddrInfos()...),
-		dht.Mode(dht.ModeServer))
+	dhtOpts := []dht.Option{dht.Mode(dht.ModeServer)}
+	if cfg.lan {
+		dhtOpts = append(dhtOpts, dht.ProtocolPrefix(p2p.LANProtocolPrefix))
+	} else if len(cfg.psk) == 0 {
+		dhtOpts = append(dhtOpts, dht.BootstrapPeers(dht.GetDefaultBootstrapPeerAddrInfos()...))
+	}
+	dhtNode, err := dht.New(ctx, h, dhtOpts...)
 
 	if err != nil {
 		log.Printf("[HUB] ERROR: Failed to create DHT: %v", err)
@@ -66,18 +103,18 @@ func NewHubServer(ctx context.Context, listenAddr string) (*HubServer, error) {
 	if err != nil {
 		return nil, err
 	}
-	// In-memory store
-	st := NewHubStore()
-	log.Printf("[HUB] Hub store initialized")
-
 	srv := &HubServer{
 		Ctx:        ctx,
 		Host:       h,
 		DHT:        dhtNode,
 		Store:      st,
 		PS:         ps,
+		Limiter:    limiter,
+		Gater:      gater,
+		Challenges: NewChallengeStore(),
 		topicCache: make(map[string]*pubsub.Topic),
 	}
+	go srv.pruneLimiter()
 
 	/*
 		// Set connection notification handlers
@@ -96,6 +133,18 @@ func NewHubServer(ctx context.Context, listenAddr string) (*HubServer, error) {
 	h.SetStreamHandler(HubProtocolID, srv.handleRPC)
 	log.Printf("[HUB] Stream handler set for protocol: %s", HubProtocolID)
 
+	if cfg.lan {
+		if _, err := p2p.StartMDNS(ctx, h, nil); err != nil {
+			log.Printf("[HUB] ERROR: Failed to start mDNS: %v", err)
+			return nil, err
+		}
+		log.Printf("[HUB] LAN mode: announcing over mDNS, private DHT %s", p2p.LANProtocolPrefix)
+	}
+
+	if err := srv.watchDirectory(); err != nil {
+		log.Printf("[HUB] ERROR: Failed to join the server directory: %v", err)
+	}
+
 	return srv, nil
 }
 
@@ -109,9 +158,147 @@ func (s *HubServer) ListenAddrs() {
 	}
 }
 
-var env struct {
-	Method string          `json:"method"`
-	Params json.RawMessage `json:"params"`
+// rpcError is a generic error response. Every RPC response type carries an
+// "error" field, so clients decode it regardless of the method they called.
+type rpcError struct {
+	Error string `json:"error"`
+}
+
+// penalize records a violation for the peer and blocks it through the
+// connection gater once it has misbehaved too often.
+func (s *HubServer) penalize(p peer.ID) {
+	if !s.Limiter.RecordViolation(p) {
+		return
+	}
+	s.Gater.Block(p, blockDuration)
+	s.Limiter.Forget(p)
+	if err := s.Host.Network().ClosePeer(p); err != nil {
+		log.Printf("[HUB] ERROR: Failed to close connections to blocked peer %s: %v", p.String(), err)
+	}
+}
+
+func (s *HubServer) pruneLimiter() {
+	ticker := time.NewTicker(violationWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Limiter.Prune(2 * blockDuration)
+		case <-s.Ctx.Done():
+			return
+		}
+	}
+}
+
+// NewRelayACL lets any peer the gater accepts reserve a slot on the hub's
+// relay, as often as RelayReserveLimit allows, but only members of st be
+// reached or reach others through it. A member behind NAT needs its
+// reservation before it joins a room: the circuit address memberAddrs hands
+// out as it joins only works once it holds one.
+func NewRelayACL(st *HubStore, g *BlockGater, rl *RateLimiter) p2p.RelayACL {
+	return p2p.RelayACL{
+		Reserve: func(p peer.ID) bool {
+			return !g.IsBlocked(p) && rl.Allow(p, RelayReserveLimit)
+		},
+		Member: st.IsMember,
+	}
+}
+
+// memberAddrs collects the addresses other members can dial p on: the listen and relay
+// addresses p reported through identify, the address we observed, and a circuit through
+// this hub, which works for as long as p holds a reservation here.
+func (s *HubServer) memberAddrs(p peer.ID, observed ma.Multiaddr) []ma.Multiaddr {
+	addrs := []ma.Multiaddr{observed}
+	addrs = append(addrs, s.Host.Peerstore().Addrs(p)...)
+	for _, a := range s.Host.Addrs() {
+		circuit, err := ma.NewMultiaddr(fmt.Sprintf("%s/p2p/%s/p2p-circuit", a, s.Host.ID()))
+		if err == nil {
+			addrs = append(addrs, circuit)
+		}
+	}
+
+	seen := make(map[string]struct{}, len(addrs))
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if _, ok := seen[a.String()]; ok {
+			continue
+		}
+		seen[a.String()] = struct{}{}
+		out = append(out, a)
+		if len(out) == MaxMemberAddrs {
+			break
+		}
+	}
+	return out
+}
+
+// publicServer is server as anyone may see it: no password material nor the
+// owner record that carries it, and only its rooms that aren't private, as
+// publicRoom makes them.
+func publicServer(server models.ServerMeta) models.ServerMeta {
+	server.PasswordSalt = nil
+	server.PasswordHash = nil
+	server.Record = nil
+	rooms := make(map[string]*models.RoomMeta, len(server.Rooms))
+	for id, room := range server.Rooms {
+		if room != nil && room.Visibility != models.Private {
+			r := publicRoom(*room)
+			rooms[id] = &r
+		}
+	}
+	server.Rooms = rooms
+	return server
+}
+
+// publicRoom is room as listed and advertised: no password material, no
+// members and no room key, which is only handed out on JoinRoom.
+func publicRoom(room models.RoomMeta) models.RoomMeta {
+	room.PasswordSalt = nil
+	room.PasswordHash = nil
+	room.EncRoomKey = nil
+	room.Members = nil
+	return room
+}
+
+// createdServer is the server rec, signed by owner, asks to create. Its
+// fields, password material included, all come from the signed entry, so
+// federated hubs can check them against the same record.
+func createdServer(owner peer.ID, rec *models.DirectoryRecord) (*models.ServerMeta, error) {
+	if rec == nil {
+		return nil, ErrInvalidServer.WithDetails("no owner record")
+	}
+	if rec.OwnerPeerID != owner.String() {
+		return nil, ErrNotOwner
+	}
+	entry, err := p2p.OpenServerRecord(rec)
+	if err != nil {
+		return nil, ErrInvalidServer.WithDetails(err.Error())
+	}
+	signed := entry.Server
+	signed.Rooms = nil
+	if err := checkReplicated(&signed); err != nil {
+		return nil, err
+	}
+	return &models.ServerMeta{
+		ID:           signed.ID,
+		Name:         signed.Name,
+		Visibility:   signed.Visibility,
+		Description:  signed.Description,
+		CreatedAt:    time.Now().Unix(),
+		Version:      entry.Version,
+		OwnerPeerID:  signed.OwnerPeerID,
+		Rooms:        make(map[string]*models.RoomMeta),
+		PasswordSalt: signed.PasswordSalt,
+		PasswordHash: signed.PasswordHash,
+		Record:       rec,
+	}, nil
+}
+
+func checkLength(field string, value []byte, max int) error {
+	if len(value) > max {
+		return ErrFieldTooLong.WithDetails(fmt.Sprintf("%s exceeds %d bytes", field, max))
+	}
+	return nil
 }
 
 // handleRPC is invoked for every incoming stream on HubProtocolID.
@@ -125,14 +312,30 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		stream.Close()
 	}()
 
-	decoder := json.NewDecoder(stream)
+	if err := stream.SetDeadline(time.Now().Add(RPCStreamDeadline)); err != nil {
+		log.Printf("[HUB] RPC ERROR: Failed to set stream deadline for %s: %v",
+			remotePeer.String(), err)
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(stream, MaxRPCBytes))
 	encoder := json.NewEncoder(stream)
 
 	// 1) read envelope
-
+	var env struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
 	if err := decoder.Decode(&env); err != nil {
 		log.Printf("[HUB] RPC ERROR: Failed to decode envelope from %s: %v",
 			remotePeer.String(), err)
+		s.penalize(remotePeer)
+		return
+	}
+
+	if !s.Limiter.Allow(remotePeer, env.Method) {
+		log.Printf("[HUB] RPC: Rate limited method '%s' for peer %s", env.Method, remotePeer.String())
+		encoder.Encode(rpcError{Error: ErrRateLimited.Error()})
+		s.penalize(remotePeer)
 		return
 	}
 
@@ -152,10 +355,7 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		out := make([]models.ServerMeta, 0)
 		for _, server := range servers {
 			if server.Visibility != models.Private {
-				sanitized := server
-				sanitized.PasswordSalt = nil
-				sanitized.PasswordHash = nil
-				out = append(out, sanitized)
+				out = append(out, publicServer(server))
 			}
 		}
 		log.Printf("[HUB] RPC: ListServers returning %d public servers to %s",
@@ -175,25 +375,17 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		log.Printf("[HUB] RPC: CreateServer called by %s - Name: '%s', Visibility: %v",
 			remotePeer.String(), req.Name, req.Visibility)
 
-		var sm *models.ServerMeta
-		for {
-			serverID := utils.GenerateRandomID()
-			sm = &models.ServerMeta{
-				ID:           serverID,
-				Name:         req.Name,
-				Visibility:   req.Visibility,
-				Description:  req.Description,
-				CreatedAt:    time.Now().Unix(),
-				OwnerPeerID:  remotePeer.String(),
-				Rooms:        make(map[string]*models.RoomMeta),
-				PasswordSalt: req.PasswordSalt,
-				PasswordHash: req.PasswordHash,
-			}
-			err := s.Store.CreateServer(sm)
-			if err == nil {
-				break
-			}
-			log.Printf("[HUB] RPC: Server ID collision, retrying with new ID")
+		sm, err := createdServer(remotePeer, req.Record)
+		if err != nil {
+			log.Printf("[HUB] RPC ERROR: CreateServer rejected for %s: %v", remotePeer.String(), err)
+			encoder.Encode(models.CreateServerResponse{Error: err.Error()})
+			s.penalize(remotePeer)
+			return
+		}
+		if err := s.Store.CreateServer(sm); err != nil {
+			log.Printf("[HUB] RPC ERROR: CreateServer failed for %s: %v", remotePeer.String(), err)
+			encoder.Encode(models.CreateServerResponse{Error: err.Error()})
+			return
 		}
 
 		log.Printf("[HUB] RPC: Server created successfully - ID: %s, Name: '%s', Owner: %s",
@@ -203,6 +395,7 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 			log.Printf("[HUB] RPC ERROR: Failed to encode CreateServer response: %v", err)
 		}
 		go s.AdvertiseNewServer()
+		go s.pushToFederation(sm.ID)
 
 	case "ListRooms":
 		var req models.ListRoomsRequest
@@ -228,12 +421,7 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		out := make([]models.RoomMeta, 0)
 		for _, room := range rooms {
 			if room.Visibility != models.Private {
-				sanitized := room
-				sanitized.PasswordSalt = nil
-				sanitized.PasswordHash = nil
-				sanitized.Members = nil // Don't leak member info
-
-				out = append(out, sanitized)
+				out = append(out, publicRoom(room))
 			}
 		}
 
@@ -254,6 +442,19 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		log.Printf("[HUB] RPC: CreateRoom called by %s - Server: %s, Room: '%s', Visibility: %v",
 			remotePeer.String(), req.ServerID, req.RoomName, req.Visibility)
 
+		if err := errors.Join(
+			checkLength("room name", []byte(req.RoomName), MaxNameLength),
+			checkLength("password hash", req.PasswordHash, MaxSecretLength),
+			checkLength("password salt", req.PasswordSalt, MaxSecretLength),
+			checkLength("encrypted room key", req.EncRoomKey, MaxEncRoomKeyLength),
+			req.Retention.Validate(),
+		); err != nil {
+			log.Printf("[HUB] RPC ERROR: CreateRoom rejected for %s: %v", remotePeer.String(), err)
+			encoder.Encode(models.CreateRoomResponse{Error: err.Error()})
+			s.penalize(remotePeer)
+			return
+		}
+
 		var rm *models.RoomMeta
 		for {
 			roomID := utils.GenerateRandomID()
@@ -264,13 +465,23 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 				PasswordSalt: req.PasswordSalt,
 				PasswordHash: req.PasswordHash,
 				EncRoomKey:   req.EncRoomKey,
+				Retention:    req.Retention,
 				Members:      map[string]models.Member{},
 			}
-			err := s.Store.CreateRoom(req.ServerID, rm)
+			err := s.Store.CreateRoom(req.ServerID, remotePeer.String(), rm)
 			if err == models.ErrServerNotFound {
 				log.Printf("[HUB] RPC ERROR: CreateRoom failed - Server %s not found", req.ServerID)
 				encoder.Encode(models.CreateRoomResponse{Error: "Server not found"})
-				break
+				return
+			} else if err == ErrNotOwner {
+				log.Printf("[HUB] RPC ERROR: CreateRoom rejected - %s does not own server %s", remotePeer.String(), req.ServerID)
+				encoder.Encode(models.CreateRoomResponse{Error: err.Error()})
+				s.penalize(remotePeer)
+				return
+			} else if err == ErrRoomLimitReached {
+				log.Printf("[HUB] RPC ERROR: CreateRoom failed - Server %s has too many rooms", req.ServerID)
+				encoder.Encode(models.CreateRoomResponse{Error: err.Error()})
+				return
 			} else if err == nil {
 				log.Printf("[HUB] RPC: Room created successfully - ID: %s, Name: '%s', Server: %s",
 					rm.ID, rm.Name, req.ServerID)
@@ -284,6 +495,48 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		}
 
 		go s.AdvertiseNewRoom(req.ServerID)
+		go s.pushToFederation(req.ServerID)
+	case "JoinChallenge":
+		var req models.JoinChallengeRequest
+		if err := json.Unmarshal(env.Params, &req); err != nil {
+			log.Printf("[HUB] RPC ERROR: bad JoinChallenge params: %v", err)
+			encoder.Encode(models.JoinChallengeResponse{Error: "Invalid parameters"})
+			return
+		}
+		resp := models.JoinChallengeResponse{}
+		var salt []byte
+		if req.RoomID == "" {
+			server, err := s.Store.GetServer(req.ServerID)
+			if err != nil {
+				resp.Error = "server not found"
+			} else if server.Visibility != models.PasswordProtected {
+				resp.Error = "server is not password protected"
+			} else {
+				salt = server.PasswordSalt
+			}
+		} else {
+			room, err := s.Store.GetRoom(req.ServerID, req.RoomID)
+			if err != nil {
+				resp.Error = "room not found"
+			} else if room.Visibility != models.PasswordProtected {
+				resp.Error = "room is not password protected"
+			} else {
+				salt = room.PasswordSalt
+			}
+		}
+		if resp.Error == "" {
+			nonce, err := s.Challenges.Issue(remotePeer, req.ServerID, req.RoomID)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Salt = salt
+				resp.Nonce = nonce
+			}
+		}
+		if err := encoder.Encode(resp); err != nil {
+			log.Printf("[HUB] RPC ERROR: encoding JoinChallengeResponse: %v", err)
+		}
+
 	case "JoinServer":
 		var req models.JoinServerRequest
 		if err := json.Unmarshal(env.Params, &req); err != nil {
@@ -296,21 +549,20 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		resp := models.JoinServerResponse{}
 		if err != nil {
 			resp.Error = "server not found"
+		} else if server.Visibility != models.Public && s.Store.IsAdmitted(req.ServerID, "", remotePeer.String()) {
+			sanitized := publicServer(*server)
+			resp.Server = &sanitized
 		} else if server.Visibility == models.Private {
 			resp.Error = "server is private"
 		} else if server.Visibility == models.PasswordProtected {
-			if !bytes.Equal(req.PasswordHash, server.PasswordHash) {
-				resp.Error = "invalid server password"
+			if err := s.checkPasswordProof(remotePeer, req.ServerID, "", server.PasswordHash, req.Proof); err != nil {
+				resp.Error = err.Error()
 			} else {
-				sanitized := *server
-				sanitized.PasswordSalt = server.PasswordSalt
-				sanitized.PasswordHash = server.PasswordHash
+				sanitized := publicServer(*server)
 				resp.Server = &sanitized
 			}
 		} else {
-			sanitized := *server
-			sanitized.PasswordSalt = nil
-			sanitized.PasswordHash = nil
+			sanitized := publicServer(*server)
 			resp.Server = &sanitized
 		}
 
@@ -331,12 +583,13 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		room, err := s.Store.GetRoom(req.ServerID, req.RoomID)
 		if err != nil {
 			resp.Error = "room not found"
+		} else if room.Visibility != models.Public && s.Store.IsAdmitted(req.ServerID, req.RoomID, remotePeer.String()) {
+			resp.Room = room
 		} else if room.Visibility == models.Private {
 			resp.Error = "room is private"
 		} else if room.Visibility == models.PasswordProtected {
-			// check password hash
-			if !bytes.Equal(req.PasswordHash, room.PasswordHash) {
-				resp.Error = "invalid room password"
+			if err := s.checkPasswordProof(remotePeer, req.ServerID, req.RoomID, room.PasswordHash, req.Proof); err != nil {
+				resp.Error = err.Error()
 				encoder.Encode(models.JoinRoomResponse{Error: resp.Error})
 				log.Printf("[HUB] RPC: JoinRoom failed for %s - invalid password", remotePeer)
 				return
@@ -349,12 +602,15 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		if resp.Room != nil {
 			roomCopy := *resp.Room
 			roomCopy.Members = map[string]models.Member{} // Don't leak member info
+			roomCopy.PasswordHash = nil                   // the verifier would let invitees pass password checks
 			resp.Room = &roomCopy
 		}
-		resp.Room.Members = map[string]models.Member{} // Don't leak member info
 		if err := encoder.Encode(resp); err != nil {
 			log.Printf("[HUB] RPC ERROR: encoding JoinRoomResponse: %v", err)
 		}
+		if resp.Error != "" {
+			return
+		}
 		if remotePeer.String() != req.Sender.PeerID {
 			log.Printf("[HUB] RPC ERROR: Sender peer ID mismatch: %q != %q",
 				remotePeer.String(), req.Sender.PeerID)
@@ -362,14 +618,18 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 			return
 		}
 
-		room.Members[remotePeer.String()] = models.Member{
+		err = s.Store.AddMember(req.ServerID, req.RoomID, models.Member{
 			AddrInfo: peer.AddrInfo{
 				ID:    remotePeer,
-				Addrs: []ma.Multiaddr{stream.Conn().RemoteMultiaddr()},
+				Addrs: s.memberAddrs(remotePeer, stream.Conn().RemoteMultiaddr()),
 			},
 			User: req.Sender,
+		})
+		if err != nil {
+			log.Printf("[HUB] RPC ERROR: Failed to add %s to room %s: %v", remotePeer, req.RoomID, err)
+			return
 		}
-		go s.AdvertiseNewcomers(room, req.ServerID)
+		go s.AdvertiseNewcomers(req.ServerID, req.RoomID)
 
 	case "ListRoomMembers":
 		var req models.ListRoomMembersRequest
@@ -378,19 +638,57 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 			encoder.Encode(models.ListRoomMembersResponse{Error: "Invalid parameters"})
 			return
 		}
-		room, err := s.Store.GetRoom(req.ServerID, req.RoomID)
+		members, err := s.Store.RoomMembers(req.ServerID, req.RoomID)
 		if err != nil {
 			encoder.Encode(models.ListRoomMembersResponse{Error: "Room not found"})
 			return
 		}
-		// build a slice:
-		var members []models.Member
-		for _, pi := range room.Members {
-			members = append(members, pi)
-		}
 		encoder.Encode(models.ListRoomMembersResponse{Members: members})
 		log.Printf("[HUB] RPC: ListRoomMembers returned %d members for room %s/%s to %s", len(members), req.ServerID, req.RoomID, remotePeer.String())
 
+	case "CreateInvite":
+		var req models.CreateInviteRequest
+		if err := json.Unmarshal(env.Params, &req); err != nil {
+			log.Printf("[HUB] RPC ERROR: bad CreateInvite params: %v", err)
+			encoder.Encode(models.CreateInviteResponse{Error: "Invalid parameters"})
+			return
+		}
+		log.Printf("[HUB] RPC: CreateInvite server=%s room=%s by %s",
+			req.ServerID, req.RoomID, remotePeer)
+		if err := encoder.Encode(s.createInvite(remotePeer, req)); err != nil {
+			log.Printf("[HUB] RPC ERROR: encoding CreateInviteResponse: %v", err)
+		}
+
+	case "RedeemInvite":
+		var req models.RedeemInviteRequest
+		if err := json.Unmarshal(env.Params, &req); err != nil {
+			log.Printf("[HUB] RPC ERROR: bad RedeemInvite params: %v", err)
+			encoder.Encode(models.RedeemInviteResponse{Error: "Invalid parameters"})
+			return
+		}
+		resp := s.redeemInvite(remotePeer, req)
+		if resp.Error != "" {
+			log.Printf("[HUB] RPC: RedeemInvite failed for %s: %s", remotePeer, resp.Error)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			log.Printf("[HUB] RPC ERROR: encoding RedeemInviteResponse: %v", err)
+		}
+
+	case "RevokeInvite":
+		var req models.RevokeInviteRequest
+		if err := json.Unmarshal(env.Params, &req); err != nil {
+			log.Printf("[HUB] RPC ERROR: bad RevokeInvite params: %v", err)
+			encoder.Encode(models.RevokeInviteResponse{Error: "Invalid parameters"})
+			return
+		}
+		resp := models.RevokeInviteResponse{}
+		if err := s.Store.RevokeInvite(req.InviteID, remotePeer.String()); err != nil {
+			resp.Error = err.Error()
+		}
+		if err := encoder.Encode(resp); err != nil {
+			log.Printf("[HUB] RPC ERROR: encoding RevokeInviteResponse: %v", err)
+		}
+
 	default:
 		log.Printf("[HUB] RPC ERROR: Unknown method '%s' called by %s",
 			env.Method, remotePeer.String())
@@ -401,19 +699,15 @@ func (s *HubServer) handleRPC(stream network.Stream) {
 		env.Method, duration, remotePeer.String())
 }
 
-func (s *HubServer) AdvertiseNewcomers(room *models.RoomMeta, serverID string) error {
+func (s *HubServer) AdvertiseNewcomers(serverID, roomID string) error {
 	// TODO: Encrypt the members list before publishing
-	if room == nil {
-		log.Printf("[HUB] ERROR: Room not found")
-		return fmt.Errorf("room not found")
-	}
-	if room.Members == nil {
-		log.Printf("[HUB] ERROR: Room %s in server %s has nil members", room.ID, serverID)
-		return fmt.Errorf("room %s in server %s has nil members", room.ID, serverID)
+	targets, err := s.Store.RoomMembers(serverID, roomID)
+	if err != nil {
+		log.Printf("[HUB] ERROR: Room %s in server %s not found: %v", roomID, serverID, err)
+		return err
 	}
-	targets := room.Members
-	log.Printf("[HUB] AdvertiseNewcomers called for room %s, advertising %d members", room.ID, len(targets))
-	MemberTopic := p2p.MembersTopic(serverID, room.ID)
+	log.Printf("[HUB] AdvertiseNewcomers called for room %s, advertising %d members", roomID, len(targets))
+	MemberTopic := p2p.MembersTopic(serverID, roomID)
 	s.mu.Lock()
 	top, ok := s.topicCache[MemberTopic]
 	if !ok {
@@ -427,12 +721,7 @@ func (s *HubServer) AdvertiseNewcomers(room *models.RoomMeta, serverID string) e
 		s.topicCache[MemberTopic] = top
 	}
 	s.mu.Unlock()
-	var resp models.ListRoomMembersResponse
-	resp.Members = make([]models.Member, 0, len(targets))
-	for _, member := range targets {
-		resp.Members = append(resp.Members, member)
-	}
-	data, err := json.Marshal(resp)
+	data, err := json.Marshal(models.ListRoomMembersResponse{Members: targets})
 	if err != nil {
 		log.Printf("[HUB] ERROR: Failed to marshal ListRoomMembersResponse: %v", err)
 		return err
@@ -443,7 +732,7 @@ func (s *HubServer) AdvertiseNewcomers(room *models.RoomMeta, serverID string) e
 		return err
 	}
 	log.Printf("[HUB] Advertised newcomers in room %s of server %s to topic %s",
-		room.ID, serverID, MemberTopic)
+		roomID, serverID, MemberTopic)
 	return nil
 }
 
@@ -456,10 +745,7 @@ func (s *HubServer) AdvertiseNewServer() error {
 	out := make([]models.ServerMeta, 0)
 	for _, server := range servers {
 		if server.Visibility != models.Private {
-			sanitized := server
-			sanitized.PasswordSalt = nil
-			sanitized.PasswordHash = nil
-			out = append(out, sanitized)
+			out = append(out, publicServer(server))
 		}
 	}
 	log.Printf("[HUB] RPC: AdvertiseNewServer returning %d public servers",
@@ -510,12 +796,7 @@ func (s *HubServer) AdvertiseNewRoom(serverID string) error {
 	out := make([]models.RoomMeta, 0)
 	for _, room := range rooms {
 		if room.Visibility != models.Private {
-			sanitized := room
-			sanitized.PasswordSalt = nil
-			sanitized.PasswordHash = nil
-			sanitized.Members = nil // Don't leak member info
-
-			out = append(out, sanitized)
+			out = append(out, publicRoom(room))
 		}
 	}
 
@@ -1,20 +1,28 @@
 package hub
 
 import (
+	"errors"
 	"hillside/internal/models"
+	"hillside/internal/p2p"
 	"log"
 	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 type HubStore struct {
 	mu      sync.RWMutex
 	servers map[string]*models.ServerMeta
+	invites map[string]*inviteState
+	grants  map[string]map[string]struct{} // grantKey -> peer IDs admitted by invite
 }
 
 func NewHubStore() *HubStore {
 	log.Printf("[STORE] Initializing new hub store")
 	return &HubStore{
 		servers: make(map[string]*models.ServerMeta),
+		invites: make(map[string]*inviteState),
+		grants:  make(map[string]map[string]struct{}),
 	}
 }
 
@@ -45,6 +53,13 @@ func (hs *HubStore) CreateServer(server *models.ServerMeta) error {
 		return ErrDuplicateID
 	}
 
+	owned := hs.ownedBy(server.OwnerPeerID)
+	if owned >= MaxServersPerOwner {
+		log.Printf("[STORE] CreateServer failed - Owner %s already has %d servers",
+			server.OwnerPeerID, owned)
+		return ErrServerLimitReached
+	}
+
 	hs.servers[server.ID] = server
 	log.Printf("[STORE] Server created successfully - Total servers: %d", len(hs.servers))
 	return nil
@@ -71,7 +86,9 @@ func (hs *HubStore) ListRooms(serverID string) ([]*models.RoomMeta, error) {
 	return rooms, nil
 }
 
-func (hs *HubStore) CreateRoom(serverID string, room *models.RoomMeta) error {
+// CreateRoom adds room to a server of owner. Only the owner may add rooms,
+// and each server has at most MaxRoomsPerServer.
+func (hs *HubStore) CreateRoom(serverID, owner string, room *models.RoomMeta) error {
 	hs.mu.Lock()
 	defer hs.mu.Unlock()
 
@@ -83,6 +100,10 @@ func (hs *HubStore) CreateRoom(serverID string, room *models.RoomMeta) error {
 		log.Printf("[STORE] CreateRoom failed - Server %s not found", serverID)
 		return models.ErrServerNotFound
 	}
+	if server.OwnerPeerID != owner {
+		log.Printf("[STORE] CreateRoom failed - %s does not own server %s", owner, serverID)
+		return ErrNotOwner
+	}
 
 	if _, exists := server.Rooms[room.ID]; exists {
 		log.Printf("[STORE] CreateRoom failed - Room ID %s already exists in server %s",
@@ -90,12 +111,85 @@ func (hs *HubStore) CreateRoom(serverID string, room *models.RoomMeta) error {
 		return ErrDuplicateID
 	}
 
+	if len(server.Rooms) >= MaxRoomsPerServer {
+		log.Printf("[STORE] CreateRoom failed - Server %s already has %d rooms",
+			serverID, len(server.Rooms))
+		return ErrRoomLimitReached
+	}
+
 	server.Rooms[room.ID] = room
 	log.Printf("[STORE] Room created successfully - Server %s now has %d rooms",
 		serverID, len(server.Rooms))
 	return nil
 }
 
+// AddMember records member as joined to a room. Members are read by the
+// relay as connections come in, so they are only written under hs.mu.
+func (hs *HubStore) AddMember(serverID, roomID string, member models.Member) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	room, err := hs.room(serverID, roomID)
+	if err != nil {
+		return err
+	}
+	if room.Members == nil {
+		room.Members = map[string]models.Member{}
+	}
+	room.Members[member.AddrInfo.ID.String()] = member
+	log.Printf("[STORE] Peer %s joined room %s of server %s", member.AddrInfo.ID, roomID, serverID)
+	return nil
+}
+
+// RoomMembers returns a copy of the members of a room.
+func (hs *HubStore) RoomMembers(serverID, roomID string) ([]models.Member, error) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	room, err := hs.room(serverID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]models.Member, 0, len(room.Members))
+	for _, m := range room.Members {
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// room looks up a room. The caller must hold hs.mu.
+func (hs *HubStore) room(serverID, roomID string) (*models.RoomMeta, error) {
+	server, exists := hs.servers[serverID]
+	if !exists {
+		return nil, models.ErrServerNotFound
+	}
+	room, exists := server.Rooms[roomID]
+	if !exists || room == nil {
+		return nil, models.ErrRoomNotFound
+	}
+	return room, nil
+}
+
+// IsMember reports whether p owns a server or joined one of its rooms, the
+// peers our relay serves.
+func (hs *HubStore) IsMember(p peer.ID) bool {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	id := p.String()
+	for _, server := range hs.servers {
+		if server.OwnerPeerID == id {
+			return true
+		}
+		for _, room := range server.Rooms {
+			if _, ok := room.Members[id]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (hs *HubStore) GetServer(serverID string) (*models.ServerMeta, error) {
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
@@ -133,3 +227,241 @@ func (hs *HubStore) GetRoom(serverID, roomID string) (*models.RoomMeta, error) {
 	log.Printf("[STORE] GetRoom returning room ID: %s, Name: '%s'", room.ID, room.Name)
 	return room, nil
 }
+
+// Snapshot returns a copy of every server we hold the owner record of, room
+// member lists excluded. It is what gets replicated to federated hubs, which
+// learn servers known only from the directory topic there themselves.
+func (hs *HubStore) Snapshot() []models.ServerMeta {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	out := make([]models.ServerMeta, 0, len(hs.servers))
+	for _, server := range hs.servers {
+		if server.Record != nil {
+			out = append(out, copyServer(server))
+		}
+	}
+	return out
+}
+
+// SnapshotServer is Snapshot for a single server.
+func (hs *HubStore) SnapshotServer(serverID string) (models.ServerMeta, error) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	server, exists := hs.servers[serverID]
+	if !exists {
+		return models.ServerMeta{}, models.ErrServerNotFound
+	}
+	return copyServer(server), nil
+}
+
+func copyServer(server *models.ServerMeta) models.ServerMeta {
+	cp := *server
+	cp.Rooms = make(map[string]*models.RoomMeta, len(server.Rooms))
+	for id, room := range server.Rooms {
+		if room == nil {
+			continue
+		}
+		r := *room
+		r.Members = nil
+		cp.Rooms[id] = &r
+	}
+	return cp
+}
+
+// checkReplicated applies the caps of servers created over RPC to a server
+// replicated from another hub or the directory topic, and rejects missing rooms.
+func checkReplicated(server *models.ServerMeta) error {
+	if err := errors.Join(
+		checkLength("name", []byte(server.Name), MaxNameLength),
+		checkLength("description", []byte(server.Description), MaxDescriptionLength),
+		checkLength("password hash", server.PasswordHash, MaxSecretLength),
+		checkLength("password salt", server.PasswordSalt, MaxSecretLength),
+	); err != nil {
+		return err
+	}
+	if len(server.Rooms) > MaxRoomsPerServer {
+		return ErrRoomLimitReached
+	}
+	for id, room := range server.Rooms {
+		if room == nil || room.ID != id {
+			return ErrInvalidServer.WithDetails("malformed room " + id)
+		}
+		if err := errors.Join(
+			checkLength("room name", []byte(room.Name), MaxNameLength),
+			checkLength("room password hash", room.PasswordHash, MaxSecretLength),
+			checkLength("room password salt", room.PasswordSalt, MaxSecretLength),
+			checkLength("room key", room.EncRoomKey, MaxEncRoomKeyLength),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownedBy counts the servers of owner. The caller must hold hs.mu.
+func (hs *HubStore) ownedBy(owner string) int {
+	owned := 0
+	for _, s := range hs.servers {
+		if s.OwnerPeerID == owner {
+			owned++
+		}
+	}
+	return owned
+}
+
+// addRooms adds the rooms of remote missing from local, up to
+// MaxRoomsPerServer, and reports whether it added any. The caller must hold hs.mu.
+func addRooms(local *models.ServerMeta, remote map[string]*models.RoomMeta, publicOnly bool) bool {
+	changed := false
+	for id, room := range remote {
+		if _, ok := local.Rooms[id]; ok || (publicOnly && room.Visibility != models.Public) {
+			continue
+		}
+		if len(local.Rooms) >= MaxRoomsPerServer {
+			log.Printf("[STORE] Server %s is full, room %s not added", local.ID, id)
+			break
+		}
+		r := *room
+		if publicOnly {
+			r = models.RoomMeta{ID: room.ID, Name: room.Name, Visibility: models.Public}
+		}
+		r.Members = map[string]models.Member{}
+		local.Rooms[id] = &r
+		changed = true
+	}
+	return changed
+}
+
+// Merge folds a server replicated from another hub into the store. Server
+// fields only come from the owner record it carries, never from the hub that
+// sent it, and are last-writer-wins by its Version. Rooms are merged as a
+// union so concurrent room creation on two hubs is never lost. A server can't
+// change owner. Room members and invite grants stay on the hub that admitted
+// them: after failing over, members rejoin and invitees redeem a new invite.
+// It reports whether anything changed.
+func (hs *HubStore) Merge(remote *models.ServerMeta) (bool, error) {
+	if err := checkReplicated(remote); err != nil {
+		log.Printf("[STORE] Merge rejected server %s: %v", remote.ID, err)
+		return false, err
+	}
+	signed, err := openOwnerRecord(remote)
+	if err != nil {
+		log.Printf("[STORE] Merge rejected server %s: %v", remote.ID, err)
+		return false, err
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	local, exists := hs.servers[remote.ID]
+	if !exists {
+		if hs.ownedBy(signed.OwnerPeerID) >= MaxServersPerOwner {
+			return false, ErrServerLimitReached
+		}
+		signed.Rooms = make(map[string]*models.RoomMeta, len(remote.Rooms))
+		addRooms(signed, remote.Rooms, false)
+		hs.servers[signed.ID] = signed
+		log.Printf("[STORE] Merge added server %s from federation", signed.ID)
+		return true, nil
+	}
+	if local.OwnerPeerID != signed.OwnerPeerID {
+		log.Printf("[STORE] Merge rejected server %s - owner mismatch", remote.ID)
+		return false, ErrOwnerMismatch
+	}
+
+	changed := false
+	if signed.Version > local.Version {
+		local.Name = signed.Name
+		local.Description = signed.Description
+		local.Visibility = signed.Visibility
+		local.PasswordHash = signed.PasswordHash
+		local.PasswordSalt = signed.PasswordSalt
+		local.Record = signed.Record
+		local.Version = signed.Version
+		changed = true
+	} else if local.Record == nil {
+		// known from the directory topic only, which carries no password material
+		local.Visibility = signed.Visibility
+		local.PasswordHash = signed.PasswordHash
+		local.PasswordSalt = signed.PasswordSalt
+		local.Record = signed.Record
+		changed = true
+	}
+	if addRooms(local, remote.Rooms, false) {
+		changed = true
+	}
+	if changed {
+		log.Printf("[STORE] Merge updated server %s to version %d", local.ID, local.Version)
+	}
+	return changed, nil
+}
+
+// openOwnerRecord checks the owner record remote carries and returns the
+// server it signs, without rooms. The record must name remote and its owner.
+func openOwnerRecord(remote *models.ServerMeta) (*models.ServerMeta, error) {
+	if remote.Record == nil {
+		return nil, ErrInvalidServer.WithDetails("no owner record")
+	}
+	entry, err := p2p.OpenServerRecord(remote.Record)
+	if err != nil {
+		return nil, ErrInvalidServer.WithDetails(err.Error())
+	}
+	signed := entry.Server
+	if signed.ID != remote.ID || signed.OwnerPeerID != remote.OwnerPeerID {
+		return nil, ErrInvalidServer.WithDetails("owner record of another server")
+	}
+	signed.Rooms = nil
+	if err := checkReplicated(&signed); err != nil {
+		return nil, err
+	}
+	signed.Version = entry.Version
+	signed.Record = remote.Record
+	return &signed, nil
+}
+
+// ApplyDirectoryEntry applies an owner-signed directory record (see p2p.OpenDirectoryRecord).
+// Records carry no password material, so they may only rename a known server, add public
+// rooms to it, or introduce a new public server.
+func (hs *HubStore) ApplyDirectoryEntry(entry *models.DirectoryEntry) (bool, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	remote := entry.Server
+	if err := checkReplicated(&remote); err != nil {
+		return false, err
+	}
+	local, exists := hs.servers[remote.ID]
+	if !exists {
+		if remote.Visibility != models.Public {
+			return false, nil
+		}
+		if hs.ownedBy(remote.OwnerPeerID) >= MaxServersPerOwner {
+			return false, ErrServerLimitReached
+		}
+		server := models.ServerMeta{
+			ID:          remote.ID,
+			Name:        remote.Name,
+			Description: remote.Description,
+			Visibility:  models.Public,
+			OwnerPeerID: remote.OwnerPeerID,
+			CreatedAt:   remote.CreatedAt,
+			Rooms:       make(map[string]*models.RoomMeta),
+			Version:     entry.Version,
+		}
+		local = &server
+		hs.servers[server.ID] = local
+	} else if local.OwnerPeerID != remote.OwnerPeerID {
+		return false, ErrOwnerMismatch
+	} else if entry.Version <= local.Version {
+		return false, nil
+	} else {
+		local.Name = remote.Name
+		local.Description = remote.Description
+		local.Version = entry.Version
+	}
+	addRooms(local, remote.Rooms, true)
+	log.Printf("[STORE] Applied owner record for server %s, version %d", local.ID, local.Version)
+	return true, nil
+}
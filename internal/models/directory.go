@@ -0,0 +1,20 @@
+package models
+
+import "encoding/json"
+
+// DirectoryEntry is a snapshot of a server and its public rooms, as published by the owner.
+// Secrets (password hashes, salts, member lists) are always stripped, except from the
+// entry an owner signs to create a server (see ServerMeta.Record), which keeps the
+// password material and never goes on the directory topic.
+type DirectoryEntry struct {
+	Server  ServerMeta `json:"server"`
+	Version int64      `json:"version"` // unix micro, higher wins
+}
+
+// DirectoryRecord is an owner-signed DirectoryEntry. It is self-certifying:
+// the signature is checked against the public key embedded in OwnerPeerID.
+type DirectoryRecord struct {
+	OwnerPeerID string          `json:"owner_peer_id"`
+	Payload     json.RawMessage `json:"payload"`   // serialized DirectoryEntry
+	Signature   []byte          `json:"signature"` // libp2p key signature of Payload
+}
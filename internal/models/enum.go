@@ -1,9 +1,12 @@
 package models
 
 const (
-	TopicChat       = "chat"
-	TopicMembers    = "members"
-	TopicCatchUp    = "catchup"
-	TopicUserUpdate = "userupdate"
-	TopicRooms      = "rooms"
+	TopicChat        = "chat"
+	TopicMembers     = "members"
+	TopicCatchUp     = "catchup"
+	TopicUserUpdate  = "userupdate"
+	TopicRooms       = "rooms"
+	TopicDirectory   = "directory"
+	TopicHistory     = "history"
+	TopicHistoryResp = "historyresp"
 )
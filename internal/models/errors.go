@@ -3,7 +3,12 @@ package models
 import "hillside/internal/utils"
 
 var (
-	ErrServerNotFound = utils.NewHillsideError("server not found")
-	ErrRoomNotFound   = utils.NewHillsideError("room not found")
+	ErrServerNotFound    = utils.NewHillsideError("server not found")
+	ErrRoomNotFound      = utils.NewHillsideError("room not found")
+	ErrInvalidRetention  = utils.NewHillsideError("invalid retention policy")
+	ErrInvalidReaction   = utils.NewHillsideError("invalid reaction")
+	ErrInvalidReceipt    = utils.NewHillsideError("invalid receipt")
+	ErrInvalidAttachment = utils.NewHillsideError("invalid attachment")
+	ErrInvalidExport     = utils.NewHillsideError("invalid export")
 )
 
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExportFormat is the file format of a history export.
+type ExportFormat string
+
+const (
+	ExportJSON     ExportFormat = "json" // messages with what verifies them, see ExportedMessage
+	ExportMarkdown ExportFormat = "md"
+	ExportText     ExportFormat = "txt"
+)
+
+// ExportRequest selects the history of a room to export. Sender is a
+// username, and zero times leave the date range open on that side, as for a
+// search.
+type ExportRequest struct {
+	RoomID string
+	Format ExportFormat
+	Sender string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Validate checks the request names a room, a known format and a date range
+// in order.
+func (r ExportRequest) Validate() error {
+	switch r.Format {
+	case ExportJSON, ExportMarkdown, ExportText:
+	default:
+		return ErrInvalidExport.WithDetails(fmt.Sprintf("unknown format %q, use json, md or txt", r.Format))
+	}
+	if r.RoomID == "" {
+		return ErrInvalidExport.WithDetails("no room to export")
+	}
+	if !r.Since.IsZero() && !r.Until.IsZero() && !r.Until.After(r.Since) {
+		return ErrInvalidExport.WithDetails("the date range ends before it starts")
+	}
+	return nil
+}
+
+// ExportedMessage is a decrypted chat message as a JSON export archives it,
+// with what it takes to check the text later without the room key. Payload
+// is the stored ciphertext the sender signed with Signature, under the SigAlg
+// key SenderKey we know them by, and Key and Nonce are the message key of its
+// chain index, which decrypt it and no other message. Sealed messages are
+// signed inside their ciphertext and have no Signature. The text of an edited
+// message is the one of its last Edit, checked the same way.
+type ExportedMessage struct {
+	ChainIndex uint64              `json:"chain_index"`
+	Time       time.Time           `json:"time"`
+	SenderID   string              `json:"sender_id"`
+	Sender     string              `json:"sender"`
+	Text       string              `json:"text"`
+	ReplyTo    *uint64             `json:"reply_to,omitempty"`
+	ThreadRoot *uint64             `json:"thread_root,omitempty"`
+	Edited     bool                `json:"edited,omitempty"`
+	Deleted    bool                `json:"deleted,omitempty"`
+	Reactions  map[string][]string `json:"reactions,omitempty"`
+	Attachment *ExportedAttachment `json:"attachment,omitempty"`
+
+	SigAlg    string        `json:"sig_alg,omitempty"`
+	Signature []byte        `json:"signature,omitempty"`
+	Payload   []byte        `json:"payload,omitempty"`
+	Key       []byte        `json:"key,omitempty"`
+	Nonce     []byte        `json:"nonce,omitempty"`
+	SenderKey []byte        `json:"sender_key,omitempty"`
+	Edit      *ExportedEdit `json:"edit,omitempty"`
+}
+
+// ExportedEdit is the signed edit an exported text comes from, with the
+// message key of its own chain index.
+type ExportedEdit struct {
+	ChainIndex uint64 `json:"chain_index"`
+	SigAlg     string `json:"sig_alg,omitempty"`
+	Signature  []byte `json:"signature"`
+	Payload    []byte `json:"payload"`
+	Key        []byte `json:"key"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// ExportedAttachment describes an attachment without the key to its blob.
+type ExportedAttachment struct {
+	Name string `json:"name"`
+	MIME string `json:"mime"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
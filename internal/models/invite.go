@@ -0,0 +1,26 @@
+package models
+
+import "encoding/json"
+
+// InviteScheme prefixes invite links shared between users.
+const InviteScheme = "hillside://invite/"
+
+// Invite grants access to a server, and optionally one of its rooms, regardless of visibility.
+// It is issued and signed by the hub that tracks its usage.
+type Invite struct {
+	ID          string `json:"id"`
+	HubPeerID   string `json:"hub_peer_id"`
+	ServerID    string `json:"server_id"`
+	RoomID      string `json:"room_id,omitempty"`
+	IssuedBy    string `json:"issued_by"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`    // unix seconds, 0 never expires
+	MaxUses     int    `json:"max_uses,omitempty"`      // 0 is unlimited
+	BoundPeerID string `json:"bound_peer_id,omitempty"` // only this peer may redeem it
+}
+
+// InviteToken is a hub-signed Invite. The signature is checked against the
+// public key embedded in the invite's HubPeerID.
+type InviteToken struct {
+	Payload   json.RawMessage `json:"payload"`   // serialized Invite
+	Signature []byte          `json:"signature"` // libp2p key signature of Payload
+}
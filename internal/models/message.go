@@ -2,7 +2,13 @@
 package models
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"unicode"
 )
 
 // MessageType indicates which kind of payload lives inside the Envelope.
@@ -16,14 +22,29 @@ const (
 	MsgTypeCatchUpReq  MessageType = "catchup_req"
 	MsgTypeCatchUpResp MessageType = "catchup_resp"
 	MsgTypeUserUpdate  MessageType = "user_update"
+	MsgTypeSealedChat  MessageType = "sealed_chat"
+	MsgTypeEdit        MessageType = "edit"
+	MsgTypeDelete      MessageType = "delete"
+	MsgTypeReaction    MessageType = "reaction"
+	MsgTypeReceipt     MessageType = "receipt"
+	MsgTypeHistoryReq  MessageType = "history_req"
+	MsgTypeHistoryResp MessageType = "history_resp"
 )
 
 type DecrypetMessage struct {
-	Sender    User   `json:"sender"`
-	Timestamp int64  `json:"timestamp"` // unix nano
-	Content   string `json:"content"`
-	RoomID    string `json:"room_id"`
-	ServerID  string `json:"server_id"`
+	Sender     User    `json:"sender"`
+	Timestamp  int64   `json:"timestamp"` // unix nano
+	Content    string  `json:"content"`
+	RoomID     string  `json:"room_id"`
+	ServerID   string  `json:"server_id"`
+	ChainIndex uint64  `json:"chain_index"`
+	ReplyTo    *uint64 `json:"reply_to,omitempty"`
+	ThreadRoot *uint64 `json:"thread_root,omitempty"`
+	Edited     bool    `json:"edited,omitempty"`
+	Deleted    bool    `json:"deleted,omitempty"`
+
+	Reactions  map[string][]string `json:"reactions,omitempty"` // emoji: peer IDs of who reacted
+	Attachment *Attachment         `json:"attachment,omitempty"`
 }
 
 type Message interface {
@@ -33,10 +54,168 @@ type Message interface {
 type ChatMessage struct {
 	ChainIndex uint64 `json:"chain_index"`
 	Ciphertext []byte `json:"ciphertext"`
+	Padded     bool   `json:"padded,omitempty"`     // plaintext was padded with crypto.PadMessage
+	Sealed     bool   `json:"sealed,omitempty"`     // plaintext is a signed SealedChat envelope, the outer one is anonymous
+	Structured bool   `json:"structured,omitempty"` // text is a MessageBody rather than raw text
 }
 
 func (ChatMessage) Type() MessageType { return MsgTypeChat }
 
+// MessageBody is the text of a structured chat message. Replies point at the
+// message they answer and at the root of its thread, both by chain index.
+type MessageBody struct {
+	Text       string  `json:"text"`
+	ReplyTo    *uint64 `json:"reply_to,omitempty"`
+	ThreadRoot *uint64 `json:"thread_root,omitempty"`
+
+	Attachment *Attachment `json:"attachment,omitempty"`
+}
+
+// MaxAttachmentSize bounds the encrypted size of an attachment, in bytes.
+const MaxAttachmentSize = 100 << 20
+
+// Attachment describes a file sent with a chat message. The file is encrypted
+// with its own random Key into a blob that members fetch from each other by
+// Hash, the hex SHA-256 of the blob, over the blob protocol.
+type Attachment struct {
+	Name string `json:"name"`
+	MIME string `json:"mime"`
+	Size int64  `json:"size"` // of the encrypted blob
+	Hash string `json:"hash"`
+	Key  []byte `json:"key"`
+}
+
+// Validate checks the attachment can be fetched and saved safely: its name is
+// a plain file name and nothing it shows can break out of a chat line.
+func (a Attachment) Validate() error {
+	if b, err := hex.DecodeString(a.Hash); err != nil || len(b) != 32 || a.Hash != strings.ToLower(a.Hash) {
+		return ErrInvalidAttachment.WithDetails("hash must be a hex SHA-256")
+	}
+	if len(a.Key) != 32 {
+		return ErrInvalidAttachment.WithDetails("key must be 32 bytes")
+	}
+	if a.Size <= 0 || a.Size > MaxAttachmentSize {
+		return ErrInvalidAttachment.WithDetails(fmt.Sprintf("size must be 1 to %d bytes", MaxAttachmentSize))
+	}
+	if a.Name == "" || len(a.Name) > 255 || a.Name != filepath.Base(a.Name) || a.Name == ".." || strings.ContainsAny(a.Name, `/\[]`) {
+		return ErrInvalidAttachment.WithDetails("name must be a plain file name")
+	}
+	if strings.ContainsFunc(a.Name, unicode.IsControl) {
+		return ErrInvalidAttachment.WithDetails("name has control characters")
+	}
+	if _, _, err := mime.ParseMediaType(a.MIME); err != nil || strings.ContainsAny(a.MIME, "[]") {
+		return ErrInvalidAttachment.WithDetails("bad MIME type")
+	}
+	return nil
+}
+
+// SealedChat is the signed content of a sealed-sender chat message, edit,
+// delete, reaction or receipt. Its envelope travels inside the room
+// ciphertext with a Sender holding only the peer ID; receivers take the keys
+// from what they know of the room members.
+type SealedChat struct {
+	RoomID     string      `json:"room_id"`
+	ChainIndex uint64      `json:"chain_index"`    // must match the outer ChatMessage
+	Kind       MessageType `json:"kind,omitempty"` // must match the outer envelope, empty for chat
+	Text       string      `json:"text"`           // for a control message, its JSON content
+}
+
+func (SealedChat) Type() MessageType { return MsgTypeSealedChat }
+
+// MessageRef points at a chat message of a room. The chain index is unique in
+// the room, the sender is checked against whoever edits or deletes it.
+type MessageRef struct {
+	RoomID     string `json:"room_id"`
+	ChainIndex uint64 `json:"chain_index"`
+	SenderID   string `json:"sender_id"`
+}
+
+// EditMessage replaces the text of a chat message. Like chat it is encrypted
+// through the room ratchet at its own chain index; the plaintext is a
+// MessageControl. Edits and deletes are never sealed.
+type EditMessage struct {
+	ChatMessage
+}
+
+func (EditMessage) Type() MessageType { return MsgTypeEdit }
+
+// DeleteMessage tombstones a chat message, see EditMessage.
+type DeleteMessage struct {
+	ChatMessage
+}
+
+func (DeleteMessage) Type() MessageType { return MsgTypeDelete }
+
+// ReactionMessage adds or removes an emoji reaction to a chat message,
+// encrypted like an EditMessage. The plaintext is a Reaction.
+type ReactionMessage struct {
+	ChatMessage
+}
+
+func (ReactionMessage) Type() MessageType { return MsgTypeReaction }
+
+// MaxReactionLen bounds the emoji of a reaction, in bytes.
+const MaxReactionLen = 32
+
+// Reaction is the plaintext of a ReactionMessage. A sender has each emoji at
+// most once on a message, the latest add or remove wins.
+type Reaction struct {
+	Target MessageRef `json:"target"`
+	Emoji  string     `json:"emoji"`
+	Remove bool       `json:"remove,omitempty"`
+}
+
+// Validate checks the emoji is short and can't break out of a chat line.
+func (r Reaction) Validate() error {
+	if r.Emoji == "" || len(r.Emoji) > MaxReactionLen {
+		return ErrInvalidReaction.WithDetails(fmt.Sprintf("emoji must be 1 to %d bytes", MaxReactionLen))
+	}
+	for _, c := range r.Emoji {
+		if unicode.IsSpace(c) || unicode.IsControl(c) || c == '[' || c == ']' {
+			return ErrInvalidReaction.WithDetails("emoji has spaces or markup")
+		}
+	}
+	return nil
+}
+
+// ReceiptMessage tells the room how far a member received and read it,
+// encrypted like an EditMessage. The plaintext is a Receipt.
+type ReceiptMessage struct {
+	ChatMessage
+}
+
+func (ReceiptMessage) Type() MessageType { return MsgTypeReceipt }
+
+// Receipt is the plaintext of a ReceiptMessage: how far its sender received
+// and read the room, as one past the highest chain index of each, so 0 is
+// nothing yet. Receipts only ever move forward.
+type Receipt struct {
+	RoomID    string `json:"room_id"`
+	Delivered uint64 `json:"delivered"`
+	Read      uint64 `json:"read"`
+}
+
+// Validate checks the receipt is for roomID and was sent at chainIndex, after
+// what it acknowledges.
+func (r Receipt) Validate(roomID string, chainIndex uint64) error {
+	if r.RoomID != roomID {
+		return ErrInvalidReceipt.WithDetails("for another room")
+	}
+	if r.Read > r.Delivered {
+		return ErrInvalidReceipt.WithDetails("read past what was delivered")
+	}
+	if r.Delivered > chainIndex {
+		return ErrInvalidReceipt.WithDetails("acknowledges later messages")
+	}
+	return nil
+}
+
+// MessageControl is the plaintext of an EditMessage or DeleteMessage.
+type MessageControl struct {
+	Target MessageRef `json:"target"`
+	Text   string     `json:"text,omitempty"` // the new text of an edit
+}
+
 // JoinMessage signals a new member (and can carry their public keys)
 type JoinMessage struct {
 	User User `json:"user"`
@@ -58,9 +237,12 @@ type RekeyMessage struct {
 	Entries []RekeyEntry `json:"entries"`
 }
 
+// RekeyEntry is a key wrapped for one peer, see WrapKeyFor.
 type RekeyEntry struct {
-	PeerID string `json:"peer_id"`
-	Ciph   []byte `json:"ciphertext"`
+	PeerID  string `json:"peer_id"`
+	KEMAlg  string `json:"kem_alg,omitempty"` // empty means Kyber1024
+	Ciph    []byte `json:"ciphertext"`        // KEM ciphertext
+	Wrapped []byte `json:"wrapped_key"`
 }
 
 func (RekeyMessage) Type() MessageType { return MsgTypeRekey }
@@ -72,15 +254,33 @@ type CatchUpRequest struct {
 func (CatchUpRequest) Type() MessageType { return MsgTypeCatchUpReq }
 
 type CatchUpResponse struct {
-	MasterRoomKey     []byte `json:"master_room_key"`
-	MasterRoomKeyBase []byte `json:"master_room_key_base"` // base key, hashed becomes MasterRoomKey (for Proof of Work)
-	ChainIndex        uint64 `json:"chain_index"`
-	CatchUpMessages   []byte `json:"catchup_messages"` // serialized CatchUpMessages
-	Error             string `json:"error,omitempty"`  // if any error occurred during catch-up
+	RoomKey           *RekeyEntry `json:"room_key,omitempty"`             // the master ratchet key, wrapped for the requester
+	MasterRoomKeyBase []byte      `json:"master_room_key_base,omitempty"` // base key, hashed becomes MasterRoomKey (for Proof of Work)
+	ChainIndex        uint64      `json:"chain_index"`
+	CatchUpMessages   []byte      `json:"catchup_messages"` // serialized CatchUpMessages
+	Error             string      `json:"error,omitempty"`  // if any error occurred during catch-up
 }
 
 func (CatchUpResponse) Type() MessageType { return MsgTypeCatchUpResp }
 
+// HistoryRequest asks the members of a room for the messages before
+// BeforeIndex, or for the newest if it is 0, once ours run out.
+type HistoryRequest struct {
+	BeforeIndex uint64 `json:"before_index,omitempty"`
+	Limit       int    `json:"limit"`
+}
+
+func (HistoryRequest) Type() MessageType { return MsgTypeHistoryReq }
+
+// HistoryResponse carries the messages asked for, compressed like catch-up
+// messages. They are still encrypted and signed by their senders.
+type HistoryResponse struct {
+	Messages []byte `json:"messages"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (HistoryResponse) Type() MessageType { return MsgTypeHistoryResp }
+
 type UserUpdate struct {
 	User User `json:"user"`
 }
@@ -91,8 +291,9 @@ func (UserUpdate) Type() MessageType { return MsgTypeUserUpdate }
 type Envelope struct {
 	Type      MessageType     `json:"type"`
 	Sender    User            `json:"sender"`
-	Timestamp int64           `json:"timestamp"` // unix micro
-	Signature []byte          `json:"signature"` // signature of the payload
+	Timestamp int64           `json:"timestamp"`         // unix micro
+	SigAlg    string          `json:"sig_alg,omitempty"` // empty means Dilithium2
+	Signature []byte          `json:"signature"`         // signature of the payload
 	Payload   json.RawMessage `json:"payload"`
 }
 
@@ -104,6 +305,11 @@ type StoredMessage struct {
 	MsgType    MessageType `json:"msg_type"`
 	SenderID   string      `json:"sender_id"`
 	Timestamp  int64       `json:"timestamp"`
+	SigAlg     string      `json:"sig_alg,omitempty"`
 	Signature  []byte      `json:"signature"`
 	Payload    []byte      `json:"payload"`
+	EditedAt   int64       `json:"edited_at,omitempty"`  // unix micro of the last edit
+	DeletedAt  int64       `json:"deleted_at,omitempty"` // tombstone, signature and payload are erased
+	ReplyTo    *uint64     `json:"reply_to,omitempty"`   // from the decrypted MessageBody, for the thread index
+	ThreadRoot *uint64     `json:"thread_root,omitempty"`
 }
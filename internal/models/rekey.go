@@ -0,0 +1,49 @@
+package models
+
+import hcrypto "hillside/internal/crypto"
+
+// WrapKeyFor wraps key for u under the most preferred KEM u has a key for,
+// so members on older versions, with only Kyber1024, can still open it.
+func WrapKeyFor(u User, key []byte) (RekeyEntry, error) {
+	alg := hcrypto.Negotiate(hcrypto.KEMAlgs, u.KEMAlgs())
+	if alg == "" {
+		return RekeyEntry{}, hcrypto.ErrUnsupportedAlg.WithDetails("no KEM in common with " + u.PeerID)
+	}
+	ct, wrapped, err := hcrypto.WrapKeyFor(alg, u.KEMKey(alg), key)
+	if err != nil {
+		return RekeyEntry{}, err
+	}
+	return RekeyEntry{PeerID: u.PeerID, KEMAlg: alg, Ciph: ct, Wrapped: wrapped}, nil
+}
+
+// UnwrapKey opens an entry wrapped for the owner of kb.
+func (kb *Keybag) UnwrapKey(e RekeyEntry) ([]byte, error) {
+	priv := kb.KEMPriv(e.KEMAlg)
+	if priv == nil {
+		return nil, hcrypto.ErrUnsupportedAlg.WithDetails(e.KEMAlg)
+	}
+	return hcrypto.UnwrapKeyFrom(e.KEMAlg, priv, e.Ciph, e.Wrapped)
+}
+
+// NewRekeyMessage wraps a new room key for each of members.
+func NewRekeyMessage(key []byte, members []User) (*RekeyMessage, error) {
+	msg := &RekeyMessage{Entries: make([]RekeyEntry, 0, len(members))}
+	for _, m := range members {
+		e, err := WrapKeyFor(m, key)
+		if err != nil {
+			return nil, err
+		}
+		msg.Entries = append(msg.Entries, e)
+	}
+	return msg, nil
+}
+
+// OpenRekey returns the room key msg wraps for peerID, the owner of kb.
+func (kb *Keybag) OpenRekey(msg *RekeyMessage, peerID string) ([]byte, error) {
+	for _, e := range msg.Entries {
+		if e.PeerID == peerID {
+			return kb.UnwrapKey(e)
+		}
+	}
+	return nil, hcrypto.ErrBadKey.WithDetails("no key wrapped for " + peerID)
+}
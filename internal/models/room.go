@@ -1,5 +1,7 @@
 package models
 
+import "fmt"
+
 type Visibility int
 
 const (
@@ -8,6 +10,48 @@ const (
 	Private
 )
 
+// RetentionMode says how long members keep a room's messages.
+type RetentionMode int
+
+const (
+	KeepForever  RetentionMode = iota
+	KeepDays                   // Value days after being sent
+	KeepMessages               // the Value most recent messages
+	Ephemeral                  // Value seconds after being sent
+)
+
+// Retention limits, Value must be within [min, max] for the mode.
+var retentionBounds = map[RetentionMode][2]int64{
+	KeepDays:     {1, 36500},
+	KeepMessages: {1, 1000000},
+	Ephemeral:    {10, 7 * 24 * 3600},
+}
+
+// Retention is a room's message retention policy. There is no way to make a
+// peer forget, so it is enforced by every member's client on its own copy.
+type Retention struct {
+	Mode  RetentionMode `json:"mode,omitempty"`
+	Value int64         `json:"value,omitempty"`
+}
+
+// Validate checks that the mode is known and its value in range.
+func (r Retention) Validate() error {
+	if r.Mode == KeepForever {
+		if r.Value != 0 {
+			return ErrInvalidRetention.WithDetails("keep forever takes no value")
+		}
+		return nil
+	}
+	bounds, ok := retentionBounds[r.Mode]
+	if !ok {
+		return ErrInvalidRetention.WithDetails("unknown mode")
+	}
+	if r.Value < bounds[0] || r.Value > bounds[1] {
+		return ErrInvalidRetention.WithDetails(fmt.Sprintf("value must be between %d and %d", bounds[0], bounds[1]))
+	}
+	return nil
+}
+
 type RoomMeta struct {
 	ID           string     `json:"room_id"`
 	Name         string     `json:"name"`
@@ -15,6 +59,7 @@ type RoomMeta struct {
 	PasswordHash []byte     `json:"password_hash,omitempty"`
 	PasswordSalt []byte     `json:"password_salt,omitempty"`
 	EncRoomKey   []byte     `json:"enc_room_key,omitempty"`
+	Retention    Retention  `json:"retention"`
 
 	Members map[string]Member `json:"members,omitempty"` // key: peer ID, value: Member
 }
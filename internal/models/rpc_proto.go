@@ -3,6 +3,7 @@ package models
 type ListServersRequest struct{}
 type ListServersResponse struct {
 	Servers []ServerMeta `json:"servers"`
+	Error   string       `json:"error,omitempty"`
 }
 
 type CreateServerRequest struct {
@@ -12,9 +13,13 @@ type CreateServerRequest struct {
 	PasswordHash []byte     `json:"password_hash,omitempty"`
 	PasswordSalt []byte     `json:"password_salt,omitempty"`
 	Creator      User       `json:"creator"`
+	// Record is the owner-signed entry of the server, whose ID the owner picks
+	// with p2p.NewServerID. The hub creates the server from it alone.
+	Record *DirectoryRecord `json:"record,omitempty"`
 }
 type CreateServerResponse struct {
 	ServerID string `json:"server_id"`
+	Error    string `json:"error,omitempty"`
 }
 
 type ListRoomsRequest struct {
@@ -32,15 +37,28 @@ type CreateRoomRequest struct {
 	PasswordHash []byte     `json:"password_hash,omitempty"`
 	PasswordSalt []byte     `json:"password_salt,omitempty"`
 	EncRoomKey   []byte     `json:"enc_room_key,omitempty"`
+	Retention    Retention  `json:"retention"`
 }
 type CreateRoomResponse struct {
 	RoomID string `json:"room_id"`
 	Error  string `json:"error,omitempty"`
 }
 
+// JoinChallengeRequest asks the hub for a single-use nonce before joining
+// a password protected server, or room when RoomID is set.
+type JoinChallengeRequest struct {
+	ServerID string `json:"server_id"`
+	RoomID   string `json:"room_id,omitempty"`
+}
+type JoinChallengeResponse struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Error string `json:"error,omitempty"`
+}
+
 type JoinServerRequest struct {
-	ServerID     string `json:"server_id"`
-	PasswordHash []byte `json:"password_hash,omitempty"`
+	ServerID string `json:"server_id"`
+	Proof    []byte `json:"proof,omitempty"` // crypto.PasswordProof over the JoinChallenge nonce
 }
 
 type JoinServerResponse struct {
@@ -49,10 +67,10 @@ type JoinServerResponse struct {
 }
 
 type JoinRoomRequest struct {
-	ServerID     string `json:"server_id"`
-	RoomID       string `json:"room_id"`
-	PasswordHash []byte `json:"password_hash,omitempty"`
-	Sender       User   `json:"sender"`
+	ServerID string `json:"server_id"`
+	RoomID   string `json:"room_id"`
+	Proof    []byte `json:"proof,omitempty"` // crypto.PasswordProof over the JoinChallenge nonce
+	Sender   User   `json:"sender"`
 }
 
 type JoinRoomResponse struct {
@@ -70,3 +88,42 @@ type ListRoomMembersResponse struct {
 	Error   string   `json:"error,omitempty"`
 }
 
+// FederationRequest is sent between peered hubs on the federation protocol.
+// Method is either "Snapshot" (send me your directory) or "Push" (merge these servers).
+type FederationRequest struct {
+	Method  string       `json:"method"`
+	Servers []ServerMeta `json:"servers,omitempty"`
+}
+type FederationResponse struct {
+	Servers []ServerMeta `json:"servers,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type CreateInviteRequest struct {
+	ServerID    string `json:"server_id"`
+	RoomID      string `json:"room_id,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
+	MaxUses     int    `json:"max_uses,omitempty"`
+	BoundPeerID string `json:"bound_peer_id,omitempty"`
+}
+type CreateInviteResponse struct {
+	InviteID string `json:"invite_id"`
+	Link     string `json:"link"` // hillside://invite/...
+	Error    string `json:"error,omitempty"`
+}
+
+type RedeemInviteRequest struct {
+	Link string `json:"link"`
+}
+type RedeemInviteResponse struct {
+	ServerID string `json:"server_id"`
+	RoomID   string `json:"room_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type RevokeInviteRequest struct {
+	InviteID string `json:"invite_id"`
+}
+type RevokeInviteResponse struct {
+	Error string `json:"error,omitempty"`
+}
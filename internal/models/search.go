@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SearchRequest is what the search dialog asks for. Sender is a username, and
+// zero times leave the date range open on that side.
+type SearchRequest struct {
+	Text     string
+	Sender   string
+	Since    time.Time
+	Until    time.Time
+	AllRooms bool // the joined rooms of the current server, not only the current room
+}
+
+// SearchResult is a message found by a search, rendered as Line.
+type SearchResult struct {
+	RoomID     string
+	ChainIndex uint64
+	Line       string
+}
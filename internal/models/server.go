@@ -11,4 +11,6 @@ type ServerMeta struct {
 	PasswordSalt []byte               `json:"password_salt,omitempty"`
 	Rooms        map[string]*RoomMeta `json:"rooms"`
 	Online       int16                `json:"online"`
+	Version      int64                `json:"version,omitempty"` // unix micro of the last change, used to merge federated directories
+	Record       *DirectoryRecord     `json:"record,omitempty"`  // owner-signed entry the server was created from, checked by federated hubs
 }
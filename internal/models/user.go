@@ -1,23 +1,97 @@
 package models
 
 import (
+	hcrypto "hillside/internal/crypto"
+
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
+// PublicKey is a public key tagged with its algorithm identifier.
+type PublicKey struct {
+	Alg string `json:"alg"`
+	Key []byte `json:"key"`
+}
+
 type User struct {
-	DilithiumPub   []byte `json:"dilithium_pub"`
-	KyberPub       []byte `json:"kyber_pub"`
-	Libp2pPub      []byte `json:"libp2p_pub"`
-	PeerID         string `json:"peer_id"`
-	Username       string `json:"username"`
-	PreferredColor string `json:"preferred_color"`
+	DilithiumPub   []byte      `json:"dilithium_pub"`
+	KyberPub       []byte      `json:"kyber_pub"`
+	SigKeys        []PublicKey `json:"sig_keys,omitempty"` // keys beyond the Dilithium2 one, most preferred first
+	KEMKeys        []PublicKey `json:"kem_keys,omitempty"` // keys beyond the Kyber1024 one, most preferred first
+	Libp2pPub      []byte      `json:"libp2p_pub"`
+	PeerID         string      `json:"peer_id"`
+	Username       string      `json:"username"`
+	PreferredColor string      `json:"preferred_color"`
+}
+
+// SigKey returns u's public key for a signature algorithm, nil if u has none.
+func (u User) SigKey(alg string) []byte {
+	if alg == "" || alg == hcrypto.SigAlgDilithium2 {
+		return u.DilithiumPub
+	}
+	return findKey(u.SigKeys, alg)
+}
+
+// KEMKey returns u's public key for a KEM algorithm, nil if u has none.
+func (u User) KEMKey(alg string) []byte {
+	if alg == "" || alg == hcrypto.KEMAlgKyber1024 {
+		return u.KyberPub
+	}
+	return findKey(u.KEMKeys, alg)
+}
+
+// SigAlgs lists the signature algorithms u has keys for.
+func (u User) SigAlgs() []string {
+	return listAlgs(u.SigKeys, hcrypto.SigAlgDilithium2, u.DilithiumPub)
+}
+
+// KEMAlgs lists the KEM algorithms u has keys for.
+func (u User) KEMAlgs() []string {
+	return listAlgs(u.KEMKeys, hcrypto.KEMAlgKyber1024, u.KyberPub)
+}
+
+func findKey(keys []PublicKey, alg string) []byte {
+	for _, k := range keys {
+		if k.Alg == alg {
+			return k.Key
+		}
+	}
+	return nil
+}
+
+func listAlgs(keys []PublicKey, legacy string, legacyKey []byte) []string {
+	algs := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		algs = append(algs, k.Alg)
+	}
+	if legacyKey != nil {
+		algs = append(algs, legacy)
+	}
+	return algs
 }
 
 type Keybag struct {
-	DilithiumPriv []byte         `json:"dilithium_priv"`
-	KyberPriv     []byte         `json:"kyber_priv"`
-	Libp2pPriv    crypto.PrivKey `json:"libp2p_priv"`
+	DilithiumPriv []byte            `json:"dilithium_priv"`
+	KyberPriv     []byte            `json:"kyber_priv"`
+	SigPrivs      map[string][]byte `json:"sig_privs,omitempty"` // by algorithm, beyond DilithiumPriv
+	KEMPrivs      map[string][]byte `json:"kem_privs,omitempty"` // by algorithm, beyond KyberPriv
+	Libp2pPriv    crypto.PrivKey    `json:"libp2p_priv"`
+}
+
+// SigPriv returns the private key for a signature algorithm, nil if there is none.
+func (kb *Keybag) SigPriv(alg string) []byte {
+	if alg == "" || alg == hcrypto.SigAlgDilithium2 {
+		return kb.DilithiumPriv
+	}
+	return kb.SigPrivs[alg]
+}
+
+// KEMPriv returns the private key for a KEM algorithm, nil if there is none.
+func (kb *Keybag) KEMPriv(alg string) []byte {
+	if alg == "" || alg == hcrypto.KEMAlgKyber1024 {
+		return kb.KyberPriv
+	}
+	return kb.KEMPrivs[alg]
 }
 
 type Member struct {
@@ -0,0 +1,136 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"hillside/internal/storage"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// BlobProtocolID is the stream protocol members fetch attachment blobs over.
+const BlobProtocolID = "/hillside/blob/1.0.0"
+
+// blobChunkLen is the most bytes of a blob served per request.
+const blobChunkLen = 256 << 10
+
+// blobTimeout bounds each request and its answer on a blob stream.
+const blobTimeout = 30 * time.Second
+
+// blobRequest asks for the chunk of a blob starting at Offset. Several are
+// sent in turn on one stream.
+type blobRequest struct {
+	Hash   string `json:"hash"`
+	Offset int64  `json:"offset"`
+}
+
+// blobResponse is a JSON line followed by Length raw bytes of the blob.
+type blobResponse struct {
+	Size   int64  `json:"size"`
+	Length int64  `json:"length"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ServeBlobs answers blob requests from the complete blobs of cache. Blobs
+// are encrypted, whoever asks must already know the hash to get one.
+func (n *Node) ServeBlobs(cache *storage.BlobCache) {
+	n.Host.SetStreamHandler(BlobProtocolID, func(s network.Stream) {
+		defer s.Close()
+		dec := json.NewDecoder(s)
+		enc := json.NewEncoder(s)
+		for {
+			_ = s.SetDeadline(time.Now().Add(blobTimeout))
+			var req blobRequest
+			if err := dec.Decode(&req); err != nil {
+				return
+			}
+			if !serveBlobChunk(cache, enc, s, req) {
+				return
+			}
+		}
+	})
+}
+
+// serveBlobChunk answers one request and reports whether the stream is still
+// usable.
+func serveBlobChunk(cache *storage.BlobCache, enc *json.Encoder, w io.Writer, req blobRequest) bool {
+	f, size, err := cache.Open(req.Hash)
+	if err != nil {
+		return enc.Encode(blobResponse{Error: "not found"}) == nil
+	}
+	defer f.Close()
+	if req.Offset < 0 || req.Offset > size {
+		return enc.Encode(blobResponse{Size: size, Error: "bad offset"}) == nil
+	}
+	length := min(size-req.Offset, blobChunkLen)
+	if err := enc.Encode(blobResponse{Size: size, Length: length}); err != nil {
+		return false
+	}
+	_, err = io.Copy(w, io.NewSectionReader(f, req.Offset, length))
+	return err == nil
+}
+
+// FetchBlob downloads the blob with hash and size from p into cache, resuming
+// whatever an earlier attempt left, and verifies it against its hash.
+func (n *Node) FetchBlob(ctx context.Context, p peer.ID, cache *storage.BlobCache, hash string, size int64) error {
+	if cache.Has(hash) {
+		return nil
+	}
+	f, offset, err := cache.Partial(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if offset < size {
+		if err := n.fetchBlobFrom(ctx, p, f, hash, offset, size); err != nil {
+			return err
+		}
+	}
+	return cache.Complete(hash, size)
+}
+
+func (n *Node) fetchBlobFrom(ctx context.Context, p peer.ID, w io.Writer, hash string, offset, size int64) error {
+	s, err := n.Host.NewStream(AllowRelayed(ctx), p, BlobProtocolID)
+	if err != nil {
+		return ErrBlobUnavailable.WithDetails(err.Error())
+	}
+	defer s.Close()
+	enc := json.NewEncoder(s)
+	rd := bufio.NewReader(s)
+	for offset < size {
+		_ = s.SetDeadline(time.Now().Add(blobTimeout))
+		if err := enc.Encode(blobRequest{Hash: hash, Offset: offset}); err != nil {
+			return err
+		}
+		line, err := rd.ReadBytes('\n')
+		if err != nil {
+			return ErrBlobUnavailable.WithDetails(err.Error())
+		}
+		var resp blobResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			return ErrBlobUnavailable.WithDetails(err.Error())
+		}
+		if resp.Error != "" {
+			return ErrBlobUnavailable.WithDetails(resp.Error)
+		}
+		if resp.Size != size || resp.Length <= 0 || resp.Length > min(size-offset, blobChunkLen) {
+			return ErrBlobUnavailable.WithDetails("peer has another blob under this hash")
+		}
+		// keep what arrived of a chunk cut short, the next attempt resumes after it
+		copied, err := io.CopyN(w, rd, resp.Length)
+		offset += copied
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return ErrBlobUnavailable.WithDetails(err.Error())
+		}
+	}
+	return nil
+}
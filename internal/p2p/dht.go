@@ -25,7 +25,6 @@ func (n *Node) DiscoverPeers(serverID, roomID string) ([]peer.AddrInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("[DiscoverPeers] Discovering peers for server %s, room %s", serverID, roomID)
 	var peers []peer.AddrInfo
 	for p := range peerChan {
 		// Don't try to connect to self
@@ -36,6 +35,5 @@ func (n *Node) DiscoverPeers(serverID, roomID string) ([]peer.AddrInfo, error) {
 			peers = append(peers, p)
 		}
 	}
-	fmt.Printf("[DiscoverPeers] Found %d peers for server %s, room %s", len(peers), serverID, roomID)
 	return peers, nil
 }
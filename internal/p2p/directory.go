@@ -0,0 +1,122 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"hillside/internal/models"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	lib "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SignDirectoryEntry serializes the entry and signs it with the owner's libp2p key.
+func SignDirectoryEntry(entry *models.DirectoryEntry, priv lib.PrivKey) (*models.DirectoryRecord, error) {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := priv.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DirectoryRecord{
+		OwnerPeerID: entry.Server.OwnerPeerID,
+		Payload:     payload,
+		Signature:   sig,
+	}, nil
+}
+
+// OpenDirectoryRecord verifies the owner signature and returns the signed entry.
+func OpenDirectoryRecord(rec *models.DirectoryRecord) (*models.DirectoryEntry, error) {
+	entry, err := OpenServerRecord(rec)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Server.Visibility == models.Private {
+		return nil, ErrInvalidRecord.WithDetails("private servers are never published")
+	}
+	return entry, nil
+}
+
+// OpenServerRecord is OpenDirectoryRecord for the record an owner signs when
+// creating a server, which may be private and carries its password material.
+// Such records only travel to the hub and between federated hubs.
+func OpenServerRecord(rec *models.DirectoryRecord) (*models.DirectoryEntry, error) {
+	owner, err := peer.Decode(rec.OwnerPeerID)
+	if err != nil {
+		return nil, ErrInvalidRecord.WithDetails(err.Error())
+	}
+	pub, err := owner.ExtractPublicKey()
+	if err != nil {
+		return nil, ErrInvalidRecord.WithDetails(err.Error())
+	}
+	ok, err := pub.Verify(rec.Payload, rec.Signature)
+	if err != nil || !ok {
+		return nil, ErrInvalidRecord.WithDetails("bad owner signature")
+	}
+	var entry models.DirectoryEntry
+	if err := json.Unmarshal(rec.Payload, &entry); err != nil {
+		return nil, ErrInvalidRecord.WithDetails(err.Error())
+	}
+	if entry.Server.OwnerPeerID != rec.OwnerPeerID {
+		return nil, ErrInvalidRecord.WithDetails("owner mismatch")
+	}
+	if !ServerIDOwnedBy(entry.Server.ID, rec.OwnerPeerID) {
+		return nil, ErrInvalidRecord.WithDetails("server ID is not bound to its owner")
+	}
+	for id, room := range entry.Server.Rooms {
+		if room == nil || room.ID != id {
+			return nil, ErrInvalidRecord.WithDetails("malformed room " + id)
+		}
+	}
+	return &entry, nil
+}
+
+// NewServerID returns a fresh server ID bound to owner: a random nonce then a
+// digest of the owner and nonce. Records naming it are only valid when signed
+// by owner, so nobody can publish one first and squat the ID.
+func NewServerID(owner string) string {
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	return serverID(owner, nonce)
+}
+
+// ServerIDOwnedBy reports whether id was made by NewServerID for owner.
+func ServerIDOwnedBy(id, owner string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	nonce, err := hex.DecodeString(id[:16])
+	return err == nil && id == serverID(owner, nonce)
+}
+
+func serverID(owner string, nonce []byte) string {
+	h := sha256.Sum256(append([]byte(owner), nonce...))
+	return hex.EncodeToString(nonce) + hex.EncodeToString(h[:8])
+}
+
+// DirectoryValidator drops directory records that aren't properly owner-signed
+// before they are delivered or forwarded.
+func DirectoryValidator(_ context.Context, _ peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+	var rec models.DirectoryRecord
+	if err := json.Unmarshal(msg.Data, &rec); err != nil {
+		return pubsub.ValidationReject
+	}
+	if _, err := OpenDirectoryRecord(&rec); err != nil {
+		return pubsub.ValidationReject
+	}
+	return pubsub.ValidationAccept
+}
+
+// JoinDirectory registers the record validator and joins the directory topic.
+func (n *Node) JoinDirectory() (*pubsub.Topic, error) {
+	if err := n.PS.RegisterTopicValidator(DirectoryTopic(), DirectoryValidator); err != nil {
+		return nil, err
+	}
+	return n.PS.Join(DirectoryTopic())
+}
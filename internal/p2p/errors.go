@@ -0,0 +1,13 @@
+package p2p
+
+import "hillside/internal/utils"
+
+var (
+	ErrNoHub           = utils.NewHillsideError("no hub configured")
+	ErrHubUnreachable  = utils.NewHillsideError("no hub reachable")
+	ErrInvalidSwarmKey = utils.NewHillsideError("invalid swarm key")
+	ErrInvalidRecord   = utils.NewHillsideError("invalid directory record")
+	ErrInvalidInvite   = utils.NewHillsideError("invalid invite")
+	ErrNoBootstrapPeer = utils.NewHillsideError("no reachable bootstrap peer")
+	ErrBlobUnavailable = utils.NewHillsideError("blob unavailable")
+)
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"hillside/internal/models"
+
+	lib "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// SignInvite serializes the invite and signs it with the issuing hub's libp2p key.
+func SignInvite(inv *models.Invite, priv lib.PrivKey) (*models.InviteToken, error) {
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := priv.Sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InviteToken{Payload: payload, Signature: sig}, nil
+}
+
+// OpenInviteToken verifies the hub signature and returns the signed invite.
+// Expiry and usage are tracked by the hub, not checked here.
+func OpenInviteToken(tok *models.InviteToken) (*models.Invite, error) {
+	var inv models.Invite
+	if err := json.Unmarshal(tok.Payload, &inv); err != nil {
+		return nil, ErrInvalidInvite.WithDetails(err.Error())
+	}
+	hub, err := peer.Decode(inv.HubPeerID)
+	if err != nil {
+		return nil, ErrInvalidInvite.WithDetails(err.Error())
+	}
+	pub, err := hub.ExtractPublicKey()
+	if err != nil {
+		return nil, ErrInvalidInvite.WithDetails(err.Error())
+	}
+	ok, err := pub.Verify(tok.Payload, tok.Signature)
+	if err != nil || !ok {
+		return nil, ErrInvalidInvite.WithDetails("bad hub signature")
+	}
+	return &inv, nil
+}
+
+// EncodeInvite renders a token as a shareable hillside://invite/ link.
+func EncodeInvite(tok *models.InviteToken) (string, error) {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	return models.InviteScheme + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeInvite parses a link produced by EncodeInvite. The bare code without
+// the scheme is accepted too, so users can paste either.
+func DecodeInvite(link string) (*models.InviteToken, error) {
+	code := strings.TrimPrefix(strings.TrimSpace(link), models.InviteScheme)
+	data, err := base64.RawURLEncoding.DecodeString(code)
+	if err != nil {
+		return nil, ErrInvalidInvite.WithDetails(err.Error())
+	}
+	var tok models.InviteToken
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return nil, ErrInvalidInvite.WithDetails(err.Error())
+	}
+	return &tok, nil
+}
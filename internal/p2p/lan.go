@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+const (
+	// LANServiceTag is the mDNS service name hubs and clients announce themselves under
+	LANServiceTag = "hillside"
+	// LANProtocolPrefix keeps the LAN DHT apart from the public IPFS DHT
+	LANProtocolPrefix = "/hillside"
+
+	lanDialTimeout = 5 * time.Second
+)
+
+type mdnsNotifee struct {
+	ctx   context.Context
+	host  host.Host
+	found func(peer.AddrInfo)
+}
+
+func (m *mdnsNotifee) HandlePeerFound(pi peer.AddrInfo) {
+	if pi.ID == m.host.ID() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, lanDialTimeout)
+	defer cancel()
+	if err := m.host.Connect(ctx, pi); err != nil {
+		return
+	}
+	if m.found != nil {
+		m.found(pi)
+	}
+}
+
+// StartMDNS announces h on the local network and dials every Hillside peer found there.
+// found, if not nil, is called for each peer once it is connected (and identified).
+func StartMDNS(ctx context.Context, h host.Host, found func(peer.AddrInfo)) (mdns.Service, error) {
+	svc := mdns.NewMdnsService(h, LANServiceTag, &mdnsNotifee{ctx: ctx, host: h, found: found})
+	if err := svc.Start(); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// isHub reports whether an identified peer serves the hub RPC protocol.
+func isHub(h host.Host, id peer.ID) bool {
+	protos, err := h.Peerstore().SupportsProtocols(id, protocolID)
+	return err == nil && len(protos) > 0
+}
+
+// startLAN runs mDNS for the node and adopts every hub it finds on the local network.
+func (n *Node) startLAN() error {
+	_, err := StartMDNS(n.Ctx, n.Host, func(pi peer.AddrInfo) {
+		if isHub(n.Host, pi.ID) {
+			n.addHub(pi)
+		}
+	})
+	return err
+}
+
+func (n *Node) addHub(pi peer.AddrInfo) {
+	n.hubMu.Lock()
+	defer n.hubMu.Unlock()
+	for _, h := range n.Hubs {
+		if h.ID == pi.ID {
+			return
+		}
+	}
+	n.Hubs = append(n.Hubs, pi)
+	if n.Hub == nil {
+		n.Hub = &n.Hubs[len(n.Hubs)-1]
+	}
+}
+
+// DiscoverLANHubs looks for hubs on the local network for up to wait, using a
+// throwaway host so it can run before the user has logged in. psk may be nil.
+func DiscoverLANHubs(ctx context.Context, wait time.Duration, psk pnet.PSK) ([]peer.AddrInfo, error) {
+	opts := []libp2p.Option{libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0")}
+	if len(psk) > 0 {
+		opts = append(opts, libp2p.PrivateNetwork(psk))
+	}
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+
+	var mu sync.Mutex
+	var hubs []peer.AddrInfo
+	svc, err := StartMDNS(ctx, h, func(pi peer.AddrInfo) {
+		if !isHub(h, pi.ID) {
+			return
+		}
+		mu.Lock()
+		hubs = append(hubs, pi)
+		mu.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer svc.Close()
+
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]peer.AddrInfo(nil), hubs...), nil
+}
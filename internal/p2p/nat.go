@@ -0,0 +1,77 @@
+package p2p
+
+import (
+	"context"
+	"time"
+
+	"hillside/internal/models"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// relayLimit bounds every relayed connection, in time and in bytes each way.
+// Members reconnect once one is reset, directly if hole punching worked by then.
+var relayLimit = relay.RelayLimit{Duration: time.Hour, Data: 4 * models.MaxAttachmentSize}
+
+// RelayResources configures the circuit-relay v2 service offered by hubs and
+// designated members. Relayed connections are limited by relayLimit, which
+// marks them limited: gossipsub and blob streams are still opened on them,
+// see AllowRelayed.
+func RelayResources() relay.Resources {
+	rc := relay.DefaultResources()
+	rc.Limit = &relayLimit
+	rc.MaxReservations = 256
+	rc.MaxCircuits = 32
+	return rc
+}
+
+// AllowRelayed lets the streams opened with ctx use limited, relayed
+// connections.
+func AllowRelayed(ctx context.Context) context.Context {
+	return network.WithAllowLimitedConn(ctx, "room members behind NAT")
+}
+
+// RelayACL gates a relay: Reserve decides who may hold a reservation on it,
+// and Member who may be reached or reach others through it. A nil func lets
+// nobody in.
+type RelayACL struct {
+	Reserve func(peer.ID) bool
+	Member  func(peer.ID) bool
+}
+
+// MemberACL is the RelayACL of a relay that only members may reserve on too.
+func MemberACL(member func(peer.ID) bool) RelayACL {
+	return RelayACL{Reserve: member, Member: member}
+}
+
+func (a RelayACL) AllowReserve(p peer.ID, _ ma.Multiaddr) bool {
+	return a.Reserve != nil && a.Reserve(p)
+}
+
+func (a RelayACL) AllowConnect(src peer.ID, _ ma.Multiaddr, dest peer.ID) bool {
+	return a.Member != nil && a.Member(src) && a.Member(dest)
+}
+
+// natOptions enables NAT traversal for a client host: UPnP/NAT-PMP port mapping,
+// AutoNAT to learn whether we are reachable, DCUtR hole punching and, when we are not,
+// relay reservations on the hubs (and StaticRelays) so other members can still dial us.
+func (n *Node) natOptions() []libp2p.Option {
+	opts := []libp2p.Option{
+		libp2p.NATPortMap(),
+		libp2p.EnableNATService(),
+		libp2p.EnableRelay(),
+		libp2p.EnableHolePunching(),
+	}
+	relays := append(n.hubCandidates(), n.StaticRelays...)
+	if len(relays) > 0 {
+		opts = append(opts, libp2p.EnableAutoRelayWithStaticRelays(relays))
+	}
+	if n.RelayService {
+		opts = append(opts, libp2p.EnableRelayService(relay.WithResources(RelayResources()), relay.WithACL(MemberACL(n.RelayMembers))))
+	}
+	return opts
+}
@@ -7,14 +7,20 @@ package p2p
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"strings"
+	"sync"
+	"unicode"
 
 	libp2p "github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	lib "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
 	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
@@ -26,15 +32,96 @@ type Node struct {
 	PS   *pubsub.PubSub
 	Ctx  context.Context
 	PK   lib.PrivKey
-	Hub  *peer.AddrInfo
+	Hub  *peer.AddrInfo  // hub currently used for RPCs, one of Hubs
+	Hubs []peer.AddrInfo // every known hub, tried in order when Hub is unreachable
+
+	StaticRelays []peer.AddrInfo    // relays to reserve a slot on besides the hubs
+	RelayService bool               // act as a relay for other members
+	RelayMembers func(peer.ID) bool // who may use our relay when RelayService is on
+	LAN          bool               // isolated network: mDNS discovery and a private DHT, no public bootstrap
+	PSK          pnet.PSK           // pre-shared swarm key, peers without it can't complete a handshake
+	ListenAddrs  []string           // defaults to DefaultListenAddrs
+
+	hubMu sync.Mutex
+}
+
+// ParseHubAddrs parses a comma or space separated list of hub multiaddrs.
+func ParseHubAddrs(s string) ([]peer.AddrInfo, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	hubs := make([]peer.AddrInfo, 0, len(fields))
+	for _, f := range fields {
+		pi, err := peer.AddrInfoFromString(f)
+		if err != nil {
+			return nil, err
+		}
+		hubs = append(hubs, *pi)
+	}
+	return hubs, nil
+}
+
+// SetHubs replaces the known hubs, the first one becoming the current hub.
+func (n *Node) SetHubs(hubs []peer.AddrInfo) {
+	n.hubMu.Lock()
+	defer n.hubMu.Unlock()
+	n.Hubs = hubs
+	n.Hub = nil
+	if len(hubs) > 0 {
+		n.Hub = &n.Hubs[0]
+	}
+}
+
+// IsHub reports whether id is one of the known hubs.
+func (n *Node) IsHub(id peer.ID) bool {
+	n.hubMu.Lock()
+	defer n.hubMu.Unlock()
+	for _, h := range n.Hubs {
+		if h.ID == id {
+			return true
+		}
+	}
+	return n.Hub != nil && n.Hub.ID == id
+}
+
+// hubCandidates returns the current hub followed by the other known hubs.
+func (n *Node) hubCandidates() []peer.AddrInfo {
+	n.hubMu.Lock()
+	defer n.hubMu.Unlock()
+	var out []peer.AddrInfo
+	if n.Hub != nil {
+		out = append(out, *n.Hub)
+	}
+	for _, h := range n.Hubs {
+		if n.Hub == nil || h.ID != n.Hub.ID {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func (n *Node) setCurrentHub(id peer.ID) {
+	n.hubMu.Lock()
+	defer n.hubMu.Unlock()
+	for i := range n.Hubs {
+		if n.Hubs[i].ID == id {
+			n.Hub = &n.Hubs[i]
+			return
+		}
+	}
 }
 
 func (n *Node) InitHost(listenAddrs []string) error {
 	pk := n.PK
-	host, err := libp2p.New(
+	if len(n.PSK) > 0 {
+		listenAddrs = PrivateNetworkListenAddrs(listenAddrs)
+	}
+	opts := append([]libp2p.Option{
 		libp2p.Identity(pk),
 		libp2p.ListenAddrStrings(listenAddrs...),
-	)
+	}, n.natOptions()...)
+	if len(n.PSK) > 0 {
+		opts = append(opts, libp2p.PrivateNetwork(n.PSK))
+	}
+	host, err := libp2p.New(opts...)
 	if err != nil {
 		return err
 	}
@@ -43,11 +130,17 @@ func (n *Node) InitHost(listenAddrs []string) error {
 }
 
 func (n *Node) InitDHT() error {
-	dhtOpts := []dht.Option{
-		dht.Mode(dht.ModeServer),
-		// include the Hub and public IPFS peers as bootstrap
-		dht.BootstrapPeers(*n.Hub),
+	// include the Hub and public IPFS peers as bootstrap, so the DHT
+	// (and the directory records found through it) survives a hub outage
+	bootstrap := n.hubCandidates()
+	dhtOpts := []dht.Option{dht.Mode(dht.ModeServer)}
+	if n.LAN {
+		dhtOpts = append(dhtOpts, dht.ProtocolPrefix(LANProtocolPrefix))
+	} else if len(n.PSK) == 0 {
+		// public bootstrap peers can't join a private network anyway
+		bootstrap = append(bootstrap, dht.GetDefaultBootstrapPeerAddrInfos()...)
 	}
+	dhtOpts = append(dhtOpts, dht.BootstrapPeers(bootstrap...))
 	dht, err := dht.New(n.Ctx, n.Host, dhtOpts...)
 	if err != nil {
 		return err
@@ -60,7 +153,9 @@ func (n *Node) InitDHT() error {
 }
 
 func (n *Node) InitPubSub() error {
-	ps, err := pubsub.NewGossipSub(n.Ctx, n.Host)
+	ps, err := pubsub.NewGossipSub(AllowRelayed(n.Ctx), n.Host,
+		pubsub.WithPeerScore(PeerScoreParams(), PeerScoreThresholds()),
+	)
 	if err != nil {
 		return err
 	}
@@ -68,13 +163,38 @@ func (n *Node) InitPubSub() error {
 	return nil
 }
 
+// AnonymousPublish publishes a message signed by a throwaway identity, made
+// for it alone, so that neither the gossipsub author nor its signature name
+// the peer that sent it.
+func AnonymousPublish() (pubsub.PubOpt, error) {
+	priv, _, err := lib.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pubsub.WithSecretKeyAndPeerId(priv, pid), nil
+}
+
 func (n *Node) InitNode() error {
-	if err := n.InitHost([]string{"/ip4/0.0.0.0/tcp/0"}); err != nil {
+	listenAddrs := n.ListenAddrs
+	if len(listenAddrs) == 0 {
+		listenAddrs = DefaultListenAddrs
+	}
+	if err := n.InitHost(listenAddrs); err != nil {
 		return err
 	}
 
-	if err := n.Host.Connect(n.Ctx, *n.Hub); err != nil {
-		return err
+	// an unreachable hub is not fatal, see HubReachable
+	for _, h := range n.hubCandidates() {
+		_ = n.Host.Connect(n.Ctx, h)
+	}
+	if n.LAN {
+		if err := n.startLAN(); err != nil {
+			return err
+		}
 	}
 	if err := n.InitDHT(); err != nil {
 		return err
@@ -86,12 +206,44 @@ func (n *Node) InitNode() error {
 	return nil
 }
 
+// HubReachable reports whether the node currently has a connection to any hub.
+func (n *Node) HubReachable() bool {
+	if n.Host == nil {
+		return false
+	}
+	for _, h := range n.hubCandidates() {
+		if n.Host.Network().Connectedness(h.ID) == network.Connected {
+			return true
+		}
+	}
+	return false
+}
+
+// SendRPC calls method on the current hub. When the hub can't be reached the
+// other known hubs are tried in order, and the first that answers becomes current.
+// Once a stream is open the call is never retried elsewhere, as it may not be idempotent.
 func (n *Node) SendRPC(method string, params, out any) error {
-	pi := n.Hub
+	hubs := n.hubCandidates()
+	if len(hubs) == 0 {
+		return ErrNoHub
+	}
 
-	s, err := n.Host.NewStream(n.Ctx, pi.ID, protocol.ID(protocolID))
+	var s network.Stream
+	var err error
+	for _, pi := range hubs {
+		if n.Host.Network().Connectedness(pi.ID) != network.Connected {
+			if err = n.Host.Connect(n.Ctx, pi); err != nil {
+				continue
+			}
+		}
+		s, err = n.Host.NewStream(n.Ctx, pi.ID, protocol.ID(protocolID))
+		if err == nil {
+			n.setCurrentHub(pi.ID)
+			break
+		}
+	}
 	if err != nil {
-		return err
+		return ErrHubUnreachable.WithDetails(err.Error())
 	}
 	defer s.Close()
 
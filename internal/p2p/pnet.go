@@ -0,0 +1,39 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/libp2p/go-libp2p/core/pnet"
+)
+
+// LoadSwarmKey reads a pre-shared key in the swarm.key format used by go-ipfs:
+//
+//	/key/swarm/psk/1.0.0/
+//	/base16/
+//	<64 hex characters>
+func LoadSwarmKey(path string) (pnet.PSK, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, ErrInvalidSwarmKey.WithDetails(err.Error())
+	}
+	return psk, nil
+}
+
+// WriteSwarmKey generates a random 32 byte pre-shared key and writes it in swarm.key format.
+func WriteSwarmKey(w io.Writer) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "/key/swarm/psk/1.0.0/\n/base16/\n%s\n", hex.EncodeToString(key))
+	return err
+}
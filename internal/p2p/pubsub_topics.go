@@ -5,9 +5,12 @@ import "fmt"
 // Topic namespace root
 const topicRoot = "/hillside"
 
-// ServersTopic learn about active servers (unimplemented)
+// ServersTopic learn about active servers (published by the hub)
 func ServersTopic() string { return topicRoot + "/servers" }
 
+// DirectoryTopic for owner-signed server and room records, so servers can be found without a hub
+func DirectoryTopic() string { return topicRoot + "/directory" }
+
 // ServerMetaTopic for server metadata
 func ServerMetaTopic(sid string) string {
 	return fmt.Sprintf("%s/servers/%s/meta", topicRoot, sid)
@@ -42,12 +45,12 @@ func UserUpdateTopic(sid, rid string) string {
 	return fmt.Sprintf("%s/servers/%s/rooms/%s/user_update", topicRoot, sid, rid)
 }
 
-// HistoryReqTopic to allow late joiners to request past ciphertexts (unimplemented)
+// HistoryReqTopic to allow members to request past ciphertexts they don't have
 func HistoryReqTopic(sid, rid string) string {
 	return fmt.Sprintf("%s/servers/%s/rooms/%s/history/req", topicRoot, sid, rid)
 }
 
-// HistoryRespTopic for responses to history requests (unimplemented)
+// HistoryRespTopic for responses to history requests
 func HistoryRespTopic(sid, rid, pid string) string {
 	return fmt.Sprintf("%s/servers/%s/rooms/%s/history/resp/%s", topicRoot, sid, rid, pid)
 }
@@ -0,0 +1,60 @@
+package p2p
+
+import (
+	"time"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// PeerScoreParams are the global gossipsub scoring parameters used by every node.
+// Topic specific parameters are attached per topic (see ChatTopicScoreParams).
+func PeerScoreParams() *pubsub.PeerScoreParams {
+	return &pubsub.PeerScoreParams{
+		Topics:            make(map[string]*pubsub.TopicScoreParams),
+		AppSpecificScore:  func(peer.ID) float64 { return 0 },
+		AppSpecificWeight: 1,
+
+		// Disabled: room members on the same LAN or host share an IP.
+		IPColocationFactorWeight: 0,
+
+		BehaviourPenaltyWeight:    -10,
+		BehaviourPenaltyThreshold: 6,
+		BehaviourPenaltyDecay:     pubsub.ScoreParameterDecay(10 * time.Minute),
+
+		DecayInterval: time.Second,
+		DecayToZero:   0.01,
+		RetainScore:   30 * time.Minute,
+	}
+}
+
+// PeerScoreThresholds controls when a badly scored peer stops receiving gossip,
+// stops being published to, and finally gets graylisted.
+func PeerScoreThresholds() *pubsub.PeerScoreThresholds {
+	return &pubsub.PeerScoreThresholds{
+		GossipThreshold:             -100,
+		PublishThreshold:            -500,
+		GraylistThreshold:           -1000,
+		AcceptPXThreshold:           10,
+		OpportunisticGraftThreshold: 5,
+	}
+}
+
+// ChatTopicScoreParams rewards peers that stay in the mesh and deliver messages first,
+// and heavily penalizes peers that forward messages rejected by the chat validator.
+func ChatTopicScoreParams() *pubsub.TopicScoreParams {
+	return &pubsub.TopicScoreParams{
+		TopicWeight: 1,
+
+		TimeInMeshWeight:  0.01,
+		TimeInMeshQuantum: time.Second,
+		TimeInMeshCap:     3600,
+
+		FirstMessageDeliveriesWeight: 1,
+		FirstMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(10 * time.Minute),
+		FirstMessageDeliveriesCap:    50,
+
+		InvalidMessageDeliveriesWeight: -100,
+		InvalidMessageDeliveriesDecay:  pubsub.ScoreParameterDecay(time.Hour),
+	}
+}
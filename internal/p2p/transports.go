@@ -0,0 +1,33 @@
+package p2p
+
+import (
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// DefaultListenAddrs are the client listen addresses unless configured otherwise:
+// TCP, QUIC and WebSocket on random ports. When dialing, the swarm's default dial
+// ranker tries QUIC first and falls back to TCP and WebSocket shortly after.
+var DefaultListenAddrs = []string{
+	"/ip4/0.0.0.0/tcp/0",
+	"/ip4/0.0.0.0/udp/0/quic-v1",
+	"/ip4/0.0.0.0/tcp/0/ws",
+}
+
+// PrivateNetworkListenAddrs drops UDP based addresses (QUIC, WebTransport, WebRTC),
+// which libp2p can't protect with a pre-shared key.
+func PrivateNetworkListenAddrs(addrs []string) []string {
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		m, err := ma.NewMultiaddr(a)
+		if err != nil {
+			// let libp2p report the bad address
+			out = append(out, a)
+			continue
+		}
+		if _, err := m.ValueForProtocol(ma.P_UDP); err == nil {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
@@ -1,11 +1,16 @@
 package profile
 
+import "hillside/internal/crypto"
+
 type Profile struct {
-	Username         string `json:"username"`
-	PasswordSalt     []byte `json:"password_salt"`
-	PasswordChecksum []byte `json:"password_checksum"`
-	DilithiumPrivEnc []byte `json:"dilithium_priv_enc"` // encrypted w/ password
-	KyberPrivEnc     []byte `json:"kyber_priv_enc"`     // encrypted w/ password
-	Libp2pPrivEnc    []byte `json:"libp2p_priv_enc"`    // encrypted w/ password
-	PeerID           string `json:"peer_id"`
+	Username         string            `json:"username"`
+	KDF              *crypto.KDFParams `json:"kdf,omitempty"` // nil on profiles from before versioned KDFs
+	PasswordSalt     []byte            `json:"password_salt"` // same as KDF.Salt, read when KDF is nil
+	PasswordChecksum []byte            `json:"password_checksum"`
+	DilithiumPrivEnc []byte            `json:"dilithium_priv_enc"`      // encrypted w/ password
+	KyberPrivEnc     []byte            `json:"kyber_priv_enc"`          // encrypted w/ password
+	SigPrivsEnc      map[string][]byte `json:"sig_privs_enc,omitempty"` // hybrid keys by algorithm, encrypted w/ password
+	KEMPrivsEnc      map[string][]byte `json:"kem_privs_enc,omitempty"` // hybrid keys by algorithm, encrypted w/ password
+	Libp2pPrivEnc    []byte            `json:"libp2p_priv_enc"`         // encrypted w/ password
+	PeerID           string            `json:"peer_id"`
 }
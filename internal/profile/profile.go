@@ -1,6 +1,7 @@
 package profile
 
 import (
+	"crypto/cipher"
 	"encoding/json"
 	"os"
 
@@ -9,78 +10,199 @@ import (
 	"hillside/internal/utils"
 )
 
-func GenerateProfile(username string, pass string) (*Profile, error) {
+// keyset is a profile's private keys in the clear.
+type keyset struct {
+	dilithium, kyber, libp2p []byte
+	sig, kem                 map[string][]byte // hybrid keys by algorithm
+}
 
-	passKey, unlocker, salt, err := crypto.GenPasskeys(pass, nil) // idk what the unlocker is for tbh
-	if err != nil {
-		return nil, ErrProfileCreation.WithDetails(err.Error())
+// addMissingKeys generates a key for every supported algorithm the set has no
+// key for yet, and reports whether it added any.
+func (ks *keyset) addMissingKeys() (bool, error) {
+	if ks.sig == nil {
+		ks.sig = make(map[string][]byte)
+	}
+	if ks.kem == nil {
+		ks.kem = make(map[string][]byte)
 	}
+	added := false
+	for _, alg := range crypto.SigAlgs {
+		if alg == crypto.SigAlgDilithium2 || ks.sig[alg] != nil {
+			continue
+		}
+		_, priv, err := crypto.GenSigKeyFor(alg)
+		if err != nil {
+			return false, err
+		}
+		ks.sig[alg] = priv
+		added = true
+	}
+	for _, alg := range crypto.KEMAlgs {
+		if alg == crypto.KEMAlgKyber1024 || ks.kem[alg] != nil {
+			continue
+		}
+		_, priv, err := crypto.GenKEMKeyFor(alg)
+		if err != nil {
+			return false, err
+		}
+		ks.kem[alg] = priv
+		added = true
+	}
+	return added, nil
+}
 
+func GenerateProfile(username string, pass string) (*Profile, error) {
 	// Key generation
-	_, dilPrivBytes, err := crypto.GenSignKey()
+	var keys keyset
+	var err error
+	_, keys.dilithium, err = crypto.GenSignKey()
 	if err != nil {
 		return nil, ErrProfileCreation.WithDetails(err.Error())
 	}
 
-	_, kemPrivBytes, err := crypto.GenKEMKey()
+	_, keys.kyber, err = crypto.GenKEMKey()
 	if err != nil {
 		return nil, ErrProfileCreation.WithDetails(err.Error())
 	}
 
-	libPrivBytes, _, pid, err := crypto.GenP2PKey()
-	if err != nil {
+	if _, err := keys.addMissingKeys(); err != nil {
 		return nil, ErrProfileCreation.WithDetails(err.Error())
 	}
 
-	aead, err := crypto.DeriveChaChaKey(passKey)
+	libPrivBytes, _, pid, err := crypto.GenP2PKey()
 	if err != nil {
 		return nil, ErrProfileCreation.WithDetails(err.Error())
 	}
+	keys.libp2p = libPrivBytes
 
-	dilEnc, err := crypto.SealAEAD(dilPrivBytes, aead)
-	if err != nil {
+	prof := &Profile{
+		Username: username,
+		PeerID:   pid,
+	}
+	if err := prof.seal(pass, &keys); err != nil {
 		return nil, ErrProfileCreation.WithDetails(err.Error())
 	}
 
-	kemEnc, err := crypto.SealAEAD(kemPrivBytes, aead)
+	// Saving to disk
+
+	profilePath, err := createProfilePath(username)
 	if err != nil {
-		return nil, ErrProfileCreation.WithDetails(err.Error())
+		return nil, err
+	}
+	if err := writeProfile(*profilePath, prof); err != nil {
+		return nil, err
 	}
 
-	libEnc, err := crypto.SealAEAD(libPrivBytes, aead)
+	return prof, nil
+}
+
+// seal encrypts the private keys under a key derived from pass with fresh,
+// current KDF parameters.
+func (prof *Profile) seal(pass string, keys *keyset) error {
+	params, err := crypto.NewKDFParams()
 	if err != nil {
-		return nil, ErrProfileCreation.WithDetails(err.Error())
+		return err
 	}
-
-	prof := &Profile{
-		Username:         username,
-		PasswordSalt:     salt,
-		PasswordChecksum: unlocker,
-		DilithiumPrivEnc: dilEnc,
-		KyberPrivEnc:     kemEnc,
-		Libp2pPrivEnc:    libEnc,
-		PeerID:           pid,
+	passKey, checksum, err := params.Derive(pass)
+	if err != nil {
+		return err
+	}
+	aead, err := crypto.DeriveChaChaKey(passKey)
+	if err != nil {
+		return err
 	}
 
-	// Saving to disk
-
-	profilePath, err := createProfilePath(username)
+	dilEnc, err := crypto.SealAEAD(keys.dilithium, aead)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	file, err := os.Create(*profilePath)
+	kemEnc, err := crypto.SealAEAD(keys.kyber, aead)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	libEnc, err := crypto.SealAEAD(keys.libp2p, aead)
+	if err != nil {
+		return err
+	}
+	sigEnc, err := sealAll(keys.sig, aead)
+	if err != nil {
+		return err
+	}
+	kemsEnc, err := sealAll(keys.kem, aead)
+	if err != nil {
+		return err
 	}
 
-	defer file.Close()
+	prof.KDF = params
+	prof.PasswordSalt = params.Salt
+	prof.PasswordChecksum = checksum
+	prof.DilithiumPrivEnc = dilEnc
+	prof.KyberPrivEnc = kemEnc
+	prof.SigPrivsEnc = sigEnc
+	prof.KEMPrivsEnc = kemsEnc
+	prof.Libp2pPrivEnc = libEnc
+	return nil
+}
 
-	enc := json.NewEncoder(file)
-	if err := enc.Encode(prof); err != nil {
-		return nil, err
+func sealAll(keys map[string][]byte, aead cipher.AEAD) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(keys))
+	for alg, key := range keys {
+		enc, err := crypto.SealAEAD(key, aead)
+		if err != nil {
+			return nil, err
+		}
+		out[alg] = enc
 	}
+	return out, nil
+}
 
-	return prof, nil
+func openAll(encs map[string][]byte, aead cipher.AEAD) (map[string][]byte, error) {
+	out := make(map[string][]byte, len(encs))
+	for alg, enc := range encs {
+		key, err := crypto.OpenAEAD(enc, aead)
+		if err != nil {
+			return nil, err
+		}
+		out[alg] = key
+	}
+	return out, nil
+}
+
+// publicKeys derives the tagged public keys of privs, ordered as prefs.
+func publicKeys(prefs []string, privs map[string][]byte, derive func(alg string, priv []byte) ([]byte, error)) ([]models.PublicKey, error) {
+	var out []models.PublicKey
+	for _, alg := range prefs {
+		priv, ok := privs[alg]
+		if !ok {
+			continue
+		}
+		pub, err := derive(alg, priv)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, models.PublicKey{Alg: alg, Key: pub})
+	}
+	return out, nil
+}
+
+// writeProfile replaces the profile file atomically, so an interrupted
+// migration never leaves a half-written profile behind.
+func writeProfile(path string, prof *Profile) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(prof); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
 func LoadProfile(usrname string, pass string, path string) (*models.Keybag, *models.User, error) {
@@ -101,55 +223,100 @@ func LoadProfile(usrname string, pass string, path string) (*models.Keybag, *mod
 	if err := dec.Decode(&prof); err != nil {
 		return nil, nil, err
 	}
-	passKey, _, _, err := crypto.GenPasskeys(pass, prof.PasswordSalt)
+	params := prof.KDF
+	if params == nil {
+		params = crypto.LegacyKDFParams(prof.PasswordSalt)
+	}
+	passKey, checksum, err := params.Derive(pass)
 	if err != nil {
 		return nil, nil, ErrProfileLoad.WithDetails(err.Error())
 	}
+	if !crypto.CheckPasswordChecksum(checksum, prof.PasswordChecksum) {
+		return nil, nil, ErrInvalidPassword
+	}
 
 	aead, err := crypto.DeriveChaChaKey(passKey)
 	if err != nil {
 		return nil, nil, ErrProfileLoad.WithDetails(err.Error())
 	}
 
-	dilPrivBytes, err := crypto.OpenAEAD(prof.DilithiumPrivEnc, aead)
+	var keys keyset
+	keys.dilithium, err = crypto.OpenAEAD(prof.DilithiumPrivEnc, aead)
 	if err != nil {
 		return nil, nil, ErrInvalidPassword.WithDetails(err.Error())
 	}
 
-	kemPrivBytes, err := crypto.OpenAEAD(prof.KyberPrivEnc, aead)
+	keys.kyber, err = crypto.OpenAEAD(prof.KyberPrivEnc, aead)
 	if err != nil {
 		return nil, nil, ErrInvalidPassword.WithDetails(err.Error())
 	}
 
-	libPrivBytes, err := crypto.OpenAEAD(prof.Libp2pPrivEnc, aead)
+	keys.libp2p, err = crypto.OpenAEAD(prof.Libp2pPrivEnc, aead)
 	if err != nil {
 		return nil, nil, ErrInvalidPassword.WithDetails(err.Error())
 	}
 
-	_, _, dilPubBytes, err := crypto.DeriveSignKey(dilPrivBytes)
+	if keys.sig, err = openAll(prof.SigPrivsEnc, aead); err != nil {
+		return nil, nil, ErrInvalidPassword.WithDetails(err.Error())
+	}
+	if keys.kem, err = openAll(prof.KEMPrivsEnc, aead); err != nil {
+		return nil, nil, ErrInvalidPassword.WithDetails(err.Error())
+	}
+
+	// Profiles from before hybrid keys get them now; the identity (peer ID and
+	// legacy keys) is unchanged, so existing rooms keep working.
+	added, err := keys.addMissingKeys()
+	if err != nil {
+		return nil, nil, ErrProfileLoad.WithDetails(err.Error())
+	}
+
+	if added || params.Version < crypto.KDFVersionCurrent {
+		// Re-seal under current parameters. On failure the old profile stays
+		// usable and the migration is retried on the next login.
+		migrated := prof
+		if err := migrated.seal(pass, &keys); err == nil {
+			writeProfile(*profilePath, &migrated)
+		}
+	}
+
+	_, _, dilPubBytes, err := crypto.DeriveSignKey(keys.dilithium)
+	if err != nil {
+		return nil, nil, ErrProfileLoad.WithDetails("Profile file is corrupted: " + err.Error())
+	}
+
+	_, _, kyberPubBytes, err := crypto.DeriveKEMKey(keys.kyber)
+	if err != nil {
+		return nil, nil, ErrProfileLoad.WithDetails("Profile file is corrupted: " + err.Error())
+	}
+
+	libPriv, _, libPubBytes, err := crypto.DeriveP2PKey(keys.libp2p)
 	if err != nil {
 		return nil, nil, ErrProfileLoad.WithDetails("Profile file is corrupted: " + err.Error())
 	}
 
-	_, _, kyberPubBytes, err := crypto.DeriveKEMKey(kemPrivBytes)
+	sigKeys, err := publicKeys(crypto.SigAlgs, keys.sig, crypto.SigPublicKey)
 	if err != nil {
 		return nil, nil, ErrProfileLoad.WithDetails("Profile file is corrupted: " + err.Error())
 	}
 
-	libPriv, _, libPubBytes, err := crypto.DeriveP2PKey(libPrivBytes)
+	kemKeys, err := publicKeys(crypto.KEMAlgs, keys.kem, crypto.KEMPublicKey)
 	if err != nil {
 		return nil, nil, ErrProfileLoad.WithDetails("Profile file is corrupted: " + err.Error())
 	}
 
 	kb := &models.Keybag{
-		DilithiumPriv: dilPrivBytes,
-		KyberPriv:     kemPrivBytes,
+		DilithiumPriv: keys.dilithium,
+		KyberPriv:     keys.kyber,
+		SigPrivs:      keys.sig,
+		KEMPrivs:      keys.kem,
 		Libp2pPriv:    libPriv,
 	}
 
 	usr := &models.User{
 		DilithiumPub:   dilPubBytes,
 		KyberPub:       kyberPubBytes,
+		SigKeys:        sigKeys,
+		KEMKeys:        kemKeys,
 		Libp2pPub:      libPubBytes,
 		PeerID:         prof.PeerID,
 		Username:       prof.Username,
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"hillside/internal/models"
+)
+
+// MigrateAlgorithms adds the algorithm-agility columns to databases created
+// before them: the tagged public keys of each peer and the signature
+// algorithm of each message (NULL meaning Dilithium2).
+func (s *Store) MigrateAlgorithms() error {
+	if err := s.addColumn("peers", "sig_keys", "BLOB"); err != nil {
+		return err
+	}
+	if err := s.addColumn("peers", "kem_keys", "BLOB"); err != nil {
+		return err
+	}
+	return s.addColumn("messages", "sig_alg", "TEXT")
+}
+
+// addColumn adds column to table unless it is already there.
+func (s *Store) addColumn(table, column, decl string) error {
+	rows, err := s.db.Query(fmt.Sprintf(`PRAGMA table_info(%s);`, table))
+	if err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    any
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+func marshalKeys(keys []models.PublicKey) ([]byte, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(keys)
+}
+
+func unmarshalKeys(data []byte) ([]models.PublicKey, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var keys []models.PublicKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("decode keys: %w", err)
+	}
+	return keys, nil
+}
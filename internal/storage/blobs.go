@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"hillside/internal/crypto"
+)
+
+// BlobCache is a content-addressed store of encrypted attachment blobs, one
+// file per blob named by its hash. Downloads in progress sit next to them
+// with a .part suffix, so they can be resumed, until they are verified.
+type BlobCache struct {
+	dir string
+}
+
+// NewBlobCache opens the cache in dir, creating it if needed.
+func NewBlobCache(dir string) (*BlobCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create blob cache: %w", err)
+	}
+	return &BlobCache{dir: dir}, nil
+}
+
+// path returns where the blob with hash lives, refusing anything that isn't a
+// hex SHA-256 so peers can't name other files.
+func (c *BlobCache) path(hash string) (string, error) {
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size || hex.EncodeToString(b) != hash {
+		return "", ErrBlobNotFound.WithDetails("bad hash " + hash)
+	}
+	return filepath.Join(c.dir, hash), nil
+}
+
+// Has reports whether the complete blob with hash is in the cache.
+func (c *BlobCache) Has(hash string) bool {
+	p, err := c.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// Open opens the complete blob with hash for reading and returns its size.
+func (c *BlobCache) Open(hash string) (*os.File, int64, error) {
+	p, err := c.path(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrBlobNotFound.WithDetails(hash)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
+
+// Encrypt encrypts r under key into the cache and returns the size and hash
+// of the blob.
+func (c *BlobCache) Encrypt(r io.Reader, key []byte) (int64, string, error) {
+	tmp, err := os.CreateTemp(c.dir, "encrypt-*.part")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name())
+	size, hash, err := crypto.EncryptBlob(r, tmp, key)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	p, err := c.path(hash)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return 0, "", err
+	}
+	return size, hash, nil
+}
+
+// Decrypt decrypts the blob with hash under key into w.
+func (c *BlobCache) Decrypt(hash string, key []byte, w io.Writer) error {
+	f, _, err := c.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return crypto.DecryptBlob(f, w, key)
+}
+
+// Partial opens the download of the blob with hash for appending and returns
+// how much of it was already received.
+func (c *BlobCache) Partial(hash string) (*os.File, int64, error) {
+	p, err := c.path(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(p+".part", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, st.Size(), nil
+}
+
+// Complete checks the download of the blob with hash has the expected size
+// and hash, and moves it into the cache. A download that doesn't match is
+// discarded so it is fetched again from scratch.
+func (c *BlobCache) Complete(hash string, size int64) error {
+	p, err := c.path(hash)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(p + ".part")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if n != size || hex.EncodeToString(h.Sum(nil)) != hash {
+		_ = os.Remove(p + ".part")
+		return ErrBadBlob.WithDetails(hash)
+	}
+	return os.Rename(p+".part", p)
+}
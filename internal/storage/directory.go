@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"hillside/internal/models"
+)
+
+// MigrateDirectory creates the directory table caching owner-signed server records,
+// so servers and rooms stay browsable while the hub is unreachable.
+func (s *Store) MigrateDirectory() error {
+	const sqlStmt = `
+CREATE TABLE IF NOT EXISTS directory (
+	server_id TEXT PRIMARY KEY,
+	owner_peer_id TEXT NOT NULL,
+	version INTEGER NOT NULL, -- unix micro, set by the owner
+	record BLOB NOT NULL, -- signed models.DirectoryRecord (JSON)
+	updated_at INTEGER NOT NULL -- unix micro
+);
+`
+	_, err := s.db.Exec(sqlStmt)
+	return err
+}
+
+// SaveDirectoryRecord stores a verified record. Older versions, and records claiming
+// a server already owned by someone else, are ignored. It reports whether the row changed.
+// Server IDs are bound to their owner (see p2p.ServerIDOwnedBy), so the first owner seen
+// is the only one that can be.
+func (s *Store) SaveDirectoryRecord(ctx context.Context, rec *models.DirectoryRecord, entry *models.DirectoryEntry) (bool, error) {
+	blob, err := json.Marshal(rec)
+	if err != nil {
+		return false, fmt.Errorf("save directory record: %w", err)
+	}
+	const q = `
+INSERT INTO directory (server_id, owner_peer_id, version, record, updated_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT(server_id) DO UPDATE SET
+	version = excluded.version,
+	record = excluded.record,
+	updated_at = excluded.updated_at
+WHERE excluded.version > directory.version
+	AND excluded.owner_peer_id = directory.owner_peer_id;
+`
+	res, err := s.db.ExecContext(ctx, q, entry.Server.ID, rec.OwnerPeerID, entry.Version, blob, time.Now().UnixMicro())
+	if err != nil {
+		return false, fmt.Errorf("save directory record: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetDirectoryRecord returns the cached record of a server, or ErrNoRows.
+func (s *Store) GetDirectoryRecord(ctx context.Context, serverID string) (*models.DirectoryRecord, error) {
+	const q = `SELECT record FROM directory WHERE server_id = ?;`
+	var blob []byte
+	if err := s.db.QueryRowContext(ctx, q, serverID).Scan(&blob); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+		return nil, fmt.Errorf("get directory record: %w", err)
+	}
+	var rec models.DirectoryRecord
+	if err := json.Unmarshal(blob, &rec); err != nil {
+		return nil, fmt.Errorf("get directory record: %w", err)
+	}
+	return &rec, nil
+}
+
+// ListDirectoryRecords returns every cached record, most recently updated first.
+func (s *Store) ListDirectoryRecords(ctx context.Context) ([]models.DirectoryRecord, error) {
+	const q = `SELECT record FROM directory ORDER BY updated_at DESC;`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list directory records: %w", err)
+	}
+	defer rows.Close()
+	var out []models.DirectoryRecord
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, fmt.Errorf("list directory records scan: %w", err)
+		}
+		var rec models.DirectoryRecord
+		if err := json.Unmarshal(blob, &rec); err != nil {
+			return nil, fmt.Errorf("list directory records: %w", err)
+		}
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
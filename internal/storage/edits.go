@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"hillside/internal/models"
+)
+
+// MigrateEdits adds the columns tracking edits and deletions: edit and delete
+// rows point at the chain index of their target, which records when it was
+// last edited or tombstoned.
+func (s *Store) MigrateEdits() error {
+	if err := s.addColumn("messages", "target_index", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumn("messages", "edited_at", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumn("messages", "deleted_at", "INTEGER"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_room_target ON messages (room_id, target_index) WHERE target_index IS NOT NULL;`)
+	return err
+}
+
+// SaveEdit stores an edit or delete message, then applies it to its target if
+// that is a chat message of the room sent by target.SenderID. Deleting erases
+// the signature and payload of the target and of every edit of it, and drops
+// its reactions and its words from the search index. Saving the same message again is harmless, which lets
+// messages stored by catch-up be applied once decrypted. It reports whether
+// the target was changed.
+func (s *Store) SaveEdit(ctx context.Context, msg models.StoredMessage, target models.MessageRef) (bool, error) {
+	if msg.ChainIndex == nil {
+		return false, fmt.Errorf("save edit: no chain index")
+	}
+	var apply string
+	switch msg.MsgType {
+	case models.MsgTypeEdit:
+		apply = `
+UPDATE messages SET edited_at = MAX(COALESCE(edited_at, 0), ?)
+WHERE room_id = ? AND chain_index = ? AND sender_id = ? AND msg_type = 'chat' AND deleted_at IS NULL;
+`
+	case models.MsgTypeDelete:
+		apply = `
+UPDATE messages SET deleted_at = ?, signature = X'', payload = X''
+WHERE room_id = ? AND chain_index = ? AND sender_id = ? AND msg_type = 'chat' AND deleted_at IS NULL;
+`
+	default:
+		return false, fmt.Errorf("save edit: unexpected message type %s", msg.MsgType)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("save edit: %w", err)
+	}
+	defer tx.Rollback()
+
+	var alg any
+	if msg.SigAlg != "" {
+		alg = msg.SigAlg
+	}
+	const qInsert = `
+INSERT OR IGNORE INTO messages
+(room_id, server_id, chain_index, msg_type, sender_id, timestamp, sig_alg, signature, payload)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+	if _, err := tx.ExecContext(ctx, qInsert, msg.RoomID, msg.ServerID, int64(*msg.ChainIndex), string(msg.MsgType),
+		msg.SenderID, msg.Timestamp, alg, msg.Signature, msg.Payload); err != nil {
+		return false, fmt.Errorf("insert edit: %w", err)
+	}
+	const qTarget = `UPDATE messages SET target_index = ? WHERE room_id = ? AND chain_index = ? AND msg_type = ?;`
+	if _, err := tx.ExecContext(ctx, qTarget, int64(target.ChainIndex), msg.RoomID, int64(*msg.ChainIndex), string(msg.MsgType)); err != nil {
+		return false, fmt.Errorf("link edit: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, apply, msg.Timestamp, msg.RoomID, int64(target.ChainIndex), target.SenderID)
+	if err != nil {
+		return false, fmt.Errorf("apply edit: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	// edits of a deleted message go with it, whichever arrived first
+	const qErase = `
+UPDATE messages SET deleted_at = ?, signature = X'', payload = X''
+WHERE room_id = ? AND msg_type = 'edit' AND target_index = ? AND deleted_at IS NULL
+AND EXISTS (SELECT 1 FROM messages WHERE room_id = ? AND chain_index = ? AND deleted_at IS NOT NULL);
+`
+	if _, err := tx.ExecContext(ctx, qErase, msg.Timestamp, msg.RoomID, int64(target.ChainIndex), msg.RoomID, int64(target.ChainIndex)); err != nil {
+		return false, fmt.Errorf("erase edits: %w", err)
+	}
+	if msg.MsgType == models.MsgTypeDelete && n > 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM reactions WHERE room_id = ? AND chain_index = ?;`, msg.RoomID, int64(target.ChainIndex)); err != nil {
+			return false, fmt.Errorf("erase reactions: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM search_index WHERE room_id = ? AND chain_index = ?;`, msg.RoomID, int64(target.ChainIndex)); err != nil {
+			return false, fmt.Errorf("unindex message: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("save edit: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetEditHistory returns the edits of the chat message at chainIndex, oldest
+// first. They are still encrypted, each at its own chain index.
+func (s *Store) GetEditHistory(ctx context.Context, roomID string, chainIndex uint64) ([]models.StoredMessage, error) {
+	const q = `
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND msg_type = 'edit' AND target_index = ? AND deleted_at IS NULL
+ORDER BY chain_index ASC;
+`
+	rows, err := s.db.QueryContext(ctx, q, roomID, int64(chainIndex))
+	if err != nil {
+		return nil, fmt.Errorf("select edit history: %w", err)
+	}
+	return scanMessages(rows)
+}
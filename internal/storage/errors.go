@@ -6,4 +6,6 @@ var (
 	ErrNoRows         = utils.NewHillsideError("no rows in result set")
 	ErrDBNotConnected = utils.NewHillsideError("database not connected")
 	ErrCannotConnect  = utils.NewHillsideError("cannot connect to database")
+	ErrBlobNotFound   = utils.NewHillsideError("blob not found")
+	ErrBadBlob        = utils.NewHillsideError("blob does not match its hash")
 )
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"hillside/internal/models"
+)
+
+// ExportQuery selects the chat messages of a room for an export. Zero times
+// leave the range open on that side.
+type ExportQuery struct {
+	RoomID string
+	Since  time.Time
+	Until  time.Time
+}
+
+// GetMessagesForExport returns up to limit chat messages of q from chain index
+// fromIndex on, deleted ones included, ordered ASC. Their edits are stored
+// apart, see GetEditHistory.
+func (s *Store) GetMessagesForExport(ctx context.Context, q ExportQuery, fromIndex uint64, limit int) ([]models.StoredMessage, error) {
+	const sel = `
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND msg_type = 'chat' AND chain_index IS NOT NULL AND chain_index >= ?
+  AND timestamp >= ? AND timestamp < ?
+ORDER BY chain_index ASC
+LIMIT ?;
+`
+	since, until := int64(0), int64(math.MaxInt64)
+	if !q.Since.IsZero() {
+		since = q.Since.UnixMicro()
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.UnixMicro()
+	}
+	rows, err := s.db.QueryContext(ctx, sel, q.RoomID, int64(min(fromIndex, math.MaxInt64)), since, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select messages for export: %w", err)
+	}
+	return scanMessages(rows)
+}
+
+// ArchiveHeader is what an archive says about itself before its messages.
+type ArchiveHeader struct {
+	RoomID   string
+	RoomName string
+	Exported time.Time
+}
+
+// ArchiveWriter writes exported messages in one of the export formats, one
+// at a time, so long histories are never held whole.
+type ArchiveWriter struct {
+	w      *bufio.Writer
+	format models.ExportFormat
+	count  int
+}
+
+// archiveTime is how Markdown and text archives show times.
+const archiveTime = "2006-01-02 15:04:05"
+
+// NewArchiveWriter starts an archive of format on w with its header.
+func NewArchiveWriter(w io.Writer, format models.ExportFormat, h ArchiveHeader) (*ArchiveWriter, error) {
+	a := &ArchiveWriter{w: bufio.NewWriter(w), format: format}
+	name := h.RoomName
+	if name == "" {
+		name = h.RoomID
+	}
+	switch format {
+	case models.ExportJSON:
+		head, err := json.Marshal(struct {
+			RoomID   string    `json:"room_id"`
+			RoomName string    `json:"room_name,omitempty"`
+			Exported time.Time `json:"exported_at"`
+		}{h.RoomID, h.RoomName, h.Exported})
+		if err != nil {
+			return nil, err
+		}
+		// the messages are added as the last field of the header object
+		fmt.Fprintf(a.w, "%s,\n\"messages\": [", head[:len(head)-1])
+	case models.ExportMarkdown:
+		fmt.Fprintf(a.w, "# %s\n\nExported from Hillside on %s.\n\n", name, h.Exported.Format(archiveTime))
+	case models.ExportText:
+		fmt.Fprintf(a.w, "%s (%s), exported on %s\n\n", name, h.RoomID, h.Exported.Format(archiveTime))
+	default:
+		return nil, models.ErrInvalidExport.WithDetails(fmt.Sprintf("unknown format %q", format))
+	}
+	return a, nil
+}
+
+// Write adds m to the archive.
+func (a *ArchiveWriter) Write(m models.ExportedMessage) error {
+	a.count++
+	switch a.format {
+	case models.ExportJSON:
+		entry, err := json.MarshalIndent(m, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if a.count == 1 {
+			sep = ""
+		}
+		_, err = fmt.Fprintf(a.w, "%s\n  %s", sep, entry)
+		return err
+	case models.ExportMarkdown:
+		var b strings.Builder
+		fmt.Fprintf(&b, "**%s** · %s · #%d  \n", m.Sender, m.Time.Format(archiveTime), m.ChainIndex)
+		if m.ReplyTo != nil {
+			fmt.Fprintf(&b, "↪ reply to #%d  \n", *m.ReplyTo)
+		}
+		switch {
+		case m.Deleted:
+			b.WriteString("_message deleted_  \n")
+		case m.Text != "":
+			b.WriteString(strings.ReplaceAll(m.Text, "\n", "  \n"))
+			if m.Edited {
+				b.WriteString(" _(edited)_")
+			}
+			b.WriteString("  \n")
+		}
+		if m.Attachment != nil {
+			fmt.Fprintf(&b, "📎 %s (%s)  \n", m.Attachment.Name, m.Attachment.MIME)
+		}
+		if r := reactionCounts(m.Reactions); r != "" {
+			b.WriteString(r + "  \n")
+		}
+		b.WriteString("\n")
+		_, err := a.w.WriteString(b.String())
+		return err
+	default:
+		var b strings.Builder
+		fmt.Fprintf(&b, "[%s] #%d %s:", m.Time.Format(archiveTime), m.ChainIndex, m.Sender)
+		if m.ReplyTo != nil {
+			fmt.Fprintf(&b, " (reply to #%d)", *m.ReplyTo)
+		}
+		switch {
+		case m.Deleted:
+			b.WriteString(" message deleted")
+		case m.Text != "":
+			b.WriteString(" " + strings.ReplaceAll(m.Text, "\n", "\n    "))
+			if m.Edited {
+				b.WriteString(" (edited)")
+			}
+		}
+		if m.Attachment != nil {
+			fmt.Fprintf(&b, " [attachment %s (%s)]", m.Attachment.Name, m.Attachment.MIME)
+		}
+		if r := reactionCounts(m.Reactions); r != "" {
+			b.WriteString(" [" + r + "]")
+		}
+		b.WriteString("\n")
+		_, err := a.w.WriteString(b.String())
+		return err
+	}
+}
+
+// Close ends the archive and flushes it. It reports how many messages it
+// holds.
+func (a *ArchiveWriter) Close() (int, error) {
+	if a.format == models.ExportJSON {
+		if a.count > 0 {
+			a.w.WriteString("\n")
+		}
+		a.w.WriteString("]}\n")
+	}
+	return a.count, a.w.Flush()
+}
+
+// reactionCounts renders reactions as each emoji with how many reacted, in
+// emoji order.
+func reactionCounts(reactions map[string][]string) string {
+	emojis := make([]string, 0, len(reactions))
+	for e := range reactions {
+		emojis = append(emojis, e)
+	}
+	slices.Sort(emojis)
+	parts := make([]string, 0, len(emojis))
+	for _, e := range emojis {
+		parts = append(parts, fmt.Sprintf("%s %d", e, len(reactions[e])))
+	}
+	return strings.Join(parts, " ")
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"sync"
 	"time"
 
@@ -33,6 +34,8 @@ type HistoryManager struct {
 
 type messageWriteRequest struct {
 	storedMsg models.StoredMessage
+	target    *models.MessageRef // set for edits and deletes, see SaveEdit
+	reaction  *models.Reaction   // set for reactions, see SaveReaction
 	ctx       context.Context
 	result    chan error
 }
@@ -70,26 +73,32 @@ func (h *HistoryManager) Stop() {
 
 func (h *HistoryManager) EnqueueEnvelope(
 	ctx context.Context,
+	sigAlg string,
 	signature, payload []byte,
 	timestamp int64,
 	msgType models.MessageType,
 	chainIndex *uint64,
 	sender_id, roomID, serverID string,
 ) error {
+	return h.EnqueueMessage(ctx, models.StoredMessage{
+		RoomID:     roomID,
+		ServerID:   serverID,
+		ChainIndex: chainIndex,
+		MsgType:    msgType,
+		SenderID:   sender_id,
+		Timestamp:  timestamp,
+		SigAlg:     sigAlg,
+		Signature:  signature,
+		Payload:    payload,
+	})
+}
 
+// EnqueueMessage queues msg to be saved with SaveMessage.
+func (h *HistoryManager) EnqueueMessage(ctx context.Context, msg models.StoredMessage) error {
 	req := messageWriteRequest{
-		storedMsg: models.StoredMessage{
-			RoomID:     roomID,
-			ServerID:   serverID,
-			ChainIndex: chainIndex,
-			MsgType:    msgType,
-			SenderID:   sender_id,
-			Timestamp:  timestamp,
-			Signature:  signature,
-			Payload:    payload,
-		},
-		ctx:    ctx,
-		result: make(chan error, 1),
+		storedMsg: msg,
+		ctx:       ctx,
+		result:    make(chan error, 1),
 	}
 
 	select {
@@ -102,6 +111,40 @@ func (h *HistoryManager) EnqueueEnvelope(
 	}
 }
 
+// EnqueueEdit queues an edit or delete message to be saved and applied with
+// SaveEdit, after the messages enqueued before it.
+func (h *HistoryManager) EnqueueEdit(ctx context.Context, msg models.StoredMessage, target models.MessageRef) error {
+	req := messageWriteRequest{
+		storedMsg: msg,
+		target:    &target,
+		ctx:       ctx,
+		result:    make(chan error, 1),
+	}
+	select {
+	case h.writeQ <- req:
+		return nil
+	default:
+		return errors.New("history write queue full")
+	}
+}
+
+// EnqueueReaction queues a reaction message to be saved and applied with
+// SaveReaction, after the messages enqueued before it.
+func (h *HistoryManager) EnqueueReaction(ctx context.Context, msg models.StoredMessage, r models.Reaction) error {
+	req := messageWriteRequest{
+		storedMsg: msg,
+		reaction:  &r,
+		ctx:       ctx,
+		result:    make(chan error, 1),
+	}
+	select {
+	case h.writeQ <- req:
+		return nil
+	default:
+		return errors.New("history write queue full")
+	}
+}
+
 // writeWorker batches writes into the DB to limit transactions and contention.
 func (h *HistoryManager) writeWorker(store *Store) {
 	defer h.wg.Done()
@@ -115,7 +158,15 @@ func (h *HistoryManager) writeWorker(store *Store) {
 		}
 		for _, r := range batch {
 			_ = r.ctx // currently unused, but could use store.WithContext
-			if err := store.SaveEnvelope(context.Background(), r.storedMsg.Signature, r.storedMsg.Payload, r.storedMsg.Timestamp, r.storedMsg.MsgType, r.storedMsg.ChainIndex, r.storedMsg.SenderID, r.storedMsg.RoomID, r.storedMsg.ServerID); err != nil {
+			var err error
+			if r.target != nil {
+				_, err = store.SaveEdit(context.Background(), r.storedMsg, *r.target)
+			} else if r.reaction != nil {
+				err = store.SaveReaction(context.Background(), r.storedMsg, *r.reaction)
+			} else {
+				err = store.SaveMessage(context.Background(), r.storedMsg)
+			}
+			if err != nil {
 				log.Printf("history: save envelope error: %v", err)
 				r.result <- err
 			} else {
@@ -199,27 +250,58 @@ func (h *HistoryManager) BuildCatchUpPayload(ctx context.Context, roomID string,
 		latest, _ := h.GetLastIndex(roomID, store)
 		return nil, latest, nil, nil
 	}
+	if payload, err = compressMessages(msgs); err != nil {
+		return nil, 0, err, nil
+	}
+	if last := msgs[len(msgs)-1]; last.ChainIndex != nil {
+		lastIndex = *last.ChainIndex
+	}
+	return payload, lastIndex, nil, msgs
+}
 
+// BuildHistoryPayload compresses, like BuildCatchUpPayload, the newest limit
+// messages before beforeIndex, or the newest of all if it is 0, for members
+// scrolling back past what they stored. Deleted messages are left out.
+func (h *HistoryManager) BuildHistoryPayload(ctx context.Context, roomID string, beforeIndex uint64, limit int, store *Store) ([]byte, int, error) {
+	if beforeIndex == 0 {
+		beforeIndex = math.MaxInt64
+	}
+	msgs, err := store.GetMessagesBefore(ctx, roomID, beforeIndex, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	kept := msgs[:0]
+	for _, m := range msgs {
+		if m.DeletedAt == 0 {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, 0, nil
+	}
+	payload, err := compressMessages(kept)
+	return payload, len(kept), err
+}
+
+// compressMessages gzips msgs as JSON frames, read back by
+// DecompressCatchUpPayload.
+func compressMessages(msgs []models.StoredMessage) ([]byte, error) {
 	var buf bytes.Buffer
 	gw := gzip.NewWriter(&buf)
 	for _, m := range msgs {
 		entry, err := json.Marshal(m)
 		if err != nil {
-			return nil, 0, err, nil
+			return nil, err
 		}
 		if err := writeFrame(gw, entry); err != nil {
 			_ = gw.Close()
-			return nil, 0, err, nil
-		}
-		lastIndex = 0
-		if m.ChainIndex != nil {
-			lastIndex = *m.ChainIndex
+			return nil, err
 		}
 	}
 	if err := gw.Close(); err != nil {
-		return nil, 0, err, nil
+		return nil, err
 	}
-	return buf.Bytes(), lastIndex, nil, msgs
+	return buf.Bytes(), nil
 }
 
 var RL, _ = utils.NewRemoteLogger(7000)
@@ -270,6 +352,7 @@ func (h *HistoryManager) DecompressCatchUpPayload(ctx context.Context, payload [
 			SenderID:   dec.SenderID,
 			Timestamp:  dec.Timestamp,
 			MsgType:    dec.MsgType,
+			SigAlg:     dec.SigAlg,
 		}
 		catchUpMsgs.ReturnedMessages = append(catchUpMsgs.ReturnedMessages, catchUpMsg)
 	}
@@ -301,28 +384,51 @@ func (h *HistoryManager) BuildEncryptedCatchUpResponse(ctx context.Context, room
 
 // SaveEnvelope stores an envelope. Use chainIndex != nil for chat messages.
 // Behavior: insert is idempotent (duplicate chain_index for same room ignored).
-func (s *Store) SaveEnvelope(ctx context.Context, signature, payload []byte, timestamp int64, msgType models.MessageType, chainIndex *uint64, sender_id, roomID, serverID string) error {
+// An empty sigAlg is stored as NULL, the legacy Dilithium2 signature.
+func (s *Store) SaveEnvelope(ctx context.Context, sigAlg string, signature, payload []byte, timestamp int64, msgType models.MessageType, chainIndex *uint64, sender_id, roomID, serverID string) error {
+	return s.SaveMessage(ctx, models.StoredMessage{
+		RoomID:     roomID,
+		ServerID:   serverID,
+		ChainIndex: chainIndex,
+		MsgType:    msgType,
+		SenderID:   sender_id,
+		Timestamp:  timestamp,
+		SigAlg:     sigAlg,
+		Signature:  signature,
+		Payload:    payload,
+	})
+}
+
+// SaveMessage stores msg like SaveEnvelope, with its place in a thread.
+func (s *Store) SaveMessage(ctx context.Context, msg models.StoredMessage) error {
 	var ci any
-	if chainIndex != nil {
-		ci = int64(*chainIndex)
+	if msg.ChainIndex != nil {
+		ci = int64(*msg.ChainIndex)
 	} else {
 		ci = nil
 	}
 
 	const q = `
 INSERT OR IGNORE INTO messages
-(room_id, server_id, chain_index, msg_type, sender_id, timestamp, signature, payload)
-VALUES (?, ?, ?, ?, ?, ?, ?,?);
+(room_id, server_id, chain_index, msg_type, sender_id, timestamp, sig_alg, signature, payload, reply_to, thread_root)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 `
+	var alg any
+	if msg.SigAlg != "" {
+		alg = msg.SigAlg
+	}
 	_, err := s.db.ExecContext(ctx, q,
-		roomID,
-		serverID,
+		msg.RoomID,
+		msg.ServerID,
 		ci,
-		string(msgType),
-		sender_id,
-		timestamp,
-		signature,
-		payload,
+		string(msg.MsgType),
+		msg.SenderID,
+		msg.Timestamp,
+		alg,
+		msg.Signature,
+		msg.Payload,
+		nullIndex(msg.ReplyTo),
+		nullIndex(msg.ThreadRoot),
 	)
 	if err != nil {
 		return fmt.Errorf("insert envelope: %w", err)
@@ -330,26 +436,11 @@ VALUES (?, ?, ?, ?, ?, ?, ?,?);
 	return nil
 }
 
-// GetMessagesSinceChainIndex returns chat messages with chain_index > sinceIndex ordered ASC.
-func (s *Store) GetMessagesSinceChainIndex(ctx context.Context, roomID string, sinceIndex uint64, limit int) ([]models.StoredMessage, error) {
-	var q = `
-SELECT id, room_id, server_id, chain_index, msg_type, sender_id, timestamp, signature, payload
-FROM messages
-WHERE room_id = ? AND chain_index IS NOT NULL AND chain_index >= ?
-ORDER BY chain_index ASC
-`
-	var rows *sql.Rows
-	var err error
-	if limit <= 0 {
-		q += ";"
-		rows, err = s.db.QueryContext(ctx, q, roomID, int64(sinceIndex))
-	} else {
-		q += " LIMIT ?;"
-		rows, err = s.db.QueryContext(ctx, q, roomID, int64(sinceIndex), limit)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("select messages since: %w", err)
-	}
+// messageColumns are the columns read by scanMessages, in order.
+const messageColumns = `id, room_id, server_id, chain_index, msg_type, sender_id, timestamp, sig_alg, signature, payload, edited_at, deleted_at, reply_to, thread_root`
+
+// scanMessages reads and closes rows selected with messageColumns.
+func scanMessages(rows *sql.Rows) ([]models.StoredMessage, error) {
 	defer rows.Close()
 
 	var out []models.StoredMessage
@@ -362,27 +453,32 @@ ORDER BY chain_index ASC
 			msgType   string
 			senderID  sql.NullString
 			timestamp int64
+			sigAlg    sql.NullString
 			signature []byte
 			payload   []byte
+			editedAt  sql.NullInt64
+			deletedAt sql.NullInt64
+			replyTo   sql.NullInt64
+			root      sql.NullInt64
 		)
-		if err := rows.Scan(&id, &room, &server, &chainN, &msgType, &senderID, &timestamp, &signature, &payload); err != nil {
+		if err := rows.Scan(&id, &room, &server, &chainN, &msgType, &senderID, &timestamp, &sigAlg, &signature, &payload, &editedAt, &deletedAt, &replyTo, &root); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
-		var ci *uint64
-		if chainN.Valid {
-			v := uint64(chainN.Int64)
-			ci = &v
-		}
 		sm := models.StoredMessage{
 			ID:         id,
 			RoomID:     room,
 			ServerID:   server.String,
-			ChainIndex: ci,
+			ChainIndex: indexOf(chainN),
 			MsgType:    models.MessageType(msgType),
 			SenderID:   senderID.String,
 			Timestamp:  timestamp,
+			SigAlg:     sigAlg.String,
 			Signature:  signature,
 			Payload:    payload,
+			EditedAt:   editedAt.Int64,
+			DeletedAt:  deletedAt.Int64,
+			ReplyTo:    indexOf(replyTo),
+			ThreadRoot: indexOf(root),
 		}
 		out = append(out, sm)
 	}
@@ -392,10 +488,49 @@ ORDER BY chain_index ASC
 	return out, nil
 }
 
+func indexOf(n sql.NullInt64) *uint64 {
+	if !n.Valid {
+		return nil
+	}
+	v := uint64(n.Int64)
+	return &v
+}
+
+func nullIndex(i *uint64) any {
+	if i == nil {
+		return nil
+	}
+	return int64(*i)
+}
+
+// GetMessagesSinceChainIndex returns chat messages with chain_index > sinceIndex ordered ASC.
+// Deleted messages are left out, so they are not handed out in catch-up.
+func (s *Store) GetMessagesSinceChainIndex(ctx context.Context, roomID string, sinceIndex uint64, limit int) ([]models.StoredMessage, error) {
+	var q = `
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND chain_index IS NOT NULL AND chain_index >= ? AND deleted_at IS NULL
+ORDER BY chain_index ASC
+`
+	var rows *sql.Rows
+	var err error
+	if limit <= 0 {
+		q += ";"
+		rows, err = s.db.QueryContext(ctx, q, roomID, int64(sinceIndex))
+	} else {
+		q += " LIMIT ?;"
+		rows, err = s.db.QueryContext(ctx, q, roomID, int64(sinceIndex), limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select messages since: %w", err)
+	}
+	return scanMessages(rows)
+}
+
 // GetLatestMessages returns latest messages ordered like Postgres implementation.
 func (s *Store) GetLatestMessages(ctx context.Context, roomID string, limit int) ([]models.StoredMessage, error) {
 	const q = `
-SELECT id, room_id, server_id, chain_index, msg_type, sender_id, timestamp, signature, payload
+SELECT ` + messageColumns + `
 FROM messages
 WHERE room_id = ?
 ORDER BY
@@ -408,46 +543,62 @@ LIMIT ?;
 	if err != nil {
 		return nil, fmt.Errorf("select latest messages: %w", err)
 	}
-	defer rows.Close()
+	return scanMessages(rows)
+}
 
-	var out []models.StoredMessage
-	for rows.Next() {
-		var (
-			id        int64
-			room      string
-			server    sql.NullString
-			chainN    sql.NullInt64
-			msgType   string
-			senderID  sql.NullString
-			timestamp int64
-			signature []byte
-			payload   []byte
-		)
-		if err := rows.Scan(&id, &room, &server, &chainN, &msgType, &senderID, &timestamp, &signature, &payload); err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
-		}
-		var ci *uint64
-		if chainN.Valid {
-			v := uint64(chainN.Int64)
-			ci = &v
-		}
-		sm := models.StoredMessage{
-			ID:         id,
-			RoomID:     room,
-			ServerID:   server.String,
-			ChainIndex: ci,
-			MsgType:    models.MessageType(msgType),
-			SenderID:   senderID.String,
-			Timestamp:  timestamp,
-			Signature:  signature,
-			Payload:    payload,
-		}
-		out = append(out, sm)
+// GetMessagesBefore returns the newest limit messages of a room with
+// chain_index < beforeIndex, deleted ones included, ordered ASC. It pages back
+// through history from the first message shown.
+func (s *Store) GetMessagesBefore(ctx context.Context, roomID string, beforeIndex uint64, limit int) ([]models.StoredMessage, error) {
+	const q = `
+SELECT * FROM (
+  SELECT ` + messageColumns + `
+  FROM messages
+  WHERE room_id = ? AND chain_index IS NOT NULL AND chain_index < ?
+  ORDER BY chain_index DESC
+  LIMIT ?
+) ORDER BY chain_index ASC;
+`
+	rows, err := s.db.QueryContext(ctx, q, roomID, int64(min(beforeIndex, math.MaxInt64)), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select messages before: %w", err)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return scanMessages(rows)
+}
+
+// GetMessagesFrom returns the oldest limit messages of a room with
+// chain_index >= fromIndex, deleted ones included, ordered ASC. It pages
+// forward again through history from the last message shown.
+func (s *Store) GetMessagesFrom(ctx context.Context, roomID string, fromIndex uint64, limit int) ([]models.StoredMessage, error) {
+	const q = `
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND chain_index IS NOT NULL AND chain_index >= ?
+ORDER BY chain_index ASC
+LIMIT ?;
+`
+	rows, err := s.db.QueryContext(ctx, q, roomID, int64(min(fromIndex, math.MaxInt64)), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select messages from: %w", err)
 	}
-	return out, nil
+	return scanMessages(rows)
+}
+
+// GetMessagesAround returns the messages of a room within n chain indexes of
+// chainIndex, ordered ASC so the edits among them apply to what they target.
+func (s *Store) GetMessagesAround(ctx context.Context, roomID string, chainIndex uint64, n int) ([]models.StoredMessage, error) {
+	const q = `
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND chain_index IS NOT NULL AND chain_index BETWEEN ? AND ?
+ORDER BY chain_index ASC;
+`
+	from := max(int64(chainIndex)-int64(n), 0)
+	rows, err := s.db.QueryContext(ctx, q, roomID, from, int64(chainIndex)+int64(n))
+	if err != nil {
+		return nil, fmt.Errorf("select messages around: %w", err)
+	}
+	return scanMessages(rows)
 }
 
 // GetLatestChainIndex returns highest chain_index for room or ErrNoRows.
@@ -481,5 +632,8 @@ DELETE FROM messages WHERE room_id = ? AND timestamp < ?;
 		return 0, fmt.Errorf("delete older than: %w", err)
 	}
 	n, _ := res.RowsAffected()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM search_index WHERE room_id = ? AND timestamp < ?;`, roomID, before.UnixMicro()); err != nil {
+		return n, fmt.Errorf("delete older than: %w", err)
+	}
 	return n, nil
 }
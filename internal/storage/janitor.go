@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// JanitorInterval is how often retention policies are enforced. It bounds
+	// how long an ephemeral message outlives its timer.
+	JanitorInterval = 5 * time.Second
+
+	// AuthTombstoneTTL is how long soft-deleted room keys are kept before
+	// being purged for good.
+	AuthTombstoneTTL = 30 * 24 * time.Hour
+)
+
+// Janitor enforces the retention policy of every room in the background and
+// purges old tombstoned room keys.
+type Janitor struct {
+	interval time.Duration
+	wg       sync.WaitGroup
+	stopCh   chan struct{}
+
+	mu       sync.Mutex
+	onExpire func(Expiry)
+}
+
+func NewJanitor(interval time.Duration) *Janitor {
+	return &Janitor{
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// OnExpire sets a callback run after messages of a room were deleted, to drop
+// them from memory and the screen too.
+func (j *Janitor) OnExpire(fn func(Expiry)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.onExpire = fn
+}
+
+func (j *Janitor) Start(store *Store) {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stopCh:
+				return
+			case now := <-ticker.C:
+				if err := j.Sweep(context.Background(), store, now); err != nil {
+					log.Printf("janitor: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor and waits for a running sweep to finish.
+func (j *Janitor) Stop() {
+	close(j.stopCh)
+	j.wg.Wait()
+}
+
+// Sweep runs one pass of the janitor as of now.
+func (j *Janitor) Sweep(ctx context.Context, store *Store, now time.Time) error {
+	policies, err := store.ListRetentions(ctx)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	onExpire := j.onExpire
+	j.mu.Unlock()
+
+	for roomID, policy := range policies {
+		exp, err := store.ExpireMessages(ctx, roomID, policy, now)
+		if err != nil {
+			log.Printf("janitor: expire room %s: %v", roomID, err)
+		}
+		if exp != nil && exp.Deleted > 0 && onExpire != nil {
+			onExpire(*exp)
+		}
+	}
+	_, err = store.PurgeAuthsOlderThan(ctx, now.Add(-AuthTombstoneTTL))
+	return err
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MigrateMutes creates the muted_peers table holding the local ignore list.
+func (s *Store) MigrateMutes() error {
+	const sqlStmt = `
+CREATE TABLE IF NOT EXISTS muted_peers (
+	peer_id TEXT PRIMARY KEY,
+	muted_at INTEGER NOT NULL -- unix micro
+);
+`
+	_, err := s.db.Exec(sqlStmt)
+	return err
+}
+
+// MutePeer adds a peer to the ignore list. Muting twice is a no-op.
+func (s *Store) MutePeer(ctx context.Context, peerID string) error {
+	const q = `INSERT OR IGNORE INTO muted_peers (peer_id, muted_at) VALUES (?, ?);`
+	if _, err := s.db.ExecContext(ctx, q, peerID, time.Now().UnixMicro()); err != nil {
+		return fmt.Errorf("mute peer: %w", err)
+	}
+	return nil
+}
+
+// UnmutePeer removes a peer from the ignore list.
+func (s *Store) UnmutePeer(ctx context.Context, peerID string) error {
+	const q = `DELETE FROM muted_peers WHERE peer_id = ?;`
+	if _, err := s.db.ExecContext(ctx, q, peerID); err != nil {
+		return fmt.Errorf("unmute peer: %w", err)
+	}
+	return nil
+}
+
+// ListMutedPeers returns the peer IDs on the ignore list.
+func (s *Store) ListMutedPeers(ctx context.Context) ([]string, error) {
+	const q = `SELECT peer_id FROM muted_peers ORDER BY muted_at ASC;`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list muted peers: %w", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var pid string
+		if err := rows.Scan(&pid); err != nil {
+			return nil, fmt.Errorf("list muted peers scan: %w", err)
+		}
+		out = append(out, pid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -78,16 +78,26 @@ func (s *Store) SaveUser(ctx context.Context, user *models.User) error {
 	name := user.Username
 	color := user.PreferredColor
 	lastSeen := time.Now().UnixMicro()
+	sigKeys, err := marshalKeys(user.SigKeys)
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+	kemKeys, err := marshalKeys(user.KEMKeys)
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
 
 	const q = `
 	INSERT OR REPLACE INTO peers
-	(peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen, synced)
-	VALUES (?, ?, ?, ?, ?, ?,?,?);
+	(peer_id, dilithium_pub, kyber_pub, sig_keys, kem_keys, libp2p_pub, username, color, last_seen, synced)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?,?,?);
 `
-	_, err := s.db.ExecContext(ctx, q,
+	_, err = s.db.ExecContext(ctx, q,
 		pid,
 		dilithiumPub,
 		kyberPub,
+		sigKeys,
+		kemKeys,
 		libpub,
 		name,
 		color,
@@ -102,7 +112,7 @@ func (s *Store) SaveUser(ctx context.Context, user *models.User) error {
 
 func (s *Store) GetUserByID(ctx context.Context, peerID string) (*models.User, error) {
 	const q = `
-SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen, synced
+SELECT peer_id, dilithium_pub, kyber_pub, sig_keys, kem_keys, libp2p_pub, username, color, last_seen, synced
 	FROM peers
 	WHERE peer_id = ?
 	LIMIT 1;
@@ -119,19 +129,31 @@ SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen
 			peerID       string
 			dilithiumPub []byte
 			kyberPub     []byte
+			sigKeys      []byte
+			kemKeys      []byte
 			libp2pPub    []byte
 			username     sql.NullString
 			color        sql.NullString
 			lastSeen     sql.NullInt64
 			synced       sql.NullInt64
 		)
-		if err := rows.Scan(&peerID, &dilithiumPub, &kyberPub, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
+		if err := rows.Scan(&peerID, &dilithiumPub, &kyberPub, &sigKeys, &kemKeys, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
+		sigPubs, err := unmarshalKeys(sigKeys)
+		if err != nil {
+			return nil, err
+		}
+		kemPubs, err := unmarshalKeys(kemKeys)
+		if err != nil {
+			return nil, err
+		}
 		out = &models.User{
 			PeerID:         peerID,
 			DilithiumPub:   dilithiumPub,
 			KyberPub:       kyberPub,
+			SigKeys:        sigPubs,
+			KEMKeys:        kemPubs,
 			Libp2pPub:      libp2pPub,
 			Username:       username.String,
 			PreferredColor: color.String,
@@ -145,7 +167,7 @@ SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen
 
 func (s *Store) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	const q = `
-	SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen, synced
+	SELECT peer_id, dilithium_pub, kyber_pub, sig_keys, kem_keys, libp2p_pub, username, color, last_seen, synced
 	FROM peers;
 `
 	rows, err := s.db.QueryContext(ctx, q)
@@ -157,23 +179,34 @@ func (s *Store) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 	var out []*models.User
 	for rows.Next() {
 		var (
-			id           int64
 			peerID       string
 			dilithiumPub []byte
 			kyberPub     []byte
+			sigKeys      []byte
+			kemKeys      []byte
 			libp2pPub    []byte
 			username     sql.NullString
 			color        sql.NullString
 			lastSeen     sql.NullInt64
 			synced       sql.NullInt64
 		)
-		if err := rows.Scan(&id, &peerID, &dilithiumPub, &kyberPub, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
+		if err := rows.Scan(&peerID, &dilithiumPub, &kyberPub, &sigKeys, &kemKeys, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
+		sigPubs, err := unmarshalKeys(sigKeys)
+		if err != nil {
+			return nil, err
+		}
+		kemPubs, err := unmarshalKeys(kemKeys)
+		if err != nil {
+			return nil, err
+		}
 		m := &models.User{
 			PeerID:         peerID,
 			DilithiumPub:   dilithiumPub,
 			KyberPub:       kyberPub,
+			SigKeys:        sigPubs,
+			KEMKeys:        kemPubs,
 			Libp2pPub:      libp2pPub,
 			Username:       username.String,
 			PreferredColor: color.String,
@@ -189,7 +222,7 @@ func (s *Store) GetAllUsers(ctx context.Context) ([]*models.User, error) {
 func (s *Store) GetLastSeenUsers(ctx context.Context, since time.Time) ([]*models.User, error) {
 	sinceUnix := since.UnixMicro()
 	const q = `
-SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen, synced
+SELECT peer_id, dilithium_pub, kyber_pub, sig_keys, kem_keys, libp2p_pub, username, color, last_seen, synced
 	FROM peers
 	WHERE last_seen >= ?;
 `
@@ -201,23 +234,34 @@ SELECT peer_id, dilithium_pub, kyber_pub, libp2p_pub, username, color, last_seen
 	var out []*models.User
 	for rows.Next() {
 		var (
-			id           int64
 			peerID       string
 			dilithiumPub []byte
 			kyberPub     []byte
+			sigKeys      []byte
+			kemKeys      []byte
 			libp2pPub    []byte
 			username     sql.NullString
 			color        sql.NullString
 			lastSeen     sql.NullInt64
 			synced       sql.NullInt64
 		)
-		if err := rows.Scan(&id, &peerID, &dilithiumPub, &kyberPub, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
+		if err := rows.Scan(&peerID, &dilithiumPub, &kyberPub, &sigKeys, &kemKeys, &libp2pPub, &username, &color, &lastSeen, &synced); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
+		sigPubs, err := unmarshalKeys(sigKeys)
+		if err != nil {
+			return nil, err
+		}
+		kemPubs, err := unmarshalKeys(kemKeys)
+		if err != nil {
+			return nil, err
+		}
 		m := &models.User{
 			PeerID:         peerID,
 			DilithiumPub:   dilithiumPub,
 			KyberPub:       kyberPub,
+			SigKeys:        sigPubs,
+			KEMKeys:        kemPubs,
 			Libp2pPub:      libp2pPub,
 			Username:       username.String,
 			PreferredColor: color.String,
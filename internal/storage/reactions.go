@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"hillside/internal/models"
+)
+
+// MigrateReactions creates the reactions table: the state of each emoji of
+// each sender on a message, so repeated adds count once.
+func (s *Store) MigrateReactions() error {
+	const sqlStmt = `
+CREATE TABLE IF NOT EXISTS reactions (
+	room_id TEXT NOT NULL,
+	chain_index INTEGER NOT NULL, -- of the message reacted to
+	sender_id TEXT NOT NULL,
+	emoji TEXT NOT NULL,
+	active INTEGER NOT NULL, -- boolean (0/1), 0 once removed
+	updated_index INTEGER NOT NULL, -- chain index of the latest reaction message applied
+	PRIMARY KEY (room_id, chain_index, sender_id, emoji)
+);
+`
+	_, err := s.db.Exec(sqlStmt)
+	return err
+}
+
+// SaveReaction stores a reaction message, then applies it unless a later
+// reaction of the same sender and emoji already was, or the target is
+// deleted. Saving the same message again is harmless.
+func (s *Store) SaveReaction(ctx context.Context, msg models.StoredMessage, r models.Reaction) error {
+	if msg.ChainIndex == nil {
+		return fmt.Errorf("save reaction: no chain index")
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save reaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var alg any
+	if msg.SigAlg != "" {
+		alg = msg.SigAlg
+	}
+	const qInsert = `
+INSERT OR IGNORE INTO messages
+(room_id, server_id, chain_index, msg_type, sender_id, timestamp, sig_alg, signature, payload, target_index)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`
+	if _, err := tx.ExecContext(ctx, qInsert, msg.RoomID, msg.ServerID, int64(*msg.ChainIndex), string(msg.MsgType),
+		msg.SenderID, msg.Timestamp, alg, msg.Signature, msg.Payload, int64(r.Target.ChainIndex)); err != nil {
+		return fmt.Errorf("insert reaction: %w", err)
+	}
+
+	var deleted sql.NullInt64
+	const qDeleted = `SELECT deleted_at FROM messages WHERE room_id = ? AND chain_index = ?;`
+	err = tx.QueryRowContext(ctx, qDeleted, msg.RoomID, int64(r.Target.ChainIndex)).Scan(&deleted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("save reaction: %w", err)
+	}
+	if !deleted.Valid {
+		const qApply = `
+INSERT INTO reactions (room_id, chain_index, sender_id, emoji, active, updated_index) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(room_id, chain_index, sender_id, emoji) DO UPDATE SET
+	active = excluded.active,
+	updated_index = excluded.updated_index
+WHERE excluded.updated_index > reactions.updated_index;
+`
+		if _, err := tx.ExecContext(ctx, qApply, msg.RoomID, int64(r.Target.ChainIndex), msg.SenderID, r.Emoji,
+			!r.Remove, int64(*msg.ChainIndex)); err != nil {
+			return fmt.Errorf("apply reaction: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save reaction: %w", err)
+	}
+	return nil
+}
+
+// GetReactions returns the reactions to the messages of a room, by chain index
+// then emoji, with the peer IDs of who reacted.
+func (s *Store) GetReactions(ctx context.Context, roomID string) (map[uint64]map[string][]string, error) {
+	const q = `
+SELECT chain_index, emoji, sender_id FROM reactions
+WHERE room_id = ? AND active = 1
+ORDER BY chain_index, emoji, updated_index;
+`
+	rows, err := s.db.QueryContext(ctx, q, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("select reactions: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[uint64]map[string][]string)
+	for rows.Next() {
+		var (
+			chainIndex int64
+			emoji      string
+			senderID   string
+		)
+		if err := rows.Scan(&chainIndex, &emoji, &senderID); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		byEmoji, ok := out[uint64(chainIndex)]
+		if !ok {
+			byEmoji = make(map[string][]string)
+			out[uint64(chainIndex)] = byEmoji
+		}
+		byEmoji[emoji] = append(byEmoji[emoji], senderID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
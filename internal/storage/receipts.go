@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"hillside/internal/models"
+)
+
+// MigrateReceipts creates the receipts table: how far each member of a room
+// received and read it, as told by their last receipt.
+func (s *Store) MigrateReceipts() error {
+	const sqlStmt = `
+CREATE TABLE IF NOT EXISTS receipts (
+	room_id TEXT NOT NULL,
+	peer_id TEXT NOT NULL,
+	delivered_index INTEGER NOT NULL,
+	read_index INTEGER NOT NULL,
+	PRIMARY KEY (room_id, peer_id)
+);
+`
+	_, err := s.db.Exec(sqlStmt)
+	return err
+}
+
+// SaveReceipt records the receipt of peerID, never moving its indexes back.
+func (s *Store) SaveReceipt(ctx context.Context, peerID string, r models.Receipt) error {
+	const q = `
+INSERT INTO receipts (room_id, peer_id, delivered_index, read_index) VALUES (?, ?, ?, ?)
+ON CONFLICT(room_id, peer_id) DO UPDATE SET
+	delivered_index = MAX(delivered_index, excluded.delivered_index),
+	read_index = MAX(read_index, excluded.read_index);
+`
+	if _, err := s.db.ExecContext(ctx, q, r.RoomID, peerID, int64(r.Delivered), int64(r.Read)); err != nil {
+		return fmt.Errorf("save receipt: %w", err)
+	}
+	return nil
+}
+
+// GetReceipts returns the receipts of the members of a room, by peer ID.
+func (s *Store) GetReceipts(ctx context.Context, roomID string) (map[string]models.Receipt, error) {
+	const q = `SELECT peer_id, delivered_index, read_index FROM receipts WHERE room_id = ?;`
+	rows, err := s.db.QueryContext(ctx, q, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("select receipts: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]models.Receipt)
+	for rows.Next() {
+		var (
+			peerID          string
+			delivered, read int64
+		)
+		if err := rows.Scan(&peerID, &delivered, &read); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out[peerID] = models.Receipt{RoomID: roomID, Delivered: uint64(delivered), Read: uint64(read)}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+)
+
+// MigrateRetention creates the room_retention table holding the policy of
+// every room we keep history for, so it is enforced even before rejoining.
+func (s *Store) MigrateRetention() error {
+	const sqlStmt = `
+CREATE TABLE IF NOT EXISTS room_retention (
+	room_id TEXT PRIMARY KEY,
+	mode INTEGER NOT NULL,
+	value INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL -- unix micro
+);
+`
+	_, err := s.db.Exec(sqlStmt)
+	return err
+}
+
+// SetRetention records the retention policy of a room. Keeping forever
+// removes the row.
+func (s *Store) SetRetention(ctx context.Context, roomID string, r models.Retention) error {
+	if r.Mode == models.KeepForever {
+		const q = `DELETE FROM room_retention WHERE room_id = ?;`
+		if _, err := s.db.ExecContext(ctx, q, roomID); err != nil {
+			return fmt.Errorf("clear retention: %w", err)
+		}
+		return nil
+	}
+	const q = `
+INSERT INTO room_retention (room_id, mode, value, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT(room_id) DO UPDATE SET
+	mode = excluded.mode,
+	value = excluded.value,
+	updated_at = excluded.updated_at;
+`
+	if _, err := s.db.ExecContext(ctx, q, roomID, int(r.Mode), r.Value, time.Now().UnixMicro()); err != nil {
+		return fmt.Errorf("set retention: %w", err)
+	}
+	return nil
+}
+
+// ListRetentions returns the policy of every room that doesn't keep forever.
+func (s *Store) ListRetentions(ctx context.Context) (map[string]models.Retention, error) {
+	const q = `SELECT room_id, mode, value FROM room_retention;`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list retentions: %w", err)
+	}
+	defer rows.Close()
+	out := make(map[string]models.Retention)
+	for rows.Next() {
+		var (
+			roomID string
+			mode   int
+			value  int64
+		)
+		if err := rows.Scan(&roomID, &mode, &value); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out[roomID] = models.Retention{Mode: models.RetentionMode(mode), Value: value}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Expiry describes the messages of a room removed by ExpireMessages.
+type Expiry struct {
+	RoomID    string
+	Before    int64  // every message sent before this (unix micro) is gone
+	NextIndex uint64 // ratchet keys below this chain index were erased, 0 if none were, see erasableIndex
+	Deleted   int64
+}
+
+// retentionCutoff returns the send time before which messages of the room
+// expire under r, or 0 when none do.
+func (s *Store) retentionCutoff(ctx context.Context, roomID string, r models.Retention, now time.Time) (int64, error) {
+	switch r.Mode {
+	case models.KeepDays:
+		return now.Add(-time.Duration(r.Value) * 24 * time.Hour).UnixMicro(), nil
+	case models.Ephemeral:
+		return now.Add(-time.Duration(r.Value) * time.Second).UnixMicro(), nil
+	case models.KeepMessages:
+		// the send time of the oldest chat message kept, edits, deletes and
+		// reactions don't count
+		const q = `SELECT timestamp FROM messages WHERE room_id = ? AND msg_type = 'chat' ORDER BY timestamp DESC LIMIT 1 OFFSET ?;`
+		var ts int64
+		err := s.db.QueryRowContext(ctx, q, roomID, r.Value-1).Scan(&ts)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("retention cutoff: %w", err)
+		}
+		return ts, nil
+	}
+	return 0, nil
+}
+
+// ExpireMessages deletes the messages of a room that r no longer keeps, then
+// ratchets the stored room key past them so they can't be decrypted again
+// even from a copy of the ciphertext.
+func (s *Store) ExpireMessages(ctx context.Context, roomID string, r models.Retention, now time.Time) (*Expiry, error) {
+	cutoff, err := s.retentionCutoff(ctx, roomID, r, now)
+	if err != nil || cutoff == 0 {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("expire messages: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastIndex sql.NullInt64
+	const qMax = `SELECT MAX(chain_index) FROM messages WHERE room_id = ? AND timestamp < ?;`
+	if err := tx.QueryRowContext(ctx, qMax, roomID, cutoff).Scan(&lastIndex); err != nil {
+		return nil, fmt.Errorf("expire messages: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE room_id = ? AND timestamp < ?;`, roomID, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("expire messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	const qReactions = `
+DELETE FROM reactions WHERE room_id = ? AND chain_index NOT IN (
+	SELECT chain_index FROM messages WHERE room_id = ? AND chain_index IS NOT NULL
+);
+`
+	if _, err := tx.ExecContext(ctx, qReactions, roomID, roomID); err != nil {
+		return nil, fmt.Errorf("expire reactions: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM search_index WHERE room_id = ? AND timestamp < ?;`, roomID, cutoff); err != nil {
+		return nil, fmt.Errorf("expire search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("expire messages: %w", err)
+	}
+
+	exp := &Expiry{RoomID: roomID, Before: cutoff, Deleted: n}
+	if lastIndex.Valid {
+		if exp.NextIndex, err = s.erasableIndex(ctx, roomID, uint64(lastIndex.Int64)+1); err != nil {
+			return exp, err
+		}
+		if err := s.AdvanceAuth(ctx, roomID, exp.NextIndex); err != nil {
+			return exp, err
+		}
+	}
+	return exp, nil
+}
+
+// erasableIndex returns how far the key of a room can be ratcheted once the
+// messages below chain index to are deleted: up to the first message still
+// kept. Send times are chosen by the sender, so a message chained after one
+// that expired may well be kept, and its key with it.
+func (s *Store) erasableIndex(ctx context.Context, roomID string, to uint64) (uint64, error) {
+	var from uint64
+	ra, err := s.GetAuth(ctx, roomID)
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		return 0, err
+	}
+	if err == nil {
+		from = ra.ChainIndex
+	}
+	var kept sql.NullInt64
+	const q = `SELECT MIN(chain_index) FROM messages WHERE room_id = ? AND chain_index >= ?;`
+	if err := s.db.QueryRowContext(ctx, q, roomID, from).Scan(&kept); err != nil {
+		return 0, fmt.Errorf("erasable index: %w", err)
+	}
+	if kept.Valid && uint64(kept.Int64) < to {
+		return uint64(kept.Int64), nil
+	}
+	return to, nil
+}
+
+// AdvanceAuth ratchets the stored master key of a room forward to chain index
+// to, erasing every earlier key. It never moves the key backwards.
+func (s *Store) AdvanceAuth(ctx context.Context, roomID string, to uint64) error {
+	ra, err := s.GetAuth(ctx, roomID)
+	if errors.Is(err, ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ra.ChainIndex >= to {
+		return nil
+	}
+	r := &crypto.RoomRatchet{Index: ra.ChainIndex, ChainKey: ra.MasterRatchetKey}
+	for r.Index < to {
+		if _, _, err := r.NextKey(); err != nil {
+			return fmt.Errorf("advance auth: %w", err)
+		}
+	}
+	return s.SaveAuth(ctx, roomID, int64(r.Index), r.ChainKey, time.Now())
+}
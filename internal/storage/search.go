@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MigrateSearch creates the search index of decrypted messages. It holds the
+// blinded words of each message (see crypto.SearchTokens), never its text. It
+// is an FTS5 table when the sqlite driver has FTS5 (build tag sqlite_fts5, as
+// the Makefile builds), else a plain table scanned on each search.
+func (s *Store) MigrateSearch() error {
+	var existing string
+	err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'search_index';`).Scan(&existing)
+	switch {
+	case err == nil && strings.Contains(strings.ToLower(existing), "fts5"):
+		s.fts = true
+		return nil
+	case err == nil:
+		return s.upgradeSearch()
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	_, err = s.db.Exec(ftsSearchIndex)
+	if err == nil {
+		s.fts = true
+		return nil
+	}
+	if !strings.Contains(err.Error(), "no such module") {
+		return err
+	}
+	_, err = s.db.Exec(`
+CREATE TABLE search_index (
+	tokens TEXT NOT NULL,
+	room_id TEXT NOT NULL,
+	chain_index INTEGER NOT NULL,
+	sender_id TEXT NOT NULL,
+	timestamp INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_search_room ON search_index (room_id, chain_index);
+`)
+	return err
+}
+
+const ftsSearchIndex = `
+CREATE VIRTUAL TABLE search_index USING fts5(
+	tokens,
+	room_id UNINDEXED,
+	chain_index UNINDEXED,
+	sender_id UNINDEXED,
+	timestamp UNINDEXED
+);
+`
+
+// upgradeSearch moves a plain search index, made by a build without FTS5,
+// into an FTS5 table if this build has FTS5, and keeps it otherwise.
+func (s *Store) upgradeSearch() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("upgrade search index: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`ALTER TABLE search_index RENAME TO search_index_plain;`); err != nil {
+		return fmt.Errorf("upgrade search index: %w", err)
+	}
+	if _, err := tx.Exec(ftsSearchIndex); err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return nil
+		}
+		return fmt.Errorf("upgrade search index: %w", err)
+	}
+	const q = `
+INSERT INTO search_index (tokens, room_id, chain_index, sender_id, timestamp)
+SELECT tokens, room_id, chain_index, sender_id, timestamp FROM search_index_plain;
+DROP TABLE search_index_plain;
+`
+	if _, err := tx.Exec(q); err != nil {
+		return fmt.Errorf("upgrade search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("upgrade search index: %w", err)
+	}
+	s.fts = true
+	return nil
+}
+
+// FullTextSearch reports whether the search index is an FTS5 table.
+func (s *Store) FullTextSearch() bool {
+	return s.fts
+}
+
+// SearchEntry is a decrypted chat message as the search index knows it.
+type SearchEntry struct {
+	RoomID     string
+	ChainIndex uint64
+	SenderID   string
+	Timestamp  int64
+	Tokens     []string // blinded words, empty in search results
+}
+
+// IndexMessages adds messages to the search index, or replaces their words if
+// they are in already. Messages deleted meanwhile are left out.
+func (s *Store) IndexMessages(ctx context.Context, entries []SearchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("index messages: %w", err)
+	}
+	defer tx.Rollback()
+	const qInsert = `
+INSERT INTO search_index (tokens, room_id, chain_index, sender_id, timestamp)
+SELECT ?, ?, ?, ?, ?
+WHERE NOT EXISTS (
+	SELECT 1 FROM messages WHERE room_id = ? AND chain_index = ? AND deleted_at IS NOT NULL
+);
+`
+	for _, e := range entries {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM search_index WHERE room_id = ? AND chain_index = ?;`, e.RoomID, int64(e.ChainIndex)); err != nil {
+			return fmt.Errorf("index messages: %w", err)
+		}
+		if len(e.Tokens) == 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, qInsert, strings.Join(e.Tokens, " "), e.RoomID, int64(e.ChainIndex), e.SenderID, e.Timestamp,
+			e.RoomID, int64(e.ChainIndex)); err != nil {
+			return fmt.Errorf("index messages: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("index messages: %w", err)
+	}
+	return nil
+}
+
+// ReindexMessage replaces the words of an indexed message, after an edit.
+func (s *Store) ReindexMessage(ctx context.Context, roomID string, chainIndex uint64, tokens []string) error {
+	const q = `UPDATE search_index SET tokens = ? WHERE room_id = ? AND chain_index = ?;`
+	if _, err := s.db.ExecContext(ctx, q, strings.Join(tokens, " "), roomID, int64(chainIndex)); err != nil {
+		return fmt.Errorf("reindex message: %w", err)
+	}
+	return nil
+}
+
+// SearchQuery selects indexed messages having every one of Tokens. The other
+// fields narrow it down when set: to messages of any of RoomIDs, sent by any
+// of SenderIDs, from Since and before Until.
+type SearchQuery struct {
+	Tokens    []string
+	RoomIDs   []string
+	SenderIDs []string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Search returns the indexed messages matching q, newest first.
+func (s *Store) Search(ctx context.Context, q SearchQuery) ([]SearchEntry, error) {
+	if len(q.Tokens) == 0 {
+		return nil, nil
+	}
+	var (
+		where []string
+		args  []any
+	)
+	if s.fts {
+		quoted := make([]string, len(q.Tokens))
+		for i, t := range q.Tokens {
+			quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+		}
+		where = append(where, "search_index MATCH ?")
+		args = append(args, strings.Join(quoted, " "))
+	} else {
+		for _, t := range q.Tokens {
+			where = append(where, "(' ' || tokens || ' ') LIKE ?")
+			args = append(args, "% "+t+" %")
+		}
+	}
+	for column, values := range map[string][]string{"room_id": q.RoomIDs, "sender_id": q.SenderIDs} {
+		if len(values) == 0 {
+			continue
+		}
+		where = append(where, column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.Since.UnixMicro())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.Until.UnixMicro())
+	}
+	stmt := `SELECT room_id, chain_index, sender_id, timestamp FROM search_index WHERE ` +
+		strings.Join(where, " AND ") + ` ORDER BY timestamp DESC, chain_index DESC`
+	if q.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, stmt+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	defer rows.Close()
+	var out []SearchEntry
+	for rows.Next() {
+		var (
+			e     SearchEntry
+			index int64
+		)
+		if err := rows.Scan(&e.RoomID, &index, &e.SenderID, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		e.ChainIndex = uint64(index)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -10,13 +10,16 @@ import (
 )
 
 type Store struct {
-	db *sql.DB
+	db  *sql.DB
+	fts bool // the search index is an FTS5 table, see MigrateSearch
 }
 
 type SessionDB struct {
 	Store   *Store
 	History *HistoryManager
 	Peers   *PeerManager
+	Janitor *Janitor
+	Blobs   *BlobCache
 }
 
 // NewSQLiteStore opens (or creates) a sqlite DB file.
@@ -55,7 +58,10 @@ func InitSessionDB(username string, dbPath string, writeQSize int) (*SessionDB,
 	if err != nil {
 		return nil, err
 	}
-	filldbPath := homeDir + "/.hillside/" + fmt.Sprintf("hillside_data_%s.db", username)
+	filldbPath, err := SessionDBPath(username)
+	if err != nil {
+		return nil, err
+	}
 
 	if dbPath != "" {
 		filldbPath = dbPath
@@ -72,20 +78,39 @@ func InitSessionDB(username string, dbPath string, writeQSize int) (*SessionDB,
 		store.Close()
 		return nil, err
 	}
+	blobs, err := NewBlobCache(homeDir + "/.hillside/blobs")
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
 	h := NewHistoryManager(writeQSize)
 	h.Start(store)
 
 	p := NewPeerManager(writeQSize)
 	p.Start(store)
 
+	j := NewJanitor(JanitorInterval)
+	j.Start(store)
+
 	sdb := &SessionDB{
 		History: h,
 		Store:   store,
 		Peers:   p,
+		Janitor: j,
+		Blobs:   blobs,
 	}
 	return sdb, nil
 }
 
+// SessionDBPath is where the history of username is stored by default.
+func SessionDBPath(username string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return homeDir + "/.hillside/" + fmt.Sprintf("hillside_data_%s.db", username), nil
+}
+
 func (s *Store) Close() {
 	if s.db != nil {
 		_ = s.db.Close()
@@ -139,6 +164,32 @@ CREATE INDEX IF NOT EXISTS idx_username_id ON peers (peer_id, username);
 	if err != nil {
 		return err
 	}
-	err = s.MigrateAuth()
-	return err
+	if err = s.MigrateAuth(); err != nil {
+		return err
+	}
+	if err = s.MigrateMutes(); err != nil {
+		return err
+	}
+	if err = s.MigrateDirectory(); err != nil {
+		return err
+	}
+	if err = s.MigrateRetention(); err != nil {
+		return err
+	}
+	if err = s.MigrateAlgorithms(); err != nil {
+		return err
+	}
+	if err = s.MigrateEdits(); err != nil {
+		return err
+	}
+	if err = s.MigrateThreads(); err != nil {
+		return err
+	}
+	if err = s.MigrateReactions(); err != nil {
+		return err
+	}
+	if err = s.MigrateReceipts(); err != nil {
+		return err
+	}
+	return s.MigrateSearch()
 }
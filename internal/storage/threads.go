@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"hillside/internal/models"
+)
+
+// MigrateThreads adds the reply columns to messages, filled in from the
+// decrypted MessageBody, and the index loading a thread by its root.
+func (s *Store) MigrateThreads() error {
+	if err := s.addColumn("messages", "reply_to", "INTEGER"); err != nil {
+		return err
+	}
+	if err := s.addColumn("messages", "thread_root", "INTEGER"); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_room_thread ON messages (room_id, thread_root, chain_index) WHERE thread_root IS NOT NULL;`)
+	return err
+}
+
+// SetThread records where the chat message at chainIndex sits in a thread,
+// for messages saved before they could be decrypted, as in catch-up.
+func (s *Store) SetThread(ctx context.Context, roomID string, chainIndex, replyTo, threadRoot uint64) error {
+	const q = `
+UPDATE messages SET reply_to = ?, thread_root = ?
+WHERE room_id = ? AND chain_index = ? AND msg_type = 'chat';
+`
+	if _, err := s.db.ExecContext(ctx, q, int64(replyTo), int64(threadRoot), roomID, int64(chainIndex)); err != nil {
+		return fmt.Errorf("set thread: %w", err)
+	}
+	return nil
+}
+
+// GetThread returns the thread started by the chat message at root: the root,
+// its replies and the edits of all of them, ordered by chain index.
+func (s *Store) GetThread(ctx context.Context, roomID string, root uint64) ([]models.StoredMessage, error) {
+	const q = `
+WITH thread AS (
+	SELECT chain_index FROM messages WHERE room_id = ? AND chain_index = ? AND msg_type = 'chat'
+	UNION ALL
+	SELECT chain_index FROM messages WHERE room_id = ? AND thread_root = ?
+)
+SELECT ` + messageColumns + `
+FROM messages
+WHERE room_id = ? AND (
+	chain_index IN (SELECT chain_index FROM thread)
+	OR (msg_type = 'edit' AND deleted_at IS NULL AND target_index IN (SELECT chain_index FROM thread))
+)
+ORDER BY chain_index ASC;
+`
+	rows, err := s.db.QueryContext(ctx, q, roomID, int64(root), roomID, int64(root), roomID)
+	if err != nil {
+		return nil, fmt.Errorf("select thread: %w", err)
+	}
+	return scanMessages(rows)
+}
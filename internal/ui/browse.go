@@ -19,9 +19,13 @@ type BrowseScreen struct {
 	infoView       *tview.TextView
 	OnCreateServer func(request models.CreateServerRequest) (sid string, err error)
 	OnJoinServer   func(serverID string, pass string) error
+	OnRedeemInvite func(link string) error
 	servers        []models.ServerMeta
+	badges         map[string]Badge // by server ID
 	modalForm      *tview.Form
 	createBtn      *tview.Button
+	redeemBtn      *tview.Button
+	inviteForm     *tview.Form
 	noServersView  *tview.TextView
 	Hub            string
 	title          *tview.TextView
@@ -85,10 +89,17 @@ func (b *BrowseScreen) NewBrowseScreen() {
 		SetLabelColor(b.Theme.GetColor("button-text")).
 		SetBackgroundColor(b.Theme.GetColor("button-active"))
 
+	b.redeemBtn = tview.NewButton("Redeem Invite")
+	b.redeemBtn.SetSelectedFunc(b.showRedeemInviteForm).
+		SetLabelColor(b.Theme.GetColor("button-text")).
+		SetBackgroundColor(b.Theme.GetColor("button-active"))
+
 	b.title = tview.NewTextView().SetDynamicColors(true)
 	b.title.SetTextAlign(tview.AlignLeft)
 
 	header.AddItem(b.title, 0, 2, false).
+		AddItem(b.redeemBtn, 15, 0, false).
+		AddItem(tview.NewBox(), 1, 0, false).
 		AddItem(b.createBtn, 15, 0, false)
 
 	serverView := tview.NewFlex().SetDirection(tview.FlexColumn).
@@ -130,15 +141,7 @@ func (b *BrowseScreen) UpdateServerList(servers []models.ServerMeta) {
 		b.serverPane.RemoveItem(b.noServersView)
 
 		for i, srv := range servers {
-			line := fmt.Sprintf(
-				"%-20s | %-30s | %s | %3d Online",
-				srv.Name,
-				srv.Description,
-				formatBoolPasswordProtected(srv.Visibility),
-				srv.Online,
-			)
-
-			b.serverList.AddItem(line, "", 0, func(idx int) func() {
+			b.serverList.AddItem(b.serverLine(srv), "", 0, func(idx int) func() {
 				return func() {
 					b.selectedServer = &b.servers[idx]
 					if b.selectedServer.Visibility == models.Public {
@@ -157,6 +160,31 @@ func (b *BrowseScreen) UpdateServerList(servers []models.ServerMeta) {
 	}
 }
 
+// serverLine is the text of a server in the server list.
+func (b *BrowseScreen) serverLine(srv models.ServerMeta) string {
+	return fmt.Sprintf(
+		"%-20s | %-30s | %s | %3d Online%s",
+		srv.Name,
+		srv.Description,
+		formatBoolPasswordProtected(srv.Visibility),
+		srv.Online,
+		b.badges[srv.ID],
+	)
+}
+
+// SetServerBadge shows what is unread in the rooms of serverID.
+func (b *BrowseScreen) SetServerBadge(serverID string, badge Badge) {
+	if b.badges == nil {
+		b.badges = make(map[string]Badge)
+	}
+	b.badges[serverID] = badge
+	for i, srv := range b.servers {
+		if srv.ID == serverID && i < b.serverList.GetItemCount() {
+			b.serverList.SetItemText(i, b.serverLine(srv), "")
+		}
+	}
+}
+
 func (b *BrowseScreen) SetHub(hub string) {
 	b.Hub = hub
 	b.title.SetText(fmt.Sprintf("[yellow]Hub:[white] %s", b.Hub))
@@ -2,10 +2,14 @@ package ui
 
 import (
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"hillside/internal/models"
+	"hillside/internal/utils"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -13,27 +17,53 @@ import (
 
 type ChatScreen struct {
 	*UI
-	Layout        *tview.Flex
-	GetServerName func() string
-	GetServerID   func() string
-	GetRoomName   func() string
-	RoomList      *tview.List
-	roomPane      *tview.Flex
-	RoomWrapper   *tview.Flex
-	chatView      *tview.Flex
-	ChatSection   *tview.List
-	createBtn     *tview.Button
-	modalForm     *tview.Form
-	rooms         []models.RoomMeta
-	noRoomView    *tview.TextView
-	OnJoinRoom    func(roomID string, pass string) error
-	sendMessage   func(message string) error
-	OnCreateRoom  func(req models.CreateRoomRequest) (string, error)
-	msgInput      *tview.TextArea
-	sendButton    *tview.Button
-	joinForm      *tview.Form
-	selectedRoom  models.RoomMeta
-	InputHandler  func()
+	Layout          *tview.Flex
+	GetServerName   func() string
+	GetServerID     func() string
+	GetRoomName     func() string
+	RoomList        *tview.List
+	roomPane        *tview.Flex
+	RoomWrapper     *tview.Flex
+	chatView        *tview.Flex
+	ChatSection     *tview.List
+	createBtn       *tview.Button
+	modalForm       *tview.Form
+	rooms           []models.RoomMeta
+	noRoomView      *tview.TextView
+	OnJoinRoom      func(roomID string, pass string) error
+	sendMessage     func(message string) error
+	OnCreateRoom    func(req models.CreateRoomRequest) (string, error)
+	msgInput        *tview.TextArea
+	sendButton      *tview.Button
+	joinForm        *tview.Form
+	selectedRoom    models.RoomMeta
+	InputHandler    func()
+	OnMuteSender    func(index int) error
+	OnEditMessage   func(index int, text string) error
+	OnDeleteMessage func(index int) error
+	OnReply         func(index int, text string) error
+	OnOpenThread    func(index int) ([]string, error)
+	OnReact         func(index int, emoji string) error
+	GetMemberNames  func() []string
+	OnSeenBy        func(index int) ([]string, error)
+	OnAttach        func(path string) error
+	OnDownload      func(index int) error
+	OnSearch        func(req models.SearchRequest) ([]models.SearchResult, error)
+	OnJumpTo        func(roomID string, chainIndex uint64) error
+	OnExport        func(req models.ExportRequest) error
+	OnLoadOlder     func() error     // pages back once scrolled past the first message
+	OnLoadNewer     func() error     // pages forward once scrolled past the last message
+	badges          map[string]Badge // by room ID
+	replyTo         *int             // index of the message the input replies to
+	GetRoomID       func() string
+	OnCreateInvite  func(roomID string, maxUses int, ttl time.Duration, boundPeerID string) (string, string, error)
+	OnRevokeInvite  func(inviteID string) error
+	inviteBtn       *tview.Button
+	inviteForm      *tview.Form
+	editForm        *tview.Form
+	attachForm      *tview.Form
+	searchForm      *tview.Form
+	exportForm      *tview.Form
 }
 
 func (c *ChatScreen) NewChatScreen() {
@@ -55,6 +85,11 @@ func (c *ChatScreen) NewChatScreen() {
 		SetLabelColor(c.Theme.GetColor("button-text")).
 		SetBackgroundColor(c.Theme.GetColor("button-active"))
 
+	c.inviteBtn = tview.NewButton("Invite")
+	c.inviteBtn.SetSelectedFunc(c.showInviteForm).
+		SetLabelColor(c.Theme.GetColor("button-text")).
+		SetBackgroundColor(c.Theme.GetColor("button-active"))
+
 	c.roomPane = tview.NewFlex()
 	c.roomPane.AddItem(c.RoomList, 0, 1, false)
 
@@ -63,7 +98,9 @@ func (c *ChatScreen) NewChatScreen() {
 	c.RoomWrapper = tview.NewFlex()
 	c.RoomWrapper.SetDirection(tview.FlexRow)
 	c.RoomWrapper.AddItem(c.roomPane, 0, 1, false).
-		AddItem(c.createBtn, 1, 0, false)
+		AddItem(c.createBtn, 1, 0, false).
+		AddItem(tview.NewBox(), 1, 0, false).
+		AddItem(c.inviteBtn, 1, 0, false)
 	c.RoomWrapper.SetBorder(true).
 		SetTitle(fmt.Sprintf("[ %s ]", c.GetServerName())).
 		SetTitleColor(c.Theme.GetColor("primary")).
@@ -83,16 +120,24 @@ func (c *ChatScreen) NewChatScreen() {
 		if event.Key() == tcell.KeyEnter {
 			message := c.msgInput.GetText()
 			if message != "" {
-				err := c.sendMessage(message)
+				var err error
+				if c.replyTo != nil {
+					err = c.OnReply(*c.replyTo, message)
+				} else {
+					err = c.sendMessage(message)
+				}
 				if err != nil {
 					c.ShowError("Send message failed", err.Error(), "OK", 0, nil)
 					return nil
 				}
 				c.msgInput.SetText("", false)
+				c.setReplyTo(nil)
 			}
 			return nil
 		} else if event.Key() == tcell.KeyTAB {
-			c.App.SetFocus(c.ChatSection)
+			if !c.CompleteMention() {
+				c.App.SetFocus(c.ChatSection)
+			}
 			return nil
 		}
 		return event
@@ -104,6 +149,76 @@ func (c *ChatScreen) NewChatScreen() {
 
 	c.ChatSection = tview.NewList() //where the messages will be displayed
 	c.ChatSection.SetSelectedBackgroundColor(c.Theme.GetColor("background-light"))
+	c.ChatSection.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if err := c.loadHistory(event.Key()); err != nil {
+			c.ShowError("Loading history failed", err.Error(), "OK", 0, nil)
+		}
+		if event.Rune() == 'm' && c.OnMuteSender != nil {
+			if err := c.OnMuteSender(c.ChatSection.GetCurrentItem()); err != nil {
+				c.ShowError("Mute failed", err.Error(), "OK", 0, nil)
+			}
+			return nil
+		}
+		if event.Rune() == 'e' && c.OnEditMessage != nil {
+			c.showEditForm(c.ChatSection.GetCurrentItem())
+			return nil
+		}
+		if event.Rune() == 'd' && c.OnDeleteMessage != nil {
+			c.showDeleteConfirm(c.ChatSection.GetCurrentItem())
+			return nil
+		}
+		if event.Rune() == 'r' && c.OnReply != nil {
+			index := c.ChatSection.GetCurrentItem()
+			if c.replyTo != nil && *c.replyTo == index {
+				c.setReplyTo(nil)
+			} else {
+				c.setReplyTo(&index)
+				c.App.SetFocus(c.msgInput)
+			}
+			return nil
+		}
+		if event.Rune() == '+' && c.OnReact != nil {
+			c.showReactionPicker(c.ChatSection.GetCurrentItem())
+			return nil
+		}
+		if event.Rune() == 's' && c.OnSeenBy != nil {
+			lines, err := c.OnSeenBy(c.ChatSection.GetCurrentItem())
+			if err != nil {
+				c.ShowError("Seen by failed", err.Error(), "OK", 0, nil)
+				return nil
+			}
+			c.showSeenBy(lines)
+			return nil
+		}
+		if event.Rune() == 'a' && c.OnAttach != nil {
+			c.showAttachForm()
+			return nil
+		}
+		if event.Rune() == 'o' && c.OnDownload != nil {
+			if err := c.OnDownload(c.ChatSection.GetCurrentItem()); err != nil {
+				c.ShowError("Download failed", err.Error(), "OK", 0, nil)
+			}
+			return nil
+		}
+		if event.Rune() == '/' && c.OnSearch != nil {
+			c.showSearchForm()
+			return nil
+		}
+		if event.Rune() == 'x' && c.OnExport != nil {
+			c.showExportForm()
+			return nil
+		}
+		if event.Rune() == 't' && c.OnOpenThread != nil {
+			lines, err := c.OnOpenThread(c.ChatSection.GetCurrentItem())
+			if err != nil {
+				c.ShowError("Open thread failed", err.Error(), "OK", 0, nil)
+				return nil
+			}
+			c.showThread(lines)
+			return nil
+		}
+		return event
+	})
 
 	c.chatView = tview.NewFlex()
 	c.chatView.SetDirection(tview.FlexRow)
@@ -126,6 +241,19 @@ func (c *ChatScreen) NewChatScreen() {
 
 }
 
+// CompleteMention completes the @mention being typed in the message input
+// against the room members, and reports whether there was one to complete.
+func (c *ChatScreen) CompleteMention() bool {
+	if c.GetMemberNames == nil || !c.msgInput.HasFocus() {
+		return false
+	}
+	text, ok := utils.CompleteMention(c.msgInput.GetText(), c.GetMemberNames())
+	if ok {
+		c.msgInput.SetText(text, true)
+	}
+	return ok
+}
+
 func (c *ChatScreen) HookupInputHandler() {
 	if c.InputHandler != nil {
 		c.InputHandler()
@@ -150,14 +278,8 @@ func (c *ChatScreen) UpdateRoomList(rooms []models.RoomMeta) {
 		c.roomPane.RemoveItem(c.noRoomView)
 
 		for i, rm := range rooms {
-			// The main text shows name, description, lock icon, online count
-			line := fmt.Sprintf(
-				"%s %s",
-				rm.Name,
-				formatBoolPasswordProtected(rm.Visibility),
-			)
 			// store index i in the List for selection
-			c.RoomList.AddItem(line, "", 0, func(idx int) func() {
+			c.RoomList.AddItem(c.roomLine(rm), "", 0, func(idx int) func() {
 				return func() {
 					c.selectedRoom = rm
 					if c.selectedRoom.Visibility == models.Public {
@@ -175,6 +297,47 @@ func (c *ChatScreen) UpdateRoomList(rooms []models.RoomMeta) {
 	}
 }
 
+// Badge counts what arrived in a room, or the rooms of a server, while it
+// wasn't on screen.
+type Badge struct {
+	Unread   int
+	Mentions int // of the unread messages, those mentioning us
+}
+
+func (b Badge) String() string {
+	switch {
+	case b.Mentions > 0:
+		return fmt.Sprintf(" [::b](%d) @%d[::-]", b.Unread, b.Mentions)
+	case b.Unread > 0:
+		return fmt.Sprintf(" [::b](%d)[::-]", b.Unread)
+	}
+	return ""
+}
+
+// roomLine is the text of a room in the room list.
+func (c *ChatScreen) roomLine(rm models.RoomMeta) string {
+	// The main text shows name, lock icon and what is unread
+	return fmt.Sprintf(
+		"%s %s%s",
+		rm.Name,
+		formatBoolPasswordProtected(rm.Visibility),
+		c.badges[rm.ID],
+	)
+}
+
+// SetRoomBadge shows what is unread in roomID.
+func (c *ChatScreen) SetRoomBadge(roomID string, b Badge) {
+	if c.badges == nil {
+		c.badges = make(map[string]Badge)
+	}
+	c.badges[roomID] = b
+	for i, rm := range c.rooms {
+		if rm.ID == roomID && i < c.RoomList.GetItemCount() {
+			c.RoomList.SetItemText(i, c.roomLine(rm), "")
+		}
+	}
+}
+
 func (c *ChatScreen) showCreateRoomForm() {
 
 	c.modalForm = tview.NewForm()
@@ -190,40 +353,31 @@ func (c *ChatScreen) showCreateRoomForm() {
 	c.modalForm.SetBorderColor(c.Theme.GetColor("border"))
 	c.modalForm.SetBorderAttributes(tcell.AttrNone)
 
-	visibilityDropdown := tview.NewDropDown().
-		SetLabel("Visibility").
-		SetOptions([]string{"Public", "Password Protected", "Private"}, nil)
-
-	visibilityDropdown.SetBackgroundColor(c.Theme.GetColor("background"))
-	visibilityDropdown.SetFieldBackgroundColor(fieldBg)
-	visibilityDropdown.SetFieldTextColor(fieldText)
-	visibilityDropdown.SetPrefixTextColor(c.Theme.GetColor("background-light"))
-	visibilityDropdown.SetLabelColor(c.Theme.GetColor("primary"))
-	visibilityDropdown.SetListStyles(
-		tcell.StyleDefault.
-			Foreground(fieldText).
-			Background(c.Theme.GetColor("background")),
-		tcell.StyleDefault.
-			Foreground(fieldText).
-			Background(c.Theme.GetColor("background-light")),
-	)
-	visibilityDropdown.SetFocusedStyle(tcell.StyleDefault.
-		Foreground(fieldText).
-		Background(c.Theme.GetColor("background")))
+	visibilityDropdown := c.newDropDown("Visibility", []string{"Public", "Password Protected", "Private"})
+	retentionDropdown := c.newDropDown("Retention", []string{"Keep forever", "Days", "Messages", "Ephemeral (seconds)"})
 
 	c.modalForm.AddInputField("Name", "", 0, nil, nil).
 		AddPasswordField("Password (opt)", "", 0, '*', nil).
 		AddFormItem(visibilityDropdown).
+		AddFormItem(retentionDropdown).
+		AddInputField("Keep (days/messages/seconds)", "", 0, tview.InputFieldInteger, nil).
 		AddButton("Save", func() {
 			name := c.modalForm.GetFormItemByLabel("Name").(*tview.InputField).GetText()
 			pass := c.modalForm.GetFormItemByLabel("Password (opt)").(*tview.InputField).GetText()
 			visibilityIndex, _ := c.modalForm.GetFormItemByLabel("Visibility").(*tview.DropDown).GetCurrentOption()
 			visibility := models.Visibility(visibilityIndex)
+			retentionIndex, _ := c.modalForm.GetFormItemByLabel("Retention").(*tview.DropDown).GetCurrentOption()
+			keep, _ := strconv.ParseInt(c.modalForm.GetFormItemByLabel("Keep (days/messages/seconds)").(*tview.InputField).GetText(), 10, 64)
+			retention := models.Retention{Mode: models.RetentionMode(retentionIndex)}
+			if retention.Mode != models.KeepForever {
+				retention.Value = keep
+			}
 			req := models.CreateRoomRequest{
 				ServerID:     c.GetServerID(),
 				RoomName:     name,
 				Visibility:   visibility,
 				PasswordHash: []byte(pass),
+				Retention:    retention,
 			}
 
 			sid, err := c.OnCreateRoom(req)
@@ -258,10 +412,36 @@ func (c *ChatScreen) showCreateRoomForm() {
 			AddItem(nil, 0, 1, false)
 	}
 
-	c.Pages.AddPage("createRoom", mf(c.modalForm, 40, 12), true, true)
+	c.Pages.AddPage("createRoom", mf(c.modalForm, 40, 16), true, true)
 	c.App.SetFocus(c.modalForm)
 }
 
+// newDropDown returns a drop-down styled like the other form fields.
+func (c *ChatScreen) newDropDown(label string, options []string) *tview.DropDown {
+	_, fieldBg, _, _, fieldText := c.Theme.FormColors()
+	dropDown := tview.NewDropDown().
+		SetLabel(label).
+		SetOptions(options, nil)
+
+	dropDown.SetBackgroundColor(c.Theme.GetColor("background"))
+	dropDown.SetFieldBackgroundColor(fieldBg)
+	dropDown.SetFieldTextColor(fieldText)
+	dropDown.SetPrefixTextColor(c.Theme.GetColor("background-light"))
+	dropDown.SetLabelColor(c.Theme.GetColor("primary"))
+	dropDown.SetListStyles(
+		tcell.StyleDefault.
+			Foreground(fieldText).
+			Background(c.Theme.GetColor("background")),
+		tcell.StyleDefault.
+			Foreground(fieldText).
+			Background(c.Theme.GetColor("background-light")),
+	)
+	dropDown.SetFocusedStyle(tcell.StyleDefault.
+		Foreground(fieldText).
+		Background(c.Theme.GetColor("background")))
+	return dropDown
+}
+
 func (c *ChatScreen) joinRoomForm() {
 	c.joinForm = tview.NewForm()
 
@@ -311,3 +491,322 @@ func (c *ChatScreen) joinRoomForm() {
 	c.Pages.AddPage("joinRoom", mf(c.joinForm, 40, 8), true, true)
 	c.App.SetFocus(c.joinForm)
 }
+
+// showEditForm asks for the new text of the message at index.
+func (c *ChatScreen) showEditForm(index int) {
+	c.editForm = c.newModalForm()
+	c.editForm.AddInputField("New text", "", 0, nil, nil).
+		AddButton("Edit", func() {
+			text := c.editForm.GetFormItemByLabel("New text").(*tview.InputField).GetText()
+			if err := c.OnEditMessage(index, text); err != nil {
+				c.ShowError("Edit failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("editMessage")
+		}).
+		AddButton("Cancel", func() {
+			c.Pages.RemovePage("editMessage")
+		})
+
+	c.editForm.SetTitle("[ Edit Message ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("editMessage", centered(c.editForm, 60, 7), true, true)
+	c.App.SetFocus(c.editForm)
+}
+
+// showAttachForm asks for the path of a file to send to the room.
+func (c *ChatScreen) showAttachForm() {
+	c.attachForm = c.newModalForm()
+	c.attachForm.AddInputField("File path", "", 0, nil, nil).
+		AddButton("Send", func() {
+			path := c.attachForm.GetFormItemByLabel("File path").(*tview.InputField).GetText()
+			if err := c.OnAttach(path); err != nil {
+				c.ShowError("Attach failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("attachFile")
+			c.App.SetFocus(c.ChatSection)
+		}).
+		AddButton("Cancel", func() {
+			c.Pages.RemovePage("attachFile")
+			c.App.SetFocus(c.ChatSection)
+		})
+
+	c.attachForm.SetTitle("[ Attach File ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("attachFile", centered(c.attachForm, 60, 7), true, true)
+	c.App.SetFocus(c.attachForm)
+}
+
+// searchDateLayout is how the search form takes dates.
+const searchDateLayout = "2006-01-02"
+
+// showSearchForm asks what to search the history for, then lists the results.
+func (c *ChatScreen) showSearchForm() {
+	c.searchForm = c.newModalForm()
+	c.searchForm.AddInputField("Words", "", 0, nil, nil).
+		AddInputField("Sender", "", 0, nil, nil).
+		AddInputField("From (YYYY-MM-DD)", "", 0, nil, nil).
+		AddInputField("To (YYYY-MM-DD)", "", 0, nil, nil).
+		AddCheckbox("All rooms", false, nil).
+		AddButton("Search", func() {
+			field := func(label string) string {
+				return strings.TrimSpace(c.searchForm.GetFormItemByLabel(label).(*tview.InputField).GetText())
+			}
+			req := models.SearchRequest{
+				Text:     field("Words"),
+				Sender:   strings.TrimPrefix(field("Sender"), "@"),
+				AllRooms: c.searchForm.GetFormItemByLabel("All rooms").(*tview.Checkbox).IsChecked(),
+			}
+			var err error
+			if from := field("From (YYYY-MM-DD)"); from != "" {
+				if req.Since, err = time.ParseInLocation(searchDateLayout, from, time.Local); err != nil {
+					c.ShowError("Search failed", "Dates are YYYY-MM-DD", "OK", 0, nil)
+					return
+				}
+			}
+			if to := field("To (YYYY-MM-DD)"); to != "" {
+				if req.Until, err = time.ParseInLocation(searchDateLayout, to, time.Local); err != nil {
+					c.ShowError("Search failed", "Dates are YYYY-MM-DD", "OK", 0, nil)
+					return
+				}
+				req.Until = req.Until.AddDate(0, 0, 1) // the whole day
+			}
+			results, err := c.OnSearch(req)
+			if err != nil {
+				c.ShowError("Search failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("search")
+			c.showSearchResults(results)
+		}).
+		AddButton("Cancel", func() {
+			c.Pages.RemovePage("search")
+			c.App.SetFocus(c.ChatSection)
+		})
+
+	c.searchForm.SetTitle("[ Search History ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("search", centered(c.searchForm, 60, 15), true, true)
+	c.App.SetFocus(c.searchForm)
+}
+
+// showSearchResults lists search results, selecting one jumps to it.
+func (c *ChatScreen) showSearchResults(results []models.SearchResult) {
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetSelectedBackgroundColor(c.Theme.GetColor("background-light"))
+	list.SetBackgroundColor(c.Theme.GetColor("background"))
+	list.SetBorder(true).
+		SetTitle(fmt.Sprintf("[ %d results, Esc to close ]", len(results))).
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary")).
+		SetBorderColor(c.Theme.GetColor("border"))
+	for _, r := range results {
+		list.AddItem(r.Line, "", 0, func() {
+			c.Pages.RemovePage("searchResults")
+			if err := c.OnJumpTo(r.RoomID, r.ChainIndex); err != nil {
+				c.ShowError("Open result failed", err.Error(), "OK", 0, nil)
+			}
+		})
+	}
+	list.SetDoneFunc(func() {
+		c.Pages.RemovePage("searchResults")
+		c.App.SetFocus(c.ChatSection)
+	})
+
+	c.Pages.AddPage("searchResults", centered(list, 100, 20), true, true)
+	c.App.SetFocus(list)
+}
+
+// showExportForm asks which history of the room to export and how, then
+// starts the export.
+func (c *ChatScreen) showExportForm() {
+	formats := []models.ExportFormat{models.ExportJSON, models.ExportMarkdown, models.ExportText}
+	c.exportForm = c.newModalForm()
+	c.exportForm.AddDropDown("Format", []string{"JSON, with signatures", "Markdown", "Plain text"}, 0, nil).
+		AddInputField("Sender", "", 0, nil, nil).
+		AddInputField("From (YYYY-MM-DD)", "", 0, nil, nil).
+		AddInputField("To (YYYY-MM-DD)", "", 0, nil, nil).
+		AddButton("Export", func() {
+			field := func(label string) string {
+				return strings.TrimSpace(c.exportForm.GetFormItemByLabel(label).(*tview.InputField).GetText())
+			}
+			format, _ := c.exportForm.GetFormItemByLabel("Format").(*tview.DropDown).GetCurrentOption()
+			req := models.ExportRequest{
+				Format: formats[max(format, 0)],
+				Sender: strings.TrimPrefix(field("Sender"), "@"),
+			}
+			var err error
+			if from := field("From (YYYY-MM-DD)"); from != "" {
+				if req.Since, err = time.ParseInLocation(searchDateLayout, from, time.Local); err != nil {
+					c.ShowError("Export failed", "Dates are YYYY-MM-DD", "OK", 0, nil)
+					return
+				}
+			}
+			if to := field("To (YYYY-MM-DD)"); to != "" {
+				if req.Until, err = time.ParseInLocation(searchDateLayout, to, time.Local); err != nil {
+					c.ShowError("Export failed", "Dates are YYYY-MM-DD", "OK", 0, nil)
+					return
+				}
+				req.Until = req.Until.AddDate(0, 0, 1) // the whole day
+			}
+			if err := c.OnExport(req); err != nil {
+				c.ShowError("Export failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("export")
+			c.App.SetFocus(c.ChatSection)
+		}).
+		AddButton("Cancel", func() {
+			c.Pages.RemovePage("export")
+			c.App.SetFocus(c.ChatSection)
+		})
+
+	c.exportForm.SetTitle("[ Export History ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("export", centered(c.exportForm, 60, 13), true, true)
+	c.App.SetFocus(c.exportForm)
+}
+
+// showDeleteConfirm deletes the message at index once confirmed.
+func (c *ChatScreen) showDeleteConfirm(index int) {
+	modal := tview.NewModal().
+		SetText("Delete this message for everyone?").
+		AddButtons([]string{"Delete", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			c.Pages.RemovePage("deleteMessage")
+			c.App.SetFocus(c.ChatSection)
+			if buttonLabel != "Delete" {
+				return
+			}
+			if err := c.OnDeleteMessage(index); err != nil {
+				c.ShowError("Delete failed", err.Error(), "OK", 0, nil)
+			}
+		})
+	modal.SetButtonStyle(tcell.StyleDefault.
+		Background(c.Theme.GetColor("background")).
+		Foreground(c.Theme.GetColor("primary"))).
+		SetButtonActivatedStyle(tcell.StyleDefault.
+			Background(c.Theme.GetColor("primary")).
+			Foreground(c.Theme.GetColor("background")))
+	modal.SetBackgroundColor(c.Theme.GetColor("background")).
+		SetBorder(true).
+		SetBorderColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("deleteMessage", modal, true, true)
+	c.App.SetFocus(modal)
+}
+
+// reactionEmojis are offered by the reaction picker.
+var reactionEmojis = []string{"👍", "❤️", "😂", "😮", "😢", "🎉"}
+
+// showReactionPicker toggles the chosen reaction to the message at index.
+func (c *ChatScreen) showReactionPicker(index int) {
+	modal := tview.NewModal().
+		SetText("React to this message").
+		AddButtons(append(slices.Clone(reactionEmojis), "Cancel")).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			c.Pages.RemovePage("reactMessage")
+			c.App.SetFocus(c.ChatSection)
+			if buttonIndex < 0 || buttonIndex >= len(reactionEmojis) {
+				return
+			}
+			if err := c.OnReact(index, buttonLabel); err != nil {
+				c.ShowError("Reaction failed", err.Error(), "OK", 0, nil)
+			}
+		})
+	modal.SetButtonStyle(tcell.StyleDefault.
+		Background(c.Theme.GetColor("background")).
+		Foreground(c.Theme.GetColor("primary"))).
+		SetButtonActivatedStyle(tcell.StyleDefault.
+			Background(c.Theme.GetColor("primary")).
+			Foreground(c.Theme.GetColor("background")))
+	modal.SetBackgroundColor(c.Theme.GetColor("background")).
+		SetBorder(true).
+		SetBorderColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("reactMessage", modal, true, true)
+	c.App.SetFocus(modal)
+}
+
+// showSeenBy shows which members received or read a message.
+func (c *ChatScreen) showSeenBy(lines []string) {
+	modal := tview.NewModal().
+		SetText("Seen by\n\n" + strings.Join(lines, "\n")).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			c.Pages.RemovePage("seenBy")
+			c.App.SetFocus(c.ChatSection)
+		})
+	modal.SetButtonStyle(tcell.StyleDefault.
+		Background(c.Theme.GetColor("background")).
+		Foreground(c.Theme.GetColor("primary"))).
+		SetButtonActivatedStyle(tcell.StyleDefault.
+			Background(c.Theme.GetColor("primary")).
+			Foreground(c.Theme.GetColor("background")))
+	modal.SetBackgroundColor(c.Theme.GetColor("background")).
+		SetBorder(true).
+		SetBorderColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("seenBy", modal, true, true)
+	c.App.SetFocus(modal)
+}
+
+// setReplyTo makes the input reply to the message at index, or stop replying
+// when index is nil.
+func (c *ChatScreen) setReplyTo(index *int) {
+	c.replyTo = index
+	if index == nil {
+		c.msgInput.SetTitle("")
+		return
+	}
+	main, _ := c.ChatSection.GetItemText(*index)
+	c.msgInput.SetTitle("Replying to " + main + " (r to cancel)")
+}
+
+// showThread shows the lines of a thread, closed with Escape or Enter.
+func (c *ChatScreen) showThread(lines []string) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWordWrap(true).
+		SetText(strings.Join(lines, "\n"))
+	view.SetDoneFunc(func(key tcell.Key) {
+		c.Pages.RemovePage("thread")
+		c.App.SetFocus(c.ChatSection)
+	})
+	view.SetBackgroundColor(c.Theme.GetColor("background"))
+	view.SetBorder(true).
+		SetTitle("[ Thread ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary")).
+		SetBorderColor(c.Theme.GetColor("border"))
+
+	c.Pages.AddPage("thread", centered(view, 100, 24), true, true)
+	c.App.SetFocus(view)
+}
+
+// loadHistory pages the chat section when key moves past its first or last
+// message. The key is still handled by the list afterwards, which keeps the
+// selected message, so it moves on into what was loaded.
+func (c *ChatScreen) loadHistory(key tcell.Key) error {
+	current, count := c.ChatSection.GetCurrentItem(), c.ChatSection.GetItemCount()
+	switch key {
+	case tcell.KeyUp, tcell.KeyPgUp, tcell.KeyHome:
+		if current == 0 && c.OnLoadOlder != nil {
+			return c.OnLoadOlder()
+		}
+	case tcell.KeyDown, tcell.KeyPgDn, tcell.KeyEnd:
+		if current >= count-1 && c.OnLoadNewer != nil {
+			return c.OnLoadNewer()
+		}
+	}
+	return nil
+}
@@ -87,3 +87,12 @@ func (ui *UI) ShowError(title string, message string, actionName string, duratio
 		}()
 	}
 }
+
+// Bell rings the terminal bell, from any goroutine.
+func (ui *UI) Bell() {
+	ui.App.QueueUpdate(func() {
+		if ui.screen != nil {
+			ui.screen.Beep()
+		}
+	})
+}
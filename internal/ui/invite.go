@@ -0,0 +1,105 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+func (u *UI) newModalForm() *tview.Form {
+	form := tview.NewForm()
+	bgColor, fieldBg, buttonBg, buttonText, fieldText := u.Theme.FormColors()
+	form.SetBackgroundColor(bgColor)
+	form.SetButtonBackgroundColor(buttonBg)
+	form.SetButtonTextColor(buttonText)
+	form.SetFieldBackgroundColor(fieldBg)
+	form.SetFieldTextColor(fieldText)
+	form.SetLabelColor(u.Theme.GetColor("primary"))
+	form.SetBorder(true)
+	form.SetBorderColor(u.Theme.GetColor("border"))
+	form.SetBorderAttributes(tcell.AttrNone)
+	form.SetButtonsAlign(tview.AlignCenter)
+	return form
+}
+
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// showRedeemInviteForm lets the user paste a hillside:// invite link.
+func (b *BrowseScreen) showRedeemInviteForm() {
+	b.inviteForm = b.UI.newModalForm()
+	b.inviteForm.AddInputField("Invite", "", 0, nil, nil).
+		AddButton("Redeem", func() {
+			link := b.inviteForm.GetFormItemByLabel("Invite").(*tview.InputField).GetText()
+			b.UI.Pages.RemovePage("redeemInvite")
+			if err := b.OnRedeemInvite(link); err != nil {
+				b.UI.ShowError("Redeem invite failed", err.Error(), "OK", 0, nil)
+			}
+		}).
+		AddButton("Cancel", func() {
+			b.UI.Pages.RemovePage("redeemInvite")
+		})
+
+	b.inviteForm.SetTitle("[ Redeem Invite ]").
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(b.UI.Theme.GetColor("primary"))
+
+	b.UI.Pages.AddPage("redeemInvite", centered(b.inviteForm, 60, 7), true, true)
+	b.UI.App.SetFocus(b.inviteForm)
+}
+
+// showInviteForm creates an invite to the current server, or to one of its rooms,
+// and revokes invites by ID.
+func (c *ChatScreen) showInviteForm() {
+	c.inviteForm = c.newModalForm()
+	c.inviteForm.AddInputField("Room ID (opt)", c.GetRoomID(), 0, nil, nil).
+		AddInputField("Max uses (0 = any)", "1", 0, tview.InputFieldInteger, nil).
+		AddInputField("Expires in hours (0 = never)", "24", 0, tview.InputFieldInteger, nil).
+		AddInputField("Only for peer ID (opt)", "", 0, nil, nil).
+		AddInputField("Invite ID to revoke", "", 0, nil, nil).
+		AddButton("Create", func() {
+			text := func(label string) string {
+				return strings.TrimSpace(c.inviteForm.GetFormItemByLabel(label).(*tview.InputField).GetText())
+			}
+			maxUses, _ := strconv.Atoi(text("Max uses (0 = any)"))
+			hours, _ := strconv.Atoi(text("Expires in hours (0 = never)"))
+			link, inviteID, err := c.OnCreateInvite(text("Room ID (opt)"), maxUses,
+				time.Duration(hours)*time.Hour, text("Only for peer ID (opt)"))
+			if err != nil {
+				c.ShowError("Create invite failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("invite")
+			c.ShowToast(fmt.Sprintf("Invite %s created, share this link:\n\n%s", inviteID, link), 0, nil)
+		}).
+		AddButton("Revoke", func() {
+			inviteID := strings.TrimSpace(c.inviteForm.GetFormItemByLabel("Invite ID to revoke").(*tview.InputField).GetText())
+			if err := c.OnRevokeInvite(inviteID); err != nil {
+				c.ShowError("Revoke invite failed", err.Error(), "OK", 0, nil)
+				return
+			}
+			c.Pages.RemovePage("invite")
+			c.ShowToast("Invite "+inviteID+" revoked", 3*time.Second, nil)
+		}).
+		AddButton("Cancel", func() {
+			c.Pages.RemovePage("invite")
+		})
+
+	c.inviteForm.SetTitle(fmt.Sprintf("[ Invite to %s ]", c.GetServerName())).
+		SetTitleAlign(tview.AlignCenter).
+		SetTitleColor(c.Theme.GetColor("primary"))
+
+	c.Pages.AddPage("invite", centered(c.inviteForm, 60, 15), true, true)
+	c.App.SetFocus(c.inviteForm)
+}
@@ -11,6 +11,7 @@ type LoginScreen struct {
 	form              *tview.Form
 	loginHandler      func(username, password string, hub string)
 	createUserHandler func(username, password string, hub string)
+	findLANHubHandler func()
 	Username          string
 	Password          string
 	Hub               string
@@ -109,6 +110,9 @@ func (l *LoginScreen) NewLoginScreen() {
 
 		l.createUserHandler(l.Username, l.Password, l.Hub)
 	})
+	if l.findLANHubHandler != nil {
+		l.form.AddButton("Find LAN Hub", l.findLANHubHandler)
+	}
 
 	formContainer := tview.NewFlex().
 		SetDirection(tview.FlexColumn).
@@ -119,3 +123,11 @@ func (l *LoginScreen) NewLoginScreen() {
 	l.Layout.AddItem(formContainer, 0, 2, true).SetBorder(false)
 
 }
+
+// SetHub fills in the hub field, e.g. with a hub found on the local network.
+func (l *LoginScreen) SetHub(hub string) {
+	l.Hub = hub
+	if field, ok := l.form.GetFormItemByLabel("Hub   ").(*tview.InputField); ok {
+		field.SetText(hub)
+	}
+}
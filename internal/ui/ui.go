@@ -3,25 +3,47 @@ package ui
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"hillside/internal/models"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 type UIConfig struct {
-	Theme               *Theme
-	LoginHandler        func(username, password string, hub string)
-	CreateUserHandler   func(username, password string, hub string)
-	CreateServerHandler func(request models.CreateServerRequest) (sid string, err error)
-	JoinServerHandler   func(serverID string, pass string) error
-	GetServerName       func() string
-	GetRoomName         func() string
-	GetServerID         func() string
-	CreateRoomHandler   func(req models.CreateRoomRequest) (string, error)
-	JoinRoomHandler     func(roomID string, pass string) error
-	SendMessageHandler  func(message string) error
-	ChatInputHandler    func()
+	Theme                *Theme
+	LoginHandler         func(username, password string, hub string)
+	CreateUserHandler    func(username, password string, hub string)
+	FindLANHubHandler    func()
+	CreateServerHandler  func(request models.CreateServerRequest) (sid string, err error)
+	JoinServerHandler    func(serverID string, pass string) error
+	GetServerName        func() string
+	GetRoomName          func() string
+	GetServerID          func() string
+	CreateRoomHandler    func(req models.CreateRoomRequest) (string, error)
+	JoinRoomHandler      func(roomID string, pass string) error
+	SendMessageHandler   func(message string) error
+	ChatInputHandler     func()
+	MuteSenderHandler    func(index int) error
+	EditMessageHandler   func(index int, text string) error
+	DeleteMessageHandler func(index int) error
+	ReplyHandler         func(index int, text string) error
+	ThreadHandler        func(index int) ([]string, error)
+	ReactHandler         func(index int, emoji string) error
+	MemberNamesHandler   func() []string
+	SeenByHandler        func(index int) ([]string, error)
+	AttachHandler        func(path string) error
+	DownloadHandler      func(index int) error
+	SearchHandler        func(req models.SearchRequest) ([]models.SearchResult, error)
+	JumpToMessageHandler func(roomID string, chainIndex uint64) error
+	ExportHandler        func(req models.ExportRequest) error
+	LoadOlderHandler     func() error
+	LoadNewerHandler     func() error
+	GetRoomID            func() string
+	CreateInviteHandler  func(roomID string, maxUses int, ttl time.Duration, boundPeerID string) (link string, inviteID string, err error)
+	RedeemInviteHandler  func(link string) error
+	RevokeInviteHandler  func(inviteID string) error
 }
 
 type UI struct {
@@ -29,6 +51,8 @@ type UI struct {
 	Theme *Theme
 	Pages *tview.Pages
 
+	screen tcell.Screen // the last drawn to, for Bell
+
 	// Screens
 	LoginScreen  *LoginScreen
 	BrowseScreen *BrowseScreen
@@ -70,6 +94,11 @@ func NewUI(cfg *UIConfig) *UI {
 		Theme: cfg.Theme,
 	}
 
+	app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		ui.screen = screen
+		return false
+	})
+
 	tview.Styles.PrimitiveBackgroundColor = ui.Theme.GetColor("background")
 	tview.Styles.TitleColor = ui.Theme.GetColor("primary")
 
@@ -77,24 +106,44 @@ func NewUI(cfg *UIConfig) *UI {
 		UI:                ui,
 		Hub:               "",
 		loginHandler:      cfg.LoginHandler,
-		createUserHandler: cfg.CreateUserHandler}
+		createUserHandler: cfg.CreateUserHandler,
+		findLANHubHandler: cfg.FindLANHubHandler}
 	ui.LoginScreen.NewLoginScreen()
 	ui.BrowseScreen = &BrowseScreen{
 		UI:             ui,
 		Hub:            "",
 		OnCreateServer: cfg.CreateServerHandler,
 		OnJoinServer:   cfg.JoinServerHandler,
+		OnRedeemInvite: cfg.RedeemInviteHandler,
 	}
 	ui.BrowseScreen.NewBrowseScreen()
 
 	ui.ChatScreen = &ChatScreen{
-		UI:            ui,
-		GetServerName: cfg.GetServerName,
-		GetRoomName:   cfg.GetRoomName,
-		GetServerID:   cfg.GetServerID,
-		OnCreateRoom:  cfg.CreateRoomHandler,
-		OnJoinRoom:    cfg.JoinRoomHandler,
-		sendMessage:   cfg.SendMessageHandler,
+		UI:              ui,
+		GetServerName:   cfg.GetServerName,
+		GetRoomName:     cfg.GetRoomName,
+		GetServerID:     cfg.GetServerID,
+		OnCreateRoom:    cfg.CreateRoomHandler,
+		OnJoinRoom:      cfg.JoinRoomHandler,
+		sendMessage:     cfg.SendMessageHandler,
+		OnMuteSender:    cfg.MuteSenderHandler,
+		OnEditMessage:   cfg.EditMessageHandler,
+		OnDeleteMessage: cfg.DeleteMessageHandler,
+		OnReply:         cfg.ReplyHandler,
+		OnOpenThread:    cfg.ThreadHandler,
+		OnReact:         cfg.ReactHandler,
+		GetMemberNames:  cfg.MemberNamesHandler,
+		OnSeenBy:        cfg.SeenByHandler,
+		OnAttach:        cfg.AttachHandler,
+		OnDownload:      cfg.DownloadHandler,
+		OnSearch:        cfg.SearchHandler,
+		OnJumpTo:        cfg.JumpToMessageHandler,
+		OnExport:        cfg.ExportHandler,
+		OnLoadOlder:     cfg.LoadOlderHandler,
+		OnLoadNewer:     cfg.LoadNewerHandler,
+		GetRoomID:       cfg.GetRoomID,
+		OnCreateInvite:  cfg.CreateInviteHandler,
+		OnRevokeInvite:  cfg.RevokeInviteHandler,
 	}
 
 	ui.ChatScreen.NewChatScreen()
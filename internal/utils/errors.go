@@ -24,6 +24,10 @@ func JoinRoomError(message string) error {
 	return fmt.Errorf("join room error: %s", message)
 }
 
+func InviteError(message string) error {
+	return fmt.Errorf("invite error: %s", message)
+}
+
 func ValidationError(message string) error {
 	return fmt.Errorf("validation error: %s", message)
 }
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// mentionOf returns the name a word mentions with a leading '@', without
+// trailing punctuation, or "" if it isn't a mention.
+func mentionOf(word string) string {
+	if !strings.HasPrefix(word, "@") {
+		return ""
+	}
+	return strings.TrimRightFunc(word[1:], func(r rune) bool {
+		return unicode.IsPunct(r) && r != '_' && r != '-'
+	})
+}
+
+// MentionsUser reports whether text mentions @username, ignoring case.
+func MentionsUser(text, username string) bool {
+	if username == "" {
+		return false
+	}
+	for _, word := range strings.Fields(text) {
+		if strings.EqualFold(mentionOf(word), username) {
+			return true
+		}
+	}
+	return false
+}
+
+// HighlightMentions renders the mentions of username in text in reverse video.
+func HighlightMentions(text, username string) string {
+	if !MentionsUser(text, username) {
+		return text
+	}
+	var b strings.Builder
+	for i, r := 0, []rune(text); i < len(r); {
+		if r[i] != '@' || (i > 0 && !unicode.IsSpace(r[i-1])) {
+			b.WriteRune(r[i])
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(r) && !unicode.IsSpace(r[end]) {
+			end++
+		}
+		word := string(r[i:end])
+		if name := mentionOf(word); name != "" && strings.EqualFold(name, username) {
+			b.WriteString("[::r]@" + name + "[::-]" + word[1+len(name):])
+		} else {
+			b.WriteString(word)
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// CompleteMention completes the @mention text ends with against names: to the
+// name followed by a space if only one matches, else as far as they agree.
+// It reports false if text doesn't end with a mention that any name matches.
+func CompleteMention(text string, names []string) (string, bool) {
+	start := strings.LastIndexFunc(text, unicode.IsSpace) + 1
+	if !strings.HasPrefix(text[start:], "@") {
+		return text, false
+	}
+	prefix := strings.ToLower(text[start+1:])
+	var matches []string
+	for _, name := range names {
+		if name != "" && !strings.ContainsFunc(name, unicode.IsSpace) &&
+			strings.HasPrefix(strings.ToLower(name), prefix) && !Contains(matches, name) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return text, false
+	}
+	if len(matches) == 1 {
+		return text[:start] + "@" + matches[0] + " ", true
+	}
+	sort.Strings(matches)
+	common := []rune(matches[0])
+	for _, name := range matches[1:] {
+		r := []rune(name)
+		n := 0
+		for n < len(common) && n < len(r) && unicode.ToLower(common[n]) == unicode.ToLower(r[n]) {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(string(common)) < len(prefix) {
+		return text, true
+	}
+	return text[:start] + "@" + string(common), true
+}
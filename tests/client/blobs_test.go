@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hillside/internal/crypto"
+	"hillside/internal/p2p"
+	"hillside/internal/storage"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlobNode starts a loopback node serving the blobs of a fresh cache.
+func newBlobNode(t *testing.T) (*p2p.Node, *storage.BlobCache) {
+	t.Helper()
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	cache, err := storage.NewBlobCache(t.TempDir())
+	require.NoError(t, err)
+	n := &p2p.Node{Host: h, Ctx: context.Background()}
+	n.ServeBlobs(cache)
+	return n, cache
+}
+
+func TestFetchBlob(t *testing.T) {
+	ctx := context.Background()
+	sender, senderCache := newBlobNode(t)
+	member, memberCache := newBlobNode(t)
+	require.NoError(t, member.Host.Connect(ctx, peer.AddrInfo{ID: sender.Host.ID(), Addrs: sender.Host.Addrs()}))
+
+	pt := make([]byte, 700<<10) // several protocol chunks
+	_, _ = rand.Read(pt)
+	key, err := crypto.NewBlobKey()
+	require.NoError(t, err)
+	size, hash, err := senderCache.Encrypt(bytes.NewReader(pt), key)
+	require.NoError(t, err)
+
+	// resume from a download cut short
+	f, _, err := senderCache.Open(hash)
+	require.NoError(t, err)
+	head := make([]byte, 300<<10)
+	_, err = f.Read(head)
+	f.Close()
+	require.NoError(t, err)
+	part, offset, err := memberCache.Partial(hash)
+	require.NoError(t, err)
+	require.Zero(t, offset)
+	_, err = part.Write(head)
+	require.NoError(t, err)
+	part.Close()
+
+	require.NoError(t, member.FetchBlob(ctx, sender.Host.ID(), memberCache, hash, size))
+	require.True(t, memberCache.Has(hash))
+	var out bytes.Buffer
+	require.NoError(t, memberCache.Decrypt(hash, key, &out))
+	require.True(t, bytes.Equal(pt, out.Bytes()))
+
+	// the member now serves it in turn
+	other, otherCache := newBlobNode(t)
+	require.NoError(t, other.Host.Connect(ctx, peer.AddrInfo{ID: member.Host.ID(), Addrs: member.Host.Addrs()}))
+	require.NoError(t, other.FetchBlob(ctx, member.Host.ID(), otherCache, hash, size))
+	require.True(t, otherCache.Has(hash))
+}
+
+func TestFetchBlob_Unavailable(t *testing.T) {
+	ctx := context.Background()
+	sender, _ := newBlobNode(t)
+	member, memberCache := newBlobNode(t)
+	require.NoError(t, member.Host.Connect(ctx, peer.AddrInfo{ID: sender.Host.ID(), Addrs: sender.Host.Addrs()}))
+
+	hash := crypto.BlobHash([]byte("missing"))
+	require.ErrorIs(t, member.FetchBlob(ctx, sender.Host.ID(), memberCache, hash, 100), p2p.ErrBlobUnavailable)
+	require.False(t, memberCache.Has(hash))
+}
+
+func TestBlobCache_RejectsBadDownloads(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := storage.NewBlobCache(dir)
+	require.NoError(t, err)
+	hash := crypto.BlobHash([]byte("expected"))
+
+	part, _, err := cache.Partial(hash)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("tampered"))
+	require.NoError(t, err)
+	part.Close()
+	require.ErrorIs(t, cache.Complete(hash, 8), storage.ErrBadBlob)
+	require.False(t, cache.Has(hash))
+
+	// the bad download is dropped, the next attempt starts over
+	_, err = os.Stat(filepath.Join(dir, hash+".part"))
+	require.True(t, os.IsNotExist(err))
+
+	_, _, err = cache.Open("../" + hash)
+	require.ErrorIs(t, err, storage.ErrBlobNotFound)
+}
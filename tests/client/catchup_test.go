@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/client"
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/storage"
+	"hillside/internal/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnswerCatchUp_MembersOnly(t *testing.T) {
+	ctx := context.Background()
+	me, meKB := historyPeer(t, "me")
+	alice, aliceKB := historyPeer(t, "alice")
+	mallory, malloryKB := historyPeer(t, "mallory")
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+
+	st := newRetentionStore(t)
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, time.Now()))
+	cli := &client.Client{
+		User:   &me,
+		Keybag: meKB,
+		Node:   &p2p.Node{Ctx: ctx},
+		Session: &client.Session{
+			Muted:     client.NewMuteList(),
+			SessionDB: &storage.SessionDB{Store: st, History: storage.NewHistoryManager(10)},
+			Log:       &utils.RemoteLogger{},
+		},
+	}
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	room.Members = []models.User{me, alice}
+	request := func(signer models.User, kb *models.Keybag, from string) (*models.CatchUpResponse, error) {
+		data, _, err := client.MarshalEnvelope(&models.CatchUpRequest{}, signer, kb, "")
+		require.NoError(t, err)
+		return cli.AnswerCatchUp(room, pubsubMessage(t, from, data))
+	}
+
+	resp, err := request(alice, aliceKB, alice.PeerID)
+	require.NoError(t, err)
+	require.Empty(t, resp.Error)
+	got, err := aliceKB.UnwrapKey(*resp.RoomKey)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	// anyone can subscribe to the topic, only members get the key
+	_, err = request(mallory, malloryKB, mallory.PeerID)
+	require.ErrorContains(t, err, "not a member")
+	// and under the keys we know them by: mallory can't pose as alice with her own
+	posing := alice
+	posing.DilithiumPub, posing.KyberPub = mallory.DilithiumPub, mallory.KyberPub
+	_, err = request(posing, malloryKB, alice.PeerID)
+	require.Error(t, err)
+}
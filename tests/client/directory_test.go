@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/storage"
+
+	lib "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func ownerID(t *testing.T, priv lib.PrivKey) string {
+	t.Helper()
+	owner, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return owner.String()
+}
+
+func signedRecord(t *testing.T, priv lib.PrivKey, serverID string, version int64, name string) (*models.DirectoryRecord, *models.DirectoryEntry) {
+	t.Helper()
+	entry := &models.DirectoryEntry{
+		Server: models.ServerMeta{
+			ID:          serverID,
+			Name:        name,
+			Visibility:  models.Public,
+			OwnerPeerID: ownerID(t, priv),
+		},
+		Version: version,
+	}
+	rec, err := p2p.SignDirectoryEntry(entry, priv)
+	require.NoError(t, err)
+	return rec, entry
+}
+
+func TestDirectoryRecord_Signature(t *testing.T) {
+	priv, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	srv := p2p.NewServerID(ownerID(t, priv))
+	rec, _ := signedRecord(t, priv, srv, 1, "general")
+
+	entry, err := p2p.OpenDirectoryRecord(rec)
+	require.NoError(t, err)
+	require.Equal(t, "general", entry.Server.Name)
+
+	rec.Payload = []byte(`{"server":{"server_id":"` + srv + `","name":"evil"},"version":2}`)
+	_, err = p2p.OpenDirectoryRecord(rec)
+	require.ErrorIs(t, err, p2p.ErrInvalidRecord)
+}
+
+func TestDirectoryRecord_ServerIDBoundToOwner(t *testing.T) {
+	owner, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	squatter, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	srv := p2p.NewServerID(ownerID(t, owner))
+	require.True(t, p2p.ServerIDOwnedBy(srv, ownerID(t, owner)))
+	require.False(t, p2p.ServerIDOwnedBy(srv, ownerID(t, squatter)))
+
+	rec, _ := signedRecord(t, squatter, srv, 1, "squatted")
+	_, err = p2p.OpenDirectoryRecord(rec)
+	require.ErrorIs(t, err, p2p.ErrInvalidRecord, "only the owner can publish a server ID")
+	rec, _ = signedRecord(t, squatter, "srv-1", 1, "random")
+	_, err = p2p.OpenDirectoryRecord(rec)
+	require.ErrorIs(t, err, p2p.ErrInvalidRecord)
+}
+
+func TestDirectoryRecord_RejectsNullRooms(t *testing.T) {
+	priv, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	entry := &models.DirectoryEntry{
+		Server: models.ServerMeta{
+			ID:          p2p.NewServerID(ownerID(t, priv)),
+			Visibility:  models.Public,
+			OwnerPeerID: ownerID(t, priv),
+			Rooms:       map[string]*models.RoomMeta{"x": nil},
+		},
+		Version: 1,
+	}
+	rec, err := p2p.SignDirectoryEntry(entry, priv)
+	require.NoError(t, err)
+	_, err = p2p.OpenDirectoryRecord(rec)
+	require.ErrorIs(t, err, p2p.ErrInvalidRecord)
+
+	entry.Server.Rooms = map[string]*models.RoomMeta{"x": {ID: "y", Visibility: models.Public}}
+	rec, err = p2p.SignDirectoryEntry(entry, priv)
+	require.NoError(t, err)
+	_, err = p2p.OpenDirectoryRecord(rec)
+	require.ErrorIs(t, err, p2p.ErrInvalidRecord, "room keyed under another ID")
+}
+
+func TestDirectoryStore_LastWriterWins(t *testing.T) {
+	st, err := storage.NewSQLiteStore(filepath.Join(t.TempDir(), "dir.db"))
+	require.NoError(t, err)
+	defer st.Close()
+	require.NoError(t, st.Migrate())
+	ctx := context.Background()
+
+	owner, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	other, _, err := lib.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+
+	srv := p2p.NewServerID(ownerID(t, owner))
+	rec, entry := signedRecord(t, owner, srv, 2, "v2")
+	changed, err := st.SaveDirectoryRecord(ctx, rec, entry)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	rec, entry = signedRecord(t, owner, srv, 1, "v1")
+	changed, err = st.SaveDirectoryRecord(ctx, rec, entry)
+	require.NoError(t, err)
+	require.False(t, changed, "older versions are ignored")
+
+	rec, entry = signedRecord(t, other, srv, 3, "hijack")
+	changed, err = st.SaveDirectoryRecord(ctx, rec, entry)
+	require.NoError(t, err)
+	require.False(t, changed, "another owner cannot take over a known server")
+
+	got, err := st.GetDirectoryRecord(ctx, srv)
+	require.NoError(t, err)
+	e, err := p2p.OpenDirectoryRecord(got)
+	require.NoError(t, err)
+	require.Equal(t, "v2", e.Server.Name)
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"hillside/internal/client"
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func controlMessage(typ models.MessageType, index uint64) models.StoredMessage {
+	return models.StoredMessage{
+		RoomID:     "room",
+		ChainIndex: &index,
+		MsgType:    typ,
+		SenderID:   "peer",
+		Timestamp:  time.Now().UnixMicro(),
+		Signature:  []byte("sig"),
+		Payload:    []byte("control"),
+	}
+}
+
+func TestEditMessage_RoundTrip(t *testing.T) {
+	data, err := json.Marshal(models.Envelope{
+		Type:    models.MsgTypeEdit,
+		Payload: json.RawMessage(`{"chain_index":3,"ciphertext":"AQI=","padded":true}`),
+	})
+	require.NoError(t, err)
+	_, msg, err := client.UnmarshalEnvelope(data)
+	require.NoError(t, err)
+	edit, ok := msg.(*models.EditMessage)
+	require.True(t, ok)
+	require.EqualValues(t, 3, edit.ChainIndex)
+	require.True(t, edit.Padded)
+	require.Equal(t, models.MsgTypeEdit, edit.Type())
+}
+
+func TestSaveEdit(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now)
+	target := models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: "peer"}
+
+	applied, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 2), target)
+	require.NoError(t, err)
+	require.True(t, applied)
+	// saving it again, as when it is replayed from catch-up, changes nothing
+	_, err = st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 2), target)
+	require.NoError(t, err)
+
+	history, err := st.GetEditHistory(ctx, "room", 0)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.EqualValues(t, 2, *history[0].ChainIndex)
+
+	msgs, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 3)
+	require.NotZero(t, msgs[0].EditedAt)
+	require.Zero(t, msgs[1].EditedAt)
+
+	// only the sender's messages can be targeted
+	applied, err = st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 3), models.MessageRef{RoomID: "room", ChainIndex: 1, SenderID: "other"})
+	require.NoError(t, err)
+	require.False(t, applied)
+}
+
+func TestSaveEdit_DeleteTombstones(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now)
+	target := models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: "peer"}
+
+	_, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 2), target)
+	require.NoError(t, err)
+	applied, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeDelete, 3), target)
+	require.NoError(t, err)
+	require.True(t, applied)
+
+	msgs, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 4)
+	require.NotZero(t, msgs[0].DeletedAt)
+	require.Empty(t, msgs[0].Payload)
+	require.Empty(t, msgs[0].Signature)
+	require.NotZero(t, msgs[2].DeletedAt, "edits go with the deleted message")
+	require.Empty(t, msgs[2].Payload)
+
+	history, err := st.GetEditHistory(ctx, "room", 0)
+	require.NoError(t, err)
+	require.Empty(t, history)
+
+	// an edit arriving after the delete is erased too
+	_, err = st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 4), target)
+	require.NoError(t, err)
+	since, err := st.GetMessagesSinceChainIndex(ctx, "room", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, since, 2, "catch-up only hands out live messages")
+	require.EqualValues(t, 1, *since[0].ChainIndex)
+	require.Equal(t, models.MsgTypeDelete, since[1].MsgType)
+}
+
+func controlPayload(t *testing.T, ctl models.MessageControl) []byte {
+	t.Helper()
+	pt, err := json.Marshal(ctl)
+	require.NoError(t, err)
+	return pt
+}
+
+func TestOpenControl_OnlySenderOrModerator(t *testing.T) {
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	room.Server = client.NewServerSessionWithMeta(&models.ServerMeta{ID: "srv", OwnerPeerID: "owner"})
+	target := models.MessageRef{RoomID: "room", ChainIndex: 4, SenderID: "alice"}
+	edit := controlPayload(t, models.MessageControl{Target: target, Text: "fixed"})
+	del := controlPayload(t, models.MessageControl{Target: target})
+
+	ctl, err := client.OpenControl(room, models.MsgTypeEdit, "alice", edit)
+	require.NoError(t, err)
+	require.Equal(t, "fixed", ctl.Text)
+	_, err = client.OpenControl(room, models.MsgTypeDelete, "alice", del)
+	require.NoError(t, err)
+
+	// nobody else edits alice's messages, not even the moderator
+	for _, signer := range []string{"mallory", "owner"} {
+		_, err = client.OpenControl(room, models.MsgTypeEdit, signer, edit)
+		require.ErrorContains(t, err, "may not edit", signer)
+	}
+	// only the moderator deletes them for her
+	_, err = client.OpenControl(room, models.MsgTypeDelete, "mallory", del)
+	require.ErrorContains(t, err, "may not delete")
+	_, err = client.OpenControl(room, models.MsgTypeDelete, "owner", del)
+	require.NoError(t, err)
+
+	// nor can a control reach into another room, or empty a message
+	other := controlPayload(t, models.MessageControl{Target: models.MessageRef{RoomID: "other", ChainIndex: 4, SenderID: "alice"}, Text: "x"})
+	_, err = client.OpenControl(room, models.MsgTypeEdit, "alice", other)
+	require.ErrorContains(t, err, "targets another room")
+	_, err = client.OpenControl(room, models.MsgTypeEdit, "alice", controlPayload(t, models.MessageControl{Target: target}))
+	require.ErrorContains(t, err, "cannot empty")
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"hillside/internal/client"
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/profile"
+	"hillside/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportRequest_Validate(t *testing.T) {
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, models.ExportRequest{RoomID: "room", Format: models.ExportJSON}.Validate())
+	require.NoError(t, models.ExportRequest{RoomID: "room", Format: models.ExportText, Since: day, Until: day.AddDate(0, 0, 1)}.Validate())
+	require.ErrorIs(t, models.ExportRequest{RoomID: "room", Format: "pdf"}.Validate(), models.ErrInvalidExport)
+	require.ErrorIs(t, models.ExportRequest{Format: models.ExportMarkdown}.Validate(), models.ErrInvalidExport)
+	require.ErrorIs(t, models.ExportRequest{RoomID: "room", Format: models.ExportJSON, Since: day, Until: day}.Validate(), models.ErrInvalidExport)
+}
+
+func TestGetMessagesForExport_Filters(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	saveMessages(t, st, "room", day, day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), day.AddDate(0, 0, 3))
+	saveMessages(t, st, "other", day)
+	idx := uint64(5)
+	require.NoError(t, st.SaveEnvelope(ctx, "", []byte("sig"), []byte("payload"), day.UnixMicro(), models.MsgTypeEdit, &idx, "peer", "room", "srv"))
+
+	all, err := st.GetMessagesForExport(ctx, storage.ExportQuery{RoomID: "room"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1, 2, 3, 4}, chainIndexes(all), "only chat messages")
+
+	page, err := st.GetMessagesForExport(ctx, storage.ExportQuery{RoomID: "room"}, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2}, chainIndexes(page))
+
+	q := storage.ExportQuery{RoomID: "room", Since: day.AddDate(0, 0, 1), Until: day.AddDate(0, 0, 3)}
+	ranged, err := st.GetMessagesForExport(ctx, q, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3}, chainIndexes(ranged))
+}
+
+func exportedMessages() []models.ExportedMessage {
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	reply := uint64(0)
+	return []models.ExportedMessage{
+		{ChainIndex: 0, Time: at, SenderID: "p1", Sender: "alice", Text: "hello\nworld",
+			Reactions: map[string][]string{"👍": {"p2", "p3"}}, SigAlg: "ed25519", Signature: []byte("sig"), Payload: []byte("{}")},
+		{ChainIndex: 1, Time: at.Add(time.Minute), SenderID: "p2", Sender: "bob", Text: "hi", ReplyTo: &reply, Edited: true,
+			Attachment: &models.ExportedAttachment{Name: "cat.png", MIME: "image/png", Size: 10, Hash: "abc"}},
+		{ChainIndex: 2, Time: at.Add(2 * time.Minute), SenderID: "p2", Sender: "bob", Deleted: true},
+	}
+}
+
+func writeArchive(t *testing.T, format models.ExportFormat, msgs []models.ExportedMessage) string {
+	t.Helper()
+	var buf bytes.Buffer
+	aw, err := storage.NewArchiveWriter(&buf, format, storage.ArchiveHeader{RoomID: "room", RoomName: "general", Exported: time.Now()})
+	require.NoError(t, err)
+	for _, m := range msgs {
+		require.NoError(t, aw.Write(m))
+	}
+	n, err := aw.Close()
+	require.NoError(t, err)
+	require.Equal(t, len(msgs), n)
+	return buf.String()
+}
+
+func TestArchiveWriter_JSON(t *testing.T) {
+	for _, msgs := range [][]models.ExportedMessage{nil, exportedMessages()} {
+		var archive struct {
+			RoomID   string                   `json:"room_id"`
+			RoomName string                   `json:"room_name"`
+			Messages []models.ExportedMessage `json:"messages"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(writeArchive(t, models.ExportJSON, msgs)), &archive))
+		require.Equal(t, "room", archive.RoomID)
+		require.Equal(t, "general", archive.RoomName)
+		require.Len(t, archive.Messages, len(msgs))
+		for i := range msgs {
+			require.Equal(t, msgs[i].Text, archive.Messages[i].Text)
+			require.Equal(t, msgs[i].Signature, archive.Messages[i].Signature)
+		}
+	}
+}
+
+func TestArchiveWriter_MarkdownAndText(t *testing.T) {
+	md := writeArchive(t, models.ExportMarkdown, exportedMessages())
+	require.True(t, strings.HasPrefix(md, "# general\n"))
+	require.Contains(t, md, "**alice** · 2025-03-01 12:00:00 · #0  \nhello  \nworld  \n👍 2  \n")
+	require.Contains(t, md, "↪ reply to #0  \nhi _(edited)_  \n📎 cat.png (image/png)")
+	require.Contains(t, md, "_message deleted_")
+	require.NotContains(t, md, "sig")
+
+	txt := writeArchive(t, models.ExportText, exportedMessages())
+	require.Contains(t, txt, "[2025-03-01 12:00:00] #0 alice: hello\n    world [👍 2]\n")
+	require.Contains(t, txt, "[2025-03-01 12:01:00] #1 bob: (reply to #0) hi (edited) [attachment cat.png (image/png)]\n")
+	require.Contains(t, txt, "#2 bob: message deleted\n")
+
+	_, err := storage.NewArchiveWriter(&bytes.Buffer{}, "pdf", storage.ArchiveHeader{RoomID: "room"})
+	require.ErrorIs(t, err, models.ErrInvalidExport)
+}
+
+func TestExport_VerifiableAgainstSender(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+	_, err := profile.GenerateProfile("me", "password")
+	require.NoError(t, err)
+	alice, aliceKB := historyPeer(t, "alice")
+	mallory, _ := historyPeer(t, "mallory")
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+
+	dbPath, err := storage.SessionDBPath("me")
+	require.NoError(t, err)
+	st, err := storage.NewSQLiteStore(dbPath)
+	require.NoError(t, err)
+	defer st.Close()
+	require.NoError(t, st.Migrate())
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, time.Now()))
+	require.NoError(t, st.SaveUser(ctx, &alice))
+	for _, m := range []models.StoredMessage{
+		historyChat(t, key, "room", 0, alice, aliceKB, "hello", false),
+		historyChat(t, key, "room", 1, alice, aliceKB, "sealed", true),
+		historyChat(t, key, "room", 2, alice, aliceKB, "tpyo", false),
+		historyChat(t, key, "room", 4, alice, aliceKB, "sealed tpyo", true),
+	} {
+		require.NoError(t, st.SaveMessage(ctx, m))
+	}
+	target := models.MessageRef{RoomID: "room", ChainIndex: 2, SenderID: alice.PeerID}
+	ctl, err := json.Marshal(models.MessageControl{Target: target, Text: "typo"})
+	require.NoError(t, err)
+	edit := uint64(3)
+	_, env, err := client.MarshalEnvelope(&models.EditMessage{ChatMessage: models.ChatMessage{ChainIndex: edit, Ciphertext: encryptAt(t, key, edit, ctl), Padded: true}}, alice, aliceKB, "")
+	require.NoError(t, err)
+	_, err = st.SaveEdit(ctx, models.StoredMessage{
+		RoomID: "room", ChainIndex: &edit, MsgType: models.MsgTypeEdit, SenderID: alice.PeerID,
+		Timestamp: env.Timestamp, SigAlg: env.SigAlg, Signature: env.Signature, Payload: env.Payload,
+	}, target)
+	require.NoError(t, err)
+	sealedTarget := models.MessageRef{RoomID: "room", ChainIndex: 4, SenderID: alice.PeerID}
+	ctl, err = json.Marshal(models.MessageControl{Target: sealedTarget, Text: "sealed typo"})
+	require.NoError(t, err)
+	_, err = st.SaveEdit(ctx, sealedAs(t, key, 5, models.MsgTypeEdit, models.MsgTypeEdit, alice, aliceKB, string(ctl)), sealedTarget)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := client.Export("me", "password", models.ExportRequest{RoomID: "room", Format: models.ExportJSON}, &buf)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	var archive struct {
+		Messages []models.ExportedMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &archive))
+	msgs := archive.Messages
+	require.Len(t, msgs, 4)
+	for i, text := range []string{"hello", "sealed", "typo", "sealed typo"} {
+		require.Equal(t, text, msgs[i].Text)
+		require.Equal(t, alice.DilithiumPub, msgs[i].SenderKey)
+		require.NoError(t, client.VerifyExported("room", msgs[i]))
+	}
+	require.Empty(t, msgs[1].Signature, "sealed messages are signed inside")
+	require.NotNil(t, msgs[2].Edit)
+	require.Empty(t, msgs[3].Edit.Signature, "sealed edits are signed inside")
+
+	// the text, the edit, the sender key and the room are all checked
+	forged := msgs[0]
+	forged.Text = "goodbye"
+	require.ErrorContains(t, client.VerifyExported("room", forged), "as its sender wrote it")
+	unedited := msgs[2]
+	unedited.Edit = nil
+	require.Error(t, client.VerifyExported("room", unedited))
+	wrongKey := msgs[0]
+	wrongKey.SenderKey = mallory.DilithiumPub
+	require.Error(t, client.VerifyExported("room", wrongKey))
+	require.Error(t, client.VerifyExported("other", msgs[1]))
+	require.Error(t, client.VerifyExported("other", msgs[2]))
+	require.Error(t, client.VerifyExported("other", msgs[3]))
+	// sealed, the message and its edit open for their own sender only
+	stolen := msgs[3]
+	stolen.SenderID = mallory.PeerID
+	require.Error(t, client.VerifyExported("room", stolen))
+	// a key opens its own message only
+	swapped := msgs[0]
+	swapped.Key, swapped.Nonce = msgs[2].Key, msgs[2].Nonce
+	require.Error(t, client.VerifyExported("room", swapped))
+}
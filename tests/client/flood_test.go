@@ -0,0 +1,53 @@
+package client
+
+import (
+	"testing"
+
+	"hillside/internal/client"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFloodGuard(t *testing.T) {
+	fg := client.NewFloodGuard()
+
+	require.True(t, fg.MarkSeen("alice", 1))
+	require.False(t, fg.MarkSeen("alice", 1), "duplicate (sender, chain index) must be dropped")
+	require.True(t, fg.MarkSeen("bob", 1))
+
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		if fg.Allow("alice") {
+			allowed++
+		}
+	}
+	require.Less(t, allowed, 50, "a burst of 50 messages must be throttled")
+	require.True(t, fg.Allow("bob"), "limits are per sender")
+}
+
+func TestFloodGuard_AdmitOnlyAuthors(t *testing.T) {
+	fg := client.NewFloodGuard()
+
+	// mallory forging alice's messages is rejected without using up anything of hers
+	for i := 0; i < 50; i++ {
+		require.Equal(t, pubsub.ValidationReject, fg.Admit("alice", "mallory", 1, true))
+	}
+	require.Equal(t, pubsub.ValidationAccept, fg.Admit("alice", "alice", 1, false))
+	require.Equal(t, pubsub.ValidationIgnore, fg.Admit("alice", "alice", 1, false), "duplicate")
+
+	results := map[pubsub.ValidationResult]int{}
+	for i := uint64(2); i < 50; i++ {
+		results[fg.Admit("alice", "alice", i, true)]++
+	}
+	require.NotZero(t, results[pubsub.ValidationReject], "a direct flooder is rejected")
+}
+
+func TestMuteList(t *testing.T) {
+	ml := client.NewMuteList()
+	require.False(t, ml.IsMuted("alice"))
+	ml.Set("alice", true)
+	require.True(t, ml.IsMuted("alice"))
+	ml.Set("alice", false)
+	require.False(t, ml.IsMuted("alice"))
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaction_Validate(t *testing.T) {
+	target := models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: "peer"}
+	require.NoError(t, models.Reaction{Target: target, Emoji: "👍"}.Validate())
+	require.NoError(t, models.Reaction{Target: target, Emoji: "❤️", Remove: true}.Validate())
+	for _, emoji := range []string{"", "thumbs up", "[red]x", "a\nb", string(make([]byte, models.MaxReactionLen+1))} {
+		require.ErrorIs(t, models.Reaction{Target: target, Emoji: emoji}.Validate(), models.ErrInvalidReaction, emoji)
+	}
+}
+
+func TestSaveReaction(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now)
+	target := models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: "peer"}
+	like := models.Reaction{Target: target, Emoji: "👍"}
+
+	// the same sender adding the same emoji twice counts once
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 2), like))
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 3), like))
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 3), like))
+	reactions, err := st.GetReactions(ctx, "room")
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]map[string][]string{0: {"👍": {"peer"}}}, reactions)
+
+	// a removal only wins over the adds that came before it
+	unlike := like
+	unlike.Remove = true
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 5), unlike))
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 4), like))
+	reactions, err = st.GetReactions(ctx, "room")
+	require.NoError(t, err)
+	require.Empty(t, reactions)
+}
+
+func TestSaveReaction_DroppedWithTarget(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now)
+	target := models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: "peer"}
+
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 2), models.Reaction{Target: target, Emoji: "🎉"}))
+	_, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeDelete, 3), target)
+	require.NoError(t, err)
+	reactions, err := st.GetReactions(ctx, "room")
+	require.NoError(t, err)
+	require.Empty(t, reactions)
+
+	// reactions arriving after the delete are not applied either
+	require.NoError(t, st.SaveReaction(ctx, controlMessage(models.MsgTypeReaction, 4), models.Reaction{Target: target, Emoji: "😮"}))
+	reactions, err = st.GetReactions(ctx, "room")
+	require.NoError(t, err)
+	require.Empty(t, reactions)
+}
+
+func TestExpireMessages_DropsReactions(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now.Add(-3*24*time.Hour), now)
+	for i, target := range []uint64{0, 1} {
+		msg := controlMessage(models.MsgTypeReaction, uint64(2+i))
+		msg.Timestamp = now.UnixMicro()
+		require.NoError(t, st.SaveReaction(ctx, msg, models.Reaction{
+			Target: models.MessageRef{RoomID: "room", ChainIndex: target, SenderID: "peer"},
+			Emoji:  "👍",
+		}))
+	}
+
+	_, err := st.ExpireMessages(ctx, "room", models.Retention{Mode: models.KeepDays, Value: 1}, now)
+	require.NoError(t, err)
+	reactions, err := st.GetReactions(ctx, "room")
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]map[string][]string{1: {"👍": {"peer"}}}, reactions)
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"hillside/internal/client"
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceipt_Validate(t *testing.T) {
+	require.NoError(t, models.Receipt{RoomID: "room", Delivered: 3, Read: 2}.Validate("room", 3))
+	require.NoError(t, models.Receipt{RoomID: "room"}.Validate("room", 0))
+	for _, r := range []models.Receipt{
+		{RoomID: "other", Delivered: 1},
+		{RoomID: "room", Delivered: 1, Read: 2},
+		{RoomID: "room", Delivered: 4, Read: 1},
+	} {
+		require.ErrorIs(t, r.Validate("room", 3), models.ErrInvalidReceipt, "%+v", r)
+	}
+}
+
+func TestSaveReceipt(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, st.SaveReceipt(ctx, "peer", models.Receipt{RoomID: "room", Delivered: 5, Read: 3}))
+	// an older receipt arriving late never moves the indexes back
+	require.NoError(t, st.SaveReceipt(ctx, "peer", models.Receipt{RoomID: "room", Delivered: 4, Read: 4}))
+	require.NoError(t, st.SaveReceipt(ctx, "other", models.Receipt{RoomID: "elsewhere", Delivered: 1, Read: 1}))
+
+	receipts, err := st.GetReceipts(ctx, "room")
+	require.NoError(t, err)
+	require.Equal(t, map[string]models.Receipt{"peer": {RoomID: "room", Delivered: 5, Read: 4}}, receipts)
+}
+
+func TestReceiptTracker_Coalesces(t *testing.T) {
+	rt := client.NewReceiptTracker("room")
+	_, ok := rt.Take()
+	require.False(t, ok)
+
+	// the first message schedules a receipt, later ones ride along with it
+	require.True(t, rt.Note(0, false))
+	require.False(t, rt.Note(1, false))
+	require.False(t, rt.Note(2, true))
+	r, ok := rt.Take()
+	require.True(t, ok)
+	require.Equal(t, models.Receipt{RoomID: "room", Delivered: 3, Read: 3}, r)
+
+	// nothing moved, nothing to schedule or send
+	require.False(t, rt.Note(1, true))
+	_, ok = rt.Take()
+	require.False(t, ok)
+
+	require.True(t, rt.Note(3, false))
+	r, ok = rt.Take()
+	require.True(t, ok)
+	require.Equal(t, models.Receipt{RoomID: "room", Delivered: 4, Read: 3}, r)
+}
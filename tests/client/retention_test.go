@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRetentionStore(t *testing.T) *storage.Store {
+	t.Helper()
+	st, err := storage.NewSQLiteStore(filepath.Join(t.TempDir(), "retention.db"))
+	require.NoError(t, err)
+	t.Cleanup(st.Close)
+	require.NoError(t, st.Migrate())
+	return st
+}
+
+// saveMessages stores one chat message per timestamp, with chain indexes from 0.
+func saveMessages(t *testing.T, st *storage.Store, roomID string, timestamps ...time.Time) {
+	t.Helper()
+	for i, ts := range timestamps {
+		idx := uint64(i)
+		require.NoError(t, st.SaveEnvelope(context.Background(), "", []byte("sig"), []byte("payload"), ts.UnixMicro(), models.MsgTypeChat, &idx, "peer", roomID, "srv"))
+	}
+}
+
+func TestRetention_Validate(t *testing.T) {
+	require.NoError(t, models.Retention{}.Validate())
+	require.NoError(t, models.Retention{Mode: models.KeepDays, Value: 7}.Validate())
+	require.NoError(t, models.Retention{Mode: models.Ephemeral, Value: 60}.Validate())
+	require.ErrorIs(t, models.Retention{Mode: models.KeepForever, Value: 3}.Validate(), models.ErrInvalidRetention)
+	require.ErrorIs(t, models.Retention{Mode: models.KeepMessages}.Validate(), models.ErrInvalidRetention)
+	require.ErrorIs(t, models.Retention{Mode: models.Ephemeral, Value: 1}.Validate(), models.ErrInvalidRetention)
+	require.ErrorIs(t, models.Retention{Mode: 42, Value: 1}.Validate(), models.ErrInvalidRetention)
+}
+
+func TestExpireMessages_Modes(t *testing.T) {
+	now := time.Now()
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		policy models.Retention
+		kept   int
+	}{
+		{"days", models.Retention{Mode: models.KeepDays, Value: 2}, 2},
+		{"messages", models.Retention{Mode: models.KeepMessages, Value: 1}, 1},
+		{"ephemeral", models.Retention{Mode: models.Ephemeral, Value: 30}, 1},
+		{"forever", models.Retention{}, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			st := newRetentionStore(t)
+			saveMessages(t, st, "room", now.Add(-5*24*time.Hour), now.Add(-3*24*time.Hour), now.Add(-time.Hour), now.Add(-time.Second))
+
+			_, err := st.ExpireMessages(ctx, "room", tc.policy, now)
+			require.NoError(t, err)
+			msgs, err := st.GetLatestMessages(ctx, "room", 10)
+			require.NoError(t, err)
+			require.Len(t, msgs, tc.kept)
+		})
+	}
+}
+
+func TestExpireMessages_KeepMessagesCountsChatOnly(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now.Add(-3*time.Minute), now.Add(-2*time.Minute), now.Add(-time.Minute))
+	// a reaction and an edit, newer than every chat message
+	for i, typ := range []models.MessageType{models.MsgTypeReaction, models.MsgTypeEdit} {
+		idx := uint64(3 + i)
+		require.NoError(t, st.SaveEnvelope(ctx, "", []byte("sig"), []byte("payload"), now.UnixMicro(), typ, &idx, "peer", "room", "srv"))
+	}
+
+	exp, err := st.ExpireMessages(ctx, "room", models.Retention{Mode: models.KeepMessages, Value: 2}, now)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, exp.Deleted)
+	msgs, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3, 4}, chainIndexes(msgs))
+}
+
+func TestExpireMessages_ErasesOldRatchetKeys(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, now))
+	saveMessages(t, st, "room", now.Add(-time.Hour), now.Add(-time.Hour), now)
+
+	exp, err := st.ExpireMessages(ctx, "room", models.Retention{Mode: models.Ephemeral, Value: 60}, now)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, exp.Deleted)
+	require.EqualValues(t, 2, exp.NextIndex)
+
+	// the stored key is the one for index 2, the keys of the deleted messages are gone
+	want := &crypto.RoomRatchet{ChainKey: key}
+	for want.Index < 2 {
+		_, _, err := want.NextKey()
+		require.NoError(t, err)
+	}
+	ra, err := st.GetAuth(ctx, "room")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ra.ChainIndex)
+	require.Equal(t, want.ChainKey, ra.MasterRatchetKey)
+
+	// never moves backwards
+	require.NoError(t, st.AdvanceAuth(ctx, "room", 1))
+	ra, err = st.GetAuth(ctx, "room")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, ra.ChainIndex)
+}
+
+func TestExpireMessages_BackdatedKeepsEarlierKeys(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, now))
+	// #2 claims to be an hour old, though chained after #1 which is kept
+	saveMessages(t, st, "room", now.Add(-time.Hour), now, now.Add(-time.Hour), now)
+
+	exp, err := st.ExpireMessages(ctx, "room", models.Retention{Mode: models.Ephemeral, Value: 60}, now)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, exp.Deleted)
+	require.EqualValues(t, 1, exp.NextIndex, "only past the deleted prefix")
+	ra, err := st.GetAuth(ctx, "room")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, ra.ChainIndex)
+
+	// the kept messages can still be decrypted from the stored key
+	want := &crypto.RoomRatchet{ChainKey: key}
+	_, _, err = want.NextKey()
+	require.NoError(t, err)
+	require.Equal(t, want.ChainKey, ra.MasterRatchetKey)
+	msgs, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 3}, chainIndexes(msgs))
+
+	// once those expire too the key moves past all of them
+	exp, err = st.ExpireMessages(ctx, "room", models.Retention{Mode: models.Ephemeral, Value: 60}, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 4, exp.NextIndex)
+	ra, err = st.GetAuth(ctx, "room")
+	require.NoError(t, err)
+	require.EqualValues(t, 4, ra.ChainIndex)
+}
+
+func TestJanitor_Sweep(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "ephemeral", now.Add(-time.Minute), now)
+	saveMessages(t, st, "forever", now.Add(-time.Minute))
+	require.NoError(t, st.SetRetention(ctx, "ephemeral", models.Retention{Mode: models.Ephemeral, Value: 10}))
+	require.NoError(t, st.SetRetention(ctx, "forever", models.Retention{}))
+
+	policies, err := st.ListRetentions(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+
+	j := storage.NewJanitor(time.Hour)
+	var expired []storage.Expiry
+	j.OnExpire(func(exp storage.Expiry) { expired = append(expired, exp) })
+	require.NoError(t, j.Sweep(ctx, st, now))
+	require.Len(t, expired, 1)
+	require.Equal(t, "ephemeral", expired[0].RoomID)
+	require.EqualValues(t, 1, expired[0].Deleted)
+
+	// nothing left to expire
+	expired = nil
+	require.NoError(t, j.Sweep(ctx, st, now))
+	require.Empty(t, expired)
+	msgs, err := st.GetLatestMessages(ctx, "forever", 10)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"hillside/internal/client"
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/storage"
+	"hillside/internal/utils"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	pb "github.com/libp2p/go-libp2p-pubsub/pb"
+	lcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func chainIndexes(msgs []models.StoredMessage) []uint64 {
+	out := make([]uint64, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, *m.ChainIndex)
+	}
+	return out
+}
+
+func TestGetMessagesBefore_Pages(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now, now, now, now, now)
+	saveMessages(t, st, "other", now, now)
+
+	page, err := st.GetMessagesBefore(ctx, "room", math.MaxInt64, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 5}, chainIndexes(page))
+	page, err = st.GetMessagesBefore(ctx, "room", 4, 3)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 2, 3}, chainIndexes(page))
+	page, err = st.GetMessagesBefore(ctx, "room", 0, 3)
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	page, err = st.GetMessagesFrom(ctx, "room", 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3, 4}, chainIndexes(page))
+	page, err = st.GetMessagesFrom(ctx, "room", 6, 3)
+	require.NoError(t, err)
+	require.Empty(t, page)
+}
+
+func TestBuildHistoryPayload_LeavesOutDeleted(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	saveMessages(t, st, "room", now, now, now)
+	idx := uint64(3)
+	require.NoError(t, st.SaveMessage(ctx, models.StoredMessage{
+		RoomID: "room", ServerID: "srv", ChainIndex: &idx, MsgType: models.MsgTypeChat, SenderID: "peer",
+		Timestamp: now.UnixMicro(), SigAlg: "ml-dsa-65", Signature: []byte("sig"), Payload: []byte("payload"),
+	}))
+	_, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeDelete, 4), models.MessageRef{ChainIndex: 1, SenderID: "peer"})
+	require.NoError(t, err)
+
+	h := storage.NewHistoryManager(10)
+	payload, n, err := h.BuildHistoryPayload(ctx, "room", 4, 10, st)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	got, err := h.DecompressCatchUpPayload(ctx, payload, "room", st)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 2, 3}, chainIndexes(got.ReturnedMessages))
+	require.Equal(t, "ml-dsa-65", got.ReturnedMessages[2].SigAlg)
+
+	// 0 asks for the newest: the delete itself and the message before it
+	payload, n, err = h.BuildHistoryPayload(ctx, "room", 0, 2, st)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	got, err = h.DecompressCatchUpPayload(ctx, payload, "room", st)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3, 4}, chainIndexes(got.ReturnedMessages))
+
+	payload, n, err = h.BuildHistoryPayload(ctx, "empty", 0, 10, st)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Nil(t, payload)
+}
+
+// historyPeer is a user with a real peer ID and the keys of a profile,
+// Dilithium2 the one it signs with.
+func historyPeer(t *testing.T, name string) (models.User, *models.Keybag) {
+	t.Helper()
+	priv, libPub, err := lcrypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	libPubBytes, err := lcrypto.MarshalPublicKey(libPub)
+	require.NoError(t, err)
+	pub, sig, err := crypto.GenSigKeyFor(crypto.SigAlgDilithium2)
+	require.NoError(t, err)
+	kemPub, kemPriv, err := crypto.GenKEMKeyFor(crypto.KEMAlgKyber1024)
+	require.NoError(t, err)
+	return models.User{PeerID: id.String(), Username: name, DilithiumPub: pub, KyberPub: kemPub, Libp2pPub: libPubBytes},
+		&models.Keybag{DilithiumPriv: sig, KyberPriv: kemPriv}
+}
+
+// historyChat is text sent by sender at index under the room key, sealed or
+// not, as it is stored.
+func historyChat(t *testing.T, key []byte, roomID string, index uint64, sender models.User, kb *models.Keybag, text string, sealed bool) models.StoredMessage {
+	t.Helper()
+	pt := []byte(text)
+	if sealed {
+		var err error
+		pt, _, err = client.MarshalEnvelope(&models.SealedChat{RoomID: roomID, ChainIndex: index, Text: text}, models.User{PeerID: sender.PeerID}, kb, "")
+		require.NoError(t, err)
+	}
+	_, env, err := client.MarshalEnvelope(&models.ChatMessage{ChainIndex: index, Ciphertext: encryptAt(t, key, index, pt), Padded: true, Sealed: sealed}, sender, kb, "")
+	require.NoError(t, err)
+	return models.StoredMessage{
+		RoomID: roomID, ServerID: "srv", ChainIndex: &index, MsgType: models.MsgTypeChat, SenderID: sender.PeerID,
+		Timestamp: env.Timestamp, SigAlg: env.SigAlg, Signature: env.Signature, Payload: env.Payload,
+	}
+}
+
+// encryptAt encrypts pt as sent at index under the room key.
+func encryptAt(t *testing.T, key []byte, index uint64, pt []byte) []byte {
+	t.Helper()
+	r := &crypto.RoomRatchet{ChainKey: key}
+	for r.Index < index {
+		_, _, err := r.NextKey()
+		require.NoError(t, err)
+	}
+	ct, _, err := crypto.EncryptMessage(r, pt)
+	require.NoError(t, err)
+	return ct
+}
+
+// historyResponse is a history response signed by signer, published by from.
+func historyResponse(t *testing.T, signer models.User, kb *models.Keybag, from string, payload []byte) *pubsub.Message {
+	t.Helper()
+	data, _, err := client.MarshalEnvelope(&models.HistoryResponse{Messages: payload}, signer, kb, "")
+	require.NoError(t, err)
+	return pubsubMessage(t, from, data)
+}
+
+// pubsubMessage is data as received straight from its author.
+func pubsubMessage(t *testing.T, from string, data []byte) *pubsub.Message {
+	t.Helper()
+	pid, err := peer.Decode(from)
+	require.NoError(t, err)
+	return &pubsub.Message{Message: &pb.Message{From: []byte(pid), Data: data}, ReceivedFrom: pid}
+}
+
+func TestSaveHistory_OnlyMembersAndOurRoomKey(t *testing.T) {
+	ctx := context.Background()
+	me, meKB := historyPeer(t, "me")
+	alice, aliceKB := historyPeer(t, "alice")
+	mallory, malloryKB := historyPeer(t, "mallory")
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	otherKey, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+
+	st := newRetentionStore(t)
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, time.Now()))
+	require.NoError(t, st.SaveUser(ctx, &alice))
+	cli := &client.Client{
+		User:   &me,
+		Keybag: meKB,
+		Node:   &p2p.Node{Ctx: ctx},
+		Session: &client.Session{
+			Muted:     client.NewMuteList(),
+			SessionDB: &storage.SessionDB{Store: st, History: storage.NewHistoryManager(10)},
+			Log:       &utils.RemoteLogger{},
+		},
+	}
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	room.Members = []models.User{me, alice}
+
+	moved := historyChat(t, key, "other", 3, alice, aliceKB, "moved", true)
+	moved.RoomID = "room"
+	responder := newRetentionStore(t)
+	for _, m := range []models.StoredMessage{
+		historyChat(t, key, "room", 0, alice, aliceKB, "hello", false),
+		// signed by alice, but sent in another room
+		historyChat(t, otherKey, "room", 1, alice, aliceKB, "replayed", false),
+		historyChat(t, key, "room", 2, alice, aliceKB, "sealed", true),
+		// sealed by alice for another room, under our key
+		moved,
+		historyChat(t, key, "room", 4, alice, aliceKB, "still here", false),
+	} {
+		require.NoError(t, responder.SaveMessage(ctx, m))
+	}
+	payload, n, err := cli.Session.SessionDB.History.BuildHistoryPayload(ctx, "room", 5, 10, responder)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	_, err = cli.SaveHistory(room, historyResponse(t, mallory, malloryKB, mallory.PeerID, payload), 5)
+	require.ErrorContains(t, err, "not a member")
+	// naming alice doesn't help, her key is the one we know
+	_, err = cli.SaveHistory(room, historyResponse(t, alice, malloryKB, alice.PeerID, payload), 5)
+	require.Error(t, err)
+	stored, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+
+	saved, err := cli.SaveHistory(room, historyResponse(t, alice, aliceKB, alice.PeerID, payload), 5)
+	require.NoError(t, err)
+	require.Equal(t, 3, saved)
+	stored, err = st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 2, 4}, chainIndexes(stored))
+
+	var cm models.ChatMessage
+	require.NoError(t, json.Unmarshal(stored[1].Payload, &cm))
+	require.True(t, cm.Sealed)
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"hillside/internal/client"
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+	"hillside/internal/storage"
+	"hillside/internal/utils"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymousPublish_RelayedWithoutAuthor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	const topic = "sealed-test"
+
+	// alice - bob - carol, carol only hears alice through bob
+	hosts := make([]host.Host, 3)
+	topics := make([]*pubsub.Topic, 3)
+	subs := make([]*pubsub.Subscription, 3)
+	for i := range hosts {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		require.NoError(t, err)
+		defer h.Close()
+		hosts[i] = h
+	}
+	for i := 1; i < len(hosts); i++ {
+		require.NoError(t, hosts[i].Connect(ctx, peer.AddrInfo{ID: hosts[i-1].ID(), Addrs: hosts[i-1].Addrs()}))
+	}
+	for i, h := range hosts {
+		ps, err := pubsub.NewGossipSub(ctx, h)
+		require.NoError(t, err)
+		topics[i], err = ps.Join(topic)
+		require.NoError(t, err)
+		subs[i], err = topics[i].Subscribe()
+		require.NoError(t, err)
+	}
+	// wait for bob's mesh to reach both ends
+	require.Eventually(t, func() bool {
+		return len(topics[1].ListPeers()) == 2
+	}, 10*time.Second, 50*time.Millisecond)
+	time.Sleep(2 * time.Second)
+
+	anon, err := p2p.AnonymousPublish()
+	require.NoError(t, err)
+	require.NoError(t, topics[0].Publish(ctx, []byte("sealed"), anon))
+
+	msg, err := subs[2].Next(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("sealed"), msg.Data)
+	require.Equal(t, hosts[1].ID(), msg.ReceivedFrom)
+	ids := []peer.ID{hosts[0].ID(), hosts[1].ID(), hosts[2].ID()}
+	require.False(t, slices.Contains(ids, msg.GetFrom()), "author names a real peer")
+
+	// every message gets its own identity
+	other, err := p2p.AnonymousPublish()
+	require.NoError(t, err)
+	require.NoError(t, topics[0].Publish(ctx, []byte("again"), other))
+	next, err := subs[2].Next(ctx)
+	require.NoError(t, err)
+	require.NotEqual(t, msg.GetFrom(), next.GetFrom())
+}
+
+// sealedAs is text sealed by sender at index as a kind message, stored as a
+// typ message.
+func sealedAs(t *testing.T, key []byte, index uint64, typ, kind models.MessageType, sender models.User, kb *models.Keybag, text string) models.StoredMessage {
+	t.Helper()
+	pt, inner, err := client.MarshalEnvelope(&models.SealedChat{RoomID: "room", ChainIndex: index, Kind: kind, Text: text}, models.User{PeerID: sender.PeerID}, kb, "")
+	require.NoError(t, err)
+	_, env, err := client.MarshalSealedEnvelope(&models.ChatMessage{ChainIndex: index, Ciphertext: encryptAt(t, key, index, pt), Padded: true, Sealed: true})
+	require.NoError(t, err)
+	// stored with the inner signature, as received
+	return models.StoredMessage{
+		RoomID: "room", ServerID: "srv", ChainIndex: &index, MsgType: typ, SenderID: sender.PeerID,
+		Timestamp: inner.Timestamp, SigAlg: inner.SigAlg, Signature: inner.Signature, Payload: env.Payload,
+	}
+}
+
+func TestSaveHistory_SealedControlsKeepTheirType(t *testing.T) {
+	ctx := context.Background()
+	me, meKB := historyPeer(t, "me")
+	alice, aliceKB := historyPeer(t, "alice")
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+
+	st := newRetentionStore(t)
+	require.NoError(t, st.SaveAuth(ctx, "room", 0, key, time.Now()))
+	require.NoError(t, st.SaveUser(ctx, &alice))
+	cli := &client.Client{
+		User:   &me,
+		Keybag: meKB,
+		Node:   &p2p.Node{Ctx: ctx},
+		Session: &client.Session{
+			Muted:     client.NewMuteList(),
+			SessionDB: &storage.SessionDB{Store: st, History: storage.NewHistoryManager(10)},
+			Log:       &utils.RemoteLogger{},
+		},
+	}
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	room.Members = []models.User{me, alice}
+
+	ctl, err := json.Marshal(models.MessageControl{Target: models.MessageRef{RoomID: "room", ChainIndex: 0, SenderID: alice.PeerID}, Text: "edited"})
+	require.NoError(t, err)
+	responder := newRetentionStore(t)
+	for _, m := range []models.StoredMessage{
+		sealedAs(t, key, 0, models.MsgTypeChat, "", alice, aliceKB, "hello"),
+		sealedAs(t, key, 1, models.MsgTypeEdit, models.MsgTypeEdit, alice, aliceKB, string(ctl)),
+		// a sealed chat passed off as an edit, and the other way round
+		sealedAs(t, key, 2, models.MsgTypeEdit, "", alice, aliceKB, string(ctl)),
+		sealedAs(t, key, 3, models.MsgTypeChat, models.MsgTypeEdit, alice, aliceKB, "edited"),
+	} {
+		require.NoError(t, responder.SaveMessage(ctx, m))
+	}
+	payload, n, err := cli.Session.SessionDB.History.BuildHistoryPayload(ctx, "room", 4, 10, responder)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	saved, err := cli.SaveHistory(room, historyResponse(t, alice, aliceKB, alice.PeerID, payload), 4)
+	require.NoError(t, err)
+	require.Equal(t, 2, saved)
+	stored, err := st.GetLatestMessages(ctx, "room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1}, chainIndexes(stored))
+}
@@ -0,0 +1,60 @@
+//go:build sqlite_fts5
+
+package client
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch_FullText(t *testing.T) {
+	st := newRetentionStore(t)
+	require.True(t, st.FullTextSearch())
+	key, err := crypto.SearchIndexKey([]byte("keybag secret"))
+	require.NoError(t, err)
+	indexTexts(t, st, key, "room", time.Now(), []string{"alice"}, "lunch at noon", "dinner")
+	require.Equal(t, []uint64{0}, searchIndexes(t, st, storage.SearchQuery{Tokens: crypto.SearchTokens(key, "noon lunch")}))
+}
+
+func TestMigrateSearch_UpgradesPlainIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plain.db")
+	key, err := crypto.SearchIndexKey([]byte("keybag secret"))
+	require.NoError(t, err)
+
+	// the index a build without FTS5 made
+	db, err := sql.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+CREATE TABLE search_index (
+	tokens TEXT NOT NULL,
+	room_id TEXT NOT NULL,
+	chain_index INTEGER NOT NULL,
+	sender_id TEXT NOT NULL,
+	timestamp INTEGER NOT NULL
+);
+CREATE INDEX idx_search_room ON search_index (room_id, chain_index);
+`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO search_index VALUES (?, 'room', 7, 'alice', 1);`, strings.Join(crypto.SearchTokens(key, "kept words"), " "))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	st, err := storage.NewSQLiteStore(path)
+	require.NoError(t, err)
+	defer st.Close()
+	require.NoError(t, st.Migrate())
+	require.True(t, st.FullTextSearch())
+	require.Equal(t, []uint64{7}, searchIndexes(t, st, storage.SearchQuery{Tokens: crypto.SearchTokens(key, "words")}))
+
+	// and it stays upgraded
+	require.NoError(t, st.MigrateSearch())
+	require.True(t, st.FullTextSearch())
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// indexTexts indexes one message per text of room, at chain indexes from 0
+// and timestamps from start an hour apart, sent by senders in turn.
+func indexTexts(t *testing.T, st *storage.Store, key []byte, roomID string, start time.Time, senders []string, texts ...string) {
+	t.Helper()
+	entries := make([]storage.SearchEntry, len(texts))
+	for i, text := range texts {
+		entries[i] = storage.SearchEntry{
+			RoomID:     roomID,
+			ChainIndex: uint64(i),
+			SenderID:   senders[i%len(senders)],
+			Timestamp:  start.Add(time.Duration(i) * time.Hour).UnixMicro(),
+			Tokens:     crypto.SearchTokens(key, text),
+		}
+	}
+	require.NoError(t, st.IndexMessages(context.Background(), entries))
+}
+
+func searchIndexes(t *testing.T, st *storage.Store, q storage.SearchQuery) []uint64 {
+	t.Helper()
+	hits, err := st.Search(context.Background(), q)
+	require.NoError(t, err)
+	var out []uint64
+	for _, h := range hits {
+		out = append(out, h.ChainIndex)
+	}
+	return out
+}
+
+func TestSearch_Filters(t *testing.T) {
+	st := newRetentionStore(t)
+	key, err := crypto.SearchIndexKey([]byte("keybag secret"))
+	require.NoError(t, err)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	indexTexts(t, st, key, "room", start, []string{"alice", "bob"},
+		"Lunch at noon?", "lunch sounds good", "What about dinner", "Lunch, then dinner!")
+	indexTexts(t, st, key, "other", start, []string{"alice"}, "lunch elsewhere")
+	words := func(text string) []string { return crypto.SearchTokens(key, text) }
+
+	// every word must match, newest first, ignoring case and punctuation
+	require.Equal(t, []uint64{3, 1, 0}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("LUNCH"), RoomIDs: []string{"room"}}))
+	require.Equal(t, []uint64{3}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("dinner lunch"), RoomIDs: []string{"room"}}))
+	require.Len(t, searchIndexes(t, st, storage.SearchQuery{Tokens: words("lunch")}), 4)
+	require.Empty(t, searchIndexes(t, st, storage.SearchQuery{Tokens: words("breakfast")}))
+
+	require.Equal(t, []uint64{3, 1}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("lunch"), RoomIDs: []string{"room"}, SenderIDs: []string{"bob"}}))
+	require.Equal(t, []uint64{1}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("good"), SenderIDs: []string{"bob", "carol"}}))
+	require.Equal(t, []uint64{1, 0}, searchIndexes(t, st, storage.SearchQuery{
+		Tokens:  words("lunch"),
+		RoomIDs: []string{"room"},
+		Until:   start.Add(2 * time.Hour),
+	}))
+	require.Equal(t, []uint64{3}, searchIndexes(t, st, storage.SearchQuery{
+		Tokens:  words("lunch"),
+		RoomIDs: []string{"room"},
+		Since:   start.Add(2 * time.Hour),
+	}))
+	require.Equal(t, []uint64{3}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("lunch"), RoomIDs: []string{"room"}, Limit: 1}))
+
+	// reindexing after an edit replaces the words
+	require.NoError(t, st.ReindexMessage(context.Background(), "room", 0, words("brunch instead")))
+	require.Equal(t, []uint64{3, 1}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("lunch"), RoomIDs: []string{"room"}}))
+	require.Equal(t, []uint64{0}, searchIndexes(t, st, storage.SearchQuery{Tokens: words("brunch"), RoomIDs: []string{"room"}}))
+}
+
+func TestSearch_ForgetsDeletedAndExpired(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	key, err := crypto.SearchIndexKey([]byte("keybag secret"))
+	require.NoError(t, err)
+	now := time.Now()
+	sent := []time.Time{now.Add(-3 * 24 * time.Hour), now, now}
+	saveMessages(t, st, "room", sent...)
+	words := crypto.SearchTokens(key, "secret")
+	for i, ts := range sent {
+		require.NoError(t, st.IndexMessages(ctx, []storage.SearchEntry{{
+			RoomID: "room", ChainIndex: uint64(i), SenderID: "peer", Timestamp: ts.UnixMicro(), Tokens: words,
+		}}))
+	}
+
+	_, err = st.SaveEdit(ctx, controlMessage(models.MsgTypeDelete, 3), models.MessageRef{RoomID: "room", ChainIndex: 2, SenderID: "peer"})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1, 0}, searchIndexes(t, st, storage.SearchQuery{Tokens: words}))
+
+	// indexing a deleted message again, say from an old copy, is a no-op
+	require.NoError(t, st.IndexMessages(ctx, []storage.SearchEntry{{
+		RoomID: "room", ChainIndex: 2, SenderID: "peer", Timestamp: now.UnixMicro(), Tokens: words,
+	}}))
+	require.Equal(t, []uint64{1, 0}, searchIndexes(t, st, storage.SearchQuery{Tokens: words}))
+
+	_, err = st.ExpireMessages(ctx, "room", models.Retention{Mode: models.KeepDays, Value: 1}, now)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1}, searchIndexes(t, st, storage.SearchQuery{Tokens: words}))
+}
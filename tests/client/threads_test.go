@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetThread(t *testing.T) {
+	st := newRetentionStore(t)
+	ctx := context.Background()
+	now := time.Now()
+	// 0: root, 1: unrelated, 2: reply to 0, 3: reply to 2, 5: edit of 3
+	saveMessages(t, st, "room", now, now)
+	reply := func(index, replyTo uint64) models.StoredMessage {
+		root := uint64(0)
+		return models.StoredMessage{
+			RoomID:     "room",
+			ChainIndex: &index,
+			MsgType:    models.MsgTypeChat,
+			SenderID:   "peer",
+			Timestamp:  now.UnixMicro(),
+			Signature:  []byte("sig"),
+			Payload:    []byte("payload"),
+			ReplyTo:    &replyTo,
+			ThreadRoot: &root,
+		}
+	}
+	require.NoError(t, st.SaveMessage(ctx, reply(2, 0)))
+	// a reply saved by catch-up gets its thread once decrypted
+	require.NoError(t, st.SaveEnvelope(ctx, "", []byte("sig"), []byte("payload"), now.UnixMicro(), models.MsgTypeChat, ptr(3), "peer", "room", ""))
+	require.NoError(t, st.SetThread(ctx, "room", 3, 2, 0))
+	_, err := st.SaveEdit(ctx, controlMessage(models.MsgTypeEdit, 5), models.MessageRef{RoomID: "room", ChainIndex: 3, SenderID: "peer"})
+	require.NoError(t, err)
+
+	thread, err := st.GetThread(ctx, "room", 0)
+	require.NoError(t, err)
+	var indexes []uint64
+	for _, m := range thread {
+		indexes = append(indexes, *m.ChainIndex)
+	}
+	require.Equal(t, []uint64{0, 2, 3, 5}, indexes)
+	require.Nil(t, thread[0].ThreadRoot)
+	require.EqualValues(t, 2, *thread[2].ReplyTo)
+	require.EqualValues(t, 0, *thread[2].ThreadRoot)
+}
+
+func TestOpenMessage(t *testing.T) {
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	sender := &crypto.RoomRatchet{ChainKey: key}
+	var cts [][]byte
+	for _, text := range []string{"first", "second", "third"} {
+		ct, _, err := crypto.EncryptMessage(sender, []byte(text))
+		require.NoError(t, err)
+		cts = append(cts, ct)
+	}
+
+	r := &crypto.RoomRatchet{ChainKey: key}
+	pt, err := crypto.OpenMessage(r, 2, cts[2], true)
+	require.NoError(t, err)
+	require.Equal(t, "third", string(pt))
+	_, err = crypto.OpenMessage(r, 1, cts[1], true)
+	require.ErrorIs(t, err, crypto.ErrDecryptionFailed, "earlier keys are erased")
+}
+
+func ptr(i uint64) *uint64 { return &i }
@@ -0,0 +1,202 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"hillside/internal/crypto"
+	"hillside/internal/hub"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengeStore_SingleUse(t *testing.T) {
+	cs := hub.NewChallengeStore()
+	p := peer.ID("peer-a")
+
+	nonce, err := cs.Issue(p, "srv", "room")
+	require.NoError(t, err)
+	require.Nil(t, cs.Take(p, "srv", "other"))
+	require.Equal(t, nonce, cs.Take(p, "srv", "room"))
+	require.Nil(t, cs.Take(p, "srv", "room"))
+}
+
+func TestPasswordProof(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	verifier := crypto.PasswordVerifier("hunter2", salt)
+	nonce := []byte("nonce")
+
+	proof := crypto.PasswordProof(verifier, nonce, "peer", "srv", "room")
+	require.True(t, crypto.CheckPasswordProof(verifier, nonce, proof, "peer", "srv", "room"))
+	require.False(t, crypto.CheckPasswordProof(verifier, []byte("other"), proof, "peer", "srv", "room"))
+	require.False(t, crypto.CheckPasswordProof(verifier, nonce, proof, "mallory", "srv", "room"))
+	require.False(t, crypto.CheckPasswordProof(crypto.PasswordVerifier("wrong", salt), nonce, proof, "peer", "srv", "room"))
+}
+
+func TestHubServer_PasswordChallenge(t *testing.T) {
+	srv, err := hub.NewHubServer(context.Background(), "/ip4/127.0.0.1/tcp/0")
+	require.NoError(t, err)
+	defer srv.Host.Close()
+	hubAddr := srv.Host.Addrs()[0].String() + "/p2p/" + srv.Host.ID().String()
+	// only wrong passwords should throttle the guest here, not the join RPCs themselves
+	srv.Limiter = hub.NewRateLimiter(map[string]hub.MethodLimit{
+		"CreateServer":           {Rate: 0, Burst: 1},
+		"JoinChallenge":          {Rate: 0, Burst: 20},
+		"JoinServer":             {Rate: 0, Burst: 20},
+		hub.PasswordFailureLimit: hub.DefaultMethodLimits[hub.PasswordFailureLimit],
+	})
+
+	owner, ctx := newTestClient(t)
+	defer owner.Close()
+	guest, _ := newTestClient(t)
+	defer guest.Close()
+
+	salt := []byte("0123456789abcdef")
+	var createResp models.CreateServerResponse
+	sendRPC(t, ctx, owner, hubAddr, "CreateServer", signedCreate(t, owner, models.CreateServerRequest{
+		Name: "locked", Visibility: models.PasswordProtected,
+		PasswordSalt: salt, PasswordHash: crypto.PasswordVerifier("hunter2", salt),
+	}), &createResp)
+	require.Empty(t, createResp.Error)
+	sid := createResp.ServerID
+
+	challenge := func() models.JoinChallengeResponse {
+		var resp models.JoinChallengeResponse
+		sendRPC(t, ctx, guest, hubAddr, "JoinChallenge", models.JoinChallengeRequest{ServerID: sid}, &resp)
+		require.Empty(t, resp.Error)
+		require.Equal(t, salt, resp.Salt)
+		return resp
+	}
+	join := func(proof []byte) models.JoinServerResponse {
+		var resp models.JoinServerResponse
+		sendRPC(t, ctx, guest, hubAddr, "JoinServer", models.JoinServerRequest{ServerID: sid, Proof: proof}, &resp)
+		return resp
+	}
+
+	ch := challenge()
+	proof := crypto.PasswordProof(crypto.PasswordVerifier("hunter2", ch.Salt), ch.Nonce, guest.ID().String(), sid, "")
+	resp := join(proof)
+	require.Empty(t, resp.Error)
+	require.Nil(t, resp.Server.PasswordHash)
+	require.Nil(t, resp.Server.PasswordSalt)
+
+	// the nonce is spent, replaying the same proof fails
+	resp = join(proof)
+	require.Equal(t, hub.ErrInvalidPassword.Error(), resp.Error)
+
+	// wrong passwords get throttled
+	for i := 0; i < 10; i++ {
+		ch = challenge()
+		resp = join(crypto.PasswordProof(crypto.PasswordVerifier("guess", ch.Salt), ch.Nonce, guest.ID().String(), sid, ""))
+		if resp.Error == hub.ErrTooManyAttempts.Error() {
+			break
+		}
+		require.Equal(t, hub.ErrInvalidPassword.Error(), resp.Error)
+	}
+	require.Equal(t, hub.ErrTooManyAttempts.Error(), resp.Error)
+}
+
+func TestWrapRoomKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	_, roomKey, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+
+	wrapped, err := crypto.WrapRoomKey(roomKey, "hunter2", salt)
+	require.NoError(t, err)
+
+	got, err := crypto.UnwrapRoomKey(wrapped, "hunter2", salt)
+	require.NoError(t, err)
+	require.Equal(t, roomKey, got)
+
+	_, err = crypto.UnwrapRoomKey(wrapped, "wrong", salt)
+	require.ErrorIs(t, err, crypto.ErrBadKey)
+
+	// the verifier the hub stores is not the wrapping key
+	_, err = crypto.UnwrapRoomKey(wrapped, string(crypto.PasswordVerifier("hunter2", salt)), salt)
+	require.Error(t, err)
+	require.NotEqual(t, crypto.PasswordVerifier("hunter2", salt), crypto.RoomKeyWrappingKey("hunter2", salt))
+}
+
+func TestHubServer_JoinRoomReturnsWrappedKey(t *testing.T) {
+	srv, err := hub.NewHubServer(context.Background(), "/ip4/127.0.0.1/tcp/0")
+	require.NoError(t, err)
+	defer srv.Host.Close()
+	hubAddr := srv.Host.Addrs()[0].String() + "/p2p/" + srv.Host.ID().String()
+
+	client, ctx := newTestClient(t)
+	defer client.Close()
+
+	var createResp models.CreateServerResponse
+	sendRPC(t, ctx, client, hubAddr, "CreateServer", signedCreate(t, client, models.CreateServerRequest{Name: "open"}), &createResp)
+	sid := createResp.ServerID
+
+	// the room advert goes out on a topic anyone can read
+	ps, err := pubsub.NewGossipSub(ctx, client)
+	require.NoError(t, err)
+	top, err := ps.Join(p2p.RoomsTopic(sid))
+	require.NoError(t, err)
+	sub, err := top.Subscribe()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return slices.Contains(srv.PS.ListPeers(p2p.RoomsTopic(sid)), client.ID())
+	}, 5*time.Second, 50*time.Millisecond)
+
+	salt := []byte("0123456789abcdef")
+	_, roomKey, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	wrapped, err := crypto.WrapRoomKey(roomKey, "hunter2", salt)
+	require.NoError(t, err)
+	var roomResp models.CreateRoomResponse
+	sendRPC(t, ctx, client, hubAddr, "CreateRoom", models.CreateRoomRequest{
+		ServerID: sid, RoomName: "vault", Visibility: models.PasswordProtected,
+		PasswordSalt: salt, PasswordHash: crypto.PasswordVerifier("hunter2", salt), EncRoomKey: wrapped,
+	}, &roomResp)
+	require.Empty(t, roomResp.Error)
+
+	var rooms models.ListRoomsResponse
+	sendRPC(t, ctx, client, hubAddr, "ListRooms", models.ListRoomsRequest{ServerID: sid}, &rooms)
+	require.Len(t, rooms.Rooms, 1)
+	require.Nil(t, rooms.Rooms[0].EncRoomKey)
+
+	advCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	msg, err := sub.Next(advCtx)
+	require.NoError(t, err)
+	var advert models.ListRoomsResponse
+	require.NoError(t, json.Unmarshal(msg.Data, &advert))
+	require.Len(t, advert.Rooms, 1)
+	require.Nil(t, advert.Rooms[0].EncRoomKey)
+	require.Nil(t, advert.Rooms[0].PasswordHash)
+
+	var servers models.ListServersResponse
+	sendRPC(t, ctx, client, hubAddr, "ListServers", struct{}{}, &servers)
+	require.Len(t, servers.Servers, 1)
+	listed := servers.Servers[0].Rooms[roomResp.RoomID]
+	require.NotNil(t, listed)
+	require.Nil(t, listed.EncRoomKey)
+	require.Nil(t, listed.PasswordHash)
+	require.Nil(t, listed.Members)
+
+	var ch models.JoinChallengeResponse
+	sendRPC(t, ctx, client, hubAddr, "JoinChallenge", models.JoinChallengeRequest{ServerID: sid, RoomID: roomResp.RoomID}, &ch)
+	require.Empty(t, ch.Error)
+	var join models.JoinRoomResponse
+	sendRPC(t, ctx, client, hubAddr, "JoinRoom", models.JoinRoomRequest{
+		ServerID: sid, RoomID: roomResp.RoomID,
+		Proof:  crypto.PasswordProof(crypto.PasswordVerifier("hunter2", ch.Salt), ch.Nonce, client.ID().String(), sid, roomResp.RoomID),
+		Sender: models.User{PeerID: client.ID().String()},
+	}, &join)
+	require.Empty(t, join.Error)
+	require.Nil(t, join.Room.PasswordHash)
+
+	got, err := crypto.UnwrapRoomKey(join.Room.EncRoomKey, "hunter2", join.Room.PasswordSalt)
+	require.NoError(t, err)
+	require.Equal(t, roomKey, got)
+}
@@ -0,0 +1,299 @@
+package hub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"hillside/internal/hub"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+
+	lcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(id, owner string, version int64, rooms ...string) *models.ServerMeta {
+	sm := &models.ServerMeta{
+		ID:          id,
+		Name:        "v" + string(rune('0'+version)),
+		OwnerPeerID: owner,
+		Visibility:  models.Public,
+		Rooms:       map[string]*models.RoomMeta{},
+		Version:     version,
+	}
+	for _, r := range rooms {
+		sm.Rooms[r] = &models.RoomMeta{ID: r, Name: r, Members: map[string]models.Member{}}
+	}
+	return sm
+}
+
+// signServer signs sm as the owner record it was created from.
+func signServer(t *testing.T, key lcrypto.PrivKey, sm *models.ServerMeta) *models.ServerMeta {
+	t.Helper()
+	signed := *sm
+	signed.Rooms = nil
+	rec, err := p2p.SignDirectoryEntry(&models.DirectoryEntry{Server: signed, Version: sm.Version}, key)
+	require.NoError(t, err)
+	sm.Record = rec
+	return sm
+}
+
+// signedServer is newServer owned by key, a new one if id is empty, signed.
+func signedServer(t *testing.T, key lcrypto.PrivKey, id string, version int64, rooms ...string) *models.ServerMeta {
+	t.Helper()
+	owner, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+	if id == "" {
+		id = p2p.NewServerID(owner.String())
+	}
+	return signServer(t, key, newServer(id, owner.String(), version, rooms...))
+}
+
+// signedCreate is req with the owner record of h as its creator.
+func signedCreate(t *testing.T, h host.Host, req models.CreateServerRequest) models.CreateServerRequest {
+	t.Helper()
+	sm := signServer(t, h.Peerstore().PrivKey(h.ID()), &models.ServerMeta{
+		ID:           p2p.NewServerID(h.ID().String()),
+		Name:         req.Name,
+		Description:  req.Description,
+		Visibility:   req.Visibility,
+		OwnerPeerID:  h.ID().String(),
+		PasswordHash: req.PasswordHash,
+		PasswordSalt: req.PasswordSalt,
+		Version:      time.Now().UnixMicro(),
+	})
+	req.Record = sm.Record
+	return req
+}
+
+func ownerKey(t *testing.T) lcrypto.PrivKey {
+	t.Helper()
+	key, _, err := lcrypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	return key
+}
+
+func TestHubStore_MergeLastWriterWins(t *testing.T) {
+	a := hub.NewHubStore()
+	b := hub.NewHubStore()
+	key := ownerKey(t)
+	created := signedServer(t, key, "", 1)
+	id, owner := created.ID, created.OwnerPeerID
+	require.NoError(t, a.CreateServer(created))
+	changed, err := b.Merge(signedServer(t, key, id, 1))
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// each hub creates a room concurrently, then the owner renames the server
+	require.NoError(t, a.CreateRoom(id, owner, &models.RoomMeta{ID: "room-a", Members: map[string]models.Member{}}))
+	require.NoError(t, b.CreateRoom(id, owner, &models.RoomMeta{ID: "room-b", Members: map[string]models.Member{}}))
+	snapA, err := a.SnapshotServer(id)
+	require.NoError(t, err)
+	renamed := signedServer(t, key, id, 3)
+	snapB, err := b.SnapshotServer(id)
+	require.NoError(t, err)
+	renamed.Rooms = snapB.Rooms
+
+	_, err = a.Merge(renamed)
+	require.NoError(t, err)
+	_, err = b.Merge(&snapA)
+	require.NoError(t, err)
+
+	srv, err := a.GetServer(id)
+	require.NoError(t, err)
+	require.Equal(t, "v3", srv.Name, "newest version wins")
+	for _, st := range []*hub.HubStore{a, b} {
+		srv, err := st.GetServer(id)
+		require.NoError(t, err)
+		require.Len(t, srv.Rooms, 2, "rooms from both hubs are kept")
+		require.NotNil(t, srv.Rooms["room-a"].Members)
+	}
+}
+
+func TestHubStore_MergeOnlyTrustsOwnerRecords(t *testing.T) {
+	st := hub.NewHubStore()
+	key := ownerKey(t)
+	created := signedServer(t, key, "", 1)
+	created.Visibility = models.PasswordProtected
+	created.PasswordHash = []byte("hash")
+	created = signServer(t, key, created)
+	id := created.ID
+	_, err := st.Merge(created)
+	require.NoError(t, err)
+
+	// a peer hub can bump the version, the fields still come from the record
+	forged, err := st.SnapshotServer(id)
+	require.NoError(t, err)
+	forged.Version = 10
+	forged.Name = "forged"
+	forged.Visibility = models.Public
+	forged.PasswordHash = []byte("forged")
+	changed, err := st.Merge(&forged)
+	require.NoError(t, err)
+	require.False(t, changed)
+	srv, err := st.GetServer(id)
+	require.NoError(t, err)
+	require.Equal(t, "v1", srv.Name)
+	require.Equal(t, models.PasswordProtected, srv.Visibility)
+	require.Equal(t, []byte("hash"), srv.PasswordHash)
+
+	// nor can it drop the record, swap in another, or sign one itself
+	unsigned := forged
+	unsigned.Record = nil
+	_, err = st.Merge(&unsigned)
+	require.ErrorIs(t, err, hub.ErrInvalidServer)
+	swapped := forged
+	swapped.Record = signedServer(t, key, "", 10).Record
+	_, err = st.Merge(&swapped)
+	require.ErrorIs(t, err, hub.ErrInvalidServer)
+	_, err = st.Merge(signedServer(t, ownerKey(t), id, 10))
+	require.ErrorIs(t, err, hub.ErrInvalidServer)
+	squatted := newServer(id, "someone-else", 10)
+	squatted.Record = created.Record
+	_, err = st.Merge(squatted)
+	require.ErrorIs(t, err, hub.ErrInvalidServer)
+	srv, err = st.GetServer(id)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hash"), srv.PasswordHash)
+
+	// a server known from the directory topic gets its password from the record
+	dir := hub.NewHubStore()
+	public := signedServer(t, key, "", 1)
+	public.PasswordHash = []byte("hash")
+	public = signServer(t, key, public)
+	_, err = dir.ApplyDirectoryEntry(&models.DirectoryEntry{Server: *newServer(public.ID, public.OwnerPeerID, 0), Version: 5})
+	require.NoError(t, err)
+	changed, err = dir.Merge(public)
+	require.NoError(t, err)
+	require.True(t, changed)
+	srv, err = dir.GetServer(public.ID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hash"), srv.PasswordHash)
+	require.Equal(t, "v0", srv.Name, "the directory record is newer")
+	require.Len(t, dir.Snapshot(), 1)
+	require.Len(t, hub.NewHubStore().Snapshot(), 0)
+}
+
+// Members and invite grants stay on the hub that admitted them, see HubStore.Merge.
+func TestHubStore_MergeKeepsMembersAndGrantsLocal(t *testing.T) {
+	a := hub.NewHubStore()
+	b := hub.NewHubStore()
+	key := ownerKey(t)
+	created := signedServer(t, key, "", 1, "room")
+	created.Rooms["room"].Visibility = models.Private
+	id, owner := created.ID, created.OwnerPeerID
+	require.NoError(t, a.CreateServer(created))
+	require.NoError(t, a.AddInvite(&models.Invite{ID: "inv", ServerID: id, RoomID: "room", IssuedBy: owner}))
+	_, err := a.RedeemInvite("inv", "alice", time.Now())
+	require.NoError(t, err)
+	alice, err := peer.Decode("12D3KooWBmwkafWE2fqfzS96VoTZvm1iaAUpsrWQaMEbxAbhd5nt")
+	require.NoError(t, err)
+	require.NoError(t, a.AddMember(id, "room", models.Member{AddrInfo: peer.AddrInfo{ID: alice}}))
+
+	snap, err := a.SnapshotServer(id)
+	require.NoError(t, err)
+	_, err = b.Merge(&snap)
+	require.NoError(t, err)
+
+	members, err := b.RoomMembers(id, "room")
+	require.NoError(t, err)
+	require.Empty(t, members)
+	require.True(t, a.IsAdmitted(id, "room", "alice"))
+	require.False(t, b.IsAdmitted(id, "room", "alice"), "invitees redeem a new invite on the other hub")
+	require.True(t, b.IsAdmitted(id, "room", owner))
+}
+
+func TestHubStore_ApplyDirectoryEntry(t *testing.T) {
+	st := hub.NewHubStore()
+	require.NoError(t, st.CreateServer(newServer("srv", "owner", 5)))
+
+	stale := &models.DirectoryEntry{Server: *newServer("srv", "owner", 0, "lobby"), Version: 4}
+	changed, err := st.ApplyDirectoryEntry(stale)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	fresh := &models.DirectoryEntry{Server: *newServer("srv", "owner", 0, "lobby"), Version: 6}
+	fresh.Server.Rooms["lobby"].Visibility = models.Public
+	changed, err = st.ApplyDirectoryEntry(fresh)
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, err = st.GetRoom("srv", "lobby")
+	require.NoError(t, err)
+
+	_, err = st.ApplyDirectoryEntry(&models.DirectoryEntry{Server: *newServer("srv", "intruder", 0), Version: 7})
+	require.ErrorIs(t, err, hub.ErrOwnerMismatch)
+}
+
+func TestHubStore_ReplicatedServersAreChecked(t *testing.T) {
+	st := hub.NewHubStore()
+
+	nullRoom := newServer("srv", "owner", 1)
+	nullRoom.Rooms["x"] = nil
+	require.NotPanics(t, func() {
+		_, err := st.Merge(nullRoom)
+		require.ErrorIs(t, err, hub.ErrInvalidServer)
+		_, err = st.ApplyDirectoryEntry(&models.DirectoryEntry{Server: *nullRoom, Version: 1})
+		require.ErrorIs(t, err, hub.ErrInvalidServer)
+	})
+	_, err := st.GetServer("srv")
+	require.ErrorIs(t, err, models.ErrServerNotFound)
+
+	long := newServer("srv", "owner", 1)
+	long.Name = strings.Repeat("a", hub.MaxNameLength+1)
+	_, err = st.Merge(long)
+	require.ErrorIs(t, err, hub.ErrFieldTooLong)
+
+	crowded := newServer("srv", "owner", 1)
+	for i := 0; i <= hub.MaxRoomsPerServer; i++ {
+		id := fmt.Sprintf("room-%d", i)
+		crowded.Rooms[id] = &models.RoomMeta{ID: id, Visibility: models.Public}
+	}
+	_, err = st.ApplyDirectoryEntry(&models.DirectoryEntry{Server: *crowded, Version: 1})
+	require.ErrorIs(t, err, hub.ErrRoomLimitReached)
+
+	key := ownerKey(t)
+	var owner string
+	for i := 0; i < hub.MaxServersPerOwner; i++ {
+		sm := signedServer(t, key, "", 1)
+		owner = sm.OwnerPeerID
+		_, err := st.Merge(sm)
+		require.NoError(t, err)
+	}
+	_, err = st.ApplyDirectoryEntry(&models.DirectoryEntry{Server: *newServer("one-too-many", owner, 1), Version: 1})
+	require.ErrorIs(t, err, hub.ErrServerLimitReached)
+}
+
+func TestHubServer_CreateServerNeedsOwnerRecord(t *testing.T) {
+	srv, err := hub.NewHubServer(context.Background(), "/ip4/127.0.0.1/tcp/0")
+	require.NoError(t, err)
+	defer srv.Host.Close()
+	hubAddr := srv.Host.Addrs()[0].String() + "/p2p/" + srv.Host.ID().String()
+
+	owner, ctx := newTestClient(t)
+	defer owner.Close()
+	mallory, _ := newTestClient(t)
+	defer mallory.Close()
+
+	var resp models.CreateServerResponse
+	sendRPC(t, ctx, mallory, hubAddr, "CreateServer", models.CreateServerRequest{Name: "unsigned"}, &resp)
+	require.Contains(t, resp.Error, hub.ErrInvalidServer.Error())
+	resp = models.CreateServerResponse{}
+	sendRPC(t, ctx, mallory, hubAddr, "CreateServer", signedCreate(t, owner, models.CreateServerRequest{Name: "stolen"}), &resp)
+	require.Contains(t, resp.Error, hub.ErrNotOwner.Error())
+	require.Empty(t, srv.Store.ListServers())
+
+	req := signedCreate(t, owner, models.CreateServerRequest{Name: "mine", Visibility: models.Private, PasswordHash: []byte("hash")})
+	resp = models.CreateServerResponse{}
+	sendRPC(t, ctx, owner, hubAddr, "CreateServer", req, &resp)
+	require.Empty(t, resp.Error)
+	created, err := srv.Store.GetServer(resp.ServerID)
+	require.NoError(t, err)
+	require.Equal(t, req.Record, created.Record)
+	require.Equal(t, []byte("hash"), created.PasswordHash)
+	require.True(t, p2p.ServerIDOwnedBy(created.ID, owner.ID().String()))
+}
@@ -93,7 +93,7 @@ func TestHubServer_CRUD(t *testing.T) {
         Visibility: models.Public,
     }
     var createResp models.CreateServerResponse
-    sendRPC(t, ctx, client, hubAddr, "CreateServer", createReq, &createResp)
+    sendRPC(t, ctx, client, hubAddr, "CreateServer", signedCreate(t, client, createReq), &createResp)
 	fmt.Printf("Created server with ID: %s\n", createResp.ServerID)
     require.NotEmpty(t, createResp.ServerID)
 
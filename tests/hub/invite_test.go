@@ -0,0 +1,134 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/hub"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHubStore_Invites(t *testing.T) {
+	st := hub.NewHubStore()
+	require.NoError(t, st.CreateServer(newServer("srv", "owner", 1, "room")))
+
+	err := st.AddInvite(&models.Invite{ID: "x", ServerID: "srv", IssuedBy: "mallory"})
+	require.ErrorIs(t, err, hub.ErrNotOwner)
+
+	require.NoError(t, st.AddInvite(&models.Invite{
+		ID: "inv", ServerID: "srv", RoomID: "room", IssuedBy: "owner", MaxUses: 1,
+	}))
+	require.NoError(t, st.AddInvite(&models.Invite{
+		ID: "bound", ServerID: "srv", IssuedBy: "owner", BoundPeerID: "bob",
+	}))
+	require.NoError(t, st.AddInvite(&models.Invite{
+		ID: "old", ServerID: "srv", IssuedBy: "owner", ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	}))
+
+	require.True(t, st.IsAdmitted("srv", "room", "owner"))
+	require.False(t, st.IsAdmitted("srv", "room", "alice"))
+
+	_, err = st.RedeemInvite("inv", "alice", time.Now())
+	require.NoError(t, err)
+	require.True(t, st.IsAdmitted("srv", "", "alice"))
+	require.True(t, st.IsAdmitted("srv", "room", "alice"))
+
+	// redeeming twice doesn't use the invite up, a second peer does
+	_, err = st.RedeemInvite("inv", "alice", time.Now())
+	require.NoError(t, err)
+	_, err = st.RedeemInvite("inv", "carol", time.Now())
+	require.ErrorIs(t, err, hub.ErrInviteExhausted)
+
+	_, err = st.RedeemInvite("bound", "alice", time.Now())
+	require.ErrorIs(t, err, hub.ErrInviteWrongPeer)
+
+	_, err = st.RedeemInvite("old", "carol", time.Now().Add(time.Hour))
+	require.ErrorIs(t, err, hub.ErrInviteExpired)
+
+	require.ErrorIs(t, st.RevokeInvite("bound", "bob"), hub.ErrNotOwner)
+	require.NoError(t, st.RevokeInvite("bound", "owner"))
+	_, err = st.RedeemInvite("bound", "bob", time.Now())
+	require.ErrorIs(t, err, hub.ErrInviteRevoked)
+}
+
+func TestHubServer_InviteToPrivateRoom(t *testing.T) {
+	srv, err := hub.NewHubServer(context.Background(), "/ip4/127.0.0.1/tcp/0")
+	require.NoError(t, err)
+	defer srv.Host.Close()
+	hubAddr := srv.Host.Addrs()[0].String() + "/p2p/" + srv.Host.ID().String()
+
+	owner, ctx := newTestClient(t)
+	defer owner.Close()
+	guest, _ := newTestClient(t)
+	defer guest.Close()
+
+	var createResp models.CreateServerResponse
+	sendRPC(t, ctx, owner, hubAddr, "CreateServer", signedCreate(t, owner, models.CreateServerRequest{
+		Name: "secret", Visibility: models.Private, PasswordHash: []byte("hash"),
+	}), &createResp)
+	require.Empty(t, createResp.Error)
+	var roomResp models.CreateRoomResponse
+	sendRPC(t, ctx, owner, hubAddr, "CreateRoom", models.CreateRoomRequest{
+		ServerID: createResp.ServerID, RoomName: "hideout", Visibility: models.Private, PasswordHash: []byte("hash"),
+	}, &roomResp)
+	require.Empty(t, roomResp.Error)
+
+	var joinResp models.JoinServerResponse
+	sendRPC(t, ctx, guest, hubAddr, "JoinServer", models.JoinServerRequest{ServerID: createResp.ServerID}, &joinResp)
+	require.Equal(t, "server is private", joinResp.Error)
+
+	// only the owner can invite
+	var inviteResp models.CreateInviteResponse
+	sendRPC(t, ctx, guest, hubAddr, "CreateInvite", models.CreateInviteRequest{ServerID: createResp.ServerID}, &inviteResp)
+	require.Equal(t, hub.ErrNotOwner.Error(), inviteResp.Error)
+
+	inviteResp = models.CreateInviteResponse{}
+	sendRPC(t, ctx, owner, hubAddr, "CreateInvite", models.CreateInviteRequest{
+		ServerID: createResp.ServerID, RoomID: roomResp.RoomID, MaxUses: 1,
+		BoundPeerID: guest.ID().String(),
+	}, &inviteResp)
+	require.Empty(t, inviteResp.Error)
+	require.Contains(t, inviteResp.Link, models.InviteScheme)
+
+	tok, err := p2p.DecodeInvite(inviteResp.Link)
+	require.NoError(t, err)
+	inv, err := p2p.OpenInviteToken(tok)
+	require.NoError(t, err)
+	require.Equal(t, srv.Host.ID().String(), inv.HubPeerID)
+	require.Equal(t, roomResp.RoomID, inv.RoomID)
+
+	// a tampered token is rejected
+	tok.Signature[0] ^= 1
+	forged, err := p2p.EncodeInvite(tok)
+	require.NoError(t, err)
+	var redeemResp models.RedeemInviteResponse
+	sendRPC(t, ctx, guest, hubAddr, "RedeemInvite", models.RedeemInviteRequest{Link: forged}, &redeemResp)
+	require.NotEmpty(t, redeemResp.Error)
+
+	redeemResp = models.RedeemInviteResponse{}
+	sendRPC(t, ctx, guest, hubAddr, "RedeemInvite", models.RedeemInviteRequest{Link: inviteResp.Link}, &redeemResp)
+	require.Empty(t, redeemResp.Error)
+	require.Equal(t, createResp.ServerID, redeemResp.ServerID)
+	require.Equal(t, roomResp.RoomID, redeemResp.RoomID)
+
+	joinResp = models.JoinServerResponse{}
+	sendRPC(t, ctx, guest, hubAddr, "JoinServer", models.JoinServerRequest{ServerID: createResp.ServerID}, &joinResp)
+	require.Empty(t, joinResp.Error)
+	require.Nil(t, joinResp.Server.PasswordHash)
+
+	var roomJoin models.JoinRoomResponse
+	sendRPC(t, ctx, guest, hubAddr, "JoinRoom", models.JoinRoomRequest{
+		ServerID: createResp.ServerID, RoomID: roomResp.RoomID,
+		Sender: models.User{PeerID: guest.ID().String()},
+	}, &roomJoin)
+	require.Empty(t, roomJoin.Error)
+	require.Equal(t, "hideout", roomJoin.Room.Name)
+
+	var revokeResp models.RevokeInviteResponse
+	sendRPC(t, ctx, owner, hubAddr, "RevokeInvite", models.RevokeInviteRequest{InviteID: inviteResp.InviteID}, &revokeResp)
+	require.Empty(t, revokeResp.Error)
+}
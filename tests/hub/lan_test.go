@@ -0,0 +1,28 @@
+package hub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hillside/internal/hub"
+	"hillside/internal/p2p"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoverLANHubs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv, err := hub.NewHubServer(ctx, "/ip4/0.0.0.0/tcp/0", hub.WithLAN())
+	require.NoError(t, err)
+	defer srv.Host.Close()
+
+	hubs, err := p2p.DiscoverLANHubs(ctx, 3*time.Second, nil)
+	require.NoError(t, err)
+	if len(hubs) == 0 {
+		t.Skip("no multicast on this network")
+	}
+	require.Equal(t, srv.Host.ID(), hubs[0].ID)
+}
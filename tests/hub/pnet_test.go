@@ -0,0 +1,46 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hillside/internal/hub"
+	"hillside/internal/p2p"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateNetwork(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, p2p.WriteSwarmKey(&buf))
+	path := filepath.Join(t.TempDir(), "swarm.key")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+	psk, err := p2p.LoadSwarmKey(path)
+	require.NoError(t, err)
+	require.Len(t, psk, 32)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := hub.NewHubServer(ctx, "/ip4/127.0.0.1/tcp/0", hub.WithSwarmKey(psk))
+	require.NoError(t, err)
+	defer srv.Host.Close()
+	hubInfo := peer.AddrInfo{ID: srv.Host.ID(), Addrs: srv.Host.Addrs()}
+
+	outsider, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer outsider.Close()
+	dialCtx, dialCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer dialCancel()
+	require.Error(t, outsider.Connect(dialCtx, hubInfo), "peers without the key can't connect")
+
+	member, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.PrivateNetwork(psk))
+	require.NoError(t, err)
+	defer member.Close()
+	require.NoError(t, member.Connect(ctx, hubInfo))
+}
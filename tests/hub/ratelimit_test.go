@@ -0,0 +1,170 @@
+package hub
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"hillside/internal/hub"
+	"hillside/internal/models"
+	"hillside/internal/p2p"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter_Burst(t *testing.T) {
+	rl := hub.NewRateLimiter(map[string]hub.MethodLimit{
+		"CreateServer": {Rate: 0, Burst: 3},
+	})
+	p := peer.ID("peer-a")
+	other := peer.ID("peer-b")
+
+	for i := 0; i < 3; i++ {
+		require.True(t, rl.Allow(p, "CreateServer"), "call %d should be allowed", i)
+	}
+	require.False(t, rl.Allow(p, "CreateServer"))
+
+	// buckets are per peer
+	require.True(t, rl.Allow(other, "CreateServer"))
+}
+
+func TestRateLimiter_UnknownMethodsShareBucket(t *testing.T) {
+	rl := hub.NewRateLimiter(map[string]hub.MethodLimit{
+		"ListRooms": {Rate: 0, Burst: 1},
+	})
+	p := peer.ID("peer-a")
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if rl.Allow(p, fmt.Sprintf("Method%d", i)) {
+			allowed++
+		}
+	}
+	require.Equal(t, 5, allowed, "unknown methods draw from one default bucket")
+	require.True(t, rl.Allow(p, "ListRooms"))
+}
+
+func TestRateLimiter_Violations(t *testing.T) {
+	rl := hub.NewRateLimiter(nil)
+	p := peer.ID("peer-a")
+
+	blocked := false
+	for i := 0; i < 5; i++ {
+		blocked = rl.RecordViolation(p)
+	}
+	require.True(t, blocked)
+
+	rl.Forget(p)
+	require.False(t, rl.RecordViolation(p))
+}
+
+func TestBlockGater(t *testing.T) {
+	g := hub.NewBlockGater()
+	p := peer.ID("peer-a")
+
+	require.True(t, g.InterceptPeerDial(p))
+	g.Block(p, time.Hour)
+	require.False(t, g.InterceptPeerDial(p))
+	require.False(t, g.InterceptSecured(0, p, nil))
+
+	g.Block(p, -time.Second) // already expired
+	require.False(t, g.IsBlocked(p))
+}
+
+func TestHubStore_Caps(t *testing.T) {
+	st := hub.NewHubStore()
+
+	for i := 0; i < hub.MaxServersPerOwner; i++ {
+		require.NoError(t, st.CreateServer(&models.ServerMeta{
+			ID:          fmt.Sprintf("srv-%d", i),
+			OwnerPeerID: "owner",
+			Rooms:       map[string]*models.RoomMeta{},
+		}))
+	}
+	err := st.CreateServer(&models.ServerMeta{ID: "one-too-many", OwnerPeerID: "owner"})
+	require.ErrorIs(t, err, hub.ErrServerLimitReached)
+
+	for i := 0; i < hub.MaxRoomsPerServer; i++ {
+		require.NoError(t, st.CreateRoom("srv-0", "owner", &models.RoomMeta{ID: fmt.Sprintf("room-%d", i)}))
+	}
+	err = st.CreateRoom("srv-0", "owner", &models.RoomMeta{ID: "one-too-many"})
+	require.ErrorIs(t, err, hub.ErrRoomLimitReached)
+
+	// only the owner adds rooms, a stranger can't use up the cap
+	err = st.CreateRoom("srv-1", "stranger", &models.RoomMeta{ID: "squatted"})
+	require.ErrorIs(t, err, hub.ErrNotOwner)
+	rooms, err := st.ListRooms("srv-1")
+	require.NoError(t, err)
+	require.Empty(t, rooms)
+}
+
+func TestRelayACL_MembersOnly(t *testing.T) {
+	st := hub.NewHubStore()
+	owner, member, stranger := peer.ID("owner"), peer.ID("member"), peer.ID("stranger")
+	srv := newServer("srv", owner.String(), 1, "room")
+	srv.Rooms["room"].Members[member.String()] = models.Member{}
+	require.NoError(t, st.CreateServer(srv))
+
+	acl := p2p.MemberACL(st.IsMember)
+	require.True(t, acl.AllowReserve(owner, nil))
+	require.True(t, acl.AllowReserve(member, nil))
+	require.False(t, acl.AllowReserve(stranger, nil))
+	require.True(t, acl.AllowConnect(member, nil, owner))
+	require.False(t, acl.AllowConnect(stranger, nil, member))
+
+	require.False(t, p2p.MemberACL(nil).AllowReserve(owner, nil))
+	require.False(t, p2p.RelayACL{}.AllowConnect(owner, nil, member))
+	limit := p2p.RelayResources().Limit
+	require.NotNil(t, limit, "relayed connections are bounded")
+	require.NotZero(t, limit.Duration)
+	require.NotZero(t, limit.Data)
+}
+
+func TestRelayACL_HubReservesBeforeJoin(t *testing.T) {
+	st := hub.NewHubStore()
+	owner, member, newcomer := peer.ID("owner"), peer.ID("member"), peer.ID("newcomer")
+	srv := newServer("srv", owner.String(), 1, "room")
+	srv.Rooms["room"].Members[member.String()] = models.Member{}
+	require.NoError(t, st.CreateServer(srv))
+	gater := hub.NewBlockGater()
+	acl := hub.NewRelayACL(st, gater, hub.NewRateLimiter(nil))
+
+	// a peer behind NAT reserves before its circuit address is handed out on join
+	require.True(t, acl.AllowReserve(newcomer, nil))
+	require.False(t, acl.AllowConnect(newcomer, nil, member))
+	require.NoError(t, st.AddMember("srv", "room", models.Member{AddrInfo: peer.AddrInfo{ID: newcomer}}))
+	require.True(t, acl.AllowConnect(member, nil, newcomer))
+
+	// reservations are rate limited, and blocked peers get none
+	limit := hub.DefaultMethodLimits[hub.RelayReserveLimit]
+	for i := 1; i < int(limit.Burst); i++ {
+		require.True(t, acl.AllowReserve(newcomer, nil))
+	}
+	require.False(t, acl.AllowReserve(newcomer, nil))
+	gater.Block(member, time.Minute)
+	require.False(t, acl.AllowReserve(member, nil))
+}
+
+func TestHubStore_MembersConcurrent(t *testing.T) {
+	st := hub.NewHubStore()
+	require.NoError(t, st.CreateServer(newServer("srv", "owner", 1, "room")))
+
+	// the relay reads members while peers join
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			st.IsMember(peer.ID(fmt.Sprintf("peer-%d", i)))
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, st.AddMember("srv", "room", models.Member{AddrInfo: peer.AddrInfo{ID: peer.ID(fmt.Sprintf("peer-%d", i))}}))
+	}
+	<-done
+	members, err := st.RoomMembers("srv", "room")
+	require.NoError(t, err)
+	require.Len(t, members, 1000)
+	require.True(t, st.IsMember(peer.ID("peer-999")))
+	require.ErrorIs(t, st.AddMember("srv", "nope", models.Member{}), models.ErrRoomNotFound)
+}
@@ -0,0 +1,41 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"hillside/internal/hub"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func addrsWith(addrs []ma.Multiaddr, proto int) []ma.Multiaddr {
+	var out []ma.Multiaddr
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(proto); err == nil {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func TestHubTransports(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := hub.NewHubServer(ctx, "/ip4/127.0.0.1/tcp/0",
+		hub.WithListenAddrs("/ip4/127.0.0.1/udp/0/quic-v1", "/ip4/127.0.0.1/tcp/0/ws"))
+	require.NoError(t, err)
+	defer srv.Host.Close()
+
+	for _, proto := range []int{ma.P_QUIC_V1, ma.P_WS} {
+		addrs := addrsWith(srv.Host.Addrs(), proto)
+		require.NotEmpty(t, addrs)
+		c, err := libp2p.New(libp2p.NoListenAddrs)
+		require.NoError(t, err)
+		require.NoError(t, c.Connect(ctx, peer.AddrInfo{ID: srv.Host.ID(), Addrs: addrs}))
+		c.Close()
+	}
+}
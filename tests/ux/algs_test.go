@@ -0,0 +1,218 @@
+package ux
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+	"hillside/internal/profile"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify_AllAlgorithms(t *testing.T) {
+	msg := []byte("hello hillside")
+	for _, alg := range crypto.SigAlgs {
+		t.Run(alg, func(t *testing.T) {
+			pub, priv, err := crypto.GenSigKeyFor(alg)
+			require.NoError(t, err)
+			derived, err := crypto.SigPublicKey(alg, priv)
+			require.NoError(t, err)
+			require.Equal(t, pub, derived)
+
+			sig, err := crypto.SignWith(alg, msg, priv)
+			require.NoError(t, err)
+			require.NoError(t, crypto.VerifyWith(alg, pub, msg, sig))
+			require.ErrorIs(t, crypto.VerifyWith(alg, pub, []byte("tampered"), sig), crypto.ErrSignatureInvalid)
+		})
+	}
+}
+
+func TestSignVerify_LegacyCompatible(t *testing.T) {
+	pub, priv, err := crypto.GenSignKey()
+	require.NoError(t, err)
+	msg := []byte("old envelope")
+
+	sig, err := crypto.Sign(msg, priv)
+	require.NoError(t, err)
+	require.NoError(t, crypto.VerifyWith("", pub, msg, sig))
+
+	sig, err = crypto.SignWith(crypto.SigAlgDilithium2, msg, priv)
+	require.NoError(t, err)
+	require.NoError(t, crypto.ValidateSignature(pub, msg, sig))
+}
+
+func TestSignVerify_CompositeNeedsBothHalves(t *testing.T) {
+	alg := crypto.SigAlgEd25519MLDSA65
+	pub, priv, err := crypto.GenSigKeyFor(alg)
+	require.NoError(t, err)
+	msg := []byte("both halves")
+	sig, err := crypto.SignWith(alg, msg, priv)
+	require.NoError(t, err)
+
+	classical := append([]byte{}, sig...)
+	classical[0] ^= 0xff
+	require.Error(t, crypto.VerifyWith(alg, pub, msg, classical))
+
+	pq := append([]byte{}, sig...)
+	pq[len(pq)-1] ^= 0xff
+	require.Error(t, crypto.VerifyWith(alg, pub, msg, pq))
+
+	require.Error(t, crypto.VerifyWith(alg, pub, msg, sig[:len(sig)-1]))
+	require.ErrorIs(t, crypto.VerifyWith("RSA-512", pub, msg, sig), crypto.ErrSignatureInvalid)
+}
+
+func TestKEM_AllAlgorithms(t *testing.T) {
+	for _, alg := range crypto.KEMAlgs {
+		t.Run(alg, func(t *testing.T) {
+			pub, priv, err := crypto.GenKEMKeyFor(alg)
+			require.NoError(t, err)
+			derived, err := crypto.KEMPublicKey(alg, priv)
+			require.NoError(t, err)
+			require.Equal(t, pub, derived)
+
+			ct, shared, err := crypto.Encapsulate(alg, pub)
+			require.NoError(t, err)
+			got, err := crypto.Decapsulate(alg, priv, ct)
+			require.NoError(t, err)
+			require.Equal(t, shared, got)
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	both := []string{crypto.SigAlgEd25519MLDSA65, crypto.SigAlgDilithium2}
+	legacy := []string{crypto.SigAlgDilithium2}
+
+	require.Equal(t, crypto.SigAlgEd25519MLDSA65, crypto.Negotiate(crypto.SigAlgs, both, both))
+	require.Equal(t, crypto.SigAlgDilithium2, crypto.Negotiate(crypto.SigAlgs, both, legacy))
+	require.Equal(t, crypto.SigAlgEd25519MLDSA65, crypto.Negotiate(crypto.SigAlgs))
+	require.Equal(t, "", crypto.Negotiate(crypto.SigAlgs, []string{"Other"}))
+}
+
+func TestLoadProfile_HasHybridKeys(t *testing.T) {
+	_, err := profile.GenerateProfile("hybriduser", "pass")
+	require.NoError(t, err)
+
+	kb, usr, err := profile.LoadProfile("hybriduser", "pass", "")
+	require.NoError(t, err)
+	require.Equal(t, crypto.SigAlgs, usr.SigAlgs())
+	require.Equal(t, crypto.KEMAlgs, usr.KEMAlgs())
+	for _, alg := range crypto.SigAlgs {
+		pub, err := crypto.SigPublicKey(alg, kb.SigPriv(alg))
+		require.NoError(t, err)
+		require.Equal(t, usr.SigKey(alg), pub)
+	}
+	for _, alg := range crypto.KEMAlgs {
+		pub, err := crypto.KEMPublicKey(alg, kb.KEMPriv(alg))
+		require.NoError(t, err)
+		require.Equal(t, usr.KEMKey(alg), pub)
+	}
+}
+
+func TestLoadProfile_AddsHybridKeysToLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy_profile.json")
+	legacy := writeLegacyProfile(t, path, "secret")
+
+	kb, usr, err := profile.LoadProfile("legacy", "secret", path)
+	require.NoError(t, err)
+	require.Equal(t, legacy.PeerID, usr.PeerID)
+	require.Equal(t, crypto.SigAlgs, usr.SigAlgs())
+	require.NotNil(t, kb.SigPriv(crypto.SigAlgEd25519MLDSA65))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var migrated profile.Profile
+	require.NoError(t, json.Unmarshal(data, &migrated))
+	require.Contains(t, migrated.SigPrivsEnc, crypto.SigAlgEd25519MLDSA65)
+	require.Contains(t, migrated.KEMPrivsEnc, crypto.KEMAlgX25519MLKEM768)
+
+	// the added keys are kept, not regenerated on every login
+	_, again, err := profile.LoadProfile("legacy", "secret", path)
+	require.NoError(t, err)
+	require.Equal(t, usr.DilithiumPub, again.DilithiumPub)
+	require.Equal(t, usr.SigKeys, again.SigKeys)
+	require.Equal(t, usr.KEMKeys, again.KEMKeys)
+}
+
+// kemPeer is a peer with keys for algs only, Kyber1024 alone for a peer on
+// an older version.
+func kemPeer(t *testing.T, peerID string, algs ...string) (models.User, *models.Keybag) {
+	t.Helper()
+	usr := models.User{PeerID: peerID}
+	kb := &models.Keybag{KEMPrivs: map[string][]byte{}}
+	for _, alg := range algs {
+		pub, priv, err := crypto.GenKEMKeyFor(alg)
+		require.NoError(t, err)
+		if alg == crypto.KEMAlgKyber1024 {
+			usr.KyberPub, kb.KyberPriv = pub, priv
+			continue
+		}
+		usr.KEMKeys = append(usr.KEMKeys, models.PublicKey{Alg: alg, Key: pub})
+		kb.KEMPrivs[alg] = priv
+	}
+	return usr, kb
+}
+
+func TestWrapKeyFor_NegotiatesKEM(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	current, currentKB := kemPeer(t, "current", crypto.KEMAlgs...)
+	legacy, legacyKB := kemPeer(t, "legacy", crypto.KEMAlgKyber1024)
+
+	e, err := models.WrapKeyFor(current, key)
+	require.NoError(t, err)
+	require.Equal(t, crypto.KEMAlgX25519MLKEM768, e.KEMAlg)
+	got, err := currentKB.UnwrapKey(e)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+	// a peer without the hybrid key can't open it
+	_, err = legacyKB.UnwrapKey(e)
+	require.ErrorIs(t, err, crypto.ErrUnsupportedAlg)
+
+	e, err = models.WrapKeyFor(legacy, key)
+	require.NoError(t, err)
+	require.Equal(t, crypto.KEMAlgKyber1024, e.KEMAlg)
+	got, err = legacyKB.UnwrapKey(e)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+	_, err = currentKB.UnwrapKey(e)
+	require.Error(t, err, "wrapped for another peer")
+
+	// an entry from an older version carries no algorithm, Kyber1024 is assumed
+	e.KEMAlg = ""
+	got, err = legacyKB.UnwrapKey(e)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	_, err = models.WrapKeyFor(models.User{PeerID: "nokeys"}, key)
+	require.ErrorIs(t, err, crypto.ErrUnsupportedAlg)
+}
+
+func TestRekeyMessage_MixedVersions(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	current, currentKB := kemPeer(t, "current", crypto.KEMAlgs...)
+	legacy, legacyKB := kemPeer(t, "legacy", crypto.KEMAlgKyber1024)
+
+	msg, err := models.NewRekeyMessage(key, []models.User{current, legacy})
+	require.NoError(t, err)
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	var received models.RekeyMessage
+	require.NoError(t, json.Unmarshal(data, &received))
+	require.Equal(t, crypto.KEMAlgX25519MLKEM768, received.Entries[0].KEMAlg)
+	require.Equal(t, crypto.KEMAlgKyber1024, received.Entries[1].KEMAlg)
+
+	for _, p := range []struct {
+		id string
+		kb *models.Keybag
+	}{{"current", currentKB}, {"legacy", legacyKB}} {
+		got, err := p.kb.OpenRekey(&received, p.id)
+		require.NoError(t, err)
+		require.Equal(t, key, got)
+	}
+	_, err = legacyKB.OpenRekey(&received, "stranger")
+	require.ErrorIs(t, err, crypto.ErrBadKey)
+}
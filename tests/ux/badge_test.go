@@ -0,0 +1,72 @@
+package ux
+
+import (
+	"testing"
+
+	"hillside/internal/client"
+	"hillside/internal/models"
+	"hillside/internal/ui"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadge_String(t *testing.T) {
+	require.Empty(t, ui.Badge{}.String())
+	require.Equal(t, " [::b](3)[::-]", ui.Badge{Unread: 3}.String())
+	require.Equal(t, " [::b](3) @1[::-]", ui.Badge{Unread: 3, Mentions: 1}.String())
+}
+
+func TestRoomSession_ServerID(t *testing.T) {
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	require.Empty(t, room.ServerID())
+	room.Server = client.NewServerSessionWithMeta(&models.ServerMeta{ID: "srv"})
+	require.Equal(t, "srv", room.ServerID())
+}
+
+func TestRoomSession_CountUnseen(t *testing.T) {
+	me := &models.User{PeerID: "me", Username: "alice"}
+	room := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: "room"})
+	msg := func(from, text string) models.DecrypetMessage {
+		return models.DecrypetMessage{Sender: models.User{PeerID: from}, Content: text}
+	}
+
+	counted, mentioned := room.CountUnseen(msg("bob", "hi"), me)
+	require.True(t, counted)
+	require.False(t, mentioned)
+	_, mentioned = room.CountUnseen(msg("bob", "hey @alice"), me)
+	require.True(t, mentioned)
+	// our own messages, mentions or not, aren't unread
+	counted, _ = room.CountUnseen(msg("me", "@alice"), me)
+	require.False(t, counted)
+	require.Equal(t, ui.Badge{Unread: 2, Mentions: 1}, room.Badge())
+
+	require.True(t, room.ClearUnseen())
+	require.Equal(t, ui.Badge{}, room.Badge())
+	require.False(t, room.ClearUnseen())
+}
+
+func TestSession_ServerBadgeAndJoinedRoom(t *testing.T) {
+	s := client.NewSession(nil, nil)
+	srv := client.NewServerSessionWithMeta(&models.ServerMeta{ID: "srv"})
+	other := client.NewServerSessionWithMeta(&models.ServerMeta{ID: "other"})
+	room := func(id string, server *client.ServerSession, joined bool, unread, mentions int) *client.RoomSession {
+		rs := client.NewRoomSessionWithMeta(&models.RoomMeta{ID: id})
+		rs.Server, rs.Joined, rs.Unread, rs.Mentions = server, joined, unread, mentions
+		s.Rooms[id] = rs
+		return rs
+	}
+	general := room("general", srv, true, 3, 1)
+	room("random", srv, true, 2, 0)
+	room("left", srv, false, 0, 0)
+	room("elsewhere", other, true, 5, 5)
+
+	require.Equal(t, ui.Badge{Unread: 5, Mentions: 1}, s.ServerBadge(srv))
+	require.Equal(t, ui.Badge{Unread: 5, Mentions: 5}, s.ServerBadge(other))
+
+	// a room joined on the current server is switched to, anything else joined again
+	s.Current.Server = srv
+	require.Same(t, general, s.JoinedRoom("general"))
+	require.Nil(t, s.JoinedRoom("left"))
+	require.Nil(t, s.JoinedRoom("elsewhere"))
+	require.Nil(t, s.JoinedRoom("unknown"))
+}
@@ -0,0 +1,81 @@
+package ux
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlob_RoundTrip(t *testing.T) {
+	key, err := crypto.NewBlobKey()
+	require.NoError(t, err)
+	for _, n := range []int{0, 1, crypto.BlobChunkSize, crypto.BlobChunkSize + 1, 3*crypto.BlobChunkSize - 7} {
+		pt := make([]byte, n)
+		_, _ = rand.Read(pt)
+		var ct bytes.Buffer
+		size, hash, err := crypto.EncryptBlob(bytes.NewReader(pt), &ct, key)
+		require.NoError(t, err)
+		require.Equal(t, int64(ct.Len()), size)
+		require.Equal(t, crypto.BlobHash(ct.Bytes()), hash)
+
+		var out bytes.Buffer
+		require.NoError(t, crypto.DecryptBlob(bytes.NewReader(ct.Bytes()), &out, key), n)
+		require.True(t, bytes.Equal(pt, out.Bytes()), n)
+	}
+}
+
+func TestBlob_RejectsTamperingAndTruncation(t *testing.T) {
+	key, err := crypto.NewBlobKey()
+	require.NoError(t, err)
+	pt := make([]byte, 2*crypto.BlobChunkSize+10)
+	var ct bytes.Buffer
+	_, _, err = crypto.EncryptBlob(bytes.NewReader(pt), &ct, key)
+	require.NoError(t, err)
+	sealed := crypto.BlobChunkSize + 16
+
+	flipped := bytes.Clone(ct.Bytes())
+	flipped[sealed+3] ^= 1
+	require.ErrorIs(t, crypto.DecryptBlob(bytes.NewReader(flipped), &bytes.Buffer{}, key), crypto.ErrDecryptionFailed)
+
+	// cut at a chunk boundary: the remaining last chunk wasn't sealed as last
+	require.ErrorIs(t, crypto.DecryptBlob(bytes.NewReader(ct.Bytes()[:2*sealed]), &bytes.Buffer{}, key), crypto.ErrDecryptionFailed)
+
+	other, err := crypto.NewBlobKey()
+	require.NoError(t, err)
+	require.ErrorIs(t, crypto.DecryptBlob(bytes.NewReader(ct.Bytes()), &bytes.Buffer{}, other), crypto.ErrDecryptionFailed)
+}
+
+func TestAttachment_Validate(t *testing.T) {
+	valid := models.Attachment{
+		Name: "photo.png",
+		MIME: "image/png",
+		Size: 1234,
+		Hash: crypto.BlobHash([]byte("blob")),
+		Key:  make([]byte, 32),
+	}
+	require.NoError(t, valid.Validate())
+
+	for name, mutate := range map[string]func(a *models.Attachment){
+		"path name":    func(a *models.Attachment) { a.Name = "../../.bashrc" },
+		"dot dot":      func(a *models.Attachment) { a.Name = ".." },
+		"markup name":  func(a *models.Attachment) { a.Name = "[red]x.png" },
+		"control name": func(a *models.Attachment) { a.Name = "a\nb.png" },
+		"empty name":   func(a *models.Attachment) { a.Name = "" },
+		"bad mime":     func(a *models.Attachment) { a.MIME = "not a type" },
+		"short key":    func(a *models.Attachment) { a.Key = a.Key[:16] },
+		"bad hash":     func(a *models.Attachment) { a.Hash = "abc" },
+		"upper hash":   func(a *models.Attachment) { a.Hash = "AB" + a.Hash[2:] },
+		"empty":        func(a *models.Attachment) { a.Size = 0 },
+		"too large":    func(a *models.Attachment) { a.Size = models.MaxAttachmentSize + 1 },
+	} {
+		a := valid
+		a.Key = bytes.Clone(valid.Key)
+		mutate(&a)
+		require.ErrorIs(t, a.Validate(), models.ErrInvalidAttachment, name)
+	}
+}
@@ -0,0 +1,94 @@
+package ux
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hillside/internal/crypto"
+	"hillside/internal/profile"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadProfile_WrongPassword(t *testing.T) {
+	_, err := profile.GenerateProfile("kdfuser", "right")
+	require.NoError(t, err)
+
+	_, _, err = profile.LoadProfile("kdfuser", "wrong", "")
+	require.ErrorIs(t, err, profile.ErrInvalidPassword)
+}
+
+func TestGenerateProfile_KDFDescriptor(t *testing.T) {
+	prof, err := profile.GenerateProfile("kdfdesc", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, prof.KDF)
+	require.Equal(t, crypto.KDFVersionCurrent, prof.KDF.Version)
+	require.Equal(t, crypto.KDFArgon2id, prof.KDF.Algorithm)
+	require.Len(t, prof.KDF.Salt, 16)
+	require.Equal(t, prof.KDF.Salt, prof.PasswordSalt)
+
+	other, err := profile.GenerateProfile("kdfdesc2", "pass")
+	require.NoError(t, err)
+	require.NotEqual(t, prof.KDF.Salt, other.KDF.Salt)
+}
+
+// writeLegacyProfile seals a profile the way it was done before KDF descriptors:
+// fixed costs, no kdf field and a nil salt.
+func writeLegacyProfile(t *testing.T, path, pass string) *profile.Profile {
+	_, dil, err := crypto.GenSignKey()
+	require.NoError(t, err)
+	_, kem, err := crypto.GenKEMKey()
+	require.NoError(t, err)
+	lib, _, pid, err := crypto.GenP2PKey()
+	require.NoError(t, err)
+
+	passKey, checksum, err := crypto.LegacyKDFParams(nil).Derive(pass)
+	require.NoError(t, err)
+	aead, err := crypto.DeriveChaChaKey(passKey)
+	require.NoError(t, err)
+	seal := func(b []byte) []byte {
+		enc, err := crypto.SealAEAD(b, aead)
+		require.NoError(t, err)
+		return enc
+	}
+	prof := &profile.Profile{
+		Username:         "legacy",
+		PasswordChecksum: checksum,
+		DilithiumPrivEnc: seal(dil),
+		KyberPrivEnc:     seal(kem),
+		Libp2pPrivEnc:    seal(lib),
+		PeerID:           pid,
+	}
+	data, err := json.Marshal(prof)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return prof
+}
+
+func TestLoadProfile_MigratesLegacyKDF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy_profile.json")
+	legacy := writeLegacyProfile(t, path, "secret")
+
+	_, _, err := profile.LoadProfile("legacy", "nope", path)
+	require.ErrorIs(t, err, profile.ErrInvalidPassword)
+
+	_, usr, err := profile.LoadProfile("legacy", "secret", path)
+	require.NoError(t, err)
+	require.Equal(t, legacy.PeerID, usr.PeerID)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var migrated profile.Profile
+	require.NoError(t, json.Unmarshal(data, &migrated))
+	require.NotNil(t, migrated.KDF)
+	require.Equal(t, crypto.KDFVersionCurrent, migrated.KDF.Version)
+	require.NotEmpty(t, migrated.PasswordSalt)
+	require.NotEqual(t, legacy.Libp2pPrivEnc, migrated.Libp2pPrivEnc)
+
+	// the migrated profile still opens with the same password and keeps its identity
+	_, usr, err = profile.LoadProfile("legacy", "secret", path)
+	require.NoError(t, err)
+	require.Equal(t, legacy.PeerID, usr.PeerID)
+}
@@ -0,0 +1,43 @@
+package ux
+
+import (
+	"testing"
+
+	"hillside/internal/utils"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMentionsUser(t *testing.T) {
+	require.True(t, utils.MentionsUser("hey @alice", "alice"))
+	require.True(t, utils.MentionsUser("@Alice, look", "alice"))
+	require.True(t, utils.MentionsUser("thanks @alice!", "alice"))
+	require.False(t, utils.MentionsUser("hey @alicia", "alice"))
+	require.False(t, utils.MentionsUser("mail alice@example.com", "alice"))
+	require.False(t, utils.MentionsUser("hey @", ""))
+}
+
+func TestHighlightMentions(t *testing.T) {
+	require.Equal(t, "hi [::r]@alice[::-]! and @bob", utils.HighlightMentions("hi @alice! and @bob", "alice"))
+	require.Equal(t, "no mention here", utils.HighlightMentions("no mention here", "alice"))
+}
+
+func TestCompleteMention(t *testing.T) {
+	names := []string{"alice", "Albert", "bob", "two words"}
+	for _, tc := range []struct {
+		text, want string
+		ok         bool
+	}{
+		{"hey @b", "hey @bob ", true},
+		{"hey @AL", "hey @Al", true},
+		{"hey @ali", "hey @alice ", true},
+		{"hey @", "hey @", true},
+		{"hey @two", "hey @two", false},
+		{"hey @carol", "hey @carol", false},
+		{"hey b", "hey b", false},
+	} {
+		got, ok := utils.CompleteMention(tc.text, names)
+		require.Equal(t, tc.ok, ok, tc.text)
+		require.Equal(t, tc.want, got, tc.text)
+	}
+}
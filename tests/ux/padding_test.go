@@ -0,0 +1,80 @@
+package ux
+
+import (
+	"bytes"
+	"testing"
+
+	"hillside/internal/client"
+	"hillside/internal/crypto"
+	"hillside/internal/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPadMessage_Buckets(t *testing.T) {
+	for _, tc := range []struct {
+		len, bucket int
+	}{
+		{0, 256}, {1, 256}, {255, 256}, {256, 1024}, {1023, 1024}, {4000, 4096}, {crypto.MaxPaddedLen - 1, crypto.MaxPaddedLen},
+	} {
+		pt := bytes.Repeat([]byte{'a'}, tc.len)
+		padded, err := crypto.PadMessage(pt)
+		require.NoError(t, err)
+		require.Len(t, padded, tc.bucket)
+		got, err := crypto.UnpadMessage(padded)
+		require.NoError(t, err)
+		require.Equal(t, pt, got)
+	}
+
+	_, err := crypto.PadMessage(make([]byte, crypto.MaxPaddedLen))
+	require.ErrorIs(t, err, crypto.ErrMessageTooLong)
+}
+
+func TestPadMessage_KeepsTrailingZeros(t *testing.T) {
+	pt := []byte{'h', 'i', 0x80, 0, 0}
+	padded, err := crypto.PadMessage(pt)
+	require.NoError(t, err)
+	got, err := crypto.UnpadMessage(padded)
+	require.NoError(t, err)
+	require.Equal(t, pt, got)
+}
+
+func TestUnpadMessage_Rejects(t *testing.T) {
+	_, err := crypto.UnpadMessage(make([]byte, 256))
+	require.ErrorIs(t, err, crypto.ErrBadPadding)
+	_, err = crypto.UnpadMessage([]byte("no marker"))
+	require.ErrorIs(t, err, crypto.ErrBadPadding)
+	_, err = crypto.UnpadMessage(nil)
+	require.ErrorIs(t, err, crypto.ErrBadPadding)
+}
+
+func TestEncryptMessage_HidesLength(t *testing.T) {
+	key, _, err := crypto.GenerateRoomKey()
+	require.NoError(t, err)
+	r := &crypto.RoomRatchet{ChainKey: key}
+
+	short, _, err := crypto.EncryptMessage(r, []byte("hi"))
+	require.NoError(t, err)
+	long, _, err := crypto.EncryptMessage(r, bytes.Repeat([]byte("x"), 200))
+	require.NoError(t, err)
+	require.Equal(t, len(short), len(long))
+	require.EqualValues(t, 2, r.Index)
+
+	_, _, err = crypto.EncryptMessage(r, make([]byte, crypto.MaxPaddedLen))
+	require.Error(t, err)
+	require.EqualValues(t, 2, r.Index, "a refused message must not advance the ratchet")
+}
+
+func TestMarshalSealedEnvelope_NoSender(t *testing.T) {
+	msg := &models.ChatMessage{ChainIndex: 3, Ciphertext: []byte("ct"), Padded: true, Sealed: true}
+	data, env, err := client.MarshalSealedEnvelope(msg)
+	require.NoError(t, err)
+	require.Empty(t, env.Sender.PeerID)
+	require.Empty(t, env.Signature)
+	require.Zero(t, env.Timestamp)
+
+	got, message, err := client.UnmarshalEnvelope(data)
+	require.NoError(t, err)
+	require.Equal(t, models.MsgTypeChat, got.Type)
+	require.Equal(t, msg, message)
+}
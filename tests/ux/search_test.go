@@ -0,0 +1,28 @@
+package ux
+
+import (
+	"testing"
+
+	"hillside/internal/crypto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchTokens(t *testing.T) {
+	key, err := crypto.SearchIndexKey([]byte("keybag secret"))
+	require.NoError(t, err)
+
+	tokens := crypto.SearchTokens(key, "Meet me, MEET me at 5pm — café?")
+	require.Len(t, tokens, 5) // meet, me, at, 5pm, café
+	require.Equal(t, crypto.SearchTokens(key, "meet"), tokens[:1])
+	require.Equal(t, crypto.SearchTokens(key, "café"), tokens[4:])
+	for _, tok := range tokens {
+		require.NotContains(t, tok, "meet")
+	}
+	require.Empty(t, crypto.SearchTokens(key, " ?! "))
+
+	// another keybag blinds the same words differently
+	other, err := crypto.SearchIndexKey([]byte("another secret"))
+	require.NoError(t, err)
+	require.NotEqual(t, tokens, crypto.SearchTokens(other, "Meet me, MEET me at 5pm — café?"))
+}